@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// diagnoseTypes are the subscription types checked by default: the ones that
+// notify right away or on every block without filter params
+var diagnoseTypes = []string{"syncing", "newHeads", "newHeadsLite", "blockReceipts", "blockStats"}
+
+// diagnoseReport is the structured output of the diagnose subcommand
+type diagnoseReport struct {
+	Target        string          `json:"target"`
+	Healthy       bool            `json:"healthy"`
+	Health        json.RawMessage `json:"health,omitempty"`
+	Ready         bool            `json:"ready"`
+	BlockNumber   diagnoseCheck   `json:"blockNumber"`
+	Subscriptions []diagnoseCheck `json:"subscriptions"`
+	Errors        []string        `json:"errors,omitempty"`
+}
+
+// diagnoseCheck is the result of a timed check: ok, timeout or error
+type diagnoseCheck struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// runDiagnose implements `hlnode-websocket diagnose`: it checks a running
+// instance's health endpoints, upstream reachability through an RPC call and
+// the time to the first notification of each subscription type, prints a
+// JSON report and returns the process exit code
+func runDiagnose(args []string) int {
+	fs := flag.NewFlagSet("diagnose", flag.ContinueOnError)
+	target := fs.String("url", "ws://localhost:8080", "WebSocket URL of the instance")
+	timeout := fs.Duration("timeout", 5*time.Second, "Timeout of each check")
+	types := fs.String("types", strings.Join(diagnoseTypes, ","), "Comma-separated subscription types to measure")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	report := diagnose(*target, *timeout, strings.Split(*types, ","))
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if !report.Healthy {
+		return 1
+	}
+	return 0
+}
+
+// diagnose runs the checks against the instance at target
+func diagnose(target string, timeout time.Duration, types []string) *diagnoseReport {
+	report := &diagnoseReport{Target: target, Subscriptions: []diagnoseCheck{}}
+
+	httpURL, err := url.Parse(target)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("invalid url: %v", err))
+		return report
+	}
+	switch httpURL.Scheme {
+	case "ws":
+		httpURL.Scheme = "http"
+	case "wss":
+		httpURL.Scheme = "https"
+	}
+	httpClient := &http.Client{Timeout: timeout}
+
+	// Health endpoints
+	if resp, err := httpClient.Get(httpURL.JoinPath("/health").String()); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("health: %v", err))
+	} else {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if json.Valid(body) {
+			report.Health = body
+		}
+	}
+	if resp, err := httpClient.Get(httpURL.JoinPath("/readyz").String()); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("readyz: %v", err))
+	} else {
+		resp.Body.Close()
+		report.Ready = resp.StatusCode == http.StatusOK
+	}
+
+	dialer := websocket.Dialer{HandshakeTimeout: timeout}
+	conn, _, err := dialer.Dial(target, nil)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("connect: %v", err))
+		return report
+	}
+	defer func() { conn.Close() }()
+
+	// Upstream reachability through the proxy
+	report.BlockNumber = timedCall(conn, timeout, "eth_blockNumber", []interface{}{})
+
+	// Time to the first notification of each subscription type
+	for _, subType := range types {
+		if subType = strings.TrimSpace(subType); subType == "" {
+			continue
+		}
+		check := timedSubscription(conn, timeout, subType)
+		report.Subscriptions = append(report.Subscriptions, check)
+
+		// A connection is unusable after a read timeout
+		if check.Status != "ok" {
+			conn.Close()
+			if conn, _, err = dialer.Dial(target, nil); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("reconnect: %v", err))
+				return report
+			}
+		}
+	}
+
+	report.Healthy = report.Ready && report.BlockNumber.Status == "ok"
+	for _, check := range report.Subscriptions {
+		if check.Status != "ok" {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+// timedCall measures the round trip of a JSON-RPC request
+func timedCall(conn *websocket.Conn, timeout time.Duration, method string, params interface{}) diagnoseCheck {
+	check := diagnoseCheck{Name: method}
+	start := time.Now()
+
+	conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	conn.SetReadDeadline(start.Add(timeout))
+	var resp struct {
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := conn.ReadJSON(&resp); err != nil {
+		return failedCheck(check, err)
+	}
+	if resp.Error != nil {
+		check.Status = "error"
+		check.Error = resp.Error.Message
+		return check
+	}
+
+	check.Status = "ok"
+	check.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	return check
+}
+
+// timedSubscription measures the time from subscribing to the first
+// notification, then unsubscribes
+func timedSubscription(conn *websocket.Conn, timeout time.Duration, subType string) diagnoseCheck {
+	check := diagnoseCheck{Name: subType}
+	start := time.Now()
+
+	conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "eth_subscribe", "params": []string{subType}})
+	conn.SetReadDeadline(start.Add(timeout))
+
+	var subID string
+	for {
+		var msg struct {
+			Result json.RawMessage `json:"result"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+			Params struct {
+				Subscription string `json:"subscription"`
+			} `json:"params"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return failedCheck(check, err)
+		}
+		if msg.Error != nil {
+			check.Status = "error"
+			check.Error = msg.Error.Message
+			return check
+		}
+		if subID == "" {
+			json.Unmarshal(msg.Result, &subID)
+			continue
+		}
+		// Skip notifications still in flight from a previous check
+		if msg.Params.Subscription == subID {
+			break
+		}
+	}
+
+	check.Status = "ok"
+	check.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+
+	conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": "eth_unsubscribe", "params": []string{subID}})
+	return check
+}
+
+// failedCheck records a read error, telling timeouts apart
+func failedCheck(check diagnoseCheck, err error) diagnoseCheck {
+	if netErr, ok := err.(interface{ Timeout() bool }); ok && netErr.Timeout() {
+		check.Status = "timeout"
+		return check
+	}
+	check.Status = "error"
+	check.Error = err.Error()
+	return check
+}
@@ -2,45 +2,362 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"hlnode-websocket/internal/archive"
 	"hlnode-websocket/internal/broadcaster"
+	"hlnode-websocket/internal/cache"
+	"hlnode-websocket/internal/clock"
+	"hlnode-websocket/internal/compat"
 	"hlnode-websocket/internal/config"
+	"hlnode-websocket/internal/events"
+	"hlnode-websocket/internal/filters"
 	"hlnode-websocket/internal/handlers"
+	"hlnode-websocket/internal/labels"
 	"hlnode-websocket/internal/logger"
 	"hlnode-websocket/internal/metrics"
+	"hlnode-websocket/internal/recovery"
 	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/storage"
 	"hlnode-websocket/internal/subscription"
+	"hlnode-websocket/internal/usage"
 
+	"github.com/gorilla/websocket"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diagnose" {
+		os.Exit(runDiagnose(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "soak" {
+		os.Exit(runSoak(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		os.Exit(runSimulate(os.Args[2:]))
+	}
+
 	cfg := config.Load()
 
+	constLabels, err := metrics.ParseConstLabels(cfg.ConstLabels)
+	if err != nil {
+		logger.Error("Invalid CONST_LABELS: %v", err)
+		os.Exit(1)
+	}
+	if err := metrics.Register(constLabels); err != nil {
+		logger.Error("Failed to register metrics: %v", err)
+		os.Exit(1)
+	}
+	logger.SetFields(constLabels)
+
 	logger.Info("Starting hlnode-websocket")
 	logger.Info("Upstream RPC: %s", cfg.RPCURL)
 	logger.Info("WebSocket Port: %d", cfg.WebSocketPort)
 	logger.Info("Poll Interval: %v", cfg.PollInterval)
 
-	rpcClient := rpc.NewClient(cfg.RPCURL)
+	if cfg.UpstreamMaxIdleConnsPerHost < 0 || cfg.UpstreamMaxConnsPerHost < 0 {
+		logger.Error("UPSTREAM_MAX_IDLE_CONNS_PER_HOST and UPSTREAM_MAX_CONNS_PER_HOST must not be negative")
+		os.Exit(1)
+	}
+	if cfg.UpstreamFastConcurrency < 0 || cfg.UpstreamHeavyConcurrency < 0 || cfg.UpstreamDefaultConcurrency < 0 {
+		logger.Error("UPSTREAM_FAST_CONCURRENCY, UPSTREAM_HEAVY_CONCURRENCY and UPSTREAM_DEFAULT_CONCURRENCY must not be negative")
+		os.Exit(1)
+	}
+	// Without re-checks a degraded upstream would never be marked ready again
+	if cfg.UpstreamCheckInterval <= 0 {
+		logger.Error("UPSTREAM_CHECK_INTERVAL must be positive")
+		os.Exit(1)
+	}
+	transport := rpc.TransportOptions{
+		MaxIdleConnsPerHost: cfg.UpstreamMaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.UpstreamMaxConnsPerHost,
+		IdleConnTimeout:     cfg.UpstreamIdleConnTimeout,
+		DisableKeepAlives:   !cfg.UpstreamKeepAlive,
+		TCPKeepAlive:        cfg.UpstreamTCPKeepAlive,
+		DialTimeout:         cfg.UpstreamDialTimeout,
+		TLSHandshakeTimeout: cfg.UpstreamTLSHandshakeTimeout,
+	}
+	transport.TLSConfig, err = rpc.TLSOptions{
+		CAFile:             cfg.UpstreamTLSCAFile,
+		CertFile:           cfg.UpstreamTLSCertFile,
+		KeyFile:            cfg.UpstreamTLSKeyFile,
+		InsecureSkipVerify: cfg.UpstreamTLSInsecureSkipVerify,
+	}.Config()
+	if err != nil {
+		logger.Error("Invalid upstream TLS settings: %v", err)
+		os.Exit(1)
+	}
+	if cfg.UpstreamTLSInsecureSkipVerify {
+		logger.Warn("UPSTREAM_TLS_INSECURE_SKIP_VERIFY is set: upstream certificates are not verified")
+	}
+
+	rpcClient, err := newUpstream(cfg.RPCURL, cfg, transport)
+	if err != nil {
+		logger.Error("Invalid upstream settings: %v", err)
+		os.Exit(1)
+	}
+	if _, err := rpcClient.CheckUpstream(context.Background()); err != nil {
+		logger.Error("Upstream RPC unavailable, starting in degraded mode: %v", err)
+	}
+	upstreamClients := []*rpc.Client{rpcClient}
+	for _, upstreamURL := range cfg.UpstreamURLs {
+		c, err := newUpstream(upstreamURL, cfg, transport)
+		if err != nil {
+			logger.Error("Invalid settings for upstream %s: %v", upstreamURL, err)
+			os.Exit(1)
+		}
+		if _, err := c.CheckUpstream(context.Background()); err != nil {
+			logger.Error("Upstream %s unavailable: %v", upstreamURL, err)
+		}
+		upstreamClients = append(upstreamClients, c)
+	}
+	for _, c := range upstreamClients {
+		probeBlockReceipts(c)
+	}
+	balancer := rpc.NewBalancer(upstreamClients...)
+	if cfg.UpstreamHedge {
+		if cfg.UpstreamHedgeDelay < 0 {
+			logger.Error("UPSTREAM_HEDGE_DELAY must not be negative")
+			os.Exit(1)
+		}
+		if len(upstreamClients) < 2 {
+			logger.Warn("UPSTREAM_HEDGE needs UPSTREAM_URLS to name a second upstream; hedging has no effect")
+		}
+		balancer.SetHedging(true, cfg.UpstreamHedgeDelay)
+	}
+
+	instanceID := cfg.InstanceID
+	if instanceID == "" {
+		instanceID, _ = os.Hostname()
+	}
+	logger.Info("Instance ID: %s", instanceID)
 
 	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc.SubscriptionManager().SetInstanceID(instanceID)
+	if err := bc.SubscriptionManager().SetResumeBufferSize(cfg.ResumeBufferSize); err != nil {
+		logger.Error("Invalid RESUME_BUFFER_SIZE: %v", err)
+		os.Exit(1)
+	}
+	if err := bc.SubscriptionManager().SetDefaultConfirmations(cfg.Confirmations); err != nil {
+		logger.Error("Invalid CONFIRMATIONS: %v", err)
+		os.Exit(1)
+	}
+	if cfg.DeltaSnapshotInterval < 1 {
+		logger.Error("DELTA_SNAPSHOT_INTERVAL must be at least 1")
+		os.Exit(1)
+	}
+	bc.SetDeltaSnapshotInterval(cfg.DeltaSnapshotInterval)
+	if cfg.NotificationErrorLimit < 0 {
+		logger.Error("NOTIFICATION_ERROR_LIMIT must not be negative")
+		os.Exit(1)
+	}
+	bc.SetNotificationErrorLimit(cfg.NotificationErrorLimit)
+	if cfg.BigBlockMinGasLimit < 1 {
+		logger.Error("BIG_BLOCK_MIN_GAS_LIMIT must be at least 1")
+		os.Exit(1)
+	}
+	bc.SetBigBlockMinGasLimit(uint64(cfg.BigBlockMinGasLimit))
+	compatFlags, err := compatibility(cfg)
+	if err != nil {
+		logger.Error("Invalid compatibility flags: %v", err)
+		os.Exit(1)
+	}
+	bc.SetCompat(compatFlags)
+	if cfg.AddressLabelsFile != "" {
+		registry, err := labels.Load(cfg.AddressLabelsFile)
+		if err != nil {
+			logger.Error("Invalid ADDRESS_LABELS_FILE: %v", err)
+			os.Exit(1)
+		}
+		bc.SetAddressLabels(registry)
+		logger.Info("Address labels: %d addresses", registry.Len())
+	}
+	go recovery.Supervise("broadcaster", bc.Run)
+
+	// Per-block invalidation bus shared by all head-scoped caches
+	invalidations := cache.NewBus()
+	gasPrices := cache.NewGasPriceCache(cfg.GasPriceHistorySize)
 
 	wsHandler := handlers.NewWebSocketHandler(rpcClient, bc)
+	if len(upstreamClients) > 1 {
+		wsHandler.SetBalancer(balancer)
+		logger.Info("Balancing forwarded calls across %d upstreams", len(upstreamClients))
+	}
+	headCache := cache.NewHeadCache(invalidations)
+	headCache.SetClock(bc.Clock())
+	if cfg.CacheMaxEntries < 1 {
+		logger.Error("CACHE_MAX_ENTRIES must be at least 1")
+		os.Exit(1)
+	}
+	headCache.SetMaxEntries(cfg.CacheMaxEntries)
+	if cfg.StaleMaxAge > 0 {
+		headCache.SetMaxStaleness(cfg.StaleMaxAge)
+		logger.Info("Degraded mode: serving cached reads up to %v old while the upstream is down", cfg.StaleMaxAge)
+	}
+	wsHandler.SetCache(headCache)
+	if cfg.SendQueueSize > 0 {
+		if cfg.SendQueueTTL <= 0 || cfg.SendQueueRetryInterval <= 0 {
+			logger.Error("SEND_QUEUE_TTL and SEND_QUEUE_RETRY_INTERVAL must be positive")
+			os.Exit(1)
+		}
+		wsHandler.SetSendQueue(cfg.SendQueueSize, cfg.SendQueueTTL)
+		logger.Info("Degraded mode: queueing up to %d transactions for %v while the upstream is down", cfg.SendQueueSize, cfg.SendQueueTTL)
+	}
+	wsHandler.SetGasPrices(gasPrices)
+	wsHandler.SetTestSubscription(cfg.TestInterval > 0)
+	wsHandler.SetSyncCheck(func(ctx context.Context) *rpc.SyncStatus {
+		return checkSync(ctx, rpcClient, bc.Clock(), cfg)
+	})
+	wsHandler.SetAdminToken(cfg.AdminToken)
+	listenerTLS, err := handlers.ListenerTLSOptions{
+		CertFile:     cfg.TLSCertFile,
+		KeyFile:      cfg.TLSKeyFile,
+		ClientCAFile: cfg.TLSClientCAFile,
+		ClientAuth:   cfg.TLSClientAuth,
+	}.Config()
+	if err != nil {
+		logger.Error("Invalid TLS configuration: %v", err)
+		os.Exit(1)
+	}
+	if len(cfg.TLSAdminIdentities) > 0 && cfg.TLSClientCAFile == "" {
+		logger.Error("TLS_ADMIN_IDENTITIES requires TLS_CLIENT_CA_FILE")
+		os.Exit(1)
+	}
+	wsHandler.SetAdminIdentities(cfg.TLSAdminIdentities)
+	wsHandler.SetInstance(instanceID, cfg.InstanceHeader, cfg.StickyCookie)
+
+	serverKeepalive := broadcaster.Keepalive{PingInterval: cfg.KeepalivePingInterval, PongTimeout: cfg.KeepalivePongTimeout}
+	consumerKeepalive := broadcaster.Keepalive{PingInterval: cfg.ConsumerPingInterval, PongTimeout: cfg.ConsumerPongTimeout}
+	for _, keepalive := range []broadcaster.Keepalive{serverKeepalive, consumerKeepalive} {
+		if keepalive.PingInterval <= 0 || keepalive.PongTimeout <= keepalive.PingInterval {
+			logger.Error("Invalid keepalive: pong timeout %v must exceed ping interval %v", keepalive.PongTimeout, keepalive.PingInterval)
+			os.Exit(1)
+		}
+	}
+	wsHandler.SetKeepalive("", serverKeepalive)
+	wsHandler.SetKeepalive(broadcaster.ClientClassServer, serverKeepalive)
+	wsHandler.SetKeepalive(broadcaster.ClientClassBrowser, consumerKeepalive)
+	wsHandler.SetKeepalive(broadcaster.ClientClassMobile, consumerKeepalive)
+	wsHandler.SetBackfillLimit(cfg.LogsBackfillMaxBlocks)
+	wsHandler.SetSlowRequestThreshold(cfg.SlowRequestThreshold)
+
+	quota := broadcaster.Quota{Requests: uint64(max(cfg.QuotaRequests, 0)), Bytes: uint64(max(cfg.QuotaBytes, 0)), Window: cfg.QuotaWindow}
+	if quota.Enabled() {
+		wsHandler.SetQuota(quota)
+		logger.Info("Connection quota: %d requests, %d bytes per %v", quota.Requests, quota.Bytes, quota.Window)
+	}
+
+	var watchlist *cache.LogStore
+	if len(cfg.Watchlist) > 0 {
+		watchlist = cache.NewLogStore(cfg.Watchlist, uint64(cfg.WatchlistRetentionBlocks))
+		wsHandler.SetWatchlist(watchlist)
+		logger.Info("Watchlist: %d addresses, retaining %d blocks", watchlist.Len(), cfg.WatchlistRetentionBlocks)
+	}
+
+	localFilters := filters.NewManager()
+	localFilters.SetClock(bc.Clock())
+	wsHandler.SetFilters(localFilters)
+
+	switch cfg.HeaderHashCheck {
+	case headerCheckOff, headerCheckWarn, headerCheckReject:
+	default:
+		logger.Error("Invalid HEADER_HASH_CHECK %q: must be off, warn or reject", cfg.HeaderHashCheck)
+		os.Exit(1)
+	}
+
+	if cfg.EventBuffer < 0 {
+		logger.Error("EVENT_BUFFER must not be negative")
+		os.Exit(1)
+	}
+
+	var store storage.Storage
+	if cfg.StorageBackend != "" {
+		store, err = storage.Open(cfg.StorageBackend)
+		if err != nil {
+			logger.Error("Invalid STORAGE_BACKEND: %v", err)
+			os.Exit(1)
+		}
+		defer store.Close()
+		wsHandler.SetStorage(store)
+		logger.Info("Storage: %s, retaining %d blocks", cfg.StorageBackend, cfg.StorageRetentionBlocks)
+	}
+
+	var archiver *archive.Archiver
+	if cfg.ArchiveURL != "" {
+		// A segment must be complete and past reorgs while its blocks are still stored
+		if store == nil || cfg.ArchiveSegmentBlocks <= 0 || cfg.StorageRetentionBlocks < 2*cfg.ArchiveSegmentBlocks {
+			logger.Error("ARCHIVE_URL requires STORAGE_BACKEND and STORAGE_RETENTION_BLOCKS of at least twice ARCHIVE_SEGMENT_BLOCKS")
+			os.Exit(1)
+		}
+		bucket, err := archive.OpenBucket(cfg.ArchiveURL, archive.Credentials{
+			AccessKeyID:     cfg.ArchiveAccessKeyID,
+			SecretAccessKey: cfg.ArchiveSecretAccessKey,
+		})
+		if err == nil {
+			archiver, err = archive.New(context.Background(), bucket, uint64(cfg.ArchiveSegmentBlocks))
+		}
+		if err != nil {
+			logger.Error("Invalid ARCHIVE_URL: %v", err)
+			os.Exit(1)
+		}
+		wsHandler.SetArchive(archiver)
+		if first, last, ok := archiver.Range(); ok {
+			logger.Info("Archive: %s, %d blocks per segment, blocks %d-%d archived", cfg.ArchiveURL, cfg.ArchiveSegmentBlocks, first, last)
+		} else {
+			logger.Info("Archive: %s, %d blocks per segment", cfg.ArchiveURL, cfg.ArchiveSegmentBlocks)
+		}
+	}
+
+	if store != nil && cfg.WarmUpBlocks > 0 {
+		warmUp(rpcClient, store, cfg)
+	}
+
+	var usageTable *usage.Table
+	if cfg.UsageRetention > 0 {
+		usageTable = usage.NewTable(bc.Clock(), cfg.UsageRetention)
+		if cfg.UsageFile != "" {
+			if err := usageTable.Load(cfg.UsageFile); err != nil {
+				logger.Error("Invalid USAGE_FILE: %v", err)
+				os.Exit(1)
+			}
+		}
+		wsHandler.SetUsage(usageTable)
+		logger.Info("Usage reports: retaining %v", cfg.UsageRetention)
+	}
 
 	mux := http.NewServeMux()
 
+	var console http.Handler
+	if cfg.Console {
+		console = handlers.ConsoleHandler()
+		logger.Info("Test console enabled on /")
+	}
+
 	// WebSocket endpoint
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("Upgrade") != "websocket" {
+		// Header tokens are matched case-insensitively and may be part of a list,
+		// e.g. "Connection: keep-alive, Upgrade" and "Upgrade: WebSocket"
+		if !websocket.IsWebSocketUpgrade(r) {
+			if console != nil && r.Method == http.MethodGet && r.URL.Path == "/" {
+				console.ServeHTTP(w, r)
+				return
+			}
+			if r.Method == http.MethodPost {
+				wsHandler.ServeRPC(w, r)
+				return
+			}
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte(`{"error": "WebSocket connection required"}`))
@@ -49,15 +366,86 @@ func main() {
 		wsHandler.ServeHTTP(w, r)
 	})
 
+	// Hourly usage by API key (admin only)
+	mux.HandleFunc("/admin/usage", wsHandler.ServeUsage)
+
+	// Subscription listing and bulk removal (admin only)
+	mux.HandleFunc("/admin/subscriptions", wsHandler.ServeSubscriptions)
+
 	// Prometheus metrics
 	mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
 
 	// Health check
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
+
+		ready, reason := rpcClient.Status()
+		health := map[string]interface{}{
 			"status":        "ok",
+			"ready":         ready,
 			"activeClients": bc.GetStats().ActiveClients,
+			"circuit":       rpcClient.CircuitState(),
+		}
+		if !ready {
+			health["status"] = "degraded"
+			health["upstream"] = reason
+		}
+		if len(upstreamClients) > 1 {
+			health["upstreams"] = balancer.Scores()
+		}
+		json.NewEncoder(w).Encode(health)
+	})
+
+	// Readiness: upstream resolvable and answering the background probe,
+	// and the startup self-test passed
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		ready, reason := rpcClient.Status()
+		probe := rpcClient.ProbeStatus()
+		response := map[string]interface{}{
+			"ready":    probe.Healthy && selfTestReady(),
+			"probe":    probe,
+			"selfTest": selfTestState.Load(),
+		}
+		if !ready {
+			response["upstream"] = reason
+		}
+		if !probe.Healthy || !selfTestReady() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(response)
+	})
+
+	// Recent gas price changes with rolling statistics
+	mux.HandleFunc("/v1/gasPrice/history", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		blockType := r.URL.Query().Get("blockType")
+		if blockType == "" {
+			blockType = rpc.BlockTypeSmall
+		}
+		limit := 0
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": "limit must be a non-negative integer"}`))
+				return
+			}
+			limit = n
+		}
+
+		samples, stats, ok := gasPrices.History(blockType, limit)
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "blockType must be small or big"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"blockType": blockType,
+			"samples":   samples,
+			"stats":     stats,
 		})
 	})
 
@@ -76,20 +464,20 @@ func main() {
 
 		bcStats := bc.GetStats()
 		subMgr := bc.SubscriptionManager()
+		subscriptionCounts := make(map[string]int, len(subscription.Types))
+		for _, subType := range subscription.Types {
+			subscriptionCounts[string(subType)] = len(subMgr.GetSubscriptionsByType(subType))
+		}
 
 		response := map[string]interface{}{
+			"instanceId": instanceID,
+			"process":    readProcessStats(),
 			"websocket": map[string]interface{}{
 				"activeConnections":   bcStats.ActiveClients,
 				"totalConnections":    bcStats.TotalConnections,
 				"totalDisconnections": bcStats.TotalDisconnections,
 			},
-			"subscriptions": map[string]int{
-				"newHeads":      len(subMgr.GetSubscriptionsByType(subscription.SubTypeNewHeads)),
-				"logs":          len(subMgr.GetSubscriptionsByType(subscription.SubTypeLogs)),
-				"gasPrice":      len(subMgr.GetSubscriptionsByType(subscription.SubTypeGasPrice)),
-				"blockReceipts": len(subMgr.GetSubscriptionsByType(subscription.SubTypeBlockReceipts)),
-				"syncing":       len(subMgr.GetSubscriptionsByType(subscription.SubTypeSyncing)),
-			},
+			"subscriptions": subscriptionCounts,
 		}
 
 		json.NewEncoder(w).Encode(response)
@@ -105,181 +493,1185 @@ func main() {
 		MaxHeaderBytes:    1 << 20,
 	}
 
-	go pollBlocks(rpcClient, bc, cfg)
-	go pollSyncing(rpcClient, bc, cfg)
+	// Background loops stop when pollCtx is canceled on shutdown
+	pollCtx, stopPolling := context.WithCancel(context.Background())
+	for _, c := range upstreamClients {
+		go recovery.Supervise("monitorUpstream", func() { monitorUpstream(pollCtx, c, bc.Clock(), cfg) })
+		go recovery.Supervise("refreshUpstreamConnections", func() { refreshUpstreamConnections(pollCtx, c, bc.Clock(), cfg) })
+	}
+	go recovery.Supervise("probeUpstream", func() { probeUpstream(pollCtx, rpcClient, bc.Clock(), cfg) })
+	var headStream *rpc.HeadStream
+	if cfg.UpstreamWSURL != "" {
+		headStream = rpc.NewHeadStream(cfg.UpstreamWSURL, cfg.UpstreamWSTimeout)
+		headStream.SetTLSConfig(transport.TLSConfig)
+		go recovery.Supervise("headStream", func() { headStream.Run(pollCtx) })
+		logger.Info("Upstream head stream: %s, polling while it is down", cfg.UpstreamWSURL)
+	}
+	// The broadcaster runs synchronously so notifications keep their order
+	// with the ones pollBlocks sends itself; storage must not hold up polling,
+	// and drains its queue on shutdown after polling stops
+	bus := events.NewBus()
+	bus.Subscribe("broadcaster", events.Options{}, broadcastEvents(bc, rpcClient, gasPrices, cfg))
+	if store != nil {
+		bus.Subscribe("storage", events.Options{Buffer: cfg.EventBuffer}, storeEvents(context.Background(), store))
+	}
+	go recovery.Supervise("pollBlocks", func() {
+		pollBlocks(pollCtx, balancer, headStream, bc, bus, invalidations, gasPrices, watchlist, localFilters, cfg)
+	})
+	go recovery.Supervise("pollBigBlockGasPrice", func() { pollBigBlockGasPrice(pollCtx, rpcClient, bc, gasPrices, cfg) })
+	go recovery.Supervise("pollSyncing", func() { pollSyncing(pollCtx, rpcClient, bc, cfg) })
+	go recovery.Supervise("pollProxyMetrics", func() { pollProxyMetrics(pollCtx, bc, cfg) })
+	go recovery.Supervise("pollTest", func() { pollTest(pollCtx, bc, cfg) })
+	go recovery.Supervise("pollFeeHistory", func() { pollFeeHistory(pollCtx, rpcClient, bc, cfg) })
+	go recovery.Supervise("pollHeartbeats", func() { pollHeartbeats(pollCtx, bc) })
+	go recovery.Supervise("expireSubscriptions", func() { expireSubscriptions(pollCtx, bc) })
+	go recovery.Supervise("expireDetachedSubscriptions", func() { expireDetachedSubscriptions(pollCtx, bc, cfg) })
+	// Eviction only waits for the archive while segments are being flushed to it
+	flushing := archiver
+	if cfg.ArchiveInterval <= 0 {
+		flushing = nil
+	}
+	if store != nil && cfg.StorageRetentionInterval > 0 {
+		go recovery.Supervise("enforceRetention", func() { enforceRetention(pollCtx, bc, store, flushing, cfg) })
+	}
+	if cfg.OrphanSweepInterval > 0 {
+		go recovery.Supervise("sweepOrphanSubscriptions", func() { sweepOrphanSubscriptions(pollCtx, bc, cfg) })
+	}
+	if cfg.FilterTimeout > 0 {
+		go recovery.Supervise("expireFilters", func() { expireFilters(pollCtx, bc, localFilters, cfg) })
+	}
+	if cfg.SendQueueSize > 0 {
+		go recovery.Supervise("retrySendQueue", func() { retrySendQueue(pollCtx, bc, wsHandler, cfg) })
+	}
+	if flushing != nil {
+		go recovery.Supervise("archiveSegments", func() { archiveSegments(pollCtx, bc, store, archiver, cfg) })
+	}
+	if usageTable != nil {
+		go recovery.Supervise("saveUsage", func() { saveUsage(pollCtx, bc, usageTable, cfg) })
+	}
+
+	// Listen before serving so the self-test can connect right away
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		logger.Error("Server error: %v", err)
+		os.Exit(1)
+	}
+	if listenerTLS != nil {
+		listener = tls.NewListener(listener, listenerTLS)
+		logger.Info("Serving TLS (client certificates: %s)", clientCertMode(cfg))
+	}
 
 	go func() {
-		logger.Info("Endpoints: / (WebSocket), /metrics, /health, /connections, /stats")
-		logger.Info("Subscriptions: newHeads, logs, gasPrice, blockReceipts, syncing")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Info("Endpoints: / (WebSocket, polling filters over POST), /metrics, /health, /readyz, /admin/usage, /admin/subscriptions, /v1/gasPrice/history, /connections, /stats")
+		logger.Info("Subscriptions: %s", subscriptionNames())
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			logger.Error("Server error: %v", err)
 			os.Exit(1)
 		}
 	}()
 
+	if cfg.SelfTest {
+		selfTestState.Store(selfTestPending)
+		go func() {
+			defer recovery.Recover(recovery.Context{Component: "selfTest"})
+			if err := runSelfTest(cfg.WebSocketPort, listenerTLS, bc, cfg.SelfTestTimeout); err != nil {
+				selfTestState.Store(selfTestFailed)
+				logger.Error("Self-test failed, not marking ready: %v", err)
+				if cfg.SelfTestExit {
+					os.Exit(1)
+				}
+				return
+			}
+			selfTestState.Store(selfTestPassed)
+			logger.Info("Self-test passed")
+		}()
+	} else {
+		selfTestState.Store(selfTestDisabled)
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	logger.Info("Shutting down...")
+	wsHandler.SetDraining(true)
+	stopPolling()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	server.Shutdown(ctx)
+	bus.Close()
+	if usageTable != nil && cfg.UsageFile != "" {
+		if err := usageTable.Save(cfg.UsageFile); err != nil {
+			logger.Error("Failed to save usage reports: %v", err)
+		}
+	}
+	bc.Stop()
 	logger.Info("Stopped")
 }
 
-func pollBlocks(client *rpc.Client, bc *broadcaster.Broadcaster, cfg *config.Config) {
-	ticker := time.NewTicker(cfg.PollInterval)
+// subscriptionNames lists the subscription types for the startup log
+func subscriptionNames() string {
+	names := make([]string, len(subscription.Types))
+	for i, subType := range subscription.Types {
+		names[i] = string(subType)
+		if subType == subscription.SubTypeProxyMetrics {
+			names[i] += " (admin)"
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// monitorUpstream keeps re-checking upstream resolution in the background
+// and logs transitions between degraded and ready states
+func monitorUpstream(ctx context.Context, client *rpc.Client, clk clock.Clock, cfg *config.Config) {
+	ticker := clk.NewTicker(cfg.UpstreamCheckInterval)
 	defer ticker.Stop()
 
-	var lastBlockNum string
-	var lastGasPrice string
-	ctx := context.Background()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, cfg.UpstreamCheckInterval)
+		changed, err := client.CheckUpstream(ctx)
+		cancel()
 
-	for range ticker.C {
-		blockNum, err := client.GetBlockNumber(ctx)
+		if !changed {
+			continue
+		}
 		if err != nil {
-			logger.Error("Failed to fetch block number: %v", err)
-			metrics.UpstreamErrorsTotal.Inc()
+			logger.Error("Upstream RPC unavailable, entering degraded mode: %v", err)
+		} else {
+			logger.Info("Upstream RPC available again")
+		}
+	}
+}
+
+// refreshUpstreamConnections periodically re-resolves the upstream hostname
+// and recycles pooled connections, so DNS-based failover takes effect
+// without restarting the service
+func refreshUpstreamConnections(ctx context.Context, client *rpc.Client, clk clock.Clock, cfg *config.Config) {
+	if cfg.UpstreamConnTTL <= 0 {
+		return
+	}
+
+	ticker := clk.NewTicker(cfg.UpstreamConnTTL)
+	defer ticker.Stop()
+
+	lastAddrs, _ := client.LookupUpstream(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		addrs, err := client.LookupUpstream(ctx)
+		cancel()
+
+		if err == nil && strings.Join(addrs, ",") != strings.Join(lastAddrs, ",") {
+			logger.Info("Upstream address changed: %v -> %v", lastAddrs, addrs)
+			lastAddrs = addrs
+		}
+
+		client.CloseIdleConnections()
+	}
+}
+
+// probeUpstream measures upstream availability and latency with low-rate
+// eth_blockNumber calls, independent of client traffic. Once the upstream is
+// unhealthy, pooled connections are recycled on every failed probe so the
+// next dial can land on another address.
+func probeUpstream(ctx context.Context, client *rpc.Client, clk clock.Clock, cfg *config.Config) {
+	if cfg.UpstreamProbeInterval <= 0 {
+		return
+	}
+
+	ticker := clk.NewTicker(cfg.UpstreamProbeInterval)
+	defer ticker.Stop()
+
+	wasHealthy := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, cfg.UpstreamProbeInterval)
+		latency, err := client.Probe(ctx)
+		cancel()
+
+		if err != nil {
+			metrics.UpstreamProbeFailuresTotal.Inc()
+		} else {
+			metrics.UpstreamProbeLatency.Observe(latency.Seconds())
+		}
+
+		status := client.ProbeStatus()
+		if status.Healthy {
+			metrics.UpstreamProbeUp.Set(1)
+		} else {
+			metrics.UpstreamProbeUp.Set(0)
+			client.CloseIdleConnections()
+		}
+
+		if status.Healthy != wasHealthy {
+			if status.Healthy {
+				logger.Info("Upstream probe healthy again (latency: %v)", latency)
+			} else {
+				logger.Error("Upstream probe failed %d times in a row: %v", status.ConsecutiveFailures, err)
+			}
+			wasHealthy = status.Healthy
+		}
+	}
+}
+
+// newUpstream creates the client of an upstream with the configured
+// transport, request lanes, timeout, circuit breaker, retries, rate limit,
+// batching and block receipts mode
+func newUpstream(rpcURL string, cfg *config.Config, transport rpc.TransportOptions) (*rpc.Client, error) {
+	c := rpc.NewClient(rpcURL)
+	c.SetTransport(transport)
+	c.SetLanes(cfg.UpstreamFastConcurrency, cfg.UpstreamHeavyConcurrency, cfg.UpstreamDefaultConcurrency)
+	c.SetTimeout(cfg.UpstreamTimeout)
+	c.SetCircuitBreaker(cfg.CircuitBreakerFailures, cfg.CircuitBreakerCooldown)
+	c.SetRetries(cfg.UpstreamRetries, cfg.UpstreamRetryBackoff, cfg.UpstreamRetryMaxBackoff)
+	c.SetRateLimit(cfg.UpstreamRateLimit, cfg.UpstreamRateBurst, cfg.UpstreamRateLimitWait)
+	c.SetBatching(cfg.UpstreamBatch)
+	if err := c.SetBlockReceipts(cfg.UpstreamBlockReceipts); err != nil {
+		return c, fmt.Errorf("UPSTREAM_BLOCK_RECEIPTS: %w", err)
+	}
+	return c, nil
+}
+
+// blockReceiptsProbeTimeout caps the startup eth_getBlockReceipts probe
+const blockReceiptsProbeTimeout = 5 * time.Second
+
+// probeBlockReceipts checks at startup whether an upstream supports
+// eth_getBlockReceipts; otherwise the first block that needs receipts finds out
+func probeBlockReceipts(c *rpc.Client) {
+	if !c.Ready() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), blockReceiptsProbeTimeout)
+	defer cancel()
+	supported, err := c.ProbeBlockReceipts(ctx)
+	if err != nil {
+		logger.Warn("Could not probe eth_getBlockReceipts support: %v", err)
+		return
+	}
+	if supported {
+		logger.Debug("Upstream supports eth_getBlockReceipts")
+	}
+}
+
+// pollBlocks processes new heads: announced by the upstream head stream when
+// one is connected, polled every POLL_INTERVAL otherwise, from the upstream
+// the balancer pins the poller to
+func pollBlocks(ctx context.Context, upstreams *rpc.Balancer, stream *rpc.HeadStream, bc *broadcaster.Broadcaster, bus *events.Bus, invalidations *cache.Bus, gasPrices *cache.GasPriceCache, watchlist *cache.LogStore, localFilters *filters.Manager, cfg *config.Config) {
+	ticker := bc.Clock().NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+
+	// heads skips heights below the last broadcast block after an upstream switch
+	var heads rpc.HeadGuard
+	throughput := rpc.NewThroughputTracker(rpc.DefaultThroughputWindow)
+	chain := rpc.NewChainTracker(rpc.DefaultReorgTrackDepth)
+	// traceSupported is cleared once the upstream rejects debug_traceBlockByNumber
+	traceSupported := true
+
+	for {
+		// blockNum is set when the head stream announced it
+		var blockNum string
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if stream.Connected() {
+				continue
+			}
+		case head := <-stream.Heads():
+			blockNum = rpc.FormatHexUint64(head)
+		}
+
+		client := upstreams.Poller()
+		// Degraded: monitorUpstream logs the root cause, don't error every tick
+		if !client.Ready() {
 			continue
 		}
 
-		metrics.UpstreamRequestsTotal.Inc()
+		if blockNum == "" {
+			var err error
+			blockNum, err = rpc.Hedge(ctx, upstreams, client, "eth_blockNumber", func(ctx context.Context, c *rpc.Client) (string, error) {
+				return c.GetBlockNumber(ctx)
+			})
+			if err != nil {
+				logger.Error("Failed to fetch block number: %v", err)
+				metrics.UpstreamErrorsTotal.Inc()
+				continue
+			}
+			metrics.UpstreamRequestsTotal.Inc()
+		}
 
-		// Broadcast gas price if changed (check every poll, not just on new block)
-		subMgr := bc.SubscriptionManager()
-		if len(subMgr.GetSubscriptionsByType(subscription.SubTypeGasPrice)) > 0 {
-			gasPrice, err := client.GetGasPrice(ctx)
-			if err == nil {
-				metrics.UpstreamRequestsTotal.Inc()
-				if gasPrice != lastGasPrice {
-					bigBlockGasPrice, _ := client.GetBigBlockGasPrice(ctx)
-					if bigBlockGasPrice != "" {
-						metrics.UpstreamRequestsTotal.Inc()
-					}
-					gasPriceInfo := &rpc.GasPriceInfo{
-						GasPrice:         gasPrice,
-						BigBlockGasPrice: bigBlockGasPrice,
-						BlockNumber:      blockNum,
-					}
-					bc.BroadcastGasPrice(gasPriceInfo)
-					lastGasPrice = gasPrice
-				}
+		// Broadcast small block gas price if changed (check every poll, not just on new block).
+		// Sampled even without subscribers so /v1/gasPrice/history has no gaps;
+		// the big block price is polled separately by pollBigBlockGasPrice
+		if gasPrice, err := client.GetGasPrice(ctx); err == nil {
+			metrics.UpstreamRequestsTotal.Inc()
+			if gasPrices.SetSmall(gasPrice, blockNum) {
+				bc.BroadcastGasPrice(gasPrices.Info(rpc.BlockTypeSmall))
 			}
 		}
 
-		if blockNum == "" || blockNum == lastBlockNum {
+		head, err := rpc.ParseHexUint64(blockNum)
+		if err != nil {
+			logger.Error("Invalid block number %q: %v", blockNum, err)
+			continue
+		}
+		if !heads.Check(head) {
 			continue
 		}
 
-		fullBlock, err := client.GetFullBlock(ctx, blockNum)
+		// Receipts are fetched with the block if anyone needs them
+		subMgr := bc.SubscriptionManager()
+		wantReceipts := len(subMgr.GetSubscriptionsByType(subscription.SubTypeBlockReceipts)) > 0
+		watchingTxs := len(subMgr.GetSubscriptionsByType(subscription.SubTypeTxConfirmation)) > 0
+		wantStats := len(subMgr.GetSubscriptionsByType(subscription.SubTypeBlockStats)) > 0
+		bundle, err := fetchBlock(ctx, upstreams, client, blockNum, cfg.HeaderHashCheck, wantReceipts || watchingTxs || wantStats)
 		if err != nil {
+			// Failed calls were observed already; a corrupt header counts against the upstream too
+			var corrupt *rpc.HeaderHashError
+			if errors.As(err, &corrupt) {
+				upstreams.Observe(client, 0, err)
+			}
 			logger.Error("Failed to fetch block: %v", err)
 			metrics.UpstreamErrorsTotal.Inc()
 			continue
 		}
-
-		metrics.UpstreamRequestsTotal.Inc()
+		fullBlock, logs, logsErr := bundle.Header, bundle.Logs, bundle.LogsErr
 
 		if fullBlock != nil {
 			var blockInt int64
 			fmt.Sscanf(fullBlock.Number, "0x%x", &blockInt)
 			logger.Info("Block: %s (%d)", fullBlock.Number, blockInt)
 			metrics.BlocksProcessedTotal.Inc()
-			bc.BroadcastNewHead(fullBlock)
 
-			// Broadcast logs
-			logs, err := client.GetBlockLogs(ctx, blockNum)
-			if err == nil {
-				metrics.UpstreamRequestsTotal.Inc()
-				for _, logEntry := range logs {
-					bc.BroadcastLog(&logEntry)
+			fullBlock.Stats = throughput.Observe(fullBlock)
+			metrics.BlockTxCount.Set(float64(fullBlock.Stats.TxCount))
+			metrics.BlockGasUtilization.Set(fullBlock.Stats.GasUtilization)
+			metrics.TransactionsPerSecond.Set(fullBlock.Stats.TPS)
+			metrics.TransactionsProcessedTotal.Add(float64(fullBlock.Stats.TxCount))
+
+			// Notify reorg subscribers before the new head so they can roll back first
+			if reorg := chain.Observe(ctx, fullBlock, client.GetFullBlock); reorg != nil {
+				logger.Warn("Reorg at block %s: %d blocks replaced", fullBlock.Number, len(reorg.ReplacedBlocks))
+				metrics.ChainReorgsTotal.Inc()
+				metrics.ChainReorgDepth.Set(float64(len(reorg.ReplacedBlocks)))
+				bus.Publish(events.ReorgEvent{Reorg: reorg})
+				// Stored logs of the replaced blocks are stale
+				if watchlist != nil {
+					watchlist.Reset()
+				}
+			}
+
+			invalidations.Publish(fullBlock.Number)
+			if localFilters != nil {
+				localFilters.AddBlock(fullBlock.Hash)
+			}
+
+			// The watchlist store is updated before the block is published so a
+			// backfill from it never misses a block already broadcast
+			if logsErr == nil {
+				if watchlist != nil {
+					watchlist.AddBlock(head, logs)
 				}
+				if localFilters != nil {
+					localFilters.AddLogs(head, logs)
+				}
+			} else if watchlist != nil {
+				logger.Warn("Failed to fetch logs of block %s, resetting watchlist store: %v", blockNum, logsErr)
+				watchlist.Reset()
 			}
+			bus.Publish(events.BlockEvent{Number: head, Header: fullBlock, Logs: logs, LogsErr: logsErr})
 
-			// Broadcast block receipts if there are subscribers
-			if len(subMgr.GetSubscriptionsByType(subscription.SubTypeBlockReceipts)) > 0 {
-				receipts, err := client.GetBlockReceipts(ctx, blockNum)
+			// Classify the block's transactions and check watched balances if there are subscribers
+			wantSystemTxs := len(subMgr.GetSubscriptionsByType(subscription.SubTypeSystemTxs)) > 0
+			watchingBalances := len(subMgr.GetSubscriptionsByType(subscription.SubTypeBalanceChanges)) > 0
+			if wantSystemTxs || watchingBalances {
+				txs, err := client.GetBlockTransactions(ctx, blockNum)
 				if err == nil {
 					metrics.UpstreamRequestsTotal.Inc()
-					blockReceipts := &rpc.BlockReceipts{
-						BlockNumber: fullBlock.Number,
-						BlockHash:   fullBlock.Hash,
-						Receipts:    receipts,
+					if systemTxs := rpc.ClassifyTransactions(txs); wantSystemTxs && len(systemTxs) > 0 {
+						bc.BroadcastSystemTxs(systemTxs)
+					}
+					if watchingBalances {
+						checkBalanceChanges(ctx, client, bc, fullBlock, head, txs, &traceSupported)
 					}
+				} else {
+					logger.Warn("Failed to fetch transactions of block %s: %v", blockNum, err)
+					metrics.UpstreamErrorsTotal.Inc()
+				}
+			}
+
+			if len(subMgr.GetSubscriptionsByType(subscription.SubTypeNonceChanges)) > 0 {
+				checkNonceChanges(ctx, client, bc, fullBlock, head)
+			}
+
+			// Publish the receipts if anyone needs them
+			if wantReceipts || watchingTxs || wantStats {
+				receipts, err := bundle.Receipts, bundle.ReceiptsErr
+				if err != nil {
+					// Not fetched with the block, or inconsistent with it
+					receipts, err = fetchReceipts(ctx, client, fullBlock)
+				}
+				bus.Publish(events.ReceiptsEvent{Number: head, Header: fullBlock, Receipts: receipts, Err: err})
+			}
+
+			heads.Accept(head)
+		}
+	}
+}
+
+// maxConsistencyRetries is how many times block data not matching its
+// header is re-fetched before it is given up
+const maxConsistencyRetries = 2
+
+// compatibility resolves COMPAT_PROFILE and the COMPAT_* flags overriding it
+func compatibility(cfg *config.Config) (compat.Flags, error) {
+	flags, err := compat.Profile(cfg.CompatProfile)
+	if err != nil {
+		return flags, err
+	}
+	if cfg.CompatEmptyResult != "" {
+		flags.EmptyResult = cfg.CompatEmptyResult
+	}
+	if cfg.CompatSubscriptionIDBytes != 0 {
+		flags.SubscriptionIDBytes = cfg.CompatSubscriptionIDBytes
+	}
+	if cfg.CompatTrimSubscriptionID != "" {
+		if flags.TrimSubscriptionID, err = strconv.ParseBool(cfg.CompatTrimSubscriptionID); err != nil {
+			return flags, fmt.Errorf("COMPAT_TRIM_SUBSCRIPTION_ID must be true or false")
+		}
+	}
+	if cfg.CompatSyncing != "" {
+		flags.Syncing = cfg.CompatSyncing
+	}
+	if cfg.CompatErrors != "" {
+		flags.Errors = cfg.CompatErrors
+	}
+	return flags, flags.Validate()
+}
+
+// Modes of HEADER_HASH_CHECK
+const (
+	headerCheckOff    = "off"
+	headerCheckWarn   = "warn"
+	headerCheckReject = "reject"
+)
+
+// errBlockNotFound fails a hedged block fetch answered with a null block, so
+// another upstream that already has the block can still win
+var errBlockNotFound = errors.New("block not found")
+
+// fetchBlock fetches a block's header and logs, and its receipts with
+// receipts, in one batch through rpc.Hedge. While the logs' blockHash doesn't
+// match the header, as when the block is replaced between the two calls,
+// everything is fetched again; the bundle's LogsErr reports logs that could
+// not be fetched consistently, and its ReceiptsErr receipts that weren't
+// fetched or don't match. Unless headerCheck is off, a header whose hash
+// doesn't match its content is fetched again too, and with headerCheck
+// reject it is refused. err is set when the header can't be used; when no
+// upstream has the block yet, the bundle's Header is nil.
+func fetchBlock(ctx context.Context, upstreams *rpc.Balancer, client *rpc.Client, blockNum, headerCheck string, receipts bool) (*rpc.BlockBundle, error) {
+	for attempt := 0; ; attempt++ {
+		bundle, err := rpc.Hedge(ctx, upstreams, client, "eth_getBlockByNumber", func(ctx context.Context, c *rpc.Client) (*rpc.BlockBundle, error) {
+			bundle, err := c.GetBlockBundle(ctx, blockNum, receipts)
+			if err == nil && bundle.Header == nil {
+				return nil, errBlockNotFound
+			}
+			return bundle, err
+		})
+		if errors.Is(err, errBlockNotFound) {
+			return &rpc.BlockBundle{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		metrics.UpstreamRequestsTotal.Inc()
+		if bundle.LogsErr == nil {
+			metrics.UpstreamRequestsTotal.Inc()
+		}
+		if receipts && bundle.ReceiptsErr == nil {
+			metrics.UpstreamRequestsTotal.Inc()
+		}
+		block := bundle.Header
+		if headerCheck != headerCheckOff {
+			if corrupt := rpc.VerifyHeaderHash(block); corrupt != nil {
+				metrics.BlockConsistencyFailuresTotal.WithLabelValues("header").Inc()
+				if attempt < maxConsistencyRetries {
+					logger.Debug("Header of block %s fails its hash check, re-fetching: %v", blockNum, corrupt)
+					continue
+				}
+				if headerCheck == headerCheckReject {
+					return nil, corrupt
+				}
+				logger.Warn("Header of block %s still fails its hash check after %d retries: %v", blockNum, attempt, corrupt)
+			}
+		}
+		if bundle.ReceiptsErr == nil {
+			if mismatch := rpc.VerifyReceipts(block, bundle.Receipts); mismatch != nil {
+				metrics.BlockConsistencyFailuresTotal.WithLabelValues("receipts").Inc()
+				bundle.Receipts, bundle.ReceiptsErr = nil, mismatch
+			}
+		}
+		if bundle.LogsErr != nil {
+			return bundle, nil
+		}
+
+		mismatch := rpc.VerifyLogs(block, bundle.Logs)
+		if mismatch == nil {
+			return bundle, nil
+		}
+		metrics.BlockConsistencyFailuresTotal.WithLabelValues("logs").Inc()
+		if attempt == maxConsistencyRetries {
+			logger.Warn("Logs of block %s still inconsistent after %d retries: %v", blockNum, attempt, mismatch)
+			bundle.Logs, bundle.LogsErr = nil, mismatch
+			return bundle, nil
+		}
+		logger.Debug("Logs of block %s inconsistent with its header, re-fetching: %v", blockNum, mismatch)
+	}
+}
+
+// fetchReceipts fetches the receipts of a block, fetching them again while
+// their blockHash doesn't match the block's
+func fetchReceipts(ctx context.Context, client *rpc.Client, block *rpc.FullBlockHeader) ([]rpc.TransactionReceipt, error) {
+	for attempt := 0; ; attempt++ {
+		receipts, err := client.GetBlockReceipts(ctx, block.Number)
+		if err != nil {
+			return nil, err
+		}
+		metrics.UpstreamRequestsTotal.Inc()
+
+		mismatch := rpc.VerifyReceipts(block, receipts)
+		if mismatch == nil {
+			return receipts, nil
+		}
+		metrics.BlockConsistencyFailuresTotal.WithLabelValues("receipts").Inc()
+		if attempt == maxConsistencyRetries {
+			logger.Warn("Receipts of block %s still inconsistent after %d retries: %v", block.Number, attempt, mismatch)
+			return nil, mismatch
+		}
+		logger.Debug("Receipts of block %s inconsistent with its header, re-fetching: %v", block.Number, mismatch)
+	}
+}
+
+// broadcastEvents returns the event consumer notifying subscribers of the
+// blocks, logs, receipts and reorgs pollBlocks publishes
+func broadcastEvents(bc *broadcaster.Broadcaster, client *rpc.Client, gasPrices *cache.GasPriceCache, cfg *config.Config) func(events.Event) {
+	return func(ev events.Event) {
+		switch ev := ev.(type) {
+		case events.ReorgEvent:
+			bc.BroadcastReorg(ev.Reorg)
+		case events.BlockEvent:
+			bc.BroadcastNewHead(ev.Header)
+			if ev.Header.IsBigBlock(uint64(cfg.BigBlockMinGasLimit)) {
+				bc.BroadcastBigBlock(&rpc.BigBlockHeader{
+					FullBlockHeader:  ev.Header,
+					BigBlockGasPrice: gasPrices.Big(),
+				})
+			}
+			if ev.LogsErr == nil {
+				for _, logEntry := range ev.Logs {
+					bc.BroadcastLog(&logEntry)
+				}
+				bc.BroadcastTokenTransfers(ev.Logs)
+			}
+		case events.ReceiptsEvent:
+			subMgr := bc.SubscriptionManager()
+			if ev.Err == nil {
+				blockReceipts := &rpc.BlockReceipts{
+					BlockNumber: ev.Header.Number,
+					BlockHash:   ev.Header.Hash,
+					Receipts:    ev.Receipts,
+				}
+				if len(subMgr.GetSubscriptionsByType(subscription.SubTypeBlockReceipts)) > 0 {
 					bc.BroadcastBlockReceipts(blockReceipts)
 				}
+				if len(subMgr.GetSubscriptionsByType(subscription.SubTypeTxConfirmation)) > 0 {
+					bc.BroadcastTxConfirmations(blockReceipts)
+				}
+			} else if len(subMgr.GetSubscriptionsByType(subscription.SubTypeTxConfirmation)) > 0 {
+				// A watched transaction may be in the block: look it up directly
+				go bc.RecheckTxConfirmations(context.Background(), client.GetTransactionReceipt)
 			}
+			// Without receipts the average effective gas price is omitted
+			if len(subMgr.GetSubscriptionsByType(subscription.SubTypeBlockStats)) > 0 {
+				bc.BroadcastBlockStats(rpc.NewBlockSummary(ev.Header, ev.Receipts))
+			}
+		}
+	}
+}
 
-			lastBlockNum = blockNum
+// storeEvents returns the event consumer storing polled blocks, their logs
+// and receipts, and deleting the blocks a reorg replaced
+func storeEvents(ctx context.Context, store storage.Storage) func(events.Event) {
+	return func(ev events.Event) {
+		switch ev := ev.(type) {
+		case events.ReorgEvent:
+			if fork, ok := reorgForkPoint(ev.Reorg); ok {
+				if err := store.Truncate(ctx, fork); err != nil {
+					logger.Warn("Failed to delete stored blocks from %d after a reorg: %v", fork, err)
+				}
+			}
+		case events.BlockEvent:
+			if ev.LogsErr == nil {
+				storeBlock(ctx, store, ev.Number, ev.Header, ev.Logs)
+			}
+		case events.ReceiptsEvent:
+			if ev.Err == nil {
+				if err := store.PutReceipts(ctx, ev.Number, ev.Receipts); err != nil {
+					logger.Warn("Failed to store receipts of block %s: %v", ev.Header.Number, err)
+				}
+			}
 		}
 	}
 }
 
-// pollSyncing checks sync status every 1 second with a 2s timeout
-func pollSyncing(client *rpc.Client, bc *broadcaster.Broadcaster, cfg *config.Config) {
-	ticker := time.NewTicker(1 * time.Second)
+// reorgForkPoint returns the first block number a reorg replaced
+func reorgForkPoint(reorg *rpc.Reorg) (uint64, bool) {
+	if reorg.CommonAncestor != nil {
+		if n, err := rpc.ParseHexUint64(reorg.CommonAncestor.Number); err == nil {
+			return n + 1, true
+		}
+	}
+	fork, found := uint64(0), false
+	for _, replaced := range reorg.ReplacedBlocks {
+		if n, err := rpc.ParseHexUint64(replaced.Number); err == nil && (!found || n < fork) {
+			fork, found = n, true
+		}
+	}
+	return fork, found
+}
+
+// storeBlock stores a polled block and its logs and records it as the last
+// stored head; enforceRetention evicts old blocks
+func storeBlock(ctx context.Context, store storage.Storage, head uint64, block *rpc.FullBlockHeader, logs []rpc.Log) {
+	err := store.PutBlock(ctx, head, block)
+	if err == nil {
+		err = store.PutLogs(ctx, head, logs)
+	}
+	if err == nil {
+		err = store.PutCheckpoint(ctx, "head", []byte(block.Number))
+	}
+	if err != nil {
+		logger.Warn("Failed to store block %s: %v", block.Number, err)
+	}
+}
+
+// checkBalanceChanges fetches the balances of the watched addresses a block
+// may have changed, found from its transactions and, when the upstream
+// supports tracing, its internal value transfers, and notifies the changes
+func checkBalanceChanges(ctx context.Context, client *rpc.Client, bc *broadcaster.Broadcaster, block *rpc.FullBlockHeader, blockNum uint64, txs []rpc.Transaction, traceSupported *bool) {
+	watched := bc.WatchedBalanceAddresses()
+	if len(watched) == 0 {
+		return
+	}
+
+	candidates := rpc.TouchedAddresses(txs)
+	if *traceSupported {
+		traced, ok, err := client.TraceValueTransfers(ctx, block.Number)
+		switch {
+		case !ok:
+			logger.Info("Upstream does not support debug_traceBlockByNumber, internal value transfers won't be detected")
+			*traceSupported = false
+		case err != nil:
+			logger.Warn("Failed to trace block %s: %v", block.Number, err)
+			metrics.UpstreamErrorsTotal.Inc()
+		default:
+			metrics.UpstreamRequestsTotal.Inc()
+			candidates = append(candidates, traced...)
+		}
+	}
+
+	checked := make(map[string]bool)
+	for _, addr := range candidates {
+		if !watched[addr] || checked[addr] {
+			continue
+		}
+		checked[addr] = true
+
+		previous, ok := bc.LastBalance(addr)
+		if !ok && blockNum > 0 {
+			var err error
+			previous, err = client.GetBalance(ctx, addr, rpc.FormatHexUint64(blockNum-1))
+			if err != nil {
+				logger.Warn("Failed to fetch balance of %s: %v", addr, err)
+				metrics.UpstreamErrorsTotal.Inc()
+				continue
+			}
+			metrics.UpstreamRequestsTotal.Inc()
+		}
+
+		balance, err := client.GetBalance(ctx, addr, block.Number)
+		if err != nil {
+			logger.Warn("Failed to fetch balance of %s: %v", addr, err)
+			metrics.UpstreamErrorsTotal.Inc()
+			continue
+		}
+		metrics.UpstreamRequestsTotal.Inc()
+
+		bc.BroadcastBalanceChange(&rpc.BalanceChange{
+			Address:         addr,
+			BlockNumber:     block.Number,
+			BlockHash:       block.Hash,
+			PreviousBalance: previous,
+			Balance:         balance,
+		})
+	}
+}
+
+// checkNonceChanges fetches the nonce of every address watched by
+// nonceChanges subscriptions at the block and notifies the changes
+func checkNonceChanges(ctx context.Context, client *rpc.Client, bc *broadcaster.Broadcaster, block *rpc.FullBlockHeader, blockNum uint64) {
+	for addr := range bc.WatchedNonceAddresses() {
+		previous, ok := bc.LastNonce(addr)
+		if !ok && blockNum > 0 {
+			var err error
+			previous, err = client.GetTransactionCount(ctx, addr, rpc.FormatHexUint64(blockNum-1))
+			if err != nil {
+				logger.Warn("Failed to fetch nonce of %s: %v", addr, err)
+				metrics.UpstreamErrorsTotal.Inc()
+				continue
+			}
+			metrics.UpstreamRequestsTotal.Inc()
+		}
+
+		nonce, err := client.GetTransactionCount(ctx, addr, block.Number)
+		if err != nil {
+			logger.Warn("Failed to fetch nonce of %s: %v", addr, err)
+			metrics.UpstreamErrorsTotal.Inc()
+			continue
+		}
+		metrics.UpstreamRequestsTotal.Inc()
+
+		bc.BroadcastNonceChange(&rpc.NonceChange{
+			Address:       addr,
+			BlockNumber:   block.Number,
+			BlockHash:     block.Hash,
+			PreviousNonce: previous,
+			Nonce:         nonce,
+		})
+	}
+}
+
+// pollBigBlockGasPrice polls eth_bigBlockGasPrice on its own cadence, which
+// changes far less often than the small block price, and notifies gasPrice
+// subscribers when it changes. It polls even without subscribers, keeping the
+// price current for the gasPrice snapshot, its history and hl_bigBlocks.
+func pollBigBlockGasPrice(ctx context.Context, client *rpc.Client, bc *broadcaster.Broadcaster, gasPrices *cache.GasPriceCache, cfg *config.Config) {
+	if cfg.BigBlockGasPriceInterval <= 0 {
+		return
+	}
+
+	ticker := bc.Clock().NewTicker(cfg.BigBlockGasPriceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		if !client.Ready() {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, cfg.BigBlockGasPriceInterval)
+		bigBlockGasPrice, err := client.GetBigBlockGasPrice(ctx)
+		cancel()
+
+		if err != nil {
+			logger.Warn("Failed to fetch big block gas price: %v", err)
+			metrics.UpstreamErrorsTotal.Inc()
+			continue
+		}
+		metrics.UpstreamRequestsTotal.Inc()
+
+		// Empty when the upstream doesn't support the method
+		if bigBlockGasPrice != "" && gasPrices.SetBig(bigBlockGasPrice) {
+			bc.BroadcastGasPrice(gasPrices.Info(rpc.BlockTypeBig))
+		}
+	}
+}
+
+// pollSyncing checks sync status every 1 second while there are syncing
+// subscribers; new subscriptions check once for their snapshot
+func pollSyncing(ctx context.Context, client *rpc.Client, bc *broadcaster.Broadcaster, cfg *config.Config) {
+	ticker := bc.Clock().NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		if len(bc.SubscriptionManager().GetSubscriptionsByType(subscription.SubTypeSyncing)) == 0 {
+			continue
+		}
+		bc.BroadcastSyncing(checkSync(ctx, client, bc.Clock(), cfg))
+	}
+}
+
+// checkSync returns the sync status of the upstream, with a 2s timeout. The
+// node is out of sync if the upstream is unavailable or its latest block is
+// older than the sync threshold.
+func checkSync(ctx context.Context, client *rpc.Client, clk clock.Clock, cfg *config.Config) *rpc.SyncStatus {
 	const queryTimeout = 2 * time.Second
 
-	for range ticker.C {
+	// Upstream unavailable - consider node out of sync
+	if !client.Ready() {
+		return &rpc.SyncStatus{Syncing: true}
+	}
+
+	// Create context with 2s timeout
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	// Try to get the latest block with timeout
+	blockNum, err := client.GetBlockNumber(ctx)
+	if err != nil {
+		// Query failed or timeout - consider node out of sync
+		logger.Warn("Sync check failed (timeout or error): %v", err)
+		return &rpc.SyncStatus{Syncing: true}
+	}
+
+	fullBlock, err := client.GetFullBlock(ctx, blockNum)
+	if err != nil || fullBlock == nil {
+		// Cannot get block - consider node out of sync
+		logger.Warn("Sync check failed (cannot get block): %v", err)
+		return &rpc.SyncStatus{Syncing: true}
+	}
+
+	// Parse block timestamp (hex string to int64)
+	var blockTimestamp int64
+	_, parseErr := fmt.Sscanf(fullBlock.Timestamp, "0x%x", &blockTimestamp)
+	if parseErr != nil || blockTimestamp == 0 {
+		// Cannot parse timestamp - consider node out of sync
+		logger.Warn("Sync check failed (cannot parse timestamp): %v", parseErr)
+		return &rpc.SyncStatus{Syncing: true}
+	}
+
+	blockTime := time.Unix(blockTimestamp, 0)
+	blockAge := clk.Now().Sub(blockTime)
+
+	// Node is out of sync if block is older than threshold
+	isSyncing := blockAge > cfg.SyncThreshold
+	if isSyncing {
+		logger.Warn("Node out of sync: block %s is %.1fs old (threshold: %v)", fullBlock.Number, blockAge.Seconds(), cfg.SyncThreshold)
+	}
+
+	return &rpc.SyncStatus{
+		Syncing:      isSyncing,
+		CurrentBlock: fullBlock.Number,
+	}
+}
+
+// pollProxyMetrics streams a metrics snapshot to proxyMetrics subscribers
+func pollProxyMetrics(ctx context.Context, bc *broadcaster.Broadcaster, cfg *config.Config) {
+	if cfg.ProxyMetricsInterval <= 0 {
+		return
+	}
+
+	ticker := bc.Clock().NewTicker(cfg.ProxyMetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
 		subMgr := bc.SubscriptionManager()
-		if len(subMgr.GetSubscriptionsByType(subscription.SubTypeSyncing)) == 0 {
+		if len(subMgr.GetSubscriptionsByType(subscription.SubTypeProxyMetrics)) == 0 {
 			continue
 		}
 
-		// Create context with 2s timeout
-		ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+		bc.BroadcastProxyMetrics(bc.GetMetricsSnapshot())
+	}
+}
+
+// pollFeeHistory fetches eth_feeHistory every FEE_HISTORY_INTERVAL, once per
+// distinct window asked by feeHistory subscribers, and pushes the results
+func pollFeeHistory(ctx context.Context, client *rpc.Client, bc *broadcaster.Broadcaster, cfg *config.Config) {
+	if cfg.FeeHistoryInterval <= 0 {
+		return
+	}
 
-		// Try to get the latest block with timeout
-		blockNum, err := client.GetBlockNumber(ctx)
-		if err != nil {
+	ticker := bc.Clock().NewTicker(cfg.FeeHistoryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		subs := bc.SubscriptionManager().GetSubscriptionsByType(subscription.SubTypeFeeHistory)
+		if !client.Ready() || len(subs) == 0 {
+			continue
+		}
+
+		windows := make(map[string]*subscription.FeeHistoryFilter)
+		for _, sub := range subs {
+			if filter, err := subscription.ParseFeeHistoryFilter(sub.Params); err == nil {
+				windows[filter.Key()] = filter
+			}
+		}
+
+		for _, filter := range windows {
+			ctx, cancel := context.WithTimeout(ctx, cfg.FeeHistoryInterval)
+			history, err := client.GetFeeHistory(ctx, filter.BlockCount, "latest", filter.RewardPercentiles)
 			cancel()
-			// Query failed or timeout - consider node out of sync
-			logger.Warn("Sync check failed (timeout or error): %v", err)
-			syncStatus := &rpc.SyncStatus{Syncing: true}
-			bc.BroadcastSyncing(syncStatus)
+
+			if err != nil {
+				logger.Warn("Failed to fetch fee history: %v", err)
+				metrics.UpstreamErrorsTotal.Inc()
+				continue
+			}
+			metrics.UpstreamRequestsTotal.Inc()
+
+			bc.BroadcastFeeHistory(filter, history)
+		}
+	}
+}
+
+// pollHeartbeats sends heartbeats to quiet subscriptions that asked for them
+func pollHeartbeats(ctx context.Context, bc *broadcaster.Broadcaster) {
+	ticker := bc.Clock().NewTicker(subscription.MinHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C():
+		}
+
+		bc.BroadcastHeartbeats(now)
+	}
+}
+
+// saveUsage drops usage older than USAGE_RETENTION and, with USAGE_FILE,
+// persists the rest every minute
+func saveUsage(ctx context.Context, bc *broadcaster.Broadcaster, table *usage.Table, cfg *config.Config) {
+	ticker := bc.Clock().NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		table.Prune()
+		if cfg.UsageFile == "" {
 			continue
 		}
+		if err := table.Save(cfg.UsageFile); err != nil {
+			logger.Error("Failed to save usage reports: %v", err)
+		}
+	}
+}
 
-		fullBlock, err := client.GetFullBlock(ctx, blockNum)
-		cancel()
+// enforceRetention evicts stored blocks beyond the STORAGE_RETENTION_* limits
+// and compacts storage every STORAGE_RETENTION_INTERVAL. With an archive,
+// blocks are only evicted once archived.
+func enforceRetention(ctx context.Context, bc *broadcaster.Broadcaster, store storage.Storage, archiver *archive.Archiver, cfg *config.Config) {
+	retention := storage.Retention{
+		Blocks: uint64(max(cfg.StorageRetentionBlocks, 0)),
+		MaxAge: cfg.StorageRetentionAge,
+		Bytes:  int64(max(cfg.StorageRetentionBytes, 0)),
+	}
+	ticker := bc.Clock().NewTicker(cfg.StorageRetentionInterval)
+	defer ticker.Stop()
 
-		if err != nil || fullBlock == nil {
-			// Cannot get block - consider node out of sync
-			logger.Warn("Sync check failed (cannot get block): %v", err)
-			syncStatus := &rpc.SyncStatus{Syncing: true}
-			bc.BroadcastSyncing(syncStatus)
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C():
+		}
+
+		keepFrom := uint64(math.MaxUint64)
+		if archiver != nil {
+			keepFrom = 0
+			if _, last, ok := archiver.Range(); ok {
+				keepFrom = last + 1
+			}
+		}
+		ev, err := retention.Enforce(ctx, store, now, keepFrom)
+		if err != nil {
+			logger.Error("Failed to enforce storage retention: %v", err)
 			continue
 		}
+		if evicted := ev.Evicted[storage.EvictAge] + ev.Evicted[storage.EvictBlocks] + ev.Evicted[storage.EvictSize]; evicted > 0 {
+			logger.Debug("Evicted %d blocks from storage, %d blocks and %d bytes remain", evicted, ev.Blocks, ev.Bytes)
+		}
+	}
+}
+
+// archiveSegments flushes the completed segments of stored blocks to the
+// archive every ARCHIVE_INTERVAL. Blocks within reorg tracking depth of the
+// newest stored block may still be replaced and are left for a later flush.
+func archiveSegments(ctx context.Context, bc *broadcaster.Broadcaster, store storage.Storage, archiver *archive.Archiver, cfg *config.Config) {
+	ticker := bc.Clock().NewTicker(cfg.ArchiveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
 
-		// Parse block timestamp (hex string to int64)
-		var blockTimestamp int64
-		_, parseErr := fmt.Sscanf(fullBlock.Timestamp, "0x%x", &blockTimestamp)
-		if parseErr != nil || blockTimestamp == 0 {
-			// Cannot parse timestamp - consider node out of sync
-			logger.Warn("Sync check failed (cannot parse timestamp): %v", parseErr)
-			syncStatus := &rpc.SyncStatus{Syncing: true}
-			bc.BroadcastSyncing(syncStatus)
+		_, newest, err := store.BlockRange(ctx)
+		if err != nil || newest < rpc.DefaultReorgTrackDepth {
 			continue
 		}
+		flushed, err := archiver.Flush(ctx, store, newest-rpc.DefaultReorgTrackDepth)
+		metrics.ArchiveSegmentsTotal.Add(float64(flushed))
+		if err != nil {
+			metrics.ArchiveErrorsTotal.Inc()
+			logger.Error("Failed to archive stored blocks: %v", err)
+		}
+	}
+}
+
+// expireSubscriptions removes subscriptions whose TTL elapsed
+func expireSubscriptions(ctx context.Context, bc *broadcaster.Broadcaster) {
+	ticker := bc.Clock().NewTicker(subscription.MinTTL)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C():
+		}
+
+		bc.ExpireSubscriptions(now)
+	}
+}
+
+// expireDetachedSubscriptions drops resumable subscriptions whose client did
+// not come back within RESUME_TTL
+func expireDetachedSubscriptions(ctx context.Context, bc *broadcaster.Broadcaster, cfg *config.Config) {
+	ticker := bc.Clock().NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C():
+		}
+
+		bc.SubscriptionManager().ExpireDetached(now, cfg.ResumeTTL)
+	}
+}
+
+// clientCertMode describes how the listener treats client certificates
+func clientCertMode(cfg *config.Config) string {
+	if cfg.TLSClientCAFile == "" {
+		return "not requested"
+	}
+	return cfg.TLSClientAuth
+}
+
+// sweepOrphanSubscriptions removes subscriptions left behind by clients that
+// are no longer registered
+func sweepOrphanSubscriptions(ctx context.Context, bc *broadcaster.Broadcaster, cfg *config.Config) {
+	ticker := bc.Clock().NewTicker(cfg.OrphanSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
 
-		blockTime := time.Unix(blockTimestamp, 0)
-		blockAge := time.Since(blockTime)
+		bc.SweepOrphans()
+	}
+}
 
-		// Node is out of sync if block is older than threshold
-		isSyncing := blockAge > cfg.SyncThreshold
+// expireFilters uninstalls polling filters not polled within FILTER_TIMEOUT
+func expireFilters(ctx context.Context, bc *broadcaster.Broadcaster, localFilters *filters.Manager, cfg *config.Config) {
+	ticker := bc.Clock().NewTicker(time.Second)
+	defer ticker.Stop()
 
-		syncStatus := &rpc.SyncStatus{
-			Syncing:      isSyncing,
-			CurrentBlock: fullBlock.Number,
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C():
 		}
 
-		if isSyncing {
-			logger.Warn("Node out of sync: block %s is %.1fs old (threshold: %v)", fullBlock.Number, blockAge.Seconds(), cfg.SyncThreshold)
+		if expired := localFilters.Expire(now, cfg.FilterTimeout); expired > 0 {
+			logger.Debug("Expired %d filters not polled within %v", expired, cfg.FilterTimeout)
+		}
+	}
+}
+
+// retrySendQueue sends the transactions queued while the upstream was down
+func retrySendQueue(ctx context.Context, bc *broadcaster.Broadcaster, wsHandler *handlers.WebSocketHandler, cfg *config.Config) {
+	ticker := bc.Clock().NewTicker(cfg.SendQueueRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		if wsHandler.SendQueueLen() > 0 {
+			wsHandler.RetrySendQueue(ctx)
+		}
+	}
+}
+
+// pollTest emits a synthetic counter notification to test subscribers
+func pollTest(ctx context.Context, bc *broadcaster.Broadcaster, cfg *config.Config) {
+	if cfg.TestInterval <= 0 {
+		return
+	}
+
+	ticker := bc.Clock().NewTicker(cfg.TestInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
 		}
 
-		bc.BroadcastSyncing(syncStatus)
+		bc.BroadcastTestTick()
 	}
 }
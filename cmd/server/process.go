@@ -0,0 +1,42 @@
+package main
+
+import (
+	"runtime"
+	"runtime/metrics"
+)
+
+// processStats are the server's memory and CPU usage, reported by /stats
+type processStats struct {
+	HeapInuseBytes uint64  `json:"heapInuseBytes"`
+	SysBytes       uint64  `json:"sysBytes"`
+	Goroutines     int     `json:"goroutines"`
+	CPUSeconds     float64 `json:"cpuSeconds"`
+}
+
+// cpuSamples are the runtime metrics whose difference is the CPU time used:
+// all the CPU time available to the process minus its idle time
+var cpuSamples = []metrics.Sample{
+	{Name: "/cpu/classes/total:cpu-seconds"},
+	{Name: "/cpu/classes/idle:cpu-seconds"},
+}
+
+// readProcessStats samples the current process stats
+func readProcessStats() processStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	samples := make([]metrics.Sample, len(cpuSamples))
+	copy(samples, cpuSamples)
+	metrics.Read(samples)
+	var cpu float64
+	if samples[0].Value.Kind() == metrics.KindFloat64 && samples[1].Value.Kind() == metrics.KindFloat64 {
+		cpu = samples[0].Value.Float64() - samples[1].Value.Float64()
+	}
+
+	return processStats{
+		HeapInuseBytes: mem.HeapInuse,
+		SysBytes:       mem.Sys,
+		Goroutines:     runtime.NumGoroutine(),
+		CPUSeconds:     cpu,
+	}
+}
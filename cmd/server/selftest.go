@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"hlnode-websocket/internal/broadcaster"
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/subscription"
+
+	"github.com/gorilla/websocket"
+)
+
+// Startup self-test states reported by /readyz
+const (
+	selfTestDisabled = "disabled"
+	selfTestPending  = "pending"
+	selfTestPassed   = "passed"
+	selfTestFailed   = "failed"
+)
+
+// selfTestState holds the current self-test state
+var selfTestState atomic.Value
+
+// selfTestReady reports whether the self-test doesn't hold back readiness
+func selfTestReady() bool {
+	state, _ := selfTestState.Load().(string)
+	return state == selfTestDisabled || state == selfTestPassed
+}
+
+// runSelfTest connects to the server's own WebSocket port, subscribes to
+// newHeads and checks that a synthetic header delivered to that subscription
+// comes back over the connection. The header only goes to the self-test
+// subscription, never to real clients. With TLS, it connects over wss
+// without verifying its own certificate, and presents it as its client
+// certificate when client certificates are required.
+func runSelfTest(port int, listenerTLS *tls.Config, bc *broadcaster.Broadcaster, timeout time.Duration) error {
+	dialer := websocket.Dialer{HandshakeTimeout: timeout}
+	url := fmt.Sprintf("ws://127.0.0.1:%d/", port)
+	if listenerTLS != nil {
+		dialer.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		if listenerTLS.ClientAuth == tls.RequireAndVerifyClientCert {
+			dialer.TLSClientConfig.Certificates = listenerTLS.Certificates
+		}
+		url = fmt.Sprintf("wss://127.0.0.1:%d/", port)
+	}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	if err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "eth_subscribe", "params": []string{"newHeads"}}); err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	var resp rpc.Response
+	if err := conn.ReadJSON(&resp); err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("subscribe: %s", resp.Error.Message)
+	}
+	var subID string
+	json.Unmarshal(resp.Result, &subID)
+	sub, ok := bc.SubscriptionManager().Get(subID)
+	if !ok {
+		return fmt.Errorf("subscription %q not registered", subID)
+	}
+
+	nonce := make([]byte, 32)
+	rand.Read(nonce)
+	header := &rpc.FullBlockHeader{Number: "0x0", Hash: "0x" + hex.EncodeToString(nonce)}
+	data, err := sub.Notification(header)
+	if err != nil {
+		return fmt.Errorf("notification: %w", err)
+	}
+	if !bc.Deliver(sub, data) {
+		return fmt.Errorf("synthetic notification dropped")
+	}
+
+	// Skip the latest real head sent on subscribe
+	for {
+		var notification subscription.SubscriptionNotification
+		if err := conn.ReadJSON(&notification); err != nil {
+			return fmt.Errorf("synthetic notification: %w", err)
+		}
+		var received rpc.FullBlockHeader
+		json.Unmarshal(notification.Params.Result, &received)
+		if notification.Params.Subscription == subID && received.Hash == header.Hash {
+			return nil
+		}
+	}
+}
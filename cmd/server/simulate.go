@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// simulateIdle is the mix entry for connections without subscriptions
+const simulateIdle = "idle"
+
+// simulateReport is the structured output of the simulate subcommand
+type simulateReport struct {
+	Target        string         `json:"target"`
+	Connections   int            `json:"connections"`
+	Opened        int            `json:"opened"`
+	Mix           map[string]int `json:"mix"`
+	SlowDraining  int            `json:"slowDraining"`
+	Hold          string         `json:"hold"`
+	Notifications uint64         `json:"notifications"`
+	Before        *processStats  `json:"before,omitempty"`
+	After         *processStats  `json:"after,omitempty"`
+	PerConnection *simulateCost  `json:"perConnection,omitempty"`
+	Errors        []string       `json:"errors,omitempty"`
+}
+
+// simulateCost is the proxy's resource usage divided by the connections held
+type simulateCost struct {
+	HeapInuseBytes float64 `json:"heapInuseBytes"`
+	SysBytes       float64 `json:"sysBytes"`
+	Goroutines     float64 `json:"goroutines"`
+	// CPUCores is the average CPU used while holding, in cores
+	CPUCores float64 `json:"cpuCores"`
+}
+
+// mixEntry is a subscription type and its share of the connections
+type mixEntry struct {
+	subType string
+	weight  int
+}
+
+// runSimulate implements `hlnode-websocket simulate`: it opens and holds
+// connections with a mix of subscriptions against a running instance and
+// reports the instance's memory and CPU per connection from /stats, to guide
+// sizing. It prints a JSON report and returns the process exit code.
+func runSimulate(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	target := fs.String("url", "ws://localhost:8080", "WebSocket URL of the instance")
+	connections := fs.Int("connections", 1000, "Number of connections to hold")
+	mix := fs.String("mix", "newHeads:50,logs:30,idle:20", "Comma-separated subscription types with their weights; idle connections don't subscribe")
+	slow := fs.Float64("slow", 0, "Fraction of connections draining slowly")
+	slowDelay := fs.Duration("slow-delay", time.Second, "Delay between reads of slow-draining connections")
+	rate := fs.Int("rate", 100, "Connections opened per second")
+	hold := fs.Duration("hold", time.Minute, "How long to hold the connections before measuring")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	entries, err := parseMix(*mix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -mix: %v\n", err)
+		return 2
+	}
+	if *connections <= 0 || *rate <= 0 || *slow < 0 || *slow > 1 {
+		fmt.Fprintln(os.Stderr, "-connections and -rate must be positive and -slow between 0 and 1")
+		return 2
+	}
+
+	report := simulate(*target, *connections, entries, *slow, *slowDelay, *rate, *hold)
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if report.PerConnection == nil {
+		return 1
+	}
+	return 0
+}
+
+// parseMix parses "type:weight,..." into mix entries
+func parseMix(mix string) ([]mixEntry, error) {
+	var entries []mixEntry
+	for _, part := range strings.Split(mix, ",") {
+		subType, weight, ok := strings.Cut(strings.TrimSpace(part), ":")
+		n, err := strconv.Atoi(weight)
+		if !ok || subType == "" || err != nil || n <= 0 {
+			return nil, fmt.Errorf("%q is not type:weight with a positive weight", part)
+		}
+		entries = append(entries, mixEntry{subType: subType, weight: n})
+	}
+	return entries, nil
+}
+
+// mixType returns the subscription type of connection i, spreading the
+// types evenly in proportion to their weights
+func mixType(entries []mixEntry, i int) string {
+	total := 0
+	for _, e := range entries {
+		total += e.weight
+	}
+	slot := i % total
+	for _, e := range entries {
+		if slot < e.weight {
+			return e.subType
+		}
+		slot -= e.weight
+	}
+	return entries[len(entries)-1].subType
+}
+
+// simulate holds the connections against target and measures the instance
+func simulate(target string, connections int, entries []mixEntry, slow float64, slowDelay time.Duration, rate int, hold time.Duration) *simulateReport {
+	report := &simulateReport{Target: target, Connections: connections, Mix: make(map[string]int), Hold: hold.String()}
+
+	statsURL, err := url.Parse(target)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("invalid url: %v", err))
+		return report
+	}
+	switch statsURL.Scheme {
+	case "ws":
+		statsURL.Scheme = "http"
+	case "wss":
+		statsURL.Scheme = "https"
+	}
+	statsURL = statsURL.JoinPath("/stats")
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+
+	before, err := fetchProcessStats(httpClient, statsURL.String())
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("stats: %v", err))
+		return report
+	}
+	report.Before = before
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	var (
+		notifications atomic.Uint64
+		conns         []*websocket.Conn
+		readers       sync.WaitGroup
+		errorsMu      sync.Mutex
+		dialErrors    = make(map[string]int)
+	)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		readers.Wait()
+	}()
+
+	slowEvery := 0
+	if slow > 0 {
+		slowEvery = int(1 / slow)
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+
+open:
+	for i := 0; i < connections; i++ {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			report.Errors = append(report.Errors, "interrupted while opening connections")
+			break open
+		}
+
+		subType := mixType(entries, i)
+		conn, err := openSimulatedConnection(&dialer, target, subType)
+		if err != nil {
+			errorsMu.Lock()
+			dialErrors[err.Error()]++
+			errorsMu.Unlock()
+			continue
+		}
+		conns = append(conns, conn)
+		report.Mix[subType]++
+
+		var delay time.Duration
+		if slowEvery > 0 && i%slowEvery == 0 {
+			delay = slowDelay
+			report.SlowDraining++
+		}
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+				notifications.Add(1)
+				if delay > 0 {
+					time.Sleep(delay)
+				}
+			}
+		}()
+	}
+	report.Opened = len(conns)
+	for msg, count := range dialErrors {
+		report.Errors = append(report.Errors, fmt.Sprintf("%d connections: %s", count, msg))
+	}
+
+	start := time.Now()
+	cpuBefore, err := fetchProcessStats(httpClient, statsURL.String())
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("stats: %v", err))
+		return report
+	}
+	select {
+	case <-time.After(hold):
+	case <-quit:
+		report.Errors = append(report.Errors, "interrupted while holding connections")
+	}
+	after, err := fetchProcessStats(httpClient, statsURL.String())
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("stats: %v", err))
+		return report
+	}
+	held := time.Since(start)
+	report.After = after
+	report.Notifications = notifications.Load()
+
+	if report.Opened > 0 {
+		n := float64(report.Opened)
+		report.PerConnection = &simulateCost{
+			HeapInuseBytes: (float64(after.HeapInuseBytes) - float64(before.HeapInuseBytes)) / n,
+			SysBytes:       (float64(after.SysBytes) - float64(before.SysBytes)) / n,
+			Goroutines:     float64(after.Goroutines-before.Goroutines) / n,
+			CPUCores:       (after.CPUSeconds - cpuBefore.CPUSeconds) / held.Seconds() / n,
+		}
+	}
+	return report
+}
+
+// openSimulatedConnection connects and, unless idle, subscribes to subType
+func openSimulatedConnection(dialer *websocket.Dialer, target, subType string) (*websocket.Conn, error) {
+	conn, _, err := dialer.Dial(target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	if subType == simulateIdle {
+		return conn, nil
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+	if err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "eth_subscribe", "params": []string{subType}}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("subscribe %s: %w", subType, err)
+	}
+	// Skip notifications that may precede the response, e.g. a snapshot
+	for {
+		var resp struct {
+			ID    json.RawMessage `json:"id"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := conn.ReadJSON(&resp); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("subscribe %s: %w", subType, err)
+		}
+		if resp.ID == nil {
+			continue
+		}
+		if resp.Error != nil {
+			conn.Close()
+			return nil, fmt.Errorf("subscribe %s: %s", subType, resp.Error.Message)
+		}
+		return conn, nil
+	}
+}
+
+// fetchProcessStats reads the instance's process stats from /stats
+func fetchProcessStats(client *http.Client, statsURL string) (*processStats, error) {
+	resp, err := client.Get(statsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %s", resp.Status)
+	}
+	var stats struct {
+		Process *processStats `json:"process"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, err
+	}
+	if stats.Process == nil {
+		return nil, fmt.Errorf("instance does not report process stats")
+	}
+	return stats.Process, nil
+}
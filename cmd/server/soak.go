@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"hlnode-websocket/internal/broadcaster"
+	"hlnode-websocket/internal/cache"
+	"hlnode-websocket/internal/clock"
+	"hlnode-websocket/internal/config"
+	"hlnode-websocket/internal/events"
+	"hlnode-websocket/internal/handlers"
+	"hlnode-websocket/internal/recovery"
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/subscription"
+	"hlnode-websocket/internal/synthetic"
+
+	"github.com/gorilla/websocket"
+)
+
+// soakReport is the structured output of the soak subcommand
+type soakReport struct {
+	Duration      string       `json:"duration"`
+	Blocks        uint64       `json:"blocks"`
+	Clients       int          `json:"clients"`
+	Notifications uint64       `json:"notifications"`
+	Gaps          uint64       `json:"gaps"`
+	Memory        []soakSample `json:"memory"`
+	HeapGrowth    int64        `json:"heapGrowthBytes"`
+	Passed        bool         `json:"passed"`
+	Errors        []string     `json:"errors,omitempty"`
+}
+
+// soakSample is a memory measurement taken after a forced GC
+type soakSample struct {
+	Elapsed    string `json:"elapsed"`
+	HeapAlloc  uint64 `json:"heapAlloc"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// soakClient is a WebSocket client subscribed to newHeads and logs that
+// checks every block and log arrives exactly once and in order
+type soakClient struct {
+	logsPerBlock int
+
+	mu            sync.Mutex
+	subs          map[string]string
+	lastHead      uint64
+	logBlock      uint64
+	logCount      int
+	notifications uint64
+	gaps          uint64
+	errors        []string
+}
+
+// runSoak implements `hlnode-websocket soak`: it runs the block poller,
+// broadcaster and WebSocket handler against a synthetic upstream with
+// subscribed clients, checks every notification arrives and that memory
+// stays flat, prints a JSON report and returns the process exit code
+func runSoak(args []string) int {
+	fs := flag.NewFlagSet("soak", flag.ContinueOnError)
+	duration := fs.Duration("duration", time.Hour, "How long to run")
+	blockInterval := fs.Duration("block-interval", time.Second, "Time between synthetic blocks")
+	logsPerBlock := fs.Int("logs-per-block", 10, "Logs in every synthetic block")
+	clients := fs.Int("clients", 10, "Number of subscribed WebSocket clients")
+	sampleInterval := fs.Duration("sample-interval", time.Minute, "Time between memory samples")
+	warmup := fs.Duration("warmup", time.Minute, "Time before the baseline memory sample")
+	maxHeapGrowth := fs.Int64("max-heap-growth", 64<<20, "Allowed heap growth over the baseline, in bytes")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	report := soak(soakOptions{
+		duration:       *duration,
+		blockInterval:  *blockInterval,
+		logsPerBlock:   *logsPerBlock,
+		clients:        *clients,
+		sampleInterval: *sampleInterval,
+		warmup:         *warmup,
+		maxHeapGrowth:  *maxHeapGrowth,
+	})
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
+
+// soakOptions are the parameters of a soak run
+type soakOptions struct {
+	duration       time.Duration
+	blockInterval  time.Duration
+	logsPerBlock   int
+	clients        int
+	sampleInterval time.Duration
+	warmup         time.Duration
+	maxHeapGrowth  int64
+}
+
+// soak runs the pipeline for opts.duration, or until interrupted
+func soak(opts soakOptions) *soakReport {
+	report := &soakReport{Clients: opts.clients, Memory: []soakSample{}}
+	fail := func(format string, args ...interface{}) *soakReport {
+		report.Errors = append(report.Errors, fmt.Sprintf(format, args...))
+		return report
+	}
+
+	upstream, err := synthetic.NewUpstream(synthetic.Config{BlockInterval: opts.blockInterval, LogsPerBlock: opts.logsPerBlock}, clock.Real)
+	if err != nil {
+		return fail("synthetic upstream: %v", err)
+	}
+	upstreamListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fail("synthetic upstream: %v", err)
+	}
+	upstreamServer := &http.Server{Handler: upstream}
+	go upstreamServer.Serve(upstreamListener)
+	defer upstreamServer.Close()
+
+	// The poller must see every block to deliver it
+	cfg := config.Load()
+	cfg.RPCURL = "http://" + upstreamListener.Addr().String()
+	if cfg.PollInterval > opts.blockInterval/4 {
+		cfg.PollInterval = opts.blockInterval / 4
+	}
+
+	rpcClient := rpc.NewClient(cfg.RPCURL)
+	bc := broadcaster.NewBroadcaster()
+	go recovery.Supervise("broadcaster", bc.Run)
+	defer bc.Stop()
+
+	wsHandler := handlers.NewWebSocketHandler(rpcClient, bc)
+	gasPrices := cache.NewGasPriceCache(cfg.GasPriceHistorySize)
+	wsHandler.SetGasPrices(gasPrices)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fail("listen: %v", err)
+	}
+	server := &http.Server{Handler: wsHandler}
+	go server.Serve(listener)
+	defer server.Close()
+
+	pollCtx, stopPolling := context.WithCancel(context.Background())
+	defer stopPolling()
+	bus := events.NewBus()
+	bus.Subscribe("broadcaster", events.Options{}, broadcastEvents(bc, rpcClient, gasPrices, cfg))
+	go recovery.Supervise("pollBlocks", func() {
+		pollBlocks(pollCtx, rpc.NewBalancer(rpcClient), nil, bc, bus, cache.NewBus(), gasPrices, nil, nil, cfg)
+	})
+
+	target := "ws://" + listener.Addr().String()
+	soakClients := make([]*soakClient, opts.clients)
+	for i := range soakClients {
+		soakClients[i] = &soakClient{logsPerBlock: opts.logsPerBlock, subs: make(map[string]string)}
+		conn, err := soakClients[i].connect(target)
+		if err != nil {
+			return fail("client %d: %v", i, err)
+		}
+		defer conn.Close()
+		go soakClients[i].read(conn)
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	start := time.Now()
+	startHead := upstream.Head()
+	deadline := time.NewTimer(opts.duration)
+	defer deadline.Stop()
+	warmupDone := time.After(opts.warmup)
+	sampler := time.NewTicker(opts.sampleInterval)
+	defer sampler.Stop()
+
+	var baseline *soakSample
+	sample := func() soakSample {
+		runtime.GC()
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		s := soakSample{
+			Elapsed:    time.Since(start).Round(time.Second).String(),
+			HeapAlloc:  stats.HeapAlloc,
+			Goroutines: runtime.NumGoroutine(),
+		}
+		report.Memory = append(report.Memory, s)
+		return s
+	}
+
+loop:
+	for {
+		select {
+		case <-warmupDone:
+			s := sample()
+			baseline = &s
+		case <-sampler.C:
+			if baseline != nil {
+				sample()
+			}
+		case <-deadline.C:
+			break loop
+		case <-quit:
+			report.Errors = append(report.Errors, "interrupted")
+			break loop
+		}
+	}
+
+	report.Duration = time.Since(start).Round(time.Second).String()
+	report.Blocks = upstream.Head() - startHead
+	for i, c := range soakClients {
+		c.mu.Lock()
+		report.Notifications += c.notifications
+		report.Gaps += c.gaps
+		for _, e := range c.errors {
+			report.Errors = append(report.Errors, fmt.Sprintf("client %d: %s", i, e))
+		}
+		if c.lastHead == 0 && report.Blocks > 1 {
+			report.Errors = append(report.Errors, fmt.Sprintf("client %d: no newHeads received", i))
+		}
+		c.mu.Unlock()
+	}
+
+	if baseline == nil {
+		report.Errors = append(report.Errors, "run ended before the warm-up, memory not checked")
+	} else {
+		final := sample()
+		report.HeapGrowth = int64(final.HeapAlloc) - int64(baseline.HeapAlloc)
+		if report.HeapGrowth > opts.maxHeapGrowth {
+			report.Errors = append(report.Errors, fmt.Sprintf("heap grew by %d bytes, more than %d", report.HeapGrowth, opts.maxHeapGrowth))
+		}
+		if final.Goroutines > baseline.Goroutines {
+			report.Errors = append(report.Errors, fmt.Sprintf("goroutines grew from %d to %d", baseline.Goroutines, final.Goroutines))
+		}
+	}
+	report.Passed = report.Gaps == 0 && len(report.Errors) == 0
+	return report
+}
+
+// connect dials the server and subscribes to newHeads and, when blocks have
+// logs, to the synthetic contract's logs
+func (c *soakClient) connect(target string) (*websocket.Conn, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	requests := [][]interface{}{{"newHeads"}}
+	if c.logsPerBlock > 0 {
+		requests = append(requests, []interface{}{"logs", map[string]interface{}{"address": synthetic.LogAddress}})
+	}
+	for i, params := range requests {
+		conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": i, "method": "eth_subscribe", "params": params})
+		var resp rpc.Response
+		if err := conn.ReadJSON(&resp); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("subscribe %s: %w", params[0], err)
+		}
+		if resp.Error != nil {
+			conn.Close()
+			return nil, fmt.Errorf("subscribe %s: %s", params[0], resp.Error.Message)
+		}
+		var subID string
+		json.Unmarshal(resp.Result, &subID)
+		c.subs[subID] = params[0].(string)
+	}
+	return conn, nil
+}
+
+// soakMaxClientErrors caps the errors kept per client, gaps are still counted
+const soakMaxClientErrors = 10
+
+// addError records an error unless the client already has soakMaxClientErrors
+func (c *soakClient) addError(msg string) {
+	if len(c.errors) < soakMaxClientErrors {
+		c.errors = append(c.errors, msg)
+	}
+}
+
+// read consumes notifications until the connection is closed
+func (c *soakClient) read(conn *websocket.Conn) {
+	for {
+		var notification subscription.SubscriptionNotification
+		if err := conn.ReadJSON(&notification); err != nil {
+			return
+		}
+		c.mu.Lock()
+		c.notifications++
+		switch c.subs[notification.Params.Subscription] {
+		case "newHeads":
+			var header rpc.FullBlockHeader
+			json.Unmarshal(notification.Params.Result, &header)
+			c.observeHead(header.Number)
+		case "logs":
+			var log rpc.Log
+			json.Unmarshal(notification.Params.Result, &log)
+			c.observeLog(log.BlockNumber, log.LogIndex)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// observeHead checks heads arrive one block at a time
+func (c *soakClient) observeHead(number string) {
+	n, err := rpc.ParseHexUint64(number)
+	if err != nil {
+		c.addError(fmt.Sprintf("invalid head number %q", number))
+		return
+	}
+	if c.lastHead != 0 && n != c.lastHead+1 {
+		c.gaps++
+		c.addError(fmt.Sprintf("newHeads: got block %d after %d", n, c.lastHead))
+	}
+	c.lastHead = n
+}
+
+// observeLog checks logs arrive in order and every block has all of them.
+// Logs before the first complete block are skipped, the subscription may
+// have started in the middle of one.
+func (c *soakClient) observeLog(number, index string) {
+	n, err := rpc.ParseHexUint64(number)
+	if err != nil {
+		c.addError(fmt.Sprintf("invalid log block number %q", number))
+		return
+	}
+	i, _ := rpc.ParseHexUint64(index)
+	switch {
+	case c.logBlock == 0:
+		if i == 0 {
+			c.logBlock, c.logCount = n, 1
+		}
+	case n == c.logBlock && int(i) == c.logCount:
+		c.logCount++
+	case n == c.logBlock+1 && i == 0 && c.logCount == c.logsPerBlock:
+		c.logBlock, c.logCount = n, 1
+	default:
+		c.gaps++
+		c.addError(fmt.Sprintf("logs: got block %d index %d after block %d with %d logs", n, i, c.logBlock, c.logCount))
+		c.logBlock, c.logCount = n, int(i)+1
+	}
+}
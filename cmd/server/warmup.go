@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"hlnode-websocket/internal/config"
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/storage"
+)
+
+// warmUpWorkers is the number of blocks fetched concurrently during warm-up
+const warmUpWorkers = 8
+
+// warmUp prefetches the headers, logs and receipts of the last WARMUP_BLOCKS
+// blocks into storage before the server accepts connections, so backfills and
+// locally served queries cover them from the start. Blocks already stored
+// are skipped. It gives up on blocks not fetched within WARMUP_TIMEOUT; the
+// server starts regardless.
+func warmUp(client *rpc.Client, store storage.Storage, cfg *config.Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.WarmUpTimeout)
+	defer cancel()
+
+	latest, err := client.GetBlockNumber(ctx)
+	if err != nil {
+		logger.Warn("Skipping warm-up, failed to fetch block number: %v", err)
+		return
+	}
+	head, err := rpc.ParseHexUint64(latest)
+	if err != nil {
+		logger.Warn("Skipping warm-up, invalid block number %q", latest)
+		return
+	}
+	// Blocks beyond the count retention would be evicted right away
+	blocks := uint64(cfg.WarmUpBlocks)
+	if cfg.StorageRetentionBlocks > 0 {
+		blocks = min(blocks, uint64(cfg.StorageRetentionBlocks))
+	}
+	from := uint64(0)
+	if head >= blocks {
+		from = head - blocks + 1
+	}
+
+	numbers := make(chan uint64)
+	var stored, failed atomic.Int64
+	var wg sync.WaitGroup
+	for range warmUpWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range numbers {
+				if err := warmUpBlock(ctx, client, store, n); err != nil {
+					failed.Add(1)
+					logger.Debug("Warm-up of block %d failed: %v", n, err)
+					continue
+				}
+				stored.Add(1)
+			}
+		}()
+	}
+	for n := from; n <= head && ctx.Err() == nil; n++ {
+		if _, err := store.GetBlock(ctx, n); err == nil {
+			continue
+		}
+		select {
+		case numbers <- n:
+		case <-ctx.Done():
+		}
+	}
+	close(numbers)
+	wg.Wait()
+
+	if failed.Load() > 0 || ctx.Err() != nil {
+		logger.Warn("Warm-up stored %d of blocks %d-%d, %d failed (timeout: %v)", stored.Load(), from, head, failed.Load(), ctx.Err() != nil)
+		return
+	}
+	logger.Info("Warm-up stored %d blocks (%d-%d)", stored.Load(), from, head)
+}
+
+// warmUpBlock fetches a block with its logs and receipts and stores them
+func warmUpBlock(ctx context.Context, client *rpc.Client, store storage.Storage, n uint64) error {
+	blockNum := rpc.FormatHexUint64(n)
+	block, err := client.GetFullBlock(ctx, blockNum)
+	if err == nil && block == nil {
+		err = errors.New("block not found")
+	}
+	if err != nil {
+		return err
+	}
+	logs, err := client.GetBlockLogs(ctx, blockNum)
+	if err != nil {
+		return err
+	}
+	receipts, err := client.GetBlockReceipts(ctx, blockNum)
+	if err != nil {
+		return err
+	}
+	metrics.UpstreamRequestsTotal.Add(3)
+
+	if err := store.PutBlock(ctx, n, block); err != nil {
+		return err
+	}
+	if err := store.PutLogs(ctx, n, logs); err != nil {
+		return err
+	}
+	return store.PutReceipts(ctx, n, receipts)
+}
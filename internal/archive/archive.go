@@ -0,0 +1,290 @@
+// Package archive flushes aged-out segments of the local store (blocks and
+// their logs) to object storage in a compact format and reads them back, so
+// deep replays are served with bounded local disk
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/storage"
+)
+
+// DefaultSegmentBlocks is the number of blocks per archived segment
+const DefaultSegmentBlocks = 1000
+
+// indexKey is the object listing the archived segments
+const indexKey = "index.json"
+
+// Span is a range of archived blocks, bounds included
+type Span struct {
+	First uint64 `json:"first"`
+	Last  uint64 `json:"last"`
+}
+
+// Segment is the archived content of a span of blocks: the stored blocks
+// and their logs, in block order. Blocks that were never stored are absent.
+type Segment struct {
+	Span
+	Blocks []*rpc.FullBlockHeader `json:"blocks"`
+	Logs   []rpc.Log              `json:"logs"`
+}
+
+// segmentKey is the object key of the segment archiving a span
+func segmentKey(span Span) string {
+	return fmt.Sprintf("segments/%012d-%012d.json.gz", span.First, span.Last)
+}
+
+// Archiver flushes segments to a bucket and reads them back. The bucket's
+// index of archived spans is kept in memory and rewritten on each flush.
+type Archiver struct {
+	bucket        Bucket
+	segmentBlocks uint64
+	// index lists the archived spans in block order
+	index []Span
+	// cached is the last segment read, as replays read a segment repeatedly
+	cached *Segment
+	mu     sync.Mutex
+}
+
+// New creates an archiver over a bucket, loading its index of archived spans
+func New(ctx context.Context, bucket Bucket, segmentBlocks uint64) (*Archiver, error) {
+	if segmentBlocks == 0 {
+		segmentBlocks = DefaultSegmentBlocks
+	}
+	a := &Archiver{bucket: bucket, segmentBlocks: segmentBlocks}
+	data, err := bucket.Get(ctx, indexKey)
+	if errors.Is(err, ErrNotFound) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading archive index: %w", err)
+	}
+	if err := json.Unmarshal(data, &a.index); err != nil {
+		return nil, fmt.Errorf("reading archive index: %w", err)
+	}
+	sort.Slice(a.index, func(i, j int) bool { return a.index[i].First < a.index[j].First })
+	return a, nil
+}
+
+// Range returns the first and last archived block numbers; ok is false while
+// nothing is archived
+func (a *Archiver) Range() (first, last uint64, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.index) == 0 {
+		return 0, 0, false
+	}
+	return a.index[0].First, a.index[len(a.index)-1].Last, true
+}
+
+// Flush archives every complete segment of stored blocks up to and including
+// upTo that is not archived yet, returning the number of segments written.
+// Segments are aligned to multiples of the segment size; the first one
+// starts at the oldest stored block. Call it from a single goroutine, before
+// the blocks age out of the store.
+func (a *Archiver) Flush(ctx context.Context, store storage.Storage, upTo uint64) (int, error) {
+	oldest, _, err := store.BlockRange(ctx)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	a.mu.Lock()
+	next := oldest
+	if n := len(a.index); n > 0 && a.index[n-1].Last+1 > next {
+		next = a.index[n-1].Last + 1
+	}
+	a.mu.Unlock()
+
+	flushed := 0
+	for {
+		span := Span{First: next, Last: next - next%a.segmentBlocks + a.segmentBlocks - 1}
+		if span.Last > upTo {
+			return flushed, nil
+		}
+		if err := a.flushSegment(ctx, store, span); err != nil {
+			return flushed, err
+		}
+		flushed++
+		next = span.Last + 1
+	}
+}
+
+// flushSegment writes the segment of a span, then records it in the index
+func (a *Archiver) flushSegment(ctx context.Context, store storage.Storage, span Span) error {
+	seg := &Segment{Span: span}
+	for n := span.First; n <= span.Last; n++ {
+		block, err := store.GetBlock(ctx, n)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		seg.Blocks = append(seg.Blocks, block)
+	}
+	logs, err := store.GetLogs(ctx, span.First, span.Last)
+	if err != nil {
+		return err
+	}
+	seg.Logs = logs
+
+	data, err := encode(seg)
+	if err != nil {
+		return err
+	}
+	if err := a.bucket.Put(ctx, segmentKey(span), data); err != nil {
+		return fmt.Errorf("writing segment %d-%d: %w", span.First, span.Last, err)
+	}
+
+	a.mu.Lock()
+	a.index = append(a.index, span)
+	index, err := json.Marshal(a.index)
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := a.bucket.Put(ctx, indexKey, index); err != nil {
+		return fmt.Errorf("writing archive index: %w", err)
+	}
+	return nil
+}
+
+// Covered returns the parts of [from, to] that are archived, in block order
+func (a *Archiver) Covered(from, to uint64) []Span {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var covered []Span
+	for _, span := range a.index {
+		if span.Last < from || span.First > to {
+			continue
+		}
+		first, last := max(span.First, from), min(span.Last, to)
+		// Adjacent segments read as one span
+		if n := len(covered); n > 0 && covered[n-1].Last+1 == first {
+			covered[n-1].Last = last
+			continue
+		}
+		covered = append(covered, Span{First: first, Last: last})
+	}
+	return covered
+}
+
+// Logs returns the archived logs of the blocks in [from, to], in block order
+func (a *Archiver) Logs(ctx context.Context, from, to uint64) ([]rpc.Log, error) {
+	a.mu.Lock()
+	var spans []Span
+	for _, span := range a.index {
+		if span.Last >= from && span.First <= to {
+			spans = append(spans, span)
+		}
+	}
+	a.mu.Unlock()
+
+	var logs []rpc.Log
+	for _, span := range spans {
+		seg, err := a.segment(ctx, span)
+		if err != nil {
+			return nil, err
+		}
+		for i := range seg.Logs {
+			n, err := rpc.ParseHexUint64(seg.Logs[i].BlockNumber)
+			if err == nil && n >= from && n <= to {
+				logs = append(logs, seg.Logs[i])
+			}
+		}
+	}
+	return logs, nil
+}
+
+// Block returns the archived header of a block, or ErrNotFound
+func (a *Archiver) Block(ctx context.Context, number uint64) (*rpc.FullBlockHeader, error) {
+	a.mu.Lock()
+	var span Span
+	found := false
+	for _, s := range a.index {
+		if s.First <= number && number <= s.Last {
+			span, found = s, true
+			break
+		}
+	}
+	a.mu.Unlock()
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	seg, err := a.segment(ctx, span)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range seg.Blocks {
+		if n, err := rpc.ParseHexUint64(block.Number); err == nil && n == number {
+			return block, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// segment reads the segment of a span, from the cache when it was the last read
+func (a *Archiver) segment(ctx context.Context, span Span) (*Segment, error) {
+	a.mu.Lock()
+	cached := a.cached
+	a.mu.Unlock()
+	if cached != nil && cached.Span == span {
+		return cached, nil
+	}
+
+	data, err := a.bucket.Get(ctx, segmentKey(span))
+	if err != nil {
+		return nil, fmt.Errorf("reading segment %d-%d: %w", span.First, span.Last, err)
+	}
+	seg, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("reading segment %d-%d: %w", span.First, span.Last, err)
+	}
+	a.mu.Lock()
+	a.cached = seg
+	a.mu.Unlock()
+	return seg, nil
+}
+
+// encode serializes a segment as gzipped JSON
+func encode(seg *Segment) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(seg); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decode parses a segment written by encode
+func decode(data []byte) (*Segment, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	var seg Segment
+	if err := json.Unmarshal(raw, &seg); err != nil {
+		return nil, err
+	}
+	return &seg, nil
+}
@@ -0,0 +1,105 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/storage"
+)
+
+// storeBlocks stores blocks from..to in a memory store, with one log each
+func storeBlocks(ctx context.Context, from, to uint64) *storage.Memory {
+	store := storage.NewMemory()
+	for n := from; n <= to; n++ {
+		hex := rpc.FormatHexUint64(n)
+		store.PutBlock(ctx, n, &rpc.FullBlockHeader{Number: hex})
+		store.PutLogs(ctx, n, []rpc.Log{{BlockNumber: hex, LogIndex: "0x0"}})
+	}
+	return store
+}
+
+func TestArchiverFlush(t *testing.T) {
+	ctx := context.Background()
+	bucket := NewDir(t.TempDir())
+	a, err := New(ctx, bucket, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storeBlocks(ctx, 5, 34)
+
+	// Segments end at multiples of 10; the one ending at 29 is past upTo
+	flushed, err := a.Flush(ctx, store, 25)
+	if err != nil || flushed != 2 {
+		t.Fatalf("Expected 2 segments flushed, got %d (%v)", flushed, err)
+	}
+	if first, last, ok := a.Range(); !ok || first != 5 || last != 19 {
+		t.Errorf("Expected blocks 5-19 archived, got %d-%d (%v)", first, last, ok)
+	}
+	if flushed, _ := a.Flush(ctx, store, 25); flushed != 0 {
+		t.Errorf("Expected archived segments not to be flushed again, got %d", flushed)
+	}
+
+	// Archived blocks stay readable after the store prunes them
+	store.Prune(ctx, 30)
+	logs, err := a.Logs(ctx, 8, 12)
+	if err != nil || len(logs) != 5 || logs[0].BlockNumber != "0x8" || logs[4].BlockNumber != "0xc" {
+		t.Errorf("Expected the logs of blocks 8-12 in order, got %+v (%v)", logs, err)
+	}
+	if block, err := a.Block(ctx, 19); err != nil || block.Number != "0x13" {
+		t.Errorf("Expected block 19, got %+v (%v)", block, err)
+	}
+	if _, err := a.Block(ctx, 20); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unarchived block, got %v", err)
+	}
+
+	covered := a.Covered(0, 100)
+	if len(covered) != 1 || covered[0] != (Span{First: 5, Last: 19}) {
+		t.Errorf("Expected adjacent segments to read as one span, got %+v", covered)
+	}
+
+	// A new archiver over the bucket resumes from its index
+	reopened, err := New(ctx, bucket, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first, last, ok := reopened.Range(); !ok || first != 5 || last != 19 {
+		t.Errorf("Expected the index to be reloaded, got %d-%d (%v)", first, last, ok)
+	}
+}
+
+func TestArchiverSkipsPrunedBlocks(t *testing.T) {
+	ctx := context.Background()
+	a, _ := New(ctx, NewDir(t.TempDir()), 10)
+	if _, err := a.Flush(ctx, storeBlocks(ctx, 0, 9), 9); err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks 10-24 aged out before they were archived: archiving resumes
+	// at the oldest stored block
+	if _, err := a.Flush(ctx, storeBlocks(ctx, 25, 40), 40); err != nil {
+		t.Fatal(err)
+	}
+	covered := a.Covered(0, 100)
+	if len(covered) != 2 || covered[0] != (Span{First: 0, Last: 9}) || covered[1] != (Span{First: 25, Last: 39}) {
+		t.Errorf("Expected spans 0-9 and 25-39, got %+v", covered)
+	}
+}
+
+func TestOpenBucket(t *testing.T) {
+	creds := Credentials{AccessKeyID: "key", SecretAccessKey: "secret"}
+	for _, rawURL := range []string{"file:///tmp/archive", "s3://bucket/prefix?region=eu-west-1", "gs://bucket"} {
+		if _, err := OpenBucket(rawURL, creds); err != nil {
+			t.Errorf("Expected %s to open, got %v", rawURL, err)
+		}
+	}
+	for _, rawURL := range []string{"ftp://host/path", "s3:///prefix", "file://"} {
+		if _, err := OpenBucket(rawURL, creds); err == nil {
+			t.Errorf("Expected %s to be rejected", rawURL)
+		}
+	}
+	if _, err := OpenBucket("s3://bucket", Credentials{}); err == nil {
+		t.Error("Expected S3 without credentials to be rejected")
+	}
+}
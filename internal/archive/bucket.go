@@ -0,0 +1,99 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned when an object does not exist in a bucket
+var ErrNotFound = errors.New("object not found")
+
+// Bucket is an object store holding archive segments by key
+type Bucket interface {
+	// Put stores an object, replacing any stored under its key
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns the object stored under a key
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Credentials sign requests to S3-compatible buckets
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// OpenBucket opens the bucket located by an ARCHIVE_URL:
+//
+//	file:///var/lib/hlnode/archive       a local (or mounted) directory
+//	s3://bucket/prefix?region=eu-west-1  Amazon S3; endpoint= selects another S3-compatible store
+//	gs://bucket/prefix                   Google Cloud Storage through its XML API with HMAC keys
+func OpenBucket(rawURL string, creds Credentials) (Bucket, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("archive URL %q has no path", rawURL)
+		}
+		return NewDir(u.Path), nil
+	case "s3", "gs":
+		if u.Host == "" {
+			return nil, fmt.Errorf("archive URL %q has no bucket", rawURL)
+		}
+		if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+			return nil, fmt.Errorf("archive URL %q requires access key credentials", rawURL)
+		}
+		region := u.Query().Get("region")
+		endpoint := u.Query().Get("endpoint")
+		if u.Scheme == "gs" {
+			region, endpoint = "auto", "https://storage.googleapis.com"
+		}
+		if region == "" {
+			region = "us-east-1"
+		}
+		if endpoint == "" {
+			endpoint = "https://s3." + region + ".amazonaws.com"
+		}
+		return NewS3(endpoint, region, u.Host, strings.Trim(u.Path, "/"), creds)
+	default:
+		return nil, fmt.Errorf("unsupported archive URL scheme %q (supported: file, s3, gs)", u.Scheme)
+	}
+}
+
+// Dir is a Bucket kept in a directory, e.g. a bucket mounted with a FUSE driver
+type Dir struct {
+	root string
+}
+
+// NewDir creates a bucket in a directory, created on first write
+func NewDir(root string) *Dir {
+	return &Dir{root: root}
+}
+
+func (d *Dir) Put(ctx context.Context, key string, data []byte) error {
+	path := filepath.Join(d.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write then rename so readers never see a partial object
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (d *Dir) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(d.root, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
@@ -0,0 +1,105 @@
+package broadcaster
+
+import (
+	"encoding/json"
+	"time"
+
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/subscription"
+)
+
+// SubscriptionFilter selects subscriptions for admin bulk operations. Zero
+// fields match every subscription.
+type SubscriptionFilter struct {
+	Type subscription.SubscriptionType
+	// Address matches subscriptions whose filter names the address
+	Address string
+	// IP matches subscriptions of clients connected from the address
+	IP string
+	// OlderThan matches subscriptions created longer ago
+	OlderThan time.Duration
+}
+
+// Empty reports whether the filter matches every subscription
+func (f SubscriptionFilter) Empty() bool {
+	return f == SubscriptionFilter{}
+}
+
+// SubscriptionInfo describes a subscription to admins
+type SubscriptionInfo struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	ClientID  string          `json:"clientId"`
+	IP        string          `json:"ip,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// FindSubscriptions returns the subscriptions matching f, oldest first
+func (b *Broadcaster) FindSubscriptions(f SubscriptionFilter) []SubscriptionInfo {
+	ips := b.clientIPs()
+	subs := b.subManager.Select(b.criteria(f, ips))
+	infos := make([]SubscriptionInfo, 0, len(subs))
+	for _, sub := range subs {
+		infos = append(infos, SubscriptionInfo{
+			ID:        sub.ID,
+			Type:      string(sub.Type),
+			Params:    sub.Params,
+			ClientID:  sub.ClientID,
+			IP:        ips[sub.ClientID],
+			CreatedAt: sub.CreatedAt,
+		})
+	}
+	return infos
+}
+
+// RemoveSubscriptions removes the subscriptions matching f, sending each a
+// final error notification, and returns how many were removed
+func (b *Broadcaster) RemoveSubscriptions(f SubscriptionFilter) int {
+	removed := 0
+	for _, sub := range b.subManager.Select(b.criteria(f, b.clientIPs())) {
+		if data, err := sub.ErrorNotification(rpc.ErrCodeInvalidRequest, "subscription removed by an administrator"); err == nil {
+			b.Deliver(sub, data)
+		}
+		if b.subManager.Unsubscribe(sub.ClientID, sub.ID) {
+			metrics.WSSubscriptionsRemovedByAdmin.WithLabelValues(string(sub.Type)).Inc()
+			removed++
+		}
+	}
+	if removed > 0 {
+		logger.Warn("Admin removed %d subscriptions (type=%q address=%q ip=%q olderThan=%v)", removed, f.Type, f.Address, f.IP, f.OlderThan)
+	}
+	return removed
+}
+
+// criteria translates f into subscription selection criteria, given the IP
+// of each connected client
+func (b *Broadcaster) criteria(f SubscriptionFilter, ips map[string]string) subscription.Criteria {
+	c := subscription.Criteria{Type: f.Type, Address: f.Address}
+	if f.IP != "" {
+		c.ClientIDs = make(map[string]bool)
+		for id, ip := range ips {
+			if ip == f.IP {
+				c.ClientIDs[id] = true
+			}
+		}
+	}
+	if f.OlderThan > 0 {
+		c.CreatedBefore = b.clock.Now().Add(-f.OlderThan)
+	}
+	return c
+}
+
+// clientIPs returns the IP of each connected client by client ID
+func (b *Broadcaster) clientIPs() map[string]string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	ips := make(map[string]string, len(b.clients))
+	for id, client := range b.clients {
+		ips[id] = client.IP
+	}
+	return ips
+}
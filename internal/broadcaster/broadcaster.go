@@ -1,18 +1,27 @@
 package broadcaster
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
+	"fmt"
+	"math/big"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"hlnode-websocket/internal/clock"
+	"hlnode-websocket/internal/compat"
+	"hlnode-websocket/internal/labels"
 	"hlnode-websocket/internal/logger"
 	"hlnode-websocket/internal/metrics"
+	"hlnode-websocket/internal/recovery"
 	"hlnode-websocket/internal/rpc"
 	"hlnode-websocket/internal/subscription"
+	"hlnode-websocket/internal/usage"
 
 	"github.com/gorilla/websocket"
 )
@@ -22,24 +31,71 @@ type ClientInfo struct {
 	ID            string    `json:"id"`
 	IP            string    `json:"ip"`
 	UserAgent     string    `json:"userAgent"`
+	Class         string    `json:"class,omitempty"`
+	Identity      string    `json:"identity,omitempty"`
 	ConnectedAt   time.Time `json:"connectedAt"`
 	Subscriptions []string  `json:"subscriptions"`
 	MessagesSent  int64     `json:"messagesSent"`
 	MessagesRecv  int64     `json:"messagesReceived"`
+	SlowRequests  int64     `json:"slowRequests"`
 }
 
+// Client classes, selected with the X-Client-Class upgrade header or the
+// clientClass query parameter (browsers cannot set upgrade headers)
+const (
+	ClientClassServer  = "server"
+	ClientClassBrowser = "browser"
+	ClientClassMobile  = "mobile"
+)
+
+// Keepalive is the frame-level keepalive of a connection: a ping is sent
+// every PingInterval and the connection is dropped when nothing, pongs
+// included, is received for PongTimeout
+type Keepalive struct {
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+}
+
+// DefaultNotificationErrorLimit is the number of consecutive notifications
+// that can't be created after which a subscription is removed
+const DefaultNotificationErrorLimit = 3
+
+// DefaultKeepalive is the keepalive of clients without a configured class
+var DefaultKeepalive = Keepalive{PingInterval: 30 * time.Second, PongTimeout: 60 * time.Second}
+
 // Client represents a WebSocket client
 type Client struct {
 	ID          string
 	IP          string
 	UserAgent   string
 	ConnectedAt time.Time
-	conn        *websocket.Conn
-	send        chan []byte
-	closed      atomic.Bool
-	msgSent     atomic.Int64
-	msgRecv     atomic.Int64
-	mu          sync.Mutex
+	IsAdmin     bool
+	// RequestTimeout is the client's per-request budget (X-Request-Timeout header)
+	RequestTimeout time.Duration
+	// Class is the client class the connection announced, if known
+	Class string
+	// Keepalive is the ping interval and pong timeout of the connection
+	Keepalive Keepalive
+	// Identity is the subject of the client's verified TLS certificate, if any
+	Identity string
+	// APIKey identifies the client in usage reports (X-API-Key header or apiKey
+	// query parameter, else its certificate identity)
+	APIKey string
+	// Usage, if set, records the client's requests, notifications and bytes sent
+	Usage *usage.Table
+	// quota, if set, limits the client's requests and bytes sent per window
+	quota  *quotaUsage
+	ctx    context.Context
+	cancel context.CancelFunc
+	conn   *websocket.Conn
+	send   chan []byte
+	// registered is closed once Run has added the client
+	registered chan struct{}
+	closed     atomic.Bool
+	msgSent    atomic.Int64
+	msgRecv    atomic.Int64
+	slowReqs   atomic.Int64
+	mu         sync.Mutex
 }
 
 // Broadcaster manages WebSocket clients and broadcasts messages
@@ -49,21 +105,145 @@ type Broadcaster struct {
 	unregister chan *Client
 	subManager *subscription.Manager
 	mu         sync.RWMutex
+	done       chan struct{}
+	stopOnce   sync.Once
+
+	totalConnections     atomic.Int64
+	totalDisconnections  atomic.Int64
+	totalMessagesSent    atomic.Int64
+	totalMessagesDropped atomic.Int64
+
+	testCounter atomic.Int64
+
+	// lastGasPrice tracks the last price of each block type sent to each gasPrice subscription
+	lastGasPrice   map[gasPriceKey]*big.Int
+	lastGasPriceMu sync.Mutex
+
+	// lastHead is the latest block header, sent to new newHeads subscribers right away
+	lastHead *rpc.FullBlockHeader
+	// lastBaseFee is the base fee last sent to baseFee subscribers
+	lastBaseFee string
+	headMu      sync.RWMutex
+
+	// lastSync is the latest sync status, sent to new syncing subscribers right away
+	lastSync *rpc.SyncStatus
+	syncMu   sync.RWMutex
+
+	// compat shapes notifications and responses after a given provider
+	compat compat.Flags
+
+	// deltaSnapshotInterval is how many notifications of a delta newHeads
+	// subscription are sent between full snapshots
+	deltaSnapshotInterval int
+
+	// notificationErrorLimit is the number of consecutive notifications that
+	// can't be created after which a subscription is removed (0 never removes)
+	notificationErrorLimit int
+
+	// bigBlockMinGasLimit is the gas limit from which a block is a big block,
+	// left out of newHeads (0 treats every block as small)
+	bigBlockMinGasLimit uint64
+
+	// txMined holds the receipt of each txConfirmation subscription's mined transaction
+	txMined   map[string]*rpc.TransactionReceipt
+	txMinedMu sync.Mutex
 
-	totalConnections    atomic.Int64
-	totalDisconnections atomic.Int64
+	// confirmBuf holds recent blocks for subscriptions with a confirmation delay
+	confirmBuf map[uint64]*confirmedBlock
+	confirmMu  sync.Mutex
+
+	// lastBalance is the last native balance seen for each address watched by balanceChanges subscriptions
+	lastBalance   map[string]string
+	lastBalanceMu sync.Mutex
+
+	// lastNonce is the last nonce seen for each address watched by nonceChanges subscriptions
+	lastNonce   map[string]string
+	lastNonceMu sync.Mutex
+
+	// labels annotates notifications of subscriptions with the addressLabels option
+	labels *labels.Registry
+
+	// clock drives throttling and heartbeat bookkeeping, and the tickers of pollers using Clock
+	clock clock.Clock
+}
+
+// gasPriceKey identifies the price of one block type sent to a gasPrice subscription
+type gasPriceKey struct {
+	subID     string
+	blockType string
+}
+
+// confirmedBlock is a buffered block awaiting delivery to delayed subscribers
+type confirmedBlock struct {
+	header *rpc.FullBlockHeader
+	logs   []*rpc.Log
 }
 
 // NewBroadcaster creates a new broadcaster instance
 func NewBroadcaster() *Broadcaster {
 	return &Broadcaster{
-		clients:    make(map[string]*Client),
-		register:   make(chan *Client, 1000),
-		unregister: make(chan *Client, 1000),
-		subManager: subscription.NewManager(),
+		clients:      make(map[string]*Client),
+		register:     make(chan *Client, 1000),
+		unregister:   make(chan *Client, 1000),
+		done:         make(chan struct{}),
+		subManager:   subscription.NewManager(),
+		confirmBuf:   make(map[uint64]*confirmedBlock),
+		lastGasPrice: make(map[gasPriceKey]*big.Int),
+		txMined:      make(map[string]*rpc.TransactionReceipt),
+		lastBalance:  make(map[string]string),
+		lastNonce:    make(map[string]string),
+		clock:        clock.Real,
+
+		deltaSnapshotInterval:  subscription.DefaultDeltaSnapshotInterval,
+		notificationErrorLimit: DefaultNotificationErrorLimit,
 	}
 }
 
+// SetClock replaces the clock of the broadcaster and its subscription
+// manager, e.g. with a clock.Fake in tests. Must be called before Run.
+func (b *Broadcaster) SetClock(c clock.Clock) {
+	b.clock = c
+	b.subManager.SetClock(c)
+}
+
+// Clock returns the clock of the broadcaster
+func (b *Broadcaster) Clock() clock.Clock {
+	return b.clock
+}
+
+// SetCompat makes notifications, subscription IDs and the handlers' own
+// responses follow the compatibility flags. Must be called before Run.
+func (b *Broadcaster) SetCompat(flags compat.Flags) {
+	b.compat = flags
+	b.subManager.SetIDFormat(flags.SubscriptionIDBytes, flags.TrimSubscriptionID)
+}
+
+// SetDeltaSnapshotInterval sets how many notifications of a delta newHeads
+// subscription are sent between full snapshots. Must be called before Run.
+func (b *Broadcaster) SetDeltaSnapshotInterval(n int) {
+	if n > 0 {
+		b.deltaSnapshotInterval = n
+	}
+}
+
+// SetNotificationErrorLimit sets the number of consecutive notifications that
+// can't be created after which a subscription is removed; 0 never removes
+// one. Must be called before Run.
+func (b *Broadcaster) SetNotificationErrorLimit(n int) {
+	b.notificationErrorLimit = max(n, 0)
+}
+
+// SetBigBlockMinGasLimit sets the gas limit from which a block is a big
+// block, sent to hl_bigBlocks but not newHeads. Must be called before Run.
+func (b *Broadcaster) SetBigBlockMinGasLimit(limit uint64) {
+	b.bigBlockMinGasLimit = limit
+}
+
+// Compat returns the compatibility flags in effect
+func (b *Broadcaster) Compat() compat.Flags {
+	return b.compat
+}
+
 // NewClient creates a new WebSocket client with metadata
 func NewClient(conn *websocket.Conn, r *http.Request) *Client {
 	ip := r.Header.Get("X-Real-IP")
@@ -74,13 +254,40 @@ func NewClient(conn *websocket.Conn, r *http.Request) *Client {
 		ip = r.RemoteAddr
 	}
 
+	var requestTimeout time.Duration
+	if value := r.Header.Get("X-Request-Timeout"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			requestTimeout = d
+		}
+	}
+
+	class := r.Header.Get("X-Client-Class")
+	if class == "" {
+		class = r.URL.Query().Get("clientClass")
+	}
+	switch class = strings.ToLower(class); class {
+	case ClientClassServer, ClientClassBrowser, ClientClassMobile:
+	default:
+		class = ""
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &Client{
-		ID:          generateClientID(),
-		IP:          ip,
-		UserAgent:   r.UserAgent(),
-		ConnectedAt: time.Now(),
-		conn:        conn,
-		send:        make(chan []byte, 512),
+		APIKey:         UsageKey(r),
+		Identity:       ClientIdentity(r),
+		ID:             generateClientID(),
+		IP:             ip,
+		UserAgent:      r.UserAgent(),
+		ConnectedAt:    time.Now(),
+		RequestTimeout: requestTimeout,
+		Class:          class,
+		Keepalive:      DefaultKeepalive,
+		ctx:            ctx,
+		cancel:         cancel,
+		conn:           conn,
+		send:           make(chan []byte, 512),
+		registered:     make(chan struct{}),
 	}
 }
 
@@ -92,6 +299,7 @@ func (b *Broadcaster) Run() {
 			b.mu.Lock()
 			b.clients[client.ID] = client
 			b.mu.Unlock()
+			close(client.registered)
 			b.totalConnections.Add(1)
 
 			metrics.WSActiveConnections.Inc()
@@ -113,18 +321,62 @@ func (b *Broadcaster) Run() {
 			metrics.WSDisconnectionsTotal.Inc()
 
 			logger.Info("Client %s disconnected (total: %d)", client.ID, len(b.clients))
+
+		case <-b.done:
+			b.closeAll()
+			return
 		}
 	}
 }
 
-// Register adds a client to the broadcaster
+// Stop makes Run return, closing the send channel of every client so their
+// write pumps exit. Clients registered afterwards are closed right away.
+func (b *Broadcaster) Stop() {
+	b.stopOnce.Do(func() { close(b.done) })
+}
+
+// closeAll closes pending and registered clients once Run is stopping
+func (b *Broadcaster) closeAll() {
+	for {
+		select {
+		case client := <-b.register:
+			close(client.send)
+		default:
+			b.mu.Lock()
+			for id, client := range b.clients {
+				delete(b.clients, id)
+				close(client.send)
+				b.subManager.UnsubscribeAll(id)
+			}
+			b.mu.Unlock()
+			return
+		}
+	}
+}
+
+// Register adds a client to the broadcaster, returning once notifications
+// can reach it
 func (b *Broadcaster) Register(client *Client) {
-	b.register <- client
+	select {
+	case <-b.done:
+		close(client.send)
+		return
+	default:
+		b.register <- client
+	}
+
+	select {
+	case <-client.registered:
+	case <-b.done:
+	}
 }
 
 // Unregister removes a client from the broadcaster
 func (b *Broadcaster) Unregister(client *Client) {
-	b.unregister <- client
+	select {
+	case <-b.done:
+	case b.unregister <- client:
+	}
 }
 
 // SubscriptionManager returns the subscription manager
@@ -148,10 +400,13 @@ func (b *Broadcaster) GetClientInfo(clientID string) *ClientInfo {
 		ID:            client.ID,
 		IP:            client.IP,
 		UserAgent:     client.UserAgent,
+		Class:         client.Class,
+		Identity:      client.Identity,
 		ConnectedAt:   client.ConnectedAt,
 		Subscriptions: subs,
 		MessagesSent:  client.msgSent.Load(),
 		MessagesRecv:  client.msgRecv.Load(),
+		SlowRequests:  client.slowReqs.Load(),
 	}
 }
 
@@ -171,10 +426,13 @@ func (b *Broadcaster) GetAllClientsInfo() []ClientInfo {
 			ID:            client.ID,
 			IP:            client.IP,
 			UserAgent:     client.UserAgent,
+			Class:         client.Class,
+			Identity:      client.Identity,
 			ConnectedAt:   client.ConnectedAt,
 			Subscriptions: subs,
 			MessagesSent:  client.msgSent.Load(),
 			MessagesRecv:  client.msgRecv.Load(),
+			SlowRequests:  client.slowReqs.Load(),
 		})
 	}
 	return infos
@@ -199,8 +457,98 @@ func (b *Broadcaster) GetStats() Stats {
 	}
 }
 
+// sendToSubscription delivers a notification for a subscription, queueing it
+// instead if the subscription is currently held. Notifications for paused or
+// throttled subscriptions are dropped.
+func (b *Broadcaster) sendToSubscription(sub *subscription.Subscription, data []byte) bool {
+	if sub.Paused() {
+		sub.ResetDelta()
+		return false
+	}
+	now := b.clock.Now()
+	if sub.Throttle(now) {
+		metrics.WSThrottledNotifications.WithLabelValues(string(sub.Type)).Inc()
+		sub.ResetDelta()
+		return false
+	}
+	data = sub.Receive(data, now)
+	if sub.Enqueue(data) {
+		return false
+	}
+	return b.Deliver(sub, data)
+}
+
+// Deliver sends a notification for a subscription right away, stamped with
+// its next sequence number, bypassing the held, paused and throttled states
+func (b *Broadcaster) Deliver(sub *subscription.Subscription, data []byte) bool {
+	data = sub.Receive(data, b.clock.Now())
+	sent := sub.Sequence(data, func(stamped []byte) bool {
+		return b.sendToClient(sub.ClientID, stamped, true)
+	})
+	if sent {
+		sub.MarkSent(b.clock.Now())
+	} else {
+		// The client missed this notification, so a delta can't follow it
+		sub.ResetDelta()
+	}
+	return sent
+}
+
+// ReleaseSubscription ends the held state of a subscription and flushes
+// the notifications queued in the meantime. Logs up to backfilledTo were
+// already delivered by the backfill and are dropped.
+func (b *Broadcaster) ReleaseSubscription(clientID, subID string, backfilledTo uint64) {
+	sub, exists := b.subManager.Get(subID)
+	if !exists {
+		return
+	}
+	for _, data := range b.subManager.Release(subID) {
+		if block, ok := subscription.NotificationLogBlock(data); ok && block <= backfilledTo {
+			continue
+		}
+		b.Deliver(sub, data)
+	}
+}
+
+// MetricsSnapshot is a compact view of key stats for the proxyMetrics subscription
+type MetricsSnapshot struct {
+	Timestamp           int64          `json:"timestamp"`
+	ActiveConnections   int            `json:"activeConnections"`
+	TotalConnections    int64          `json:"totalConnections"`
+	TotalDisconnections int64          `json:"totalDisconnections"`
+	MessagesSent        int64          `json:"messagesSent"`
+	MessagesDropped     int64          `json:"messagesDropped"`
+	Subscriptions       map[string]int `json:"subscriptions"`
+}
+
+// GetMetricsSnapshot returns the current metrics snapshot
+func (b *Broadcaster) GetMetricsSnapshot() *MetricsSnapshot {
+	stats := b.GetStats()
+
+	subs := make(map[string]int)
+	for subType, count := range b.subManager.CountByType() {
+		subs[string(subType)] = count
+	}
+
+	return &MetricsSnapshot{
+		Timestamp:           time.Now().UnixMilli(),
+		ActiveConnections:   stats.ActiveClients,
+		TotalConnections:    stats.TotalConnections,
+		TotalDisconnections: stats.TotalDisconnections,
+		MessagesSent:        b.totalMessagesSent.Load(),
+		MessagesDropped:     b.totalMessagesDropped.Load(),
+		Subscriptions:       subs,
+	}
+}
+
 // SendToClient sends a message to a specific client by ID
 func (b *Broadcaster) SendToClient(clientID string, data []byte) bool {
+	return b.sendToClient(clientID, data, false)
+}
+
+// sendToClient sends a message to a client, counting it in the client's
+// usage when it is a subscription notification
+func (b *Broadcaster) sendToClient(clientID string, data []byte, notification bool) bool {
 	b.mu.RLock()
 	client, ok := b.clients[clientID]
 	b.mu.RUnlock()
@@ -208,84 +556,700 @@ func (b *Broadcaster) SendToClient(clientID string, data []byte) bool {
 	if !ok {
 		return false
 	}
+	if notification && client.bandwidthExhausted() {
+		metrics.WSQuotaExceeded.WithLabelValues(QuotaBytes).Inc()
+		b.totalMessagesDropped.Add(1)
+		return false
+	}
 
 	select {
 	case client.send <- data:
 		client.msgSent.Add(1)
+		b.totalMessagesSent.Add(1)
 		metrics.WSMessagesSent.Inc()
+		if notification {
+			client.RecordUsage(0, 1, 0)
+		}
 		return true
 	default:
+		b.totalMessagesDropped.Add(1)
 		return false
 	}
 }
 
-// BroadcastNewHead sends a new block header to all newHeads subscribers
+// SetAddressLabels sets the registry used to annotate the notifications of
+// subscriptions with the addressLabels option
+func (b *Broadcaster) SetAddressLabels(registry *labels.Registry) {
+	b.labels = registry
+}
+
+// NotificationFailed logs a notification that could not be created for a
+// subscription. After notificationErrorLimit consecutive failures the
+// subscription is removed with a final error notification, instead of failing
+// on every event for as long as the client stays connected. It reports
+// whether the subscription was removed.
+func (b *Broadcaster) NotificationFailed(sub *subscription.Subscription, err error) bool {
+	logger.Error("Failed to create %s notification for subscription %s: %v", sub.Type, sub.ID, err)
+	metrics.WSNotificationErrors.WithLabelValues(string(sub.Type)).Inc()
+	failures := sub.Failures()
+	if b.notificationErrorLimit == 0 || failures < b.notificationErrorLimit {
+		return false
+	}
+
+	message := fmt.Sprintf("subscription removed: %d consecutive notifications could not be created: %v", failures, err)
+	if data, err := sub.ErrorNotification(rpc.ErrCodeInternalError, message); err == nil {
+		b.Deliver(sub, data)
+	}
+	if b.subManager.Unsubscribe(sub.ClientID, sub.ID) {
+		metrics.WSSubscriptionsFailed.WithLabelValues(string(sub.Type)).Inc()
+		logger.Warn("Subscription %s of client %s removed after %d consecutive notification errors", sub.ID, sub.ClientID, failures)
+	}
+	return true
+}
+
+// Notification creates a notification for a subscription, with the labels of
+// the given addresses if it asked for them
+func (b *Broadcaster) Notification(sub *subscription.Subscription, result interface{}, addresses ...string) ([]byte, error) {
+	if !sub.Options.AddressLabels || b.labels == nil {
+		return sub.Notification(result)
+	}
+	return sub.LabeledNotification(result, b.labels.Lookup(addresses...))
+}
+
+// BroadcastNewHead sends a new block header to all newHeads subscribers,
+// and its minimal form to newHeadsLite subscribers.
+// Subscribers with a confirmation delay of N receive the header of block
+// head-N instead, along with that block's logs for delayed logs subscribers.
 func (b *Broadcaster) BroadcastNewHead(header *rpc.FullBlockHeader) {
-	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeNewHeads)
-	if len(subs) == 0 {
+	blockNum, err := rpc.ParseHexUint64(header.Number)
+
+	// newHeads stays small-block only; a big block still releases the logs
+	// confirmed at its height
+	if b.bigBlockMinGasLimit > 0 && header.IsBigBlock(b.bigBlockMinGasLimit) {
+		if err == nil {
+			b.broadcastConfirmedLogs(blockNum)
+		}
 		return
 	}
 
+	b.headMu.Lock()
+	b.lastHead = header
+	baseFeeChanged := header.BaseFeePerGas != "" && header.BaseFeePerGas != b.lastBaseFee
+	if baseFeeChanged {
+		b.lastBaseFee = header.BaseFeePerGas
+	}
+	b.headMu.Unlock()
+
+	if baseFeeChanged {
+		b.broadcastBaseFee(header.BaseFee())
+	}
+
+	if err == nil {
+		b.bufferHeader(blockNum, header)
+	}
+
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeNewHeads)
+	subs = append(subs, b.subManager.GetSubscriptionsByType(subscription.SubTypeNewHeadsLite)...)
 	for _, sub := range subs {
-		data, err := subscription.CreateNotification(sub.ID, header)
+		result, ok := b.headResult(sub, header)
+		if !ok {
+			continue
+		}
+		data, err := sub.Notification(result)
 		if err != nil {
-			logger.Error("Failed to create notification: %v", err)
+			b.NotificationFailed(sub, err)
 			continue
 		}
-		if b.SendToClient(sub.ClientID, data) {
+		if b.sendToSubscription(sub, data) {
 			metrics.WSBlockNotificationsSent.Inc()
 		}
 	}
+
+	if err == nil {
+		b.broadcastConfirmedLogs(blockNum)
+	}
 }
 
-// BroadcastLog sends logs to subscribers matching their filters
-func (b *Broadcaster) BroadcastLog(logEntry *rpc.Log) {
-	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeLogs)
+// SendLatestHead sends the last header passed to BroadcastNewHead to a new
+// newHeads or newHeadsLite subscription, so it knows the chain tip without
+// waiting for the next block. Returns false if there is no head yet.
+func (b *Broadcaster) SendLatestHead(sub *subscription.Subscription) bool {
+	b.headMu.RLock()
+	header := b.lastHead
+	b.headMu.RUnlock()
+	if header == nil {
+		return false
+	}
+
+	result, ok := b.headResult(sub, header)
+	if !ok {
+		return false
+	}
+	data, err := sub.Notification(result)
+	if err != nil {
+		b.NotificationFailed(sub, err)
+		return false
+	}
+	if !b.Deliver(sub, data) {
+		return false
+	}
+	metrics.WSBlockNotificationsSent.Inc()
+	return true
+}
+
+// broadcastBaseFee sends a changed base fee to baseFee subscribers
+func (b *Broadcaster) broadcastBaseFee(baseFee *rpc.BaseFee) {
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeBaseFee)
+	for _, sub := range subs {
+		data, err := sub.Notification(baseFee)
+		if err != nil {
+			b.NotificationFailed(sub, err)
+			continue
+		}
+		if b.sendToSubscription(sub, data) {
+			metrics.WSBaseFeeNotificationsSent.Inc()
+		}
+	}
+}
+
+// SendLatestBaseFee sends the base fee of the latest head to a new baseFee
+// subscription. Returns false if there is no head with a base fee yet.
+func (b *Broadcaster) SendLatestBaseFee(sub *subscription.Subscription) bool {
+	b.headMu.RLock()
+	header := b.lastHead
+	b.headMu.RUnlock()
+	if header == nil || header.BaseFee() == nil {
+		return false
+	}
+
+	data, err := sub.Notification(header.BaseFee())
+	if err != nil {
+		b.NotificationFailed(sub, err)
+		return false
+	}
+	if !b.Deliver(sub, data) {
+		return false
+	}
+	metrics.WSBaseFeeNotificationsSent.Inc()
+	return true
+}
+
+// headResult returns the notification result of head for sub: the header of
+// block head-N for a confirmation delay of N, in the subscription's form.
+// Returns false if the delayed block isn't buffered.
+func (b *Broadcaster) headResult(sub *subscription.Subscription, head *rpc.FullBlockHeader) (interface{}, bool) {
+	header := head
+	if confirmations := uint64(sub.Options.Confirmations); confirmations > 0 {
+		blockNum, err := rpc.ParseHexUint64(head.Number)
+		if err != nil || blockNum < confirmations {
+			return nil, false
+		}
+		block := b.bufferedBlock(blockNum - confirmations)
+		if block == nil || block.header == nil {
+			return nil, false
+		}
+		header = block.header
+	}
+
+	var result interface{} = header
+	if sub.Type == subscription.SubTypeNewHeadsLite {
+		result = header.Lite()
+	} else if sub.Options.Stats {
+		result = &rpc.HeaderWithStats{FullBlockHeader: header, Stats: header.Stats}
+	}
+	if sub.Options.Delta {
+		return sub.Delta(result, b.deltaSnapshotInterval), true
+	}
+	return result, true
+}
+
+// BroadcastBigBlock sends a big block header to hl_bigBlocks subscribers
+func (b *Broadcaster) BroadcastBigBlock(header *rpc.BigBlockHeader) {
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeBigBlocks)
+	for _, sub := range subs {
+		data, err := sub.Notification(header)
+		if err != nil {
+			b.NotificationFailed(sub, err)
+			continue
+		}
+		if b.sendToSubscription(sub, data) {
+			metrics.WSBigBlockNotificationsSent.Inc()
+		}
+	}
+}
+
+// BroadcastSystemTxs sends each system transaction of a block to hl_systemTxs subscribers
+func (b *Broadcaster) BroadcastSystemTxs(systemTxs []rpc.SystemTx) {
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeSystemTxs)
+	for _, sub := range subs {
+		for i := range systemTxs {
+			data, err := b.Notification(sub, &systemTxs[i], systemTxs[i].From, systemTxs[i].To)
+			if err != nil {
+				if b.NotificationFailed(sub, err) {
+					break
+				}
+				continue
+			}
+			if b.sendToSubscription(sub, data) {
+				metrics.WSSystemTxNotificationsSent.Inc()
+			}
+		}
+	}
+}
+
+// BroadcastReorg sends a reorg to reorg subscribers. Buffered replaced blocks
+// are dropped so delayed subscribers never receive them.
+func (b *Broadcaster) BroadcastReorg(reorg *rpc.Reorg) {
+	b.confirmMu.Lock()
+	for _, block := range reorg.ReplacedBlocks {
+		if blockNum, err := rpc.ParseHexUint64(block.Number); err == nil {
+			delete(b.confirmBuf, blockNum)
+		}
+	}
+	b.confirmMu.Unlock()
+
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeReorg)
+	for _, sub := range subs {
+		data, err := sub.Notification(reorg)
+		if err != nil {
+			b.NotificationFailed(sub, err)
+			continue
+		}
+		if b.sendToSubscription(sub, data) {
+			metrics.WSReorgNotificationsSent.Inc()
+		}
+	}
+}
+
+// BroadcastTokenTransfers decodes the token transfers of a block's logs and
+// sends each one to the tokenTransfers subscribers whose filter matches
+func (b *Broadcaster) BroadcastTokenTransfers(logs []rpc.Log) {
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeTokenTransfers)
 	if len(subs) == 0 {
 		return
 	}
 
+	var transfers []rpc.TokenTransfer
+	for i := range logs {
+		transfers = append(transfers, rpc.DecodeTokenTransfers(&logs[i])...)
+	}
+	if len(transfers) == 0 {
+		return
+	}
+
 	for _, sub := range subs {
-		var filter subscription.LogFilter
-		if len(sub.Params) > 0 {
-			json.Unmarshal(sub.Params, &filter)
+		filter, _ := subscription.ParseTokenTransferFilter(sub.Params)
+		for i := range transfers {
+			if !subscription.MatchesTokenTransferFilter(&transfers[i], filter) {
+				continue
+			}
+			data, err := b.Notification(sub, &transfers[i], transfers[i].Token, transfers[i].From, transfers[i].To)
+			if err != nil {
+				if b.NotificationFailed(sub, err) {
+					break
+				}
+				continue
+			}
+			if b.sendToSubscription(sub, data) {
+				metrics.WSTokenTransferNotificationsSent.Inc()
+			}
 		}
+	}
+}
 
-		if !subscription.MatchesLogFilter(logEntry, &filter) {
+// WatchedBalanceAddresses returns the addresses watched by balanceChanges
+// subscriptions, and forgets the last balance of addresses no longer watched
+func (b *Broadcaster) WatchedBalanceAddresses() map[string]bool {
+	watched := make(map[string]bool)
+	for _, sub := range b.subManager.GetSubscriptionsByType(subscription.SubTypeBalanceChanges) {
+		filter, err := subscription.ParseBalanceFilter(sub.Params)
+		if err != nil {
 			continue
 		}
+		for _, addr := range filter.Address {
+			watched[addr] = true
+		}
+	}
+
+	b.lastBalanceMu.Lock()
+	for addr := range b.lastBalance {
+		if !watched[addr] {
+			delete(b.lastBalance, addr)
+		}
+	}
+	b.lastBalanceMu.Unlock()
+	return watched
+}
+
+// LastBalance returns the last balance seen for a watched address
+func (b *Broadcaster) LastBalance(address string) (string, bool) {
+	b.lastBalanceMu.Lock()
+	defer b.lastBalanceMu.Unlock()
+	balance, ok := b.lastBalance[address]
+	return balance, ok
+}
 
-		data, err := subscription.CreateNotification(sub.ID, logEntry)
+// BroadcastBalanceChange records an address's balance and, if it differs from
+// the previous one, notifies the balanceChanges subscribers watching it
+func (b *Broadcaster) BroadcastBalanceChange(change *rpc.BalanceChange) {
+	b.lastBalanceMu.Lock()
+	b.lastBalance[change.Address] = change.Balance
+	b.lastBalanceMu.Unlock()
+
+	if change.PreviousBalance == change.Balance {
+		return
+	}
+
+	for _, sub := range b.subManager.GetSubscriptionsByType(subscription.SubTypeBalanceChanges) {
+		filter, err := subscription.ParseBalanceFilter(sub.Params)
+		if err != nil || !containsString(filter.Address, change.Address) {
+			continue
+		}
+		data, err := b.Notification(sub, change, change.Address)
 		if err != nil {
-			logger.Error("Failed to create log notification: %v", err)
+			b.NotificationFailed(sub, err)
 			continue
 		}
-		if b.SendToClient(sub.ClientID, data) {
-			metrics.WSLogNotificationsSent.Inc()
+		if b.sendToSubscription(sub, data) {
+			metrics.WSBalanceChangeNotificationsSent.Inc()
 		}
 	}
 }
 
-// BroadcastGasPrice sends gas price updates to subscribers
-func (b *Broadcaster) BroadcastGasPrice(gasPriceInfo *rpc.GasPriceInfo) {
-	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeGasPrice)
-	if len(subs) == 0 {
+// WatchedNonceAddresses returns the addresses watched by nonceChanges
+// subscriptions, and forgets the last nonce of addresses no longer watched
+func (b *Broadcaster) WatchedNonceAddresses() map[string]bool {
+	watched := make(map[string]bool)
+	for _, sub := range b.subManager.GetSubscriptionsByType(subscription.SubTypeNonceChanges) {
+		filter, err := subscription.ParseNonceFilter(sub.Params)
+		if err != nil {
+			continue
+		}
+		for _, addr := range filter.Address {
+			watched[addr] = true
+		}
+	}
+
+	b.lastNonceMu.Lock()
+	for addr := range b.lastNonce {
+		if !watched[addr] {
+			delete(b.lastNonce, addr)
+		}
+	}
+	b.lastNonceMu.Unlock()
+	return watched
+}
+
+// LastNonce returns the last nonce seen for a watched address
+func (b *Broadcaster) LastNonce(address string) (string, bool) {
+	b.lastNonceMu.Lock()
+	defer b.lastNonceMu.Unlock()
+	nonce, ok := b.lastNonce[address]
+	return nonce, ok
+}
+
+// BroadcastNonceChange records an address's nonce and, if it differs from
+// the previous one, notifies the nonceChanges subscribers watching it
+func (b *Broadcaster) BroadcastNonceChange(change *rpc.NonceChange) {
+	b.lastNonceMu.Lock()
+	b.lastNonce[change.Address] = change.Nonce
+	b.lastNonceMu.Unlock()
+
+	if change.PreviousNonce == change.Nonce {
+		return
+	}
+
+	for _, sub := range b.subManager.GetSubscriptionsByType(subscription.SubTypeNonceChanges) {
+		filter, err := subscription.ParseNonceFilter(sub.Params)
+		if err != nil || !containsString(filter.Address, change.Address) {
+			continue
+		}
+		data, err := b.Notification(sub, change, change.Address)
+		if err != nil {
+			b.NotificationFailed(sub, err)
+			continue
+		}
+		if b.sendToSubscription(sub, data) {
+			metrics.WSNonceChangeNotificationsSent.Inc()
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// BroadcastLog sends logs to subscribers matching their filters.
+// Subscribers with a confirmation delay receive it from BroadcastNewHead later.
+func (b *Broadcaster) BroadcastLog(logEntry *rpc.Log) {
+	if blockNum, err := rpc.ParseHexUint64(logEntry.BlockNumber); err == nil {
+		b.bufferLog(blockNum, logEntry)
+	}
+
+	// Dedup subscriptions matching the log are grouped by client and notified once
+	var deduped map[string][]*subscription.Subscription
+	var clients []string
+
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeLogs)
+	for _, sub := range subs {
+		if sub.Options.Confirmations > 0 {
+			continue
+		}
+		if !sub.Options.Dedup {
+			b.sendLog(sub, logEntry)
+			continue
+		}
+		if !matchesLog(sub, logEntry) {
+			continue
+		}
+		if deduped == nil {
+			deduped = make(map[string][]*subscription.Subscription)
+		}
+		if _, ok := deduped[sub.ClientID]; !ok {
+			clients = append(clients, sub.ClientID)
+		}
+		deduped[sub.ClientID] = append(deduped[sub.ClientID], sub)
+	}
+
+	for _, clientID := range clients {
+		group := deduped[clientID]
+		if len(group) == 1 {
+			b.sendLog(group[0], logEntry)
+			continue
+		}
+		b.sendMergedLog(group, logEntry)
+	}
+}
+
+// sendMergedLog sends a log once for several dedup subscriptions of a client
+func (b *Broadcaster) sendMergedLog(subs []*subscription.Subscription, logEntry *rpc.Log) {
+	// Address the notification to the oldest subscription, in creation order
+	order := make(map[string]int)
+	for i, subID := range b.subManager.GetClientSubscriptions(subs[0].ClientID) {
+		order[subID] = i
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return order[subs[i].ID] < order[subs[j].ID]
+	})
+
+	lead := subs[0]
+	var addressLabels map[string]rpc.AddressLabel
+	if lead.Options.AddressLabels && b.labels != nil {
+		addressLabels = b.labels.Lookup(logEntry.Address)
+	}
+
+	data, err := subscription.MergedNotification(subs, lead.LogResult(logEntry), addressLabels)
+	if err != nil {
+		b.NotificationFailed(lead, err)
 		return
 	}
+	if b.sendToSubscription(lead, data) {
+		metrics.WSLogNotificationsSent.Inc()
+		now := b.clock.Now()
+		for _, sub := range subs[1:] {
+			sub.MarkSent(now)
+		}
+	}
+}
 
+// broadcastConfirmedLogs delivers buffered logs to delayed logs subscribers
+// whose confirmation depth is reached at the given head
+func (b *Broadcaster) broadcastConfirmedLogs(head uint64) {
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeLogs)
 	for _, sub := range subs {
-		data, err := subscription.CreateNotification(sub.ID, gasPriceInfo)
+		confirmations := uint64(sub.Options.Confirmations)
+		if confirmations == 0 || head < confirmations {
+			continue
+		}
+		block := b.bufferedBlock(head - confirmations)
+		if block == nil {
+			continue
+		}
+		for _, logEntry := range block.logs {
+			b.sendLog(sub, logEntry)
+		}
+	}
+}
+
+// sendLog sends a log to a subscription if it matches the subscription's filter
+func (b *Broadcaster) sendLog(sub *subscription.Subscription, logEntry *rpc.Log) {
+	if !matchesLog(sub, logEntry) {
+		return
+	}
+
+	data, err := b.Notification(sub, sub.LogResult(logEntry), logEntry.Address)
+	if err != nil {
+		b.NotificationFailed(sub, err)
+		return
+	}
+	if b.sendToSubscription(sub, data) {
+		metrics.WSLogNotificationsSent.Inc()
+	}
+}
+
+// matchesLog reports whether a log matches a logs subscription's filters
+func matchesLog(sub *subscription.Subscription, logEntry *rpc.Log) bool {
+	filters, err := subscription.ParseLogFilters(sub.Params)
+	return err == nil && subscription.MatchesAnyLogFilter(logEntry, filters)
+}
+
+// bufferHeader stores a header for delayed delivery and prunes blocks
+// older than the deepest supported confirmation delay
+func (b *Broadcaster) bufferHeader(blockNum uint64, header *rpc.FullBlockHeader) {
+	b.confirmMu.Lock()
+	defer b.confirmMu.Unlock()
+
+	block, ok := b.confirmBuf[blockNum]
+	if !ok {
+		block = &confirmedBlock{}
+		b.confirmBuf[blockNum] = block
+	}
+	block.header = header
+
+	for num := range b.confirmBuf {
+		if num+subscription.MaxConfirmations < blockNum {
+			delete(b.confirmBuf, num)
+		}
+	}
+}
+
+// bufferLog stores a log for delayed delivery
+func (b *Broadcaster) bufferLog(blockNum uint64, logEntry *rpc.Log) {
+	b.confirmMu.Lock()
+	defer b.confirmMu.Unlock()
+
+	block, ok := b.confirmBuf[blockNum]
+	if !ok {
+		block = &confirmedBlock{}
+		b.confirmBuf[blockNum] = block
+	}
+	block.logs = append(block.logs, logEntry)
+}
+
+// bufferedBlock returns a snapshot of a buffered block by number
+func (b *Broadcaster) bufferedBlock(blockNum uint64) *confirmedBlock {
+	b.confirmMu.Lock()
+	defer b.confirmMu.Unlock()
+
+	block, ok := b.confirmBuf[blockNum]
+	if !ok {
+		return nil
+	}
+	return &confirmedBlock{
+		header: block.header,
+		logs:   append([]*rpc.Log(nil), block.logs...),
+	}
+}
+
+// BroadcastGasPrice sends gas price updates to subscribers.
+// Subscribers with a minChangePercent only receive prices that moved more
+// than the threshold from the last value of the same block type they were sent.
+func (b *Broadcaster) BroadcastGasPrice(gasPriceInfo *rpc.GasPriceInfo) {
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeGasPrice)
+
+	price, ok := new(big.Int).SetString(strings.TrimPrefix(gasPriceInfo.ChangedPrice(), "0x"), 16)
+
+	b.lastGasPriceMu.Lock()
+	defer b.lastGasPriceMu.Unlock()
+
+	active := make(map[string]bool, len(subs))
+	for _, sub := range subs {
+		active[sub.ID] = true
+		key := gasPriceKey{subID: sub.ID, blockType: gasPriceInfo.BlockType}
+
+		filter, _ := subscription.ParseGasPriceFilter(sub.Params)
+		if ok && filter != nil && !subscription.ExceedsChangeThreshold(b.lastGasPrice[key], price, filter.MinChangePercent) {
+			continue
+		}
+
+		data, err := sub.Notification(gasPriceInfo)
 		if err != nil {
-			logger.Error("Failed to create gas price notification: %v", err)
+			b.NotificationFailed(sub, err)
 			continue
 		}
-		if b.SendToClient(sub.ClientID, data) {
+		if b.sendToSubscription(sub, data) {
 			metrics.WSGasPriceNotificationsSent.Inc()
+			if ok {
+				b.lastGasPrice[key] = price
+			}
+		}
+	}
+
+	// Forget subscriptions that no longer exist
+	for key := range b.lastGasPrice {
+		if !active[key.subID] {
+			delete(b.lastGasPrice, key)
+		}
+	}
+}
+
+// SendGasPriceSnapshot sends the current gas prices to a new gasPrice
+// subscription and records them as the baseline of its minChangePercent filter
+func (b *Broadcaster) SendGasPriceSnapshot(sub *subscription.Subscription, gasPriceInfo *rpc.GasPriceInfo) bool {
+	data, err := sub.Notification(gasPriceInfo)
+	if err != nil {
+		b.NotificationFailed(sub, err)
+		return false
+	}
+	if !b.Deliver(sub, data) {
+		return false
+	}
+	metrics.WSGasPriceNotificationsSent.Inc()
+
+	b.lastGasPriceMu.Lock()
+	defer b.lastGasPriceMu.Unlock()
+	prices := map[string]string{rpc.BlockTypeSmall: gasPriceInfo.GasPrice, rpc.BlockTypeBig: gasPriceInfo.BigBlockGasPrice}
+	for blockType, hex := range prices {
+		if price, ok := new(big.Int).SetString(strings.TrimPrefix(hex, "0x"), 16); ok {
+			b.lastGasPrice[gasPriceKey{subID: sub.ID, blockType: blockType}] = price
+		}
+	}
+	return true
+}
+
+// BroadcastFeeHistory sends an eth_feeHistory result to the feeHistory
+// subscribers whose params ask for the window of filter
+func (b *Broadcaster) BroadcastFeeHistory(filter *subscription.FeeHistoryFilter, history *rpc.FeeHistory) {
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeFeeHistory)
+	for _, sub := range subs {
+		subFilter, err := subscription.ParseFeeHistoryFilter(sub.Params)
+		if err != nil || subFilter.Key() != filter.Key() {
+			continue
+		}
+		data, err := sub.Notification(history)
+		if err != nil {
+			b.NotificationFailed(sub, err)
+			continue
+		}
+		if b.sendToSubscription(sub, data) {
+			metrics.WSFeeHistoryNotificationsSent.Inc()
+		}
+	}
+}
+
+// BroadcastBlockStats sends per-block aggregates to blockStats subscribers
+func (b *Broadcaster) BroadcastBlockStats(summary *rpc.BlockSummary) {
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeBlockStats)
+	for _, sub := range subs {
+		data, err := sub.Notification(summary)
+		if err != nil {
+			b.NotificationFailed(sub, err)
+			continue
+		}
+		if b.sendToSubscription(sub, data) {
+			metrics.WSBlockStatsNotificationsSent.Inc()
 		}
 	}
 }
 
-// BroadcastBlockReceipts sends block receipts to subscribers
+// BroadcastBlockReceipts sends block receipts to subscribers.
+// Subscribers with an address filter only receive the matching receipts,
+// and no notification when none of the block's receipts match.
 func (b *Broadcaster) BroadcastBlockReceipts(receipts *rpc.BlockReceipts) {
 	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeBlockReceipts)
 	if len(subs) == 0 {
@@ -293,40 +1257,339 @@ func (b *Broadcaster) BroadcastBlockReceipts(receipts *rpc.BlockReceipts) {
 	}
 
 	for _, sub := range subs {
-		data, err := subscription.CreateNotification(sub.ID, receipts)
+		result := receipts
+		// Params were validated at subscribe
+		filter, err := subscription.ParseReceiptsFilter(sub.Params)
 		if err != nil {
-			logger.Error("Failed to create block receipts notification: %v", err)
 			continue
 		}
-		if b.SendToClient(sub.ClientID, data) {
+		if len(filter.Address) > 0 {
+			result = filterReceipts(receipts, filter)
+			if len(result.Receipts) == 0 {
+				continue
+			}
+		}
+
+		data, err := b.Notification(sub, result, receiptAddresses(result)...)
+		if err != nil {
+			b.NotificationFailed(sub, err)
+			continue
+		}
+		if b.sendToSubscription(sub, data) {
 			metrics.WSBlockReceiptsNotificationsSent.Inc()
 		}
 	}
 }
 
+// BroadcastTxConfirmations checks a block's receipts against txConfirmation
+// subscriptions. Each subscriber is notified when its transaction is mined and
+// again once the requested confirmation depth is reached, after which the
+// subscription is removed.
+func (b *Broadcaster) BroadcastTxConfirmations(receipts *rpc.BlockReceipts) {
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeTxConfirmation)
+
+	head, err := rpc.ParseHexUint64(receipts.BlockNumber)
+	if err != nil {
+		return
+	}
+
+	b.txMinedMu.Lock()
+	defer b.txMinedMu.Unlock()
+
+	active := make(map[string]bool, len(subs))
+	for _, sub := range subs {
+		active[sub.ID] = true
+
+		receipt := b.txMined[sub.ID]
+		if receipt == nil {
+			filter, err := subscription.ParseTxConfirmationFilter(sub.Params)
+			if err != nil {
+				continue
+			}
+			if receipt = findReceipt(receipts, filter.Hash); receipt != nil {
+				b.txMinedAt(sub, receipt, head)
+			}
+			continue
+		}
+		b.txConfirmedAt(sub, receipt, head)
+	}
+
+	// Forget subscriptions that no longer exist
+	for subID := range b.txMined {
+		if !active[subID] {
+			delete(b.txMined, subID)
+		}
+	}
+}
+
+// CheckTxConfirmation looks up the receipt of a txConfirmation subscription's
+// transaction with fetchReceipt unless it is already known to be mined, e.g.
+// at subscribe for a transaction mined earlier, and notifies the subscriber
+// if it is mined
+func (b *Broadcaster) CheckTxConfirmation(ctx context.Context, sub *subscription.Subscription, fetchReceipt func(context.Context, string) (*rpc.TransactionReceipt, error)) {
+	b.txMinedMu.Lock()
+	_, mined := b.txMined[sub.ID]
+	b.txMinedMu.Unlock()
+	if mined {
+		return
+	}
+
+	filter, err := subscription.ParseTxConfirmationFilter(sub.Params)
+	if err != nil {
+		return
+	}
+	receipt, err := fetchReceipt(ctx, filter.Hash)
+	if err != nil {
+		logger.Debug("Failed to fetch receipt of transaction %s: %v", filter.Hash, err)
+		return
+	}
+	if receipt == nil {
+		return
+	}
+	minedAt, err := rpc.ParseHexUint64(receipt.BlockNumber)
+	if err != nil {
+		return
+	}
+
+	head := minedAt
+	b.headMu.RLock()
+	if b.lastHead != nil {
+		if n, err := rpc.ParseHexUint64(b.lastHead.Number); err == nil && n > head {
+			head = n
+		}
+	}
+	b.headMu.RUnlock()
+
+	b.txMinedMu.Lock()
+	defer b.txMinedMu.Unlock()
+	// The receipt may have been found in a block meanwhile, or the subscription removed
+	if _, mined := b.txMined[sub.ID]; mined {
+		return
+	}
+	if _, exists := b.subManager.Get(sub.ID); !exists {
+		return
+	}
+	b.txMinedAt(sub, receipt, head)
+}
+
+// RecheckTxConfirmations runs CheckTxConfirmation for every txConfirmation
+// subscription, e.g. after a block's receipts couldn't be fetched, so a
+// transaction mined in that block is still reported
+func (b *Broadcaster) RecheckTxConfirmations(ctx context.Context, fetchReceipt func(context.Context, string) (*rpc.TransactionReceipt, error)) {
+	for _, sub := range b.subManager.GetSubscriptionsByType(subscription.SubTypeTxConfirmation) {
+		b.CheckTxConfirmation(ctx, sub, fetchReceipt)
+	}
+}
+
+// txMinedAt records a txConfirmation subscription's transaction as mined and
+// notifies the subscriber, then checks its depth against head.
+// Must be called with txMinedMu held.
+func (b *Broadcaster) txMinedAt(sub *subscription.Subscription, receipt *rpc.TransactionReceipt, head uint64) {
+	b.txMined[sub.ID] = receipt
+	b.sendTxConfirmation(sub, receipt, 0)
+	if sub.Options.Confirmations == 0 {
+		b.finishTxConfirmation(sub)
+		return
+	}
+	b.txConfirmedAt(sub, receipt, head)
+}
+
+// txConfirmedAt sends the final notification of a txConfirmation subscription
+// once head reaches the requested depth. Must be called with txMinedMu held.
+func (b *Broadcaster) txConfirmedAt(sub *subscription.Subscription, receipt *rpc.TransactionReceipt, head uint64) {
+	minedAt, err := rpc.ParseHexUint64(receipt.BlockNumber)
+	if err != nil || head < minedAt+uint64(sub.Options.Confirmations) {
+		return
+	}
+	b.sendTxConfirmation(sub, receipt, uint64(sub.Options.Confirmations))
+	b.finishTxConfirmation(sub)
+}
+
+// sendTxConfirmation notifies a txConfirmation subscriber of its transaction's depth
+func (b *Broadcaster) sendTxConfirmation(sub *subscription.Subscription, receipt *rpc.TransactionReceipt, confirmations uint64) {
+	result := &rpc.TxConfirmation{
+		TransactionHash: receipt.TransactionHash,
+		BlockNumber:     receipt.BlockNumber,
+		BlockHash:       receipt.BlockHash,
+		Confirmations:   rpc.FormatHexUint64(confirmations),
+		Receipt:         receipt,
+	}
+	data, err := b.Notification(sub, result, receipt.From, receipt.To, receipt.ContractAddress)
+	if err != nil {
+		b.NotificationFailed(sub, err)
+		return
+	}
+	if b.sendToSubscription(sub, data) {
+		metrics.WSTxConfirmationNotificationsSent.Inc()
+	}
+}
+
+// finishTxConfirmation removes a txConfirmation subscription once its last notification is sent.
+// Must be called with txMinedMu held.
+func (b *Broadcaster) finishTxConfirmation(sub *subscription.Subscription) {
+	b.subManager.Unsubscribe(sub.ClientID, sub.ID)
+	delete(b.txMined, sub.ID)
+}
+
+// findReceipt returns a copy of the receipt for the given lowercase transaction hash
+func findReceipt(receipts *rpc.BlockReceipts, hash string) *rpc.TransactionReceipt {
+	for i := range receipts.Receipts {
+		if strings.ToLower(receipts.Receipts[i].TransactionHash) == hash {
+			receipt := receipts.Receipts[i]
+			return &receipt
+		}
+	}
+	return nil
+}
+
+// receiptAddresses returns the sender, recipient and created contract of every
+// receipt in the block, whose address labels the notification carries
+func receiptAddresses(receipts *rpc.BlockReceipts) []string {
+	addresses := make([]string, 0, 3*len(receipts.Receipts))
+	for _, receipt := range receipts.Receipts {
+		addresses = append(addresses, receipt.From, receipt.To, receipt.ContractAddress)
+	}
+	return addresses
+}
+
+// filterReceipts returns a copy of the block receipts keeping only those matching the filter
+func filterReceipts(receipts *rpc.BlockReceipts, filter *subscription.ReceiptsFilter) *rpc.BlockReceipts {
+	filtered := &rpc.BlockReceipts{
+		BlockNumber: receipts.BlockNumber,
+		BlockHash:   receipts.BlockHash,
+		Receipts:    []rpc.TransactionReceipt{},
+	}
+	for i := range receipts.Receipts {
+		if subscription.MatchesReceiptsFilter(&receipts.Receipts[i], filter) {
+			filtered.Receipts = append(filtered.Receipts, receipts.Receipts[i])
+		}
+	}
+	return filtered
+}
+
 // BroadcastSyncing sends sync status updates to subscribers
 // Returns false if node is in sync, true if node is out of sync
 func (b *Broadcaster) BroadcastSyncing(syncStatus *rpc.SyncStatus) {
+	b.syncMu.Lock()
+	b.lastSync = syncStatus
+	b.syncMu.Unlock()
+
 	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeSyncing)
 	if len(subs) == 0 {
 		return
 	}
 
-	// Simple boolean: false = in sync, true = out of sync
-	result := syncStatus.Syncing
+	// false = in sync, true (or the sync progress) = out of sync
+	result := b.compat.SyncingResult(syncStatus)
 
 	for _, sub := range subs {
-		data, err := subscription.CreateNotification(sub.ID, result)
+		data, err := sub.Notification(result)
 		if err != nil {
-			logger.Error("Failed to create sync notification: %v", err)
+			b.NotificationFailed(sub, err)
 			continue
 		}
-		if b.SendToClient(sub.ClientID, data) {
+		if b.sendToSubscription(sub, data) {
 			metrics.WSSyncingNotificationsSent.Inc()
 		}
 	}
 }
 
+// LatestSyncStatus returns the last sync status passed to BroadcastSyncing, or nil if none yet
+func (b *Broadcaster) LatestSyncStatus() *rpc.SyncStatus {
+	b.syncMu.RLock()
+	defer b.syncMu.RUnlock()
+	return b.lastSync
+}
+
+// BroadcastProxyMetrics sends a metrics snapshot to proxyMetrics subscribers
+func (b *Broadcaster) BroadcastProxyMetrics(snapshot *MetricsSnapshot) {
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeProxyMetrics)
+	if len(subs) == 0 {
+		return
+	}
+
+	for _, sub := range subs {
+		data, err := sub.Notification(snapshot)
+		if err != nil {
+			b.NotificationFailed(sub, err)
+			continue
+		}
+		if b.sendToSubscription(sub, data) {
+			metrics.WSProxyMetricsNotificationsSent.Inc()
+		}
+	}
+}
+
+// BroadcastHeartbeats sends an empty heartbeat notification to subscriptions
+// that asked for heartbeats and had no notification for their interval
+func (b *Broadcaster) BroadcastHeartbeats(now time.Time) {
+	for _, sub := range b.subManager.All() {
+		if !sub.HeartbeatDue(now) {
+			continue
+		}
+		data, err := sub.HeartbeatNotification()
+		if err != nil {
+			logger.Error("Failed to create heartbeat notification: %v", err)
+			continue
+		}
+		if b.sendToSubscription(sub, data) {
+			metrics.WSHeartbeatNotificationsSent.Inc()
+		}
+	}
+}
+
+// ExpireSubscriptions removes the subscriptions whose TTL elapsed at now,
+// after sending each a final expiry notification
+func (b *Broadcaster) ExpireSubscriptions(now time.Time) {
+	for _, sub := range b.subManager.All() {
+		if !sub.Expired(now) {
+			continue
+		}
+		data, err := sub.ExpiryNotification()
+		if err != nil {
+			logger.Error("Failed to create expiry notification: %v", err)
+		} else {
+			b.sendToSubscription(sub, data)
+		}
+		if b.subManager.Unsubscribe(sub.ClientID, sub.ID) {
+			metrics.WSSubscriptionsExpired.WithLabelValues(string(sub.Type)).Inc()
+			logger.Info("Subscription %s of client %s expired after %v", sub.ID, sub.ClientID, sub.Options.TTL)
+		}
+	}
+}
+
+// TestTick is the payload of the synthetic test subscription
+type TestTick struct {
+	Counter   int64 `json:"counter"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+// BroadcastTestTick sends the next counter value to test subscribers.
+// The counter only advances when there are subscribers, so consecutive
+// notifications always differ by one.
+func (b *Broadcaster) BroadcastTestTick() {
+	subs := b.subManager.GetSubscriptionsByType(subscription.SubTypeTest)
+	if len(subs) == 0 {
+		return
+	}
+
+	tick := &TestTick{
+		Counter:   b.testCounter.Add(1),
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	for _, sub := range subs {
+		data, err := sub.Notification(tick)
+		if err != nil {
+			b.NotificationFailed(sub, err)
+			continue
+		}
+		if b.sendToSubscription(sub, data) {
+			metrics.WSTestNotificationsSent.Inc()
+		}
+	}
+}
+
 // ClientCount returns the number of connected clients
 func (b *Broadcaster) ClientCount() int {
 	b.mu.RLock()
@@ -336,7 +1599,8 @@ func (b *Broadcaster) ClientCount() int {
 
 // WritePump pumps messages from the send channel to the WebSocket connection
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(30 * time.Second)
+	defer recovery.Recover(recovery.Context{Component: "writePump", ClientID: c.ID})
+	ticker := time.NewTicker(c.Keepalive.PingInterval)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -354,6 +1618,12 @@ func (c *Client) WritePump() {
 			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
+			c.RecordUsage(0, 0, uint64(len(message)))
+			if warning := c.useBytes(len(message)); warning != nil {
+				if data, err := QuotaWarningNotification(warning); err == nil {
+					c.conn.WriteMessage(websocket.TextMessage, data)
+				}
+			}
 
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
@@ -370,9 +1640,21 @@ func (c *Client) IncrementRecv() {
 	metrics.WSMessagesReceived.Inc()
 }
 
-// Close marks the client as closed
+// IncrementSlowRequests counts a forwarded request of the client that
+// exceeded the slow request threshold
+func (c *Client) IncrementSlowRequests() {
+	c.slowReqs.Add(1)
+}
+
+// Close marks the client as closed and cancels its in-flight requests
 func (c *Client) Close() {
 	c.closed.Store(true)
+	c.cancel()
+}
+
+// Context returns a context that is canceled when the client disconnects
+func (c *Client) Context() context.Context {
+	return c.ctx
 }
 
 // IsClosed returns whether the client is closed
@@ -390,6 +1672,55 @@ func (c *Client) Send() chan []byte {
 	return c.send
 }
 
+// APIKey returns the API key of a request, sent either as "X-API-Key: <key>"
+// or as the apiKey query parameter
+func APIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("apiKey")
+}
+
+// ClientIdentity returns the identity of a request's verified TLS client
+// certificate: its subject common name, else its first DNS, URI or email
+// subject alternative name. It is empty without a verified certificate.
+func ClientIdentity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	}
+	return ""
+}
+
+// UsageKey returns the key a request's usage is recorded under: its API key,
+// else "cert:" and its certificate identity
+func UsageKey(r *http.Request) string {
+	if key := APIKey(r); key != "" {
+		return key
+	}
+	if identity := ClientIdentity(r); identity != "" {
+		return "cert:" + identity
+	}
+	return ""
+}
+
+// RecordUsage adds to the client's usage when usage reports are enabled
+func (c *Client) RecordUsage(requests, notifications, bytes uint64) {
+	if c.Usage != nil {
+		c.Usage.Record(c.APIKey, requests, notifications, bytes)
+	}
+}
+
 func generateClientID() string {
 	bytes := make([]byte, 8)
 	rand.Read(bytes)
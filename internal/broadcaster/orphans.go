@@ -0,0 +1,30 @@
+package broadcaster
+
+import (
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+)
+
+// SweepOrphans removes subscriptions whose client is no longer registered,
+// which a subscribe racing its connection's unregister can leave behind, and
+// returns how many were found. Detached resumable subscriptions are kept.
+func (b *Broadcaster) SweepOrphans() int {
+	orphans := 0
+	for _, sub := range b.subManager.All() {
+		// Subscriptions listed before the lookup can only belong to clients
+		// registered earlier, so a missing client is gone for good
+		b.mu.RLock()
+		_, registered := b.clients[sub.ClientID]
+		b.mu.RUnlock()
+		if registered {
+			continue
+		}
+
+		if b.subManager.RemoveOrphan(sub.ClientID, sub.ID) {
+			metrics.WSSubscriptionsOrphaned.WithLabelValues(string(sub.Type)).Inc()
+			logger.Warn("Removed orphaned %s subscription %s of unregistered client %s", sub.Type, sub.ID, sub.ClientID)
+			orphans++
+		}
+	}
+	return orphans
+}
@@ -0,0 +1,195 @@
+package broadcaster
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"hlnode-websocket/internal/clock"
+	"hlnode-websocket/internal/metrics"
+	"hlnode-websocket/internal/rpc"
+)
+
+// Quota names
+const (
+	QuotaRequests = "requests"
+	QuotaBytes    = "bytes"
+)
+
+// QuotaWarningLevels are the percentages of a quota at which a connection is warned
+var QuotaWarningLevels = []int{80, 95}
+
+// Quota limits the requests and bytes sent of a connection per window; a
+// zero limit is unlimited
+type Quota struct {
+	Requests uint64
+	Bytes    uint64
+	Window   time.Duration
+}
+
+// Enabled reports whether the quota limits anything
+func (q Quota) Enabled() bool {
+	return q.Window > 0 && (q.Requests > 0 || q.Bytes > 0)
+}
+
+// limit returns the limit of a quota name
+func (q Quota) limit(name string) uint64 {
+	if name == QuotaRequests {
+		return q.Requests
+	}
+	return q.Bytes
+}
+
+// quotaUsage is a connection's use of its quota in the current window
+type quotaUsage struct {
+	quota       Quota
+	clock       clock.Clock
+	windowStart time.Time
+	used        map[string]uint64
+	// warned is the highest warning level sent in the window by quota name
+	warned map[string]int
+	mu     sync.Mutex
+}
+
+// roll starts a new window once the current one has elapsed. u.mu must be held.
+func (u *quotaUsage) roll() {
+	now := u.clock.Now()
+	if now.Sub(u.windowStart) < u.quota.Window {
+		return
+	}
+	u.windowStart = now
+	u.used = make(map[string]uint64)
+	u.warned = make(map[string]int)
+}
+
+// use counts n against a quota. If enforce is set and n would exceed the
+// quota, nothing is counted and ok is false. warning is set when the usage
+// crosses a new warning level.
+func (u *quotaUsage) use(name string, n uint64, enforce bool) (ok bool, warning *rpc.QuotaStatus) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.roll()
+
+	limit := u.quota.limit(name)
+	if limit == 0 {
+		return true, nil
+	}
+	if enforce && u.used[name]+n > limit {
+		metrics.WSQuotaExceeded.WithLabelValues(name).Inc()
+		return false, nil
+	}
+	u.used[name] += n
+
+	level := 0
+	for _, l := range QuotaWarningLevels {
+		if u.used[name]*100 >= limit*uint64(l) {
+			level = l
+		}
+	}
+	if level <= u.warned[name] {
+		return true, nil
+	}
+	u.warned[name] = level
+	metrics.WSQuotaWarningsSent.WithLabelValues(name).Inc()
+	return true, u.status(name)
+}
+
+// exhausted reports whether a quota is used up. u.mu must not be held.
+func (u *quotaUsage) exhausted(name string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.roll()
+	limit := u.quota.limit(name)
+	return limit > 0 && u.used[name] >= limit
+}
+
+// status describes a quota at its warning level. u.mu must be held.
+func (u *quotaUsage) status(name string) *rpc.QuotaStatus {
+	return &rpc.QuotaStatus{
+		Quota:    name,
+		Used:     u.used[name],
+		Limit:    u.quota.limit(name),
+		Percent:  u.warned[name],
+		ResetsAt: u.windowStart.Add(u.quota.Window).UnixMilli(),
+	}
+}
+
+// SetQuota limits the connection's requests and bytes sent per window,
+// measured with clk. It must be called before the client is registered.
+func (c *Client) SetQuota(q Quota, clk clock.Clock) {
+	if !q.Enabled() {
+		return
+	}
+	c.quota = &quotaUsage{
+		quota:       q,
+		clock:       clk,
+		windowStart: clk.Now(),
+		used:        make(map[string]uint64),
+		warned:      make(map[string]int),
+	}
+}
+
+// UseRequests counts n requests against the request quota. ok is false, and
+// nothing is counted, if they would exceed it; warning is set when the
+// requests cross a warning level.
+func (c *Client) UseRequests(n uint64) (ok bool, warning *rpc.QuotaStatus) {
+	if c.quota == nil {
+		return true, nil
+	}
+	return c.quota.use(QuotaRequests, n, true)
+}
+
+// RequestQuotaResetsIn returns the time until the request quota window ends
+func (c *Client) RequestQuotaResetsIn() time.Duration {
+	if c.quota == nil {
+		return 0
+	}
+	c.quota.mu.Lock()
+	defer c.quota.mu.Unlock()
+	return c.quota.windowStart.Add(c.quota.quota.Window).Sub(c.quota.clock.Now())
+}
+
+// QuotaStatus returns the quotas past a warning level in the current window,
+// for the quota extension field of responses
+func (c *Client) QuotaStatus() []rpc.QuotaStatus {
+	if c.quota == nil {
+		return nil
+	}
+	c.quota.mu.Lock()
+	defer c.quota.mu.Unlock()
+	c.quota.roll()
+
+	var statuses []rpc.QuotaStatus
+	for _, name := range []string{QuotaRequests, QuotaBytes} {
+		if c.quota.warned[name] > 0 {
+			statuses = append(statuses, *c.quota.status(name))
+		}
+	}
+	return statuses
+}
+
+// bandwidthExhausted reports whether the connection used up its bandwidth
+// quota; notifications are dropped until the window ends
+func (c *Client) bandwidthExhausted() bool {
+	return c.quota != nil && c.quota.exhausted(QuotaBytes)
+}
+
+// useBytes counts bytes sent against the bandwidth quota, returning a warning
+// when they cross a warning level
+func (c *Client) useBytes(n int) *rpc.QuotaStatus {
+	if c.quota == nil {
+		return nil
+	}
+	_, warning := c.quota.use(QuotaBytes, uint64(n), false)
+	return warning
+}
+
+// QuotaWarningNotification creates the hl_quotaWarning notification pushed
+// when a connection crosses a quota warning level
+func QuotaWarningNotification(status *rpc.QuotaStatus) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "hl_quotaWarning",
+		"params":  status,
+	})
+}
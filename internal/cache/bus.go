@@ -0,0 +1,35 @@
+package cache
+
+import "sync"
+
+// Bus publishes a per-block invalidation event to every registered cache.
+// The block poller publishes on each new head so that all cached state
+// rolls forward together with the blocks delivered to subscribers.
+type Bus struct {
+	subscribers []func(blockNumber string)
+	mu          sync.RWMutex
+}
+
+// NewBus creates a new invalidation bus
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers a callback invoked with the new head's block number
+func (b *Bus) Subscribe(fn func(blockNumber string)) {
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, fn)
+	b.mu.Unlock()
+}
+
+// Publish notifies all subscribers that a new head has been observed
+func (b *Bus) Publish(blockNumber string) {
+	b.mu.RLock()
+	subscribers := make([]func(string), len(b.subscribers))
+	copy(subscribers, b.subscribers)
+	b.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(blockNumber)
+	}
+}
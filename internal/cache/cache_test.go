@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"hlnode-websocket/internal/clock"
+	"hlnode-websocket/internal/rpc"
+)
+
+func TestBusPublish(t *testing.T) {
+	bus := NewBus()
+
+	var got []string
+	bus.Subscribe(func(blockNumber string) { got = append(got, "a:"+blockNumber) })
+	bus.Subscribe(func(blockNumber string) { got = append(got, "b:"+blockNumber) })
+
+	bus.Publish("0x10")
+
+	if len(got) != 2 || got[0] != "a:0x10" || got[1] != "b:0x10" {
+		t.Errorf("Unexpected subscriber calls: %v", got)
+	}
+}
+
+func TestHeadCacheInvalidatedOnPublish(t *testing.T) {
+	bus := NewBus()
+	c := NewHeadCache(bus)
+
+	_, gen, ok := c.Get("eth_gasPrice")
+	if ok {
+		t.Fatal("Expected miss on empty cache")
+	}
+	if !c.Set(gen, "eth_gasPrice", json.RawMessage(`"0x1"`)) {
+		t.Fatal("Set should succeed for current generation")
+	}
+
+	value, _, ok := c.Get("eth_gasPrice")
+	if !ok || string(value) != `"0x1"` {
+		t.Fatalf("Expected cached value, got %s (ok=%v)", value, ok)
+	}
+
+	bus.Publish("0x11")
+
+	if _, _, ok := c.Get("eth_gasPrice"); ok {
+		t.Error("Entry should be dropped after new head")
+	}
+	if c.Block() != "0x11" {
+		t.Errorf("Expected block 0x11, got %s", c.Block())
+	}
+}
+
+func TestHeadCacheRejectsStaleSet(t *testing.T) {
+	bus := NewBus()
+	c := NewHeadCache(bus)
+
+	_, gen, _ := c.Get("key")
+	bus.Publish("0x2")
+
+	if c.Set(gen, "key", json.RawMessage(`1`)) {
+		t.Error("Set should be rejected after an invalidation")
+	}
+	if c.Len() != 0 {
+		t.Errorf("Expected empty cache, got %d entries", c.Len())
+	}
+}
+
+func TestHeadCacheMaxEntries(t *testing.T) {
+	bus := NewBus()
+	c := NewHeadCache(bus)
+	c.SetClock(clock.NewFake(time.Unix(1700000000, 0)))
+	c.SetMaxStaleness(time.Minute)
+	c.SetMaxEntries(2)
+
+	_, gen, _ := c.Get("a")
+	c.Set(gen, "a", json.RawMessage(`1`))
+	c.Set(gen, "b", json.RawMessage(`2`))
+	c.Set(gen, "a", json.RawMessage(`3`)) // an update doesn't evict
+	c.Set(gen, "c", json.RawMessage(`4`))
+
+	if c.Len() != 2 {
+		t.Fatalf("Expected 2 entries, got %d", c.Len())
+	}
+	if _, _, ok := c.Get("a"); ok {
+		t.Error("Expected the oldest key to be evicted")
+	}
+	if value, _, ok := c.Get("c"); !ok || string(value) != `4` {
+		t.Errorf("Expected the newest key to be cached, got %s", value)
+	}
+	if _, _, ok := c.GetStale("a"); ok {
+		t.Error("Expected the oldest stale key to be evicted")
+	}
+
+	// Stale results stay bounded across heads
+	bus.Publish("0x2")
+	_, gen, _ = c.Get("d")
+	c.Set(gen, "d", json.RawMessage(`5`))
+	if _, _, ok := c.GetStale("b"); ok {
+		t.Error("Expected b to be evicted from stale results")
+	}
+	for _, key := range []string{"c", "d"} {
+		if _, _, ok := c.GetStale(key); !ok {
+			t.Errorf("Expected a stale result for %s", key)
+		}
+	}
+}
+
+func TestGasPriceCache(t *testing.T) {
+	c := NewGasPriceCache(0)
+
+	if !c.SetSmall("0x1", "0x10") {
+		t.Error("First small price should be a change")
+	}
+	if c.SetSmall("0x1", "0x11") {
+		t.Error("Unchanged small price should not be a change")
+	}
+	if !c.SetBig("0x5") {
+		t.Error("First big price should be a change")
+	}
+
+	info := c.Info(rpc.BlockTypeBig)
+	if info.GasPrice != "0x1" || info.BigBlockGasPrice != "0x5" || info.BlockNumber != "0x11" || info.BlockType != "big" {
+		t.Errorf("Unexpected gas price info: %+v", info)
+	}
+	if info.ChangedPrice() != "0x5" {
+		t.Errorf("Expected big block price as changed price, got %s", info.ChangedPrice())
+	}
+}
+
+func TestGasPriceCacheLatest(t *testing.T) {
+	c := NewGasPriceCache(0)
+
+	if c.Latest() != nil {
+		t.Error("Expected no latest prices before the first poll")
+	}
+
+	c.SetSmall("0x1", "0x10")
+	info := c.Latest()
+	if info == nil || info.GasPrice != "0x1" || info.BlockNumber != "0x10" || info.BlockType != "" {
+		t.Errorf("Unexpected latest gas price info: %+v", info)
+	}
+}
+
+func TestGasPriceCacheHistory(t *testing.T) {
+	c := NewGasPriceCache(3)
+
+	for _, price := range []string{"0x10", "0x20", "0x30", "0x40"} {
+		c.SetSmall(price, "0x1")
+	}
+	c.SetSmall("0x40", "0x2") // unchanged, not recorded
+
+	samples, stats, ok := c.History(rpc.BlockTypeSmall, 0)
+	if !ok {
+		t.Fatal("Expected small block history")
+	}
+	if len(samples) != 3 || samples[0].GasPrice != "0x20" || samples[2].GasPrice != "0x40" {
+		t.Errorf("Expected last 3 samples oldest first, got %+v", samples)
+	}
+	if stats.Min != "0x20" || stats.Max != "0x40" || stats.Avg != "0x30" || stats.Samples != 3 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	samples, _, _ = c.History(rpc.BlockTypeSmall, 1)
+	if len(samples) != 1 || samples[0].GasPrice != "0x40" {
+		t.Errorf("Expected most recent sample, got %+v", samples)
+	}
+
+	if _, _, ok := c.History("medium", 0); ok {
+		t.Error("Unknown block type should not have history")
+	}
+
+	info := c.Info(rpc.BlockTypeSmall)
+	if info.Stats[rpc.BlockTypeSmall] == nil || info.Stats[rpc.BlockTypeBig] != nil {
+		t.Errorf("Expected stats for small block type only, got %+v", info.Stats)
+	}
+}
+
+func TestLogStore(t *testing.T) {
+	watched := "0x1111111111111111111111111111111111111111"
+	s := NewLogStore([]string{strings.ToUpper(watched[:2]) + watched[2:]}, 3)
+
+	if s.Covers([]string{watched}, 10) {
+		t.Error("Empty store should not cover anything")
+	}
+
+	for n := uint64(10); n <= 14; n++ {
+		s.AddBlock(n, []rpc.Log{
+			{Address: watched, BlockNumber: rpc.FormatHexUint64(n), LogIndex: "0x1"},
+			{Address: "0x2222", BlockNumber: rpc.FormatHexUint64(n), LogIndex: "0x0"},
+			{Address: watched, BlockNumber: rpc.FormatHexUint64(n), LogIndex: "0x0"},
+		})
+	}
+
+	// Retains blocks 12..14
+	if s.Covers([]string{watched}, 11) || !s.Covers([]string{watched}, 12) {
+		t.Error("Expected coverage from block 12")
+	}
+	if s.Covers([]string{watched, "0x2222"}, 12) {
+		t.Error("Unwatched address should not be covered")
+	}
+
+	logs, newest := s.Query([]string{watched}, 13)
+	if newest != 14 || len(logs) != 4 {
+		t.Fatalf("Expected 4 logs up to block 14, got %d up to %d", len(logs), newest)
+	}
+	if logs[0].BlockNumber != "0xd" || logs[0].LogIndex != "0x0" || logs[1].LogIndex != "0x1" {
+		t.Errorf("Expected logs in block and logIndex order, got %+v", logs)
+	}
+
+	// A skipped height restarts coverage at the next added block
+	s.AddBlock(16, nil)
+	if s.Covers([]string{watched}, 14) || !s.Covers([]string{watched}, 16) {
+		t.Error("Expected coverage to restart at block 16 after skipping 15")
+	}
+	if logs, _ := s.Query([]string{watched}, 12); len(logs) != 0 {
+		t.Errorf("Expected no logs from before the gap, got %+v", logs)
+	}
+
+	s.Reset()
+	if s.Covers([]string{watched}, 14) {
+		t.Error("Reset store should not cover anything")
+	}
+}
+
+func TestHeadCacheStale(t *testing.T) {
+	bus := NewBus()
+	c := NewHeadCache(bus)
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	c.SetClock(clk)
+
+	_, gen, _ := c.Get("eth_gasPrice")
+	c.Set(gen, "eth_gasPrice", json.RawMessage(`"0x1"`))
+	if _, _, ok := c.GetStale("eth_gasPrice"); ok {
+		t.Fatal("Expected no stale values without a max staleness")
+	}
+
+	c.SetMaxStaleness(time.Minute)
+	_, gen, _ = c.Get("eth_gasPrice")
+	c.Set(gen, "eth_gasPrice", json.RawMessage(`"0x2"`))
+	bus.Publish("0x11")
+	clk.Advance(30 * time.Second)
+
+	value, age, ok := c.GetStale("eth_gasPrice")
+	if !ok || string(value) != `"0x2"` || age != 30*time.Second {
+		t.Fatalf("Expected the value fetched before the new head, got %s, %v, %v", value, age, ok)
+	}
+
+	clk.Advance(31 * time.Second)
+	if _, _, ok := c.GetStale("eth_gasPrice"); ok {
+		t.Error("Expected values past the max staleness not to be returned")
+	}
+	bus.Publish("0x12")
+	if len(c.stale) != 0 {
+		t.Errorf("Expected expired stale values dropped on the next head, got %d", len(c.stale))
+	}
+}
@@ -0,0 +1,196 @@
+package cache
+
+import (
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"hlnode-websocket/internal/rpc"
+)
+
+// DefaultGasPriceHistorySize is the number of samples kept per block type
+const DefaultGasPriceHistorySize = 1000
+
+// GasPriceCache holds the latest small and big block gas prices, which are
+// polled on separate cadences, so each notification can carry both. It also
+// keeps a ring buffer of recent price changes per block type for history
+// queries and rolling statistics.
+type GasPriceCache struct {
+	small       string
+	big         string
+	blockNumber string
+	history     map[string]*gasPriceRing
+	mu          sync.RWMutex
+}
+
+// gasPriceRing is a fixed-size ring buffer of samples, oldest first once full
+type gasPriceRing struct {
+	samples []rpc.GasPriceSample
+	next    int
+	full    bool
+}
+
+func (r *gasPriceRing) add(sample rpc.GasPriceSample) {
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// ordered returns the samples oldest first
+func (r *gasPriceRing) ordered() []rpc.GasPriceSample {
+	if !r.full {
+		return append([]rpc.GasPriceSample{}, r.samples[:r.next]...)
+	}
+	result := make([]rpc.GasPriceSample, 0, len(r.samples))
+	result = append(result, r.samples[r.next:]...)
+	return append(result, r.samples[:r.next]...)
+}
+
+// NewGasPriceCache creates an empty gas price cache keeping up to
+// historySize samples per block type
+func NewGasPriceCache(historySize int) *GasPriceCache {
+	if historySize <= 0 {
+		historySize = DefaultGasPriceHistorySize
+	}
+	return &GasPriceCache{
+		history: map[string]*gasPriceRing{
+			rpc.BlockTypeSmall: {samples: make([]rpc.GasPriceSample, historySize)},
+			rpc.BlockTypeBig:   {samples: make([]rpc.GasPriceSample, historySize)},
+		},
+	}
+}
+
+// SetSmall records the small block gas price observed at blockNumber and
+// reports whether the price changed
+func (c *GasPriceCache) SetSmall(price, blockNumber string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.blockNumber = blockNumber
+	changed := price != c.small
+	c.small = price
+	if changed {
+		c.record(rpc.BlockTypeSmall, price)
+	}
+	return changed
+}
+
+// SetBig records the big block gas price and reports whether it changed
+func (c *GasPriceCache) SetBig(price string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := price != c.big
+	c.big = price
+	if changed {
+		c.record(rpc.BlockTypeBig, price)
+	}
+	return changed
+}
+
+// Big returns the latest big block gas price, empty if not polled yet
+func (c *GasPriceCache) Big() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.big
+}
+
+// record appends a sample to the block type's history. Must be called with mu held.
+func (c *GasPriceCache) record(blockType, price string) {
+	c.history[blockType].add(rpc.GasPriceSample{
+		Timestamp:   time.Now().Unix(),
+		BlockNumber: c.blockNumber,
+		BlockType:   blockType,
+		GasPrice:    price,
+	})
+}
+
+// Info returns a gasPrice notification for a change of the given block type,
+// with rolling statistics for each block type that has history
+func (c *GasPriceCache) Info(blockType string) *rpc.GasPriceInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	info := &rpc.GasPriceInfo{
+		GasPrice:         c.small,
+		BigBlockGasPrice: c.big,
+		BlockNumber:      c.blockNumber,
+		BlockType:        blockType,
+	}
+	for _, t := range []string{rpc.BlockTypeSmall, rpc.BlockTypeBig} {
+		if stats := computeStats(c.history[t].ordered()); stats != nil {
+			if info.Stats == nil {
+				info.Stats = make(map[string]*rpc.GasPriceStats)
+			}
+			info.Stats[t] = stats
+		}
+	}
+	return info
+}
+
+// Latest returns the current prices with rolling statistics, or nil if the
+// small block price hasn't been polled yet. BlockType is empty as it
+// reports no change.
+func (c *GasPriceCache) Latest() *rpc.GasPriceInfo {
+	c.mu.RLock()
+	polled := c.small != ""
+	c.mu.RUnlock()
+	if !polled {
+		return nil
+	}
+	return c.Info("")
+}
+
+// History returns up to limit of the most recent samples of a block type,
+// oldest first, along with their statistics. A limit <= 0 returns all samples.
+// ok is false for an unknown block type.
+func (c *GasPriceCache) History(blockType string, limit int) (samples []rpc.GasPriceSample, stats *rpc.GasPriceStats, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ring, ok := c.history[blockType]
+	if !ok {
+		return nil, nil, false
+	}
+	samples = ring.ordered()
+	if limit > 0 && len(samples) > limit {
+		samples = samples[len(samples)-limit:]
+	}
+	return samples, computeStats(samples), true
+}
+
+// computeStats returns min/max/avg over the samples, or nil if there are none
+func computeStats(samples []rpc.GasPriceSample) *rpc.GasPriceStats {
+	var minPrice, maxPrice *big.Int
+	sum := new(big.Int)
+	count := 0
+
+	for _, sample := range samples {
+		price, ok := new(big.Int).SetString(strings.TrimPrefix(sample.GasPrice, "0x"), 16)
+		if !ok {
+			continue
+		}
+		if minPrice == nil || price.Cmp(minPrice) < 0 {
+			minPrice = price
+		}
+		if maxPrice == nil || price.Cmp(maxPrice) > 0 {
+			maxPrice = price
+		}
+		sum.Add(sum, price)
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+
+	avg := sum.Div(sum, big.NewInt(int64(count)))
+	return &rpc.GasPriceStats{
+		Min:     "0x" + minPrice.Text(16),
+		Max:     "0x" + maxPrice.Text(16),
+		Avg:     "0x" + avg.Text(16),
+		Samples: count,
+	}
+}
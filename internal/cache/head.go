@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"hlnode-websocket/internal/clock"
+)
+
+// HeadCache stores JSON results that are only valid for the current head.
+// Entries are dropped whenever the bus publishes a new block.
+type HeadCache struct {
+	entries    map[string]json.RawMessage
+	block      string
+	generation uint64
+	// stale keeps the last result of every key across invalidations for up
+	// to maxStaleness, to answer while the upstream is down
+	stale        map[string]staleEntry
+	maxStaleness time.Duration
+	// maxEntries bounds entries and stale each (0 is unbounded); the oldest
+	// key is evicted first, as recorded in order and staleOrder
+	maxEntries int
+	order      []string
+	staleOrder []string
+	clock      clock.Clock
+	mu         sync.RWMutex
+}
+
+// staleEntry is a result and when it was fetched
+type staleEntry struct {
+	value json.RawMessage
+	at    time.Time
+}
+
+// NewHeadCache creates a cache and subscribes it to the invalidation bus
+func NewHeadCache(bus *Bus) *HeadCache {
+	c := &HeadCache{
+		entries: make(map[string]json.RawMessage),
+		stale:   make(map[string]staleEntry),
+		clock:   clock.Real,
+	}
+	if bus != nil {
+		bus.Subscribe(c.Invalidate)
+	}
+	return c
+}
+
+// SetMaxStaleness keeps results for up to maxStaleness after they were
+// fetched, past new heads, for GetStale. Zero disables stale results.
+func (c *HeadCache) SetMaxStaleness(maxStaleness time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxStaleness = maxStaleness
+	if maxStaleness <= 0 {
+		c.stale = make(map[string]staleEntry)
+		c.staleOrder = nil
+	}
+}
+
+// SetMaxEntries bounds the number of cached results, current and stale
+// each, evicting the oldest key first. Zero leaves the cache unbounded.
+func (c *HeadCache) SetMaxEntries(maxEntries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntries = max(maxEntries, 0)
+}
+
+// SetClock sets the clock aging stale results
+func (c *HeadCache) SetClock(clk clock.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clk
+}
+
+// Get returns the cached value for key and the generation it was looked up in.
+// The generation must be passed back to Set so that results fetched before
+// an invalidation are not stored against the new head.
+func (c *HeadCache) Get(key string) (json.RawMessage, uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	value, ok := c.entries[key]
+	return value, c.generation, ok
+}
+
+// Set stores a value if no invalidation happened since generation was read
+func (c *HeadCache) Set(generation uint64, key string, value json.RawMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return false
+	}
+	if _, ok := c.entries[key]; !ok {
+		if c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+			delete(c.entries, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = value
+	if c.maxStaleness > 0 {
+		if _, ok := c.stale[key]; !ok {
+			if c.maxEntries > 0 && len(c.stale) >= c.maxEntries {
+				delete(c.stale, c.staleOrder[0])
+				c.staleOrder = c.staleOrder[1:]
+			}
+			c.staleOrder = append(c.staleOrder, key)
+		}
+		c.stale[key] = staleEntry{value: value, at: c.clock.Now()}
+	}
+	return true
+}
+
+// GetStale returns the last value stored for key, whatever head it was
+// fetched at, and its age. Values older than the max staleness are not
+// returned.
+func (c *HeadCache) GetStale(key string) (json.RawMessage, time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.stale[key]
+	if !ok {
+		return nil, 0, false
+	}
+	age := c.clock.Now().Sub(entry.at)
+	if age > c.maxStaleness {
+		return nil, 0, false
+	}
+	return entry.value, age, true
+}
+
+// Invalidate drops all entries and records the new head
+func (c *HeadCache) Invalidate(blockNumber string) {
+	c.mu.Lock()
+	c.entries = make(map[string]json.RawMessage)
+	c.order = nil
+	c.block = blockNumber
+	c.generation++
+	now := c.clock.Now()
+	kept := c.staleOrder[:0]
+	for _, key := range c.staleOrder {
+		if now.Sub(c.stale[key].at) > c.maxStaleness {
+			delete(c.stale, key)
+			continue
+		}
+		kept = append(kept, key)
+	}
+	c.staleOrder = kept
+	c.mu.Unlock()
+}
+
+// Block returns the head the cache currently holds entries for
+func (c *HeadCache) Block() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.block
+}
+
+// Len returns the number of cached entries
+func (c *HeadCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
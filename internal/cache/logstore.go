@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"hlnode-websocket/internal/rpc"
+)
+
+// LogStore retains the recent logs of a configured watchlist of contract
+// addresses, fed by the block poller regardless of current subscribers, so
+// logs subscriptions with fromBlock on those addresses are backfilled locally
+// instead of through upstream eth_getLogs
+type LogStore struct {
+	addresses map[string]bool
+	retention uint64
+
+	// logs are indexed by block number, then by lowercase address
+	logs   map[uint64]map[string][]rpc.Log
+	oldest uint64
+	newest uint64
+	mu     sync.RWMutex
+}
+
+// NewLogStore creates a store for the given addresses keeping the last retention blocks
+func NewLogStore(addresses []string, retention uint64) *LogStore {
+	watched := make(map[string]bool, len(addresses))
+	for _, addr := range addresses {
+		watched[strings.ToLower(addr)] = true
+	}
+	return &LogStore{
+		addresses: watched,
+		retention: retention,
+		logs:      make(map[uint64]map[string][]rpc.Log),
+	}
+}
+
+// Len returns the number of watched addresses
+func (s *LogStore) Len() int {
+	return len(s.addresses)
+}
+
+// AddBlock records the watched logs of a block and prunes blocks that fell
+// out of retention. A block that doesn't follow the newest one, e.g. after
+// the poller skipped heights, drops the stored logs so coverage restarts
+// from it instead of having a gap.
+func (s *LogStore) AddBlock(blockNum uint64, logs []rpc.Log) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.newest != 0 && blockNum != s.newest+1 {
+		s.logs = make(map[uint64]map[string][]rpc.Log)
+		s.newest = 0
+	}
+
+	for _, logEntry := range logs {
+		addr := strings.ToLower(logEntry.Address)
+		if !s.addresses[addr] {
+			continue
+		}
+		if s.logs[blockNum] == nil {
+			s.logs[blockNum] = make(map[string][]rpc.Log)
+		}
+		s.logs[blockNum][addr] = append(s.logs[blockNum][addr], logEntry)
+	}
+
+	if s.newest == 0 {
+		s.oldest = blockNum
+	}
+	s.newest = blockNum
+
+	if s.retention > 0 && blockNum >= s.retention && s.oldest <= blockNum-s.retention {
+		for n := s.oldest; n <= blockNum-s.retention; n++ {
+			delete(s.logs, n)
+		}
+		s.oldest = blockNum - s.retention + 1
+	}
+}
+
+// Reset drops all stored logs, e.g. after the logs of a block could not be
+// fetched, so coverage restarts from the next added block instead of having a gap
+func (s *LogStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logs = make(map[uint64]map[string][]rpc.Log)
+	s.oldest = 0
+	s.newest = 0
+}
+
+// Covers reports whether the store holds every log of the given addresses
+// from fromBlock on: all addresses are watched and fromBlock is retained
+func (s *LogStore) Covers(addresses []string, fromBlock uint64) bool {
+	if len(addresses) == 0 {
+		return false
+	}
+	for _, addr := range addresses {
+		if !s.addresses[strings.ToLower(addr)] {
+			return false
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.newest != 0 && fromBlock >= s.oldest
+}
+
+// Query returns the stored logs of the given addresses from fromBlock up to
+// the newest stored block, in block order, along with that newest block
+func (s *LogStore) Query(addresses []string, fromBlock uint64) ([]rpc.Log, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []rpc.Log{}
+	for n := max(fromBlock, s.oldest); n <= s.newest && s.newest != 0; n++ {
+		block := s.logs[n]
+		if block == nil {
+			continue
+		}
+		var blockLogs []rpc.Log
+		seen := make(map[string]bool, len(addresses))
+		for _, addr := range addresses {
+			addr = strings.ToLower(addr)
+			if !seen[addr] {
+				seen[addr] = true
+				blockLogs = append(blockLogs, block[addr]...)
+			}
+		}
+		sort.Slice(blockLogs, func(i, j int) bool { return logIndex(blockLogs[i]) < logIndex(blockLogs[j]) })
+		result = append(result, blockLogs...)
+	}
+	return result, s.newest
+}
+
+func logIndex(logEntry rpc.Log) uint64 {
+	n, _ := rpc.ParseHexUint64(logEntry.LogIndex)
+	return n
+}
@@ -0,0 +1,45 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeAdvance(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+
+	ticker := c.NewTicker(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("Ticker fired before the clock advanced")
+	default:
+	}
+
+	c.Advance(1500 * time.Millisecond)
+	if !c.Now().Equal(start.Add(1500 * time.Millisecond)) {
+		t.Errorf("Unexpected time %v", c.Now())
+	}
+	if tick := <-ticker.C(); !tick.Equal(start.Add(time.Second)) {
+		t.Errorf("Expected tick at 1s, got %v", tick)
+	}
+
+	// Ticks a receiver missed are dropped, as with time.Ticker
+	c.Advance(3 * time.Second)
+	if tick := <-ticker.C(); !tick.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("Expected tick at 2s, got %v", tick)
+	}
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("Expected dropped ticks, got %v", tick)
+	default:
+	}
+
+	ticker.Stop()
+	c.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Error("Stopped ticker fired")
+	default:
+	}
+}
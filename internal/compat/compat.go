@@ -0,0 +1,158 @@
+// Package compat holds the flags that make the proxy's own responses mimic
+// the details of a given node or provider, for client libraries written
+// against one of them
+package compat
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"hlnode-websocket/internal/rpc"
+)
+
+// EmptyResult values: how local methods encode an empty list result
+const (
+	EmptyArray = "array"
+	EmptyNull  = "null"
+)
+
+// Syncing values: the shape of syncing notifications
+const (
+	// SyncingBool notifies true or false
+	SyncingBool = "bool"
+	// SyncingGeth notifies {"syncing":true,"status":{...}} while syncing, false once synced
+	SyncingGeth = "geth"
+	// SyncingReth notifies {"syncing":true,"currentBlock":...} while syncing, false once synced
+	SyncingReth = "reth"
+)
+
+// Errors values: the wording of errors the proxy answers itself
+const (
+	ErrorsDefault = "default"
+	ErrorsGeth    = "geth"
+	ErrorsReth    = "reth"
+)
+
+// Bounds of the random part of subscription IDs, in bytes
+const (
+	MinSubscriptionIDBytes = 8
+	MaxSubscriptionIDBytes = 32
+)
+
+// Flags toggle provider-specific response details. The zero value, like the
+// default profile, keeps the proxy's original behavior.
+type Flags struct {
+	EmptyResult string
+	// SubscriptionIDBytes is the number of random bytes in subscription IDs
+	SubscriptionIDBytes int
+	// TrimSubscriptionID strips leading zeros from subscription IDs, as geth does
+	TrimSubscriptionID bool
+	Syncing            string
+	Errors             string
+}
+
+// profiles are the flags of each provider a client may have been written against
+var profiles = map[string]Flags{
+	"default": {EmptyResult: EmptyArray, SubscriptionIDBytes: 16, Syncing: SyncingBool, Errors: ErrorsDefault},
+	"geth":    {EmptyResult: EmptyArray, SubscriptionIDBytes: 16, TrimSubscriptionID: true, Syncing: SyncingGeth, Errors: ErrorsGeth},
+	"reth":    {EmptyResult: EmptyArray, SubscriptionIDBytes: 16, TrimSubscriptionID: true, Syncing: SyncingReth, Errors: ErrorsReth},
+	// Alchemy fronts geth-compatible nodes but keeps subscription IDs at full length
+	"alchemy": {EmptyResult: EmptyArray, SubscriptionIDBytes: 16, Syncing: SyncingGeth, Errors: ErrorsGeth},
+}
+
+// Profile returns the flags of a named profile; empty means default
+func Profile(name string) (Flags, error) {
+	if name == "" {
+		name = "default"
+	}
+	flags, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return Flags{}, fmt.Errorf("unknown compatibility profile %q: must be default, geth, reth or alchemy", name)
+	}
+	return flags, nil
+}
+
+// Validate checks that every flag has a supported value
+func (f Flags) Validate() error {
+	switch f.EmptyResult {
+	case "", EmptyArray, EmptyNull:
+	default:
+		return fmt.Errorf("empty result encoding %q must be %s or %s", f.EmptyResult, EmptyArray, EmptyNull)
+	}
+	if f.SubscriptionIDBytes != 0 && (f.SubscriptionIDBytes < MinSubscriptionIDBytes || f.SubscriptionIDBytes > MaxSubscriptionIDBytes) {
+		return fmt.Errorf("subscription ID length must be between %d and %d bytes", MinSubscriptionIDBytes, MaxSubscriptionIDBytes)
+	}
+	switch f.Syncing {
+	case "", SyncingBool, SyncingGeth, SyncingReth:
+	default:
+		return fmt.Errorf("syncing shape %q must be %s, %s or %s", f.Syncing, SyncingBool, SyncingGeth, SyncingReth)
+	}
+	switch f.Errors {
+	case "", ErrorsDefault, ErrorsGeth, ErrorsReth:
+	default:
+		return fmt.Errorf("error wording %q must be %s, %s or %s", f.Errors, ErrorsDefault, ErrorsGeth, ErrorsReth)
+	}
+	return nil
+}
+
+// Empty encodes an empty list result as null when requested
+func (f Flags) Empty(result interface{}) interface{} {
+	if f.EmptyResult != EmptyNull || result == nil {
+		return result
+	}
+	if v := reflect.ValueOf(result); v.Kind() == reflect.Slice && v.Len() == 0 {
+		return nil
+	}
+	return result
+}
+
+// SyncingResult returns the result of a syncing notification
+func (f Flags) SyncingResult(status *rpc.SyncStatus) interface{} {
+	if !status.Syncing || f.Syncing == "" || f.Syncing == SyncingBool {
+		return status.Syncing
+	}
+	if f.Syncing == SyncingReth {
+		return status
+	}
+	// geth nests the progress under status
+	var progress map[string]interface{}
+	data, _ := json.Marshal(status)
+	json.Unmarshal(data, &progress)
+	delete(progress, "syncing")
+	return map[string]interface{}{"syncing": true, "status": progress}
+}
+
+// ParseError words a request that isn't valid JSON
+func (f Flags) ParseError(message string) string {
+	switch f.Errors {
+	case ErrorsGeth:
+		return "parse error"
+	case ErrorsReth:
+		return "Parse error"
+	}
+	return message
+}
+
+// InvalidRequest words a request that isn't valid JSON-RPC
+func (f Flags) InvalidRequest(message string) string {
+	switch f.Errors {
+	case ErrorsGeth:
+		return "invalid request"
+	case ErrorsReth:
+		return "Invalid request"
+	}
+	return message
+}
+
+// UnsupportedSubscription words an eth_subscribe of an unknown type
+func (f Flags) UnsupportedSubscription(subType, message string) string {
+	switch f.Errors {
+	case ErrorsGeth:
+		return fmt.Sprintf("no %q subscription in eth namespace", subType)
+	case ErrorsReth:
+		return "Invalid params"
+	}
+	return message
+}
@@ -0,0 +1,90 @@
+package compat
+
+import (
+	"encoding/json"
+	"testing"
+
+	"hlnode-websocket/internal/rpc"
+)
+
+func TestProfile(t *testing.T) {
+	for _, name := range []string{"", "default", "geth", "RETH", "alchemy"} {
+		flags, err := Profile(name)
+		if err != nil {
+			t.Fatalf("Profile(%q) failed: %v", name, err)
+		}
+		if err := flags.Validate(); err != nil {
+			t.Errorf("Profile(%q) is invalid: %v", name, err)
+		}
+	}
+	if _, err := Profile("infura"); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+
+	invalid := []Flags{
+		{EmptyResult: "none"},
+		{SubscriptionIDBytes: 4},
+		{Syncing: "erigon"},
+		{Errors: "alchemy"},
+	}
+	for _, flags := range invalid {
+		if err := flags.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", flags)
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	null := Flags{EmptyResult: EmptyNull}
+	if result := null.Empty([]rpc.Log{}); result != nil {
+		t.Errorf("Expected an empty list to encode as null, got %v", result)
+	}
+	if result := null.Empty([]string{"0x1"}); result == nil {
+		t.Error("A non-empty list must be kept")
+	}
+	if result := null.Empty(true); result != true {
+		t.Errorf("A non-list result must be kept, got %v", result)
+	}
+	if data, _ := json.Marshal(Flags{}.Empty([]string{})); string(data) != "[]" {
+		t.Errorf("Expected [] by default, got %s", data)
+	}
+}
+
+func TestSyncingResult(t *testing.T) {
+	syncing := &rpc.SyncStatus{Syncing: true, CurrentBlock: "0x10"}
+	synced := &rpc.SyncStatus{Syncing: false, CurrentBlock: "0x10"}
+
+	tests := []struct {
+		shape  string
+		status *rpc.SyncStatus
+		want   string
+	}{
+		{"", syncing, `true`},
+		{SyncingBool, synced, `false`},
+		{SyncingGeth, syncing, `{"status":{"currentBlock":"0x10"},"syncing":true}`},
+		{SyncingGeth, synced, `false`},
+		{SyncingReth, syncing, `{"syncing":true,"currentBlock":"0x10"}`},
+		{SyncingReth, synced, `false`},
+	}
+	for _, tt := range tests {
+		data, _ := json.Marshal(Flags{Syncing: tt.shape}.SyncingResult(tt.status))
+		if string(data) != tt.want {
+			t.Errorf("Syncing %q: expected %s, got %s", tt.shape, tt.want, data)
+		}
+	}
+}
+
+func TestErrorWording(t *testing.T) {
+	var original Flags
+	if msg := original.ParseError("Failed to parse JSON-RPC request"); msg != "Failed to parse JSON-RPC request" {
+		t.Errorf("Expected the original wording by default, got %q", msg)
+	}
+	geth := Flags{Errors: ErrorsGeth}
+	if msg := geth.UnsupportedSubscription("foo", ""); msg != `no "foo" subscription in eth namespace` {
+		t.Errorf("Unexpected geth wording: %q", msg)
+	}
+	reth := Flags{Errors: ErrorsReth}
+	if msg := reth.InvalidRequest("Method is required"); msg != "Invalid request" {
+		t.Errorf("Unexpected reth wording: %q", msg)
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,8 +18,245 @@ type Config struct {
 	// PollInterval is the interval for polling new blocks
 	PollInterval time.Duration
 
+	// BigBlockGasPriceInterval is the interval for polling the big block gas price (0 disables)
+	BigBlockGasPriceInterval time.Duration
+
+	// BigBlockMinGasLimit is the gas limit from which a block is treated as a big block
+	BigBlockMinGasLimit int
+
+	// GasPriceHistorySize is the number of gas price changes kept per block type for history and statistics
+	GasPriceHistorySize int
+
 	// SyncThreshold is the maximum allowed block age before considering node out of sync
 	SyncThreshold time.Duration
+
+	// UpstreamTimeout caps the duration of every upstream call
+	UpstreamTimeout time.Duration
+
+	// CircuitBreakerFailures is the number of consecutive failed upstream calls after which calls fail fast (0 disables)
+	CircuitBreakerFailures int
+
+	// CircuitBreakerCooldown is how long an open circuit fails calls fast before letting a trial call through
+	CircuitBreakerCooldown time.Duration
+
+	// UpstreamRetries is how many times an upstream call failing with a transient error is retried (0 disables)
+	UpstreamRetries int
+	// UpstreamRetryBackoff is the backoff before the first retry, doubling up to UpstreamRetryMaxBackoff
+	UpstreamRetryBackoff    time.Duration
+	UpstreamRetryMaxBackoff time.Duration
+
+	// UpstreamRateLimit caps the calls sent to each upstream per second (0 disables)
+	UpstreamRateLimit int
+	// UpstreamRateBurst is the number of calls that may be sent at once above the rate (0 uses UpstreamRateLimit)
+	UpstreamRateBurst int
+	// UpstreamRateLimitWait is how long a call over the rate limit waits for its turn before failing
+	UpstreamRateLimitWait time.Duration
+
+	// UpstreamHedge fires the poller's eth_blockNumber and eth_getBlockByNumber at a second upstream too
+	UpstreamHedge bool
+	// UpstreamHedgeDelay is how long the pinned upstream has to answer before the hedge fires (0 fires both at once)
+	UpstreamHedgeDelay time.Duration
+
+	// UpstreamBatch fetches each polled block's header, logs and receipts in one JSON-RPC batch
+	UpstreamBatch bool
+	// UpstreamBlockReceipts is whether receipts are fetched with eth_getBlockReceipts: auto, on or off
+	UpstreamBlockReceipts string
+
+	// UpstreamMaxIdleConnsPerHost is how many idle connections to each upstream are kept for reuse
+	UpstreamMaxIdleConnsPerHost int
+	// UpstreamMaxConnsPerHost caps the connections to each upstream (0 is unlimited)
+	UpstreamMaxConnsPerHost int
+	// UpstreamFastConcurrency, UpstreamHeavyConcurrency and UpstreamDefaultConcurrency cap the calls in flight
+	// to each upstream by request lane (0 is unlimited; all 0 disables lanes)
+	UpstreamFastConcurrency    int
+	UpstreamHeavyConcurrency   int
+	UpstreamDefaultConcurrency int
+	// UpstreamIdleConnTimeout closes pooled connections idle for that long
+	UpstreamIdleConnTimeout time.Duration
+	// UpstreamKeepAlive reuses connections across upstream calls; disabled, every call dials
+	UpstreamKeepAlive bool
+	// UpstreamTCPKeepAlive is the period of TCP keep-alive probes on upstream connections (negative disables)
+	UpstreamTCPKeepAlive time.Duration
+	// UpstreamDialTimeout and UpstreamTLSHandshakeTimeout cap establishing an upstream connection
+	UpstreamDialTimeout         time.Duration
+	UpstreamTLSHandshakeTimeout time.Duration
+	// UpstreamTLSCAFile is a PEM bundle of CAs trusted for https and wss upstreams instead of the system roots
+	UpstreamTLSCAFile string
+	// UpstreamTLSCertFile and UpstreamTLSKeyFile are a PEM client certificate presented to upstreams
+	UpstreamTLSCertFile string
+	UpstreamTLSKeyFile  string
+	// UpstreamTLSInsecureSkipVerify accepts any upstream certificate
+	UpstreamTLSInsecureSkipVerify bool
+
+	// SlowRequestThreshold is the latency above which forwarded requests are logged as slow (0 disables)
+	SlowRequestThreshold time.Duration
+
+	// UpstreamCheckInterval is the interval for re-checking an unavailable upstream
+	UpstreamCheckInterval time.Duration
+
+	// UpstreamConnTTL is the interval for re-resolving the upstream and recycling pooled connections
+	UpstreamConnTTL time.Duration
+
+	// UpstreamProbeInterval is the interval between background upstream latency probes (0 disables)
+	UpstreamProbeInterval time.Duration
+
+	// UpstreamURLs are further upstreams that forwarded calls are balanced across with RPC_URL
+	UpstreamURLs []string
+
+	// UpstreamWSURL is a ws:// endpoint whose newHeads stream replaces block polling while connected (empty disables)
+	UpstreamWSURL string
+	// UpstreamWSTimeout drops a head stream silent for that long, falling back to polling
+	UpstreamWSTimeout time.Duration
+
+	// StaleMaxAge is how old cached read results answered while the upstream is down may be (0 disables)
+	StaleMaxAge time.Duration
+	// CacheMaxEntries bounds the results held by the head cache
+	CacheMaxEntries int
+	// SendQueueSize is how many eth_sendRawTransaction calls are queued while the upstream is down (0 disables)
+	SendQueueSize int
+	// SendQueueTTL drops queued transactions not sent within it
+	SendQueueTTL time.Duration
+	// SendQueueRetryInterval is how often queued transactions are retried
+	SendQueueRetryInterval time.Duration
+
+	// AdminToken grants access to admin-only features (empty disables them)
+	AdminToken string
+
+	// TLSCertFile and TLSKeyFile serve the public listener over TLS (empty serves plain HTTP)
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile verifies client certificates, which identify their connections
+	TLSClientCAFile string
+	// TLSClientAuth is "optional" or "require" (connections without a valid client certificate are refused)
+	TLSClientAuth string
+	// TLSAdminIdentities are client certificate identities granted admin access
+	TLSAdminIdentities []string
+
+	// ProxyMetricsInterval is the interval between proxyMetrics notifications
+	ProxyMetricsInterval time.Duration
+
+	// TestInterval is the interval between synthetic test subscription notifications (0 disables the subscription)
+	TestInterval time.Duration
+
+	// FeeHistoryInterval is the interval between feeHistory notifications (0 disables them)
+	FeeHistoryInterval time.Duration
+
+	// Confirmations is the default emission delay in blocks for newHeads and logs subscriptions
+	Confirmations int
+
+	// Watchlist is the contract addresses whose logs are always retained locally for instant backfills
+	Watchlist []string
+
+	// WatchlistRetentionBlocks is the number of recent blocks of watchlist logs retained
+	WatchlistRetentionBlocks int
+
+	// AddressLabelsFile is a JSON file of operator address labels used to annotate notifications
+	AddressLabelsFile string
+
+	// LogsBackfillMaxBlocks is the maximum block range replayed for a logs fromBlock backfill
+	LogsBackfillMaxBlocks int
+
+	// KeepalivePingInterval and KeepalivePongTimeout are the keepalive of server clients and unclassified clients
+	KeepalivePingInterval time.Duration
+	KeepalivePongTimeout  time.Duration
+
+	// ConsumerPingInterval and ConsumerPongTimeout are the keepalive of browser and mobile clients
+	ConsumerPingInterval time.Duration
+	ConsumerPongTimeout  time.Duration
+
+	// ResumeTTL is how long resumable subscriptions of a disconnected client are kept
+	ResumeTTL time.Duration
+
+	// OrphanSweepInterval is how often subscriptions whose client is gone are looked for; 0 disables the sweep
+	OrphanSweepInterval time.Duration
+
+	// ResumeBufferSize is the number of notifications retained per resumable subscription
+	ResumeBufferSize int
+
+	// DeltaSnapshotInterval is how many notifications of a delta newHeads subscription are sent between full snapshots
+	DeltaSnapshotInterval int
+
+	// NotificationErrorLimit is the number of consecutive notifications that can't be created after which a subscription is removed (0 never removes)
+	NotificationErrorLimit int
+
+	// Console serves the HTML test console on plain GET / requests
+	Console bool
+
+	// SelfTest runs a newHeads round trip over the server's own port at startup, holding back readiness until it passes
+	SelfTest        bool
+	SelfTestTimeout time.Duration
+	// SelfTestExit exits the process when the self-test fails
+	SelfTestExit bool
+
+	// InstanceID identifies this replica to clients and load balancers (defaults to the hostname)
+	InstanceID string
+
+	// InstanceHeader is the upgrade response header carrying the instance ID (empty disables)
+	InstanceHeader string
+
+	// StickyCookie is the name of the upgrade response cookie carrying the instance ID (empty disables)
+	StickyCookie string
+
+	// ConstLabels are "name=value" labels added to every metric and log line,
+	// e.g. cluster, region or environment
+	ConstLabels []string
+
+	// UsageRetention is how long hourly usage by API key is kept for /admin/usage (0 disables usage reports)
+	UsageRetention time.Duration
+	// UsageFile persists usage reports across restarts (empty keeps them in memory only)
+	UsageFile string
+
+	// QuotaRequests and QuotaBytes limit the requests and bytes sent per QuotaWindow of each
+	// non-admin connection (0 is unlimited)
+	QuotaRequests int
+	QuotaBytes    int
+	QuotaWindow   time.Duration
+
+	// FilterTimeout uninstalls polling filters not polled within it (0 keeps them until uninstalled)
+	FilterTimeout time.Duration
+
+	// EventBuffer is how many polled block events queue for buffered consumers such as storage
+	EventBuffer int
+
+	// StorageBackend stores polled blocks, logs and receipts ("memory"; empty disables)
+	StorageBackend string
+	// StorageRetentionBlocks is the number of recent blocks kept in storage
+	StorageRetentionBlocks int
+	// StorageRetentionAge evicts stored blocks older than it by block timestamp (0 disables)
+	StorageRetentionAge time.Duration
+	// StorageRetentionBytes evicts the oldest stored blocks while storage is larger (0 disables)
+	StorageRetentionBytes int
+	// StorageRetentionInterval is how often retention limits are enforced and storage compacted
+	StorageRetentionInterval time.Duration
+	// WarmUpBlocks is the number of recent blocks prefetched into storage at startup (0 disables)
+	WarmUpBlocks int
+	// WarmUpTimeout bounds the startup warm-up
+	WarmUpTimeout time.Duration
+
+	// ArchiveURL locates the bucket stored segments are flushed to (file://, s3:// or gs://; empty disables)
+	ArchiveURL string
+	// ArchiveAccessKeyID and ArchiveSecretAccessKey sign requests to S3 and GCS buckets
+	ArchiveAccessKeyID     string
+	ArchiveSecretAccessKey string
+	// ArchiveSegmentBlocks is the number of blocks per archived segment
+	ArchiveSegmentBlocks int
+	// ArchiveInterval is how often completed segments are flushed
+	ArchiveInterval time.Duration
+
+	// HeaderHashCheck recomputes polled header hashes: "off", "warn" broadcasts
+	// mismatching headers anyway, "reject" refuses to broadcast them
+	HeaderHashCheck string
+
+	// CompatProfile selects the provider whose response details are mimicked
+	// ("default", "geth", "reth" or "alchemy"); the Compat* fields below
+	// override single flags of the profile when set
+	CompatProfile             string
+	CompatEmptyResult         string
+	CompatSubscriptionIDBytes int
+	// CompatTrimSubscriptionID is "true" or "false", empty for the profile's
+	CompatTrimSubscriptionID string
+	CompatSyncing            string
+	CompatErrors             string
 }
 
 // Load reads configuration from environment variables
@@ -28,6 +266,136 @@ func Load() *Config {
 		WebSocketPort: getEnvInt("WS_PORT", 8080),
 		PollInterval:  getEnvDuration("POLL_INTERVAL", 100*time.Millisecond),
 		SyncThreshold: getEnvDuration("SYNC_THRESHOLD", 15*time.Second),
+
+		BigBlockGasPriceInterval: getEnvDuration("BIG_BLOCK_GAS_PRICE_INTERVAL", 10*time.Second),
+		BigBlockMinGasLimit:      getEnvInt("BIG_BLOCK_MIN_GAS_LIMIT", 10000000),
+		GasPriceHistorySize:      getEnvInt("GAS_PRICE_HISTORY_SIZE", 1000),
+
+		UpstreamTimeout:       getEnvDuration("UPSTREAM_TIMEOUT", 30*time.Second),
+		SlowRequestThreshold:  getEnvDuration("SLOW_REQUEST_THRESHOLD", 1*time.Second),
+		UpstreamCheckInterval: getEnvDuration("UPSTREAM_CHECK_INTERVAL", 5*time.Second),
+		UpstreamConnTTL:       getEnvDuration("UPSTREAM_CONN_TTL", 5*time.Minute),
+		UpstreamProbeInterval: getEnvDuration("UPSTREAM_PROBE_INTERVAL", 10*time.Second),
+		UpstreamURLs:          getEnvList("UPSTREAM_URLS"),
+		UpstreamWSURL:         getEnv("UPSTREAM_WS_URL", ""),
+		UpstreamWSTimeout:     getEnvDuration("UPSTREAM_WS_TIMEOUT", 10*time.Second),
+
+		CircuitBreakerFailures: getEnvInt("CIRCUIT_BREAKER_FAILURES", 5),
+		CircuitBreakerCooldown: getEnvDuration("CIRCUIT_BREAKER_COOLDOWN", 10*time.Second),
+
+		UpstreamRetries:         getEnvInt("UPSTREAM_RETRIES", 2),
+		UpstreamRetryBackoff:    getEnvDuration("UPSTREAM_RETRY_BACKOFF", 100*time.Millisecond),
+		UpstreamRetryMaxBackoff: getEnvDuration("UPSTREAM_RETRY_MAX_BACKOFF", 2*time.Second),
+
+		UpstreamRateLimit:     getEnvInt("UPSTREAM_RATE_LIMIT", 0),
+		UpstreamRateBurst:     getEnvInt("UPSTREAM_RATE_BURST", 0),
+		UpstreamRateLimitWait: getEnvDuration("UPSTREAM_RATE_LIMIT_WAIT", 500*time.Millisecond),
+
+		UpstreamHedge:      getEnvBool("UPSTREAM_HEDGE", false),
+		UpstreamHedgeDelay: getEnvDuration("UPSTREAM_HEDGE_DELAY", 50*time.Millisecond),
+
+		UpstreamBatch:         getEnvBool("UPSTREAM_BATCH", true),
+		UpstreamBlockReceipts: getEnv("UPSTREAM_BLOCK_RECEIPTS", "auto"),
+
+		UpstreamMaxIdleConnsPerHost: getEnvInt("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", 64),
+		UpstreamMaxConnsPerHost:     getEnvInt("UPSTREAM_MAX_CONNS_PER_HOST", 0),
+		UpstreamFastConcurrency:     getEnvInt("UPSTREAM_FAST_CONCURRENCY", 0),
+		UpstreamHeavyConcurrency:    getEnvInt("UPSTREAM_HEAVY_CONCURRENCY", 0),
+		UpstreamDefaultConcurrency:  getEnvInt("UPSTREAM_DEFAULT_CONCURRENCY", 0),
+		UpstreamIdleConnTimeout:     getEnvDuration("UPSTREAM_IDLE_CONN_TIMEOUT", 90*time.Second),
+		UpstreamKeepAlive:           getEnvBool("UPSTREAM_KEEPALIVE", true),
+		UpstreamTCPKeepAlive:        getEnvDuration("UPSTREAM_TCP_KEEPALIVE", 30*time.Second),
+		UpstreamDialTimeout:         getEnvDuration("UPSTREAM_DIAL_TIMEOUT", 30*time.Second),
+		UpstreamTLSHandshakeTimeout: getEnvDuration("UPSTREAM_TLS_HANDSHAKE_TIMEOUT", 10*time.Second),
+
+		UpstreamTLSCAFile:             getEnv("UPSTREAM_TLS_CA_FILE", ""),
+		UpstreamTLSCertFile:           getEnv("UPSTREAM_TLS_CERT_FILE", ""),
+		UpstreamTLSKeyFile:            getEnv("UPSTREAM_TLS_KEY_FILE", ""),
+		UpstreamTLSInsecureSkipVerify: getEnvBool("UPSTREAM_TLS_INSECURE_SKIP_VERIFY", false),
+
+		StaleMaxAge:            getEnvDuration("STALE_MAX_AGE", 0),
+		CacheMaxEntries:        getEnvInt("CACHE_MAX_ENTRIES", 10000),
+		SendQueueSize:          getEnvInt("SEND_QUEUE_SIZE", 0),
+		SendQueueTTL:           getEnvDuration("SEND_QUEUE_TTL", 2*time.Minute),
+		SendQueueRetryInterval: getEnvDuration("SEND_QUEUE_RETRY_INTERVAL", time.Second),
+
+		TLSCertFile:        getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:         getEnv("TLS_KEY_FILE", ""),
+		TLSClientCAFile:    getEnv("TLS_CLIENT_CA_FILE", ""),
+		TLSClientAuth:      getEnv("TLS_CLIENT_AUTH", "optional"),
+		TLSAdminIdentities: getEnvList("TLS_ADMIN_IDENTITIES"),
+
+		AdminToken:           getEnv("ADMIN_TOKEN", ""),
+		ProxyMetricsInterval: getEnvDuration("PROXY_METRICS_INTERVAL", 5*time.Second),
+		TestInterval:         getEnvDuration("TEST_INTERVAL", 0),
+		FeeHistoryInterval:   getEnvDuration("FEE_HISTORY_INTERVAL", 5*time.Second),
+
+		Confirmations:         getEnvInt("CONFIRMATIONS", 0),
+		LogsBackfillMaxBlocks: getEnvInt("LOGS_BACKFILL_MAX_BLOCKS", 1000),
+
+		Watchlist:                getEnvList("WATCHLIST"),
+		WatchlistRetentionBlocks: getEnvInt("WATCHLIST_RETENTION_BLOCKS", 10000),
+
+		AddressLabelsFile: getEnv("ADDRESS_LABELS_FILE", ""),
+
+		KeepalivePingInterval: getEnvDuration("KEEPALIVE_PING_INTERVAL", 30*time.Second),
+		KeepalivePongTimeout:  getEnvDuration("KEEPALIVE_PONG_TIMEOUT", 60*time.Second),
+		ConsumerPingInterval:  getEnvDuration("CONSUMER_PING_INTERVAL", 15*time.Second),
+		ConsumerPongTimeout:   getEnvDuration("CONSUMER_PONG_TIMEOUT", 120*time.Second),
+
+		ResumeTTL:        getEnvDuration("RESUME_TTL", 60*time.Second),
+		ResumeBufferSize: getEnvInt("RESUME_BUFFER_SIZE", 256),
+
+		OrphanSweepInterval: getEnvDuration("ORPHAN_SWEEP_INTERVAL", time.Minute),
+
+		DeltaSnapshotInterval:  getEnvInt("DELTA_SNAPSHOT_INTERVAL", 32),
+		NotificationErrorLimit: getEnvInt("NOTIFICATION_ERROR_LIMIT", 3),
+
+		Console: getEnvBool("CONSOLE", false),
+
+		SelfTest:        getEnvBool("SELF_TEST", true),
+		SelfTestTimeout: getEnvDuration("SELF_TEST_TIMEOUT", 5*time.Second),
+		SelfTestExit:    getEnvBool("SELF_TEST_EXIT", false),
+
+		InstanceID:     getEnv("INSTANCE_ID", ""),
+		InstanceHeader: getEnv("INSTANCE_HEADER", "X-Instance-ID"),
+		StickyCookie:   getEnv("STICKY_COOKIE", ""),
+
+		ConstLabels: getEnvList("CONST_LABELS"),
+
+		UsageRetention: getEnvDuration("USAGE_RETENTION", 30*24*time.Hour),
+		UsageFile:      getEnv("USAGE_FILE", ""),
+
+		QuotaRequests: getEnvInt("QUOTA_REQUESTS", 0),
+		QuotaBytes:    getEnvInt("QUOTA_BYTES", 0),
+		QuotaWindow:   getEnvDuration("QUOTA_WINDOW", time.Hour),
+
+		FilterTimeout: getEnvDuration("FILTER_TIMEOUT", 5*time.Minute),
+
+		EventBuffer: getEnvInt("EVENT_BUFFER", 256),
+
+		StorageBackend:           getEnv("STORAGE_BACKEND", ""),
+		StorageRetentionBlocks:   getEnvInt("STORAGE_RETENTION_BLOCKS", 10000),
+		StorageRetentionAge:      getEnvDuration("STORAGE_RETENTION_AGE", 0),
+		StorageRetentionBytes:    getEnvInt("STORAGE_RETENTION_BYTES", 0),
+		StorageRetentionInterval: getEnvDuration("STORAGE_RETENTION_INTERVAL", 10*time.Second),
+		WarmUpBlocks:             getEnvInt("WARMUP_BLOCKS", 0),
+		WarmUpTimeout:            getEnvDuration("WARMUP_TIMEOUT", time.Minute),
+
+		ArchiveURL:             getEnv("ARCHIVE_URL", ""),
+		ArchiveAccessKeyID:     getEnv("ARCHIVE_ACCESS_KEY_ID", ""),
+		ArchiveSecretAccessKey: getEnv("ARCHIVE_SECRET_ACCESS_KEY", ""),
+		ArchiveSegmentBlocks:   getEnvInt("ARCHIVE_SEGMENT_BLOCKS", 1000),
+		ArchiveInterval:        getEnvDuration("ARCHIVE_INTERVAL", time.Minute),
+
+		HeaderHashCheck: getEnv("HEADER_HASH_CHECK", "off"),
+
+		CompatProfile:             getEnv("COMPAT_PROFILE", "default"),
+		CompatEmptyResult:         getEnv("COMPAT_EMPTY_RESULT", ""),
+		CompatSubscriptionIDBytes: getEnvInt("COMPAT_SUBSCRIPTION_ID_BYTES", 0),
+		CompatTrimSubscriptionID:  getEnv("COMPAT_TRIM_SUBSCRIPTION_ID", ""),
+		CompatSyncing:             getEnv("COMPAT_SYNCING", ""),
+		CompatErrors:              getEnv("COMPAT_ERRORS", ""),
 	}
 	return cfg
 }
@@ -48,6 +416,26 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList reads a comma-separated list, ignoring empty entries
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -0,0 +1,154 @@
+// Package events carries what the block poller observes to the parts of the
+// server that act on it, so the broadcaster, storage and future sinks attach
+// as consumers instead of being called from the poll loop
+package events
+
+import (
+	"sync"
+
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+	"hlnode-websocket/internal/recovery"
+	"hlnode-websocket/internal/rpc"
+)
+
+// Kinds of events, used as metric labels
+const (
+	KindReorg    = "reorg"
+	KindBlock    = "block"
+	KindReceipts = "receipts"
+)
+
+// Event is one of ReorgEvent, BlockEvent or ReceiptsEvent; consumers switch
+// on the type
+type Event interface {
+	Kind() string
+}
+
+// ReorgEvent is published before the first block of the new branch, so
+// consumers can roll back first
+type ReorgEvent struct {
+	Reorg *rpc.Reorg
+}
+
+// BlockEvent is a new head with its logs. Logs is nil when LogsErr reports
+// they couldn't be fetched.
+type BlockEvent struct {
+	Number  uint64
+	Header  *rpc.FullBlockHeader
+	Logs    []rpc.Log
+	LogsErr error
+}
+
+// ReceiptsEvent follows the BlockEvent of a block whose receipts were
+// fetched, which happens only while someone needs them. Receipts is nil when
+// Err reports they couldn't be fetched.
+type ReceiptsEvent struct {
+	Number   uint64
+	Header   *rpc.FullBlockHeader
+	Receipts []rpc.TransactionReceipt
+	Err      error
+}
+
+func (ReorgEvent) Kind() string    { return KindReorg }
+func (BlockEvent) Kind() string    { return KindBlock }
+func (ReceiptsEvent) Kind() string { return KindReceipts }
+
+// Options configures a consumer
+type Options struct {
+	// Buffer is how many events queue for the consumer, which then runs on
+	// its own goroutine; with 0 it runs synchronously in Publish, in
+	// subscription order
+	Buffer int
+	// Lossy drops events while the queue is full instead of making Publish
+	// wait for room
+	Lossy bool
+}
+
+// consumer is a subscribed event handler
+type consumer struct {
+	name   string
+	fn     func(Event)
+	lossy  bool
+	queue  chan Event
+	done   chan struct{}
+	closed bool
+}
+
+// Bus delivers every published event to all consumers in publication order
+type Bus struct {
+	mu        sync.RWMutex
+	consumers []*consumer
+}
+
+// NewBus creates an event bus without consumers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers fn under name, which labels the consumer's metrics
+func (b *Bus) Subscribe(name string, opts Options, fn func(Event)) {
+	c := &consumer{name: name, fn: fn, lossy: opts.Lossy}
+	if opts.Buffer > 0 {
+		c.queue = make(chan Event, opts.Buffer)
+		c.done = make(chan struct{})
+		go func() {
+			defer close(c.done)
+			recovery.Supervise("events."+name, func() {
+				for ev := range c.queue {
+					metrics.EventQueueDepth.WithLabelValues(name).Set(float64(len(c.queue)))
+					c.fn(ev)
+				}
+			})
+		}()
+	}
+	b.mu.Lock()
+	b.consumers = append(b.consumers, c)
+	b.mu.Unlock()
+}
+
+// Publish delivers ev to every consumer: synchronous ones run before it
+// returns, buffered ones are queued
+func (b *Bus) Publish(ev Event) {
+	metrics.EventsPublishedTotal.WithLabelValues(ev.Kind()).Inc()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, c := range b.consumers {
+		switch {
+		case c.closed:
+		case c.queue == nil:
+			c.fn(ev)
+		case c.lossy:
+			select {
+			case c.queue <- ev:
+			default:
+				metrics.EventsDroppedTotal.WithLabelValues(c.name).Inc()
+				logger.Debug("Event consumer %s is full, dropping %s event", c.name, ev.Kind())
+			}
+		default:
+			c.queue <- ev
+		}
+		if c.queue != nil {
+			metrics.EventQueueDepth.WithLabelValues(c.name).Set(float64(len(c.queue)))
+		}
+	}
+}
+
+// Close stops accepting events and waits for the buffered consumers to
+// handle the events already queued
+func (b *Bus) Close() {
+	b.mu.Lock()
+	consumers := b.consumers
+	for _, c := range consumers {
+		if !c.closed && c.queue != nil {
+			close(c.queue)
+		}
+		c.closed = true
+	}
+	b.mu.Unlock()
+	for _, c := range consumers {
+		if c.done != nil {
+			<-c.done
+		}
+	}
+}
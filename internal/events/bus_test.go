@@ -0,0 +1,97 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"hlnode-websocket/internal/recovery"
+	"hlnode-websocket/internal/rpc"
+)
+
+func TestBusPublish(t *testing.T) {
+	bus := NewBus()
+
+	var got []string
+	bus.Subscribe("a", Options{}, func(ev Event) { got = append(got, "a:"+ev.Kind()) })
+	bus.Subscribe("b", Options{}, func(ev Event) { got = append(got, "b:"+ev.Kind()) })
+
+	var mu sync.Mutex
+	var buffered []uint64
+	bus.Subscribe("c", Options{Buffer: 4}, func(ev Event) {
+		if block, ok := ev.(BlockEvent); ok {
+			mu.Lock()
+			buffered = append(buffered, block.Number)
+			mu.Unlock()
+		}
+	})
+
+	bus.Publish(ReorgEvent{Reorg: &rpc.Reorg{}})
+	for number := uint64(1); number <= 10; number++ {
+		bus.Publish(BlockEvent{Number: number, Header: &rpc.FullBlockHeader{}})
+	}
+
+	if len(got) != 22 || got[0] != "a:reorg" || got[1] != "b:reorg" || got[2] != "a:block" {
+		t.Errorf("Expected synchronous consumers called in order, got %v", got)
+	}
+
+	// Close waits for the queue to drain; the blocking queue loses nothing
+	bus.Close()
+	if len(buffered) != 10 || buffered[0] != 1 || buffered[9] != 10 {
+		t.Errorf("Expected all blocks in order, got %v", buffered)
+	}
+
+	bus.Publish(BlockEvent{Number: 11})
+	if len(got) != 22 {
+		t.Error("Expected no delivery after Close")
+	}
+}
+
+func TestBusLossy(t *testing.T) {
+	bus := NewBus()
+
+	release := make(chan struct{})
+	var handled []uint64
+	bus.Subscribe("slow", Options{Buffer: 1, Lossy: true}, func(ev Event) {
+		<-release
+		handled = append(handled, ev.(BlockEvent).Number)
+	})
+	var synchronous int
+	bus.Subscribe("fast", Options{}, func(Event) { synchronous++ })
+
+	// The consumer holds at most one event and queues one more; the rest
+	// are dropped without holding up Publish or the other consumers
+	for number := uint64(1); number <= 5; number++ {
+		bus.Publish(BlockEvent{Number: number})
+	}
+	if synchronous != 5 {
+		t.Errorf("Expected the synchronous consumer to get all 5 events, got %d", synchronous)
+	}
+	close(release)
+	bus.Close()
+	if len(handled) < 1 || len(handled) > 2 || handled[0] != 1 {
+		t.Errorf("Expected the first events kept and the rest dropped, got %v", handled)
+	}
+}
+
+func TestBusConsumerPanic(t *testing.T) {
+	defer func(delay time.Duration) { recovery.RestartDelay = delay }(recovery.RestartDelay)
+	recovery.RestartDelay = 0
+	bus := NewBus()
+
+	var handled []uint64
+	bus.Subscribe("flaky", Options{Buffer: 4}, func(ev Event) {
+		number := ev.(BlockEvent).Number
+		if number == 2 {
+			panic("boom")
+		}
+		handled = append(handled, number)
+	})
+	for number := uint64(1); number <= 3; number++ {
+		bus.Publish(BlockEvent{Number: number})
+	}
+	bus.Close()
+	if len(handled) != 2 || handled[0] != 1 || handled[1] != 3 {
+		t.Errorf("Expected the consumer to carry on after a panic, got %v", handled)
+	}
+}
@@ -0,0 +1,308 @@
+// Package filters implements the polling filter API (eth_newFilter,
+// eth_newBlockFilter, eth_getFilterChanges, eth_getFilterLogs,
+// eth_uninstallFilter) locally, fed by the block poller with the same heads
+// and logs that are broadcast to subscriptions
+package filters
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"hlnode-websocket/internal/clock"
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/subscription"
+)
+
+// MaxFilters is the most filters installed at once
+const MaxFilters = 10000
+
+// MaxPendingLogs is the most logs a filter keeps between polls; older ones are dropped
+const MaxPendingLogs = 10000
+
+// MaxPendingBlocks is the most block hashes a block filter keeps between polls; older ones are dropped
+const MaxPendingBlocks = 10000
+
+// ErrFilterNotFound is returned for unknown filter IDs
+var ErrFilterNotFound = errors.New("filter not found")
+
+// Filter is an installed log or block filter and the matching logs or new
+// block hashes not yet polled
+type Filter struct {
+	ID string
+	// blocks is set for block filters, which report new block hashes instead of logs
+	blocks bool
+
+	criteria  []subscription.LogFilter
+	fromBlock uint64
+	toBlock   uint64 // 0 means no upper bound
+
+	pending       []rpc.Log
+	pendingBlocks []string
+
+	// lastPoll is when the filter was installed or last polled for changes
+	lastPoll time.Time
+}
+
+// kind is the filter's type for metrics
+func (f *Filter) kind() string {
+	if f.blocks {
+		return "blocks"
+	}
+	return "logs"
+}
+
+// Manager holds the installed filters
+type Manager struct {
+	filters map[string]*Filter
+	// head is the last block whose logs were added
+	head  uint64
+	clock clock.Clock
+	mu    sync.Mutex
+}
+
+// NewManager creates an empty filter manager
+func NewManager() *Manager {
+	return &Manager{filters: make(map[string]*Filter), clock: clock.Real}
+}
+
+// SetClock replaces the clock timing filter polls, e.g. with a clock.Fake in tests
+func (m *Manager) SetClock(c clock.Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = c
+}
+
+// NewLogFilter installs a log filter from eth_newFilter criteria and returns its ID.
+// Only logs of blocks polled after installation are reported; fromBlock and
+// toBlock bound the blocks whose logs match.
+func (m *Manager) NewLogFilter(criteria json.RawMessage) (string, error) {
+	var fields map[string]json.RawMessage
+	if len(criteria) > 0 && string(criteria) != "null" {
+		if err := json.Unmarshal(criteria, &fields); err != nil {
+			return "", fmt.Errorf("filter must be an object")
+		}
+	}
+	if _, ok := fields["blockHash"]; ok {
+		return "", fmt.Errorf("blockHash filters are not supported")
+	}
+
+	filter := &Filter{ID: generateFilterID()}
+	var err error
+	if filter.fromBlock, err = blockBound(fields["fromBlock"], "fromBlock"); err != nil {
+		return "", err
+	}
+	if filter.toBlock, err = blockBound(fields["toBlock"], "toBlock"); err != nil {
+		return "", err
+	}
+	if filter.toBlock != 0 && filter.toBlock < filter.fromBlock {
+		return "", fmt.Errorf("toBlock is before fromBlock")
+	}
+	delete(fields, "toBlock")
+
+	logFilter, _ := json.Marshal(fields)
+	if filter.criteria, err = subscription.ParseLogFilters(logFilter); err != nil {
+		return "", err
+	}
+	return m.install(filter)
+}
+
+// NewBlockFilter installs a filter reporting the hashes of blocks polled
+// after installation and returns its ID
+func (m *Manager) NewBlockFilter() (string, error) {
+	return m.install(&Filter{ID: generateFilterID(), blocks: true})
+}
+
+// install adds a filter unless MaxFilters are already installed
+func (m *Manager) install(filter *Filter) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.filters) >= MaxFilters {
+		return "", fmt.Errorf("at most %d filters can be installed", MaxFilters)
+	}
+	filter.lastPoll = m.clock.Now()
+	m.filters[filter.ID] = filter
+	metrics.LocalFiltersActive.Set(float64(len(m.filters)))
+	return filter.ID, nil
+}
+
+// blockBound parses a fromBlock/toBlock bound: a hex block number, or a
+// block tag or nothing, which don't bound the range
+func blockBound(value json.RawMessage, name string) (uint64, error) {
+	if value == nil {
+		return 0, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return 0, fmt.Errorf("%s: must be a string", name)
+	}
+	switch s {
+	case "", "latest", "earliest", "pending", "safe", "finalized":
+		return 0, nil
+	}
+	n, err := rpc.ParseHexUint64(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not a block number or tag", name, s)
+	}
+	return n, nil
+}
+
+// AddLogs queues the logs of a new block for the filters they match
+func (m *Manager) AddLogs(blockNum uint64, logs []rpc.Log) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.head = blockNum
+	for _, filter := range m.filters {
+		if filter.blocks {
+			continue
+		}
+		if blockNum < filter.fromBlock || (filter.toBlock != 0 && blockNum > filter.toBlock) {
+			continue
+		}
+		for i := range logs {
+			if subscription.MatchesAnyLogFilter(&logs[i], filter.criteria) {
+				filter.pending = append(filter.pending, logs[i])
+			}
+		}
+		if dropped := len(filter.pending) - MaxPendingLogs; dropped > 0 {
+			logger.Warn("Filter %s not polled, dropping %d oldest logs", filter.ID, dropped)
+			filter.pending = append([]rpc.Log(nil), filter.pending[dropped:]...)
+		}
+	}
+}
+
+// AddBlock queues the hash of a new block for the block filters
+func (m *Manager) AddBlock(hash string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, filter := range m.filters {
+		if !filter.blocks {
+			continue
+		}
+		filter.pendingBlocks = append(filter.pendingBlocks, hash)
+		if dropped := len(filter.pendingBlocks) - MaxPendingBlocks; dropped > 0 {
+			logger.Warn("Filter %s not polled, dropping %d oldest blocks", filter.ID, dropped)
+			filter.pendingBlocks = append([]string(nil), filter.pendingBlocks[dropped:]...)
+		}
+	}
+}
+
+// Changes returns what a filter matched since the last call and clears it:
+// a []rpc.Log for log filters, a []string of block hashes for block filters.
+// ok is false if the filter doesn't exist.
+func (m *Manager) Changes(id string) (changes interface{}, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	filter, ok := m.filters[id]
+	if !ok {
+		return nil, false
+	}
+	filter.lastPoll = m.clock.Now()
+	if filter.blocks {
+		hashes := filter.pendingBlocks
+		filter.pendingBlocks = nil
+		if hashes == nil {
+			hashes = []string{}
+		}
+		return hashes, true
+	}
+	logs := filter.pending
+	filter.pending = nil
+	if logs == nil {
+		logs = []rpc.Log{}
+	}
+	return logs, true
+}
+
+// LogQuery is the block range and criteria of a log filter, resolved for eth_getFilterLogs
+type LogQuery struct {
+	FromBlock uint64
+	ToBlock   uint64
+	Criteria  []subscription.LogFilter
+}
+
+// LogQuery returns the block range and criteria of a log filter for
+// eth_getFilterLogs. Unbounded ends of the range, given as a block tag or
+// omitted, resolve to the last polled head.
+func (m *Manager) LogQuery(id string) (*LogQuery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	filter, ok := m.filters[id]
+	if !ok {
+		return nil, ErrFilterNotFound
+	}
+	if filter.blocks {
+		return nil, fmt.Errorf("filter %s is not a log filter", id)
+	}
+	q := &LogQuery{FromBlock: filter.fromBlock, ToBlock: filter.toBlock, Criteria: filter.criteria}
+	if q.FromBlock == 0 || q.ToBlock == 0 {
+		if m.head == 0 {
+			return nil, fmt.Errorf("no block polled yet")
+		}
+		if q.FromBlock == 0 {
+			q.FromBlock = m.head
+		}
+		if q.ToBlock == 0 {
+			q.ToBlock = m.head
+		}
+	}
+	return q, nil
+}
+
+// Uninstall removes a filter and reports whether it existed
+func (m *Manager) Uninstall(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.filters[id]; !ok {
+		return false
+	}
+	delete(m.filters, id)
+	metrics.LocalFiltersActive.Set(float64(len(m.filters)))
+	return true
+}
+
+// Expire uninstalls the filters not polled for changes within timeout of
+// now and returns how many were removed. eth_getFilterLogs doesn't count as
+// a poll, as in geth.
+func (m *Manager) Expire(now time.Time, timeout time.Duration) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := 0
+	for id, filter := range m.filters {
+		if now.Sub(filter.lastPoll) < timeout {
+			continue
+		}
+		delete(m.filters, id)
+		metrics.LocalFiltersExpired.WithLabelValues(filter.kind()).Inc()
+		expired++
+	}
+	if expired > 0 {
+		metrics.LocalFiltersActive.Set(float64(len(m.filters)))
+	}
+	return expired
+}
+
+// Len returns the number of installed filters
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.filters)
+}
+
+func generateFilterID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return "0x" + hex.EncodeToString(bytes)
+}
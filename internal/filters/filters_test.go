@@ -0,0 +1,174 @@
+package filters
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"hlnode-websocket/internal/clock"
+	"hlnode-websocket/internal/rpc"
+)
+
+const (
+	tokenA = "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	tokenB = "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+// logChanges returns the changes of a log filter
+func logChanges(m *Manager, id string) ([]rpc.Log, bool) {
+	changes, ok := m.Changes(id)
+	logs, _ := changes.([]rpc.Log)
+	return logs, ok
+}
+
+func TestNewLogFilterInvalid(t *testing.T) {
+	m := NewManager()
+	tests := []struct {
+		criteria string
+		message  string
+	}{
+		{`[]`, "must be an object"},
+		{`{"blockHash": "0x01"}`, "blockHash"},
+		{`{"fromBlock": 5}`, "fromBlock"},
+		{`{"toBlock": "soon"}`, "toBlock"},
+		{`{"fromBlock": "0x10", "toBlock": "0x5"}`, "before fromBlock"},
+		{`{"address": "0x12"}`, "address"},
+		{`{"topic": []}`, "unknown field"},
+	}
+	for _, tt := range tests {
+		_, err := m.NewLogFilter(json.RawMessage(tt.criteria))
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("Expected error mentioning %q for %s, got %v", tt.message, tt.criteria, err)
+		}
+	}
+	if m.Len() != 0 {
+		t.Errorf("Expected no filters installed, got %d", m.Len())
+	}
+}
+
+func TestFilterChanges(t *testing.T) {
+	m := NewManager()
+	all, err := m.NewLogFilter(nil)
+	if err != nil {
+		t.Fatalf("NewLogFilter failed: %v", err)
+	}
+	onlyA, _ := m.NewLogFilter(json.RawMessage(`{"address": "` + tokenA + `"}`))
+	bounded, _ := m.NewLogFilter(json.RawMessage(`{"fromBlock": "0x11", "toBlock": "0x11"}`))
+
+	m.AddLogs(0x10, []rpc.Log{{Address: tokenA, LogIndex: "0x0"}, {Address: tokenB, LogIndex: "0x1"}})
+	m.AddLogs(0x11, []rpc.Log{{Address: tokenA, LogIndex: "0x0"}})
+
+	if logs, ok := logChanges(m, all); !ok || len(logs) != 3 {
+		t.Errorf("Expected 3 logs for the match-all filter, got %d", len(logs))
+	}
+	if logs, _ := logChanges(m, onlyA); len(logs) != 2 || logs[0].Address != tokenA {
+		t.Errorf("Expected 2 logs of tokenA, got %+v", logs)
+	}
+	if logs, _ := logChanges(m, bounded); len(logs) != 1 {
+		t.Errorf("Expected only the log of block 0x11, got %+v", logs)
+	}
+
+	// Changes are cleared by polling
+	if logs, ok := logChanges(m, all); !ok || logs == nil || len(logs) != 0 {
+		t.Errorf("Expected an empty array after polling, got %v", logs)
+	}
+
+	if !m.Uninstall(all) || m.Uninstall(all) {
+		t.Error("Expected the filter to be uninstalled exactly once")
+	}
+	if _, ok := logChanges(m, all); ok {
+		t.Error("Expected uninstalled filter to be unknown")
+	}
+}
+
+func TestFilterPendingCap(t *testing.T) {
+	m := NewManager()
+	id, _ := m.NewLogFilter(nil)
+
+	logs := make([]rpc.Log, MaxPendingLogs/2+1)
+	m.AddLogs(1, logs)
+	m.AddLogs(2, logs)
+
+	pending, _ := logChanges(m, id)
+	if len(pending) != MaxPendingLogs {
+		t.Errorf("Expected pending logs capped at %d, got %d", MaxPendingLogs, len(pending))
+	}
+}
+
+func TestBlockFilter(t *testing.T) {
+	m := NewManager()
+	logFilter, _ := m.NewLogFilter(nil)
+	m.AddBlock("0x01")
+	blocks, err := m.NewBlockFilter()
+	if err != nil {
+		t.Fatalf("NewBlockFilter failed: %v", err)
+	}
+
+	m.AddBlock("0x02")
+	m.AddBlock("0x03")
+	m.AddLogs(3, []rpc.Log{{Address: tokenA}})
+
+	changes, ok := m.Changes(blocks)
+	if hashes, _ := changes.([]string); !ok || len(hashes) != 2 || hashes[0] != "0x02" || hashes[1] != "0x03" {
+		t.Errorf("Expected the hashes of blocks after installation, got %v", changes)
+	}
+	if changes, _ := m.Changes(blocks); len(changes.([]string)) != 0 {
+		t.Errorf("Expected no changes after polling, got %v", changes)
+	}
+	if logs, _ := logChanges(m, logFilter); len(logs) != 1 {
+		t.Errorf("Expected block hashes not to reach log filters, got %+v", logs)
+	}
+}
+
+func TestLogQuery(t *testing.T) {
+	m := NewManager()
+	open, _ := m.NewLogFilter(json.RawMessage(`{"address": "` + tokenA + `"}`))
+	bounded, _ := m.NewLogFilter(json.RawMessage(`{"fromBlock": "0x5", "toBlock": "0x8"}`))
+	blocks, _ := m.NewBlockFilter()
+
+	if _, err := m.LogQuery(open); err == nil {
+		t.Error("Expected an error before any block is polled")
+	}
+	m.AddLogs(0x20, nil)
+
+	if q, err := m.LogQuery(open); err != nil || q.FromBlock != 0x20 || q.ToBlock != 0x20 || len(q.Criteria) != 1 {
+		t.Errorf("Expected the range to resolve to the head, got %+v (%v)", q, err)
+	}
+	if q, err := m.LogQuery(bounded); err != nil || q.FromBlock != 5 || q.ToBlock != 8 {
+		t.Errorf("Expected the filter's bounds, got %+v (%v)", q, err)
+	}
+	if _, err := m.LogQuery(blocks); err == nil {
+		t.Error("Expected block filters to be rejected")
+	}
+	if _, err := m.LogQuery("0x01"); err != ErrFilterNotFound {
+		t.Errorf("Expected ErrFilterNotFound, got %v", err)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	m := NewManager()
+	m.SetClock(fake)
+
+	polled, _ := m.NewLogFilter(json.RawMessage(`{}`))
+	idle, _ := m.NewBlockFilter()
+
+	fake.Advance(3 * time.Minute)
+	m.Changes(polled)
+	if _, err := m.LogQuery(idle); err == nil {
+		t.Fatal("Expected eth_getFilterLogs of a block filter to fail")
+	}
+	fake.Advance(3 * time.Minute)
+
+	// The idle filter was last polled 6 minutes ago, the other 3
+	if expired := m.Expire(fake.Now(), 5*time.Minute); expired != 1 {
+		t.Errorf("Expected 1 filter expired, got %d", expired)
+	}
+	if _, ok := m.Changes(idle); ok {
+		t.Error("Expected the idle filter to be uninstalled")
+	}
+	if _, ok := m.Changes(polled); !ok {
+		t.Error("Expected the polled filter to remain installed")
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hlnode-websocket/internal/broadcaster"
+	"hlnode-websocket/internal/subscription"
+)
+
+// DefaultSubscriptionListLimit is the number of subscriptions listed by
+// /admin/subscriptions when limit is omitted
+const DefaultSubscriptionListLimit = 1000
+
+// SubscriptionList is the response of GET /admin/subscriptions
+type SubscriptionList struct {
+	// Count is the number of matching subscriptions, listed or not
+	Count         int                            `json:"count"`
+	Subscriptions []broadcaster.SubscriptionInfo `json:"subscriptions"`
+}
+
+// ServeSubscriptions answers /admin/subscriptions?type=&address=&ip=&olderThan=
+// for subscriptions matching all given criteria. GET counts them and lists
+// the oldest limit (DefaultSubscriptionListLimit, 0 only counts); DELETE
+// removes them, and requires all=true when no criterion is given. Requires
+// the admin token.
+func (h *WebSocketHandler) ServeSubscriptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.isAdmin(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "admin token required"}`))
+		return
+	}
+
+	query := r.URL.Query()
+	filter := broadcaster.SubscriptionFilter{
+		Type:    subscription.SubscriptionType(query.Get("type")),
+		Address: query.Get("address"),
+		IP:      query.Get("ip"),
+	}
+	if value := query.Get("olderThan"); value != "" {
+		olderThan, err := time.ParseDuration(value)
+		if err != nil || olderThan <= 0 {
+			writeAdminError(w, http.StatusBadRequest, fmt.Sprintf("olderThan: %q is not a positive duration", value))
+			return
+		}
+		filter.OlderThan = olderThan
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		limit := DefaultSubscriptionListLimit
+		if value := query.Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				writeAdminError(w, http.StatusBadRequest, fmt.Sprintf("limit: %q is not a non-negative integer", value))
+				return
+			}
+			limit = n
+		}
+		subs := h.broadcaster.FindSubscriptions(filter)
+		list := SubscriptionList{Count: len(subs), Subscriptions: subs[:min(limit, len(subs))]}
+		json.NewEncoder(w).Encode(&list)
+	case http.MethodDelete:
+		if filter.Empty() && query.Get("all") != "true" {
+			writeAdminError(w, http.StatusBadRequest, "refusing to remove every subscription without all=true")
+			return
+		}
+		removed := h.broadcaster.RemoveSubscriptions(filter)
+		json.NewEncoder(w).Encode(map[string]int{"removed": removed})
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeAdminError(w, http.StatusMethodNotAllowed, "method must be GET or DELETE")
+	}
+}
+
+func writeAdminError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
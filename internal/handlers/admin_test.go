@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"hlnode-websocket/internal/rpc"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestAdminSubscriptions tests listing, counting and bulk-removing subscriptions on /admin/subscriptions
+func TestAdminSubscriptions(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	bc := newTestBroadcaster(t)
+	wsHandler := NewWebSocketHandler(rpc.NewClient(mockServer.URL), bc)
+	wsHandler.SetAdminToken("secret")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/subscriptions", wsHandler.ServeSubscriptions)
+	mux.Handle("/", wsHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	const watched = "0x1111111111111111111111111111111111111111"
+	for i, params := range [][]interface{}{
+		{"newHeads"},
+		{"logs", map[string]interface{}{"address": watched}},
+		{"balanceChanges", map[string]interface{}{"address": []string{watched}}},
+	} {
+		conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": i, "method": "eth_subscribe", "params": params})
+		var resp rpc.Response
+		if err := conn.ReadJSON(&resp); err != nil || resp.Error != nil {
+			t.Fatalf("Failed to subscribe: %v %+v", err, resp)
+		}
+	}
+
+	do := func(method, query string, token bool) (int, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+"/admin/subscriptions"+query, nil)
+		if token {
+			req.Header.Set("X-Admin-Token", "secret")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s failed: %v", method, err)
+		}
+		defer resp.Body.Close()
+		var body json.RawMessage
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	if status, _ := do(http.MethodGet, "", false); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the admin token, got %d", status)
+	}
+
+	// Addresses match case-insensitively
+	var list SubscriptionList
+	_, body := do(http.MethodGet, "?address=0x"+strings.ToUpper(watched[2:]), true)
+	json.Unmarshal(body, &list)
+	if list.Count != 2 || len(list.Subscriptions) != 2 || list.Subscriptions[0].Type != "logs" || list.Subscriptions[0].IP == "" {
+		t.Errorf("Expected the logs and balanceChanges subscriptions, got %s", body)
+	}
+	_, body = do(http.MethodGet, "?limit=0", true)
+	list = SubscriptionList{}
+	json.Unmarshal(body, &list)
+	if list.Count != 3 || len(list.Subscriptions) != 0 {
+		t.Errorf("Expected a count of 3 without a list, got %s", body)
+	}
+
+	if status, _ := do(http.MethodDelete, "", true); status != http.StatusBadRequest {
+		t.Errorf("Expected removing everything without all=true to be refused, got %d", status)
+	}
+	if status, _ := do(http.MethodGet, "?olderThan=soon", true); status != http.StatusBadRequest {
+		t.Errorf("Expected an invalid olderThan to be rejected, got %d", status)
+	}
+
+	_, body = do(http.MethodDelete, "?type=logs", true)
+	if string(body) != `{"removed":1}` {
+		t.Errorf("Expected one subscription removed, got %s", body)
+	}
+	var notification struct {
+		Params struct {
+			Error *rpc.Error `json:"error"`
+		} `json:"params"`
+	}
+	if err := conn.ReadJSON(&notification); err != nil || notification.Params.Error == nil {
+		t.Errorf("Expected a final error notification, got %+v, %v", notification, err)
+	}
+	if subs := bc.SubscriptionManager().All(); len(subs) != 2 {
+		t.Errorf("Expected 2 subscriptions left, got %d", len(subs))
+	}
+}
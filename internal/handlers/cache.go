@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"hlnode-websocket/internal/rpc"
+)
+
+// cacheKey returns the head-cache key for requests whose result only
+// changes when a new block is produced. Requests pinned to a specific
+// block or using the pending tag are not cached.
+func cacheKey(req *rpc.Request) (string, bool) {
+	switch req.Method {
+	case "eth_gasPrice":
+		return req.Method, true
+	case "eth_call":
+		var params []json.RawMessage
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params) == 0 || len(params) > 2 {
+			return "", false
+		}
+		if len(params) == 2 && !isLatestTag(params[1]) {
+			return "", false
+		}
+		var call bytes.Buffer
+		if err := json.Compact(&call, params[0]); err != nil {
+			return "", false
+		}
+		return req.Method + ":" + call.String(), true
+	case "eth_getBalance", "eth_getTransactionCount":
+		// Wallet frontends poll these constantly for the same accounts
+		var params []json.RawMessage
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params) == 0 || len(params) > 2 {
+			return "", false
+		}
+		if len(params) == 2 && !isLatestTag(params[1]) {
+			return "", false
+		}
+		var address string
+		if err := json.Unmarshal(params[0], &address); err != nil || address == "" {
+			return "", false
+		}
+		return req.Method + ":" + strings.ToLower(address), true
+	}
+	return "", false
+}
+
+// isLatestTag reports whether a block parameter refers to the latest block
+func isLatestTag(param json.RawMessage) bool {
+	var tag string
+	if err := json.Unmarshal(param, &tag); err != nil {
+		return false
+	}
+	return tag == "latest"
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"hlnode-websocket/internal/rpc"
+)
+
+func TestCacheKey(t *testing.T) {
+	tests := []struct {
+		method    string
+		params    string
+		key       string
+		cacheable bool
+	}{
+		{"eth_gasPrice", `[]`, "eth_gasPrice", true},
+		{"eth_call", `[{"to":"0xabc","data":"0x01"},"latest"]`, `eth_call:{"to":"0xabc","data":"0x01"}`, true},
+		{"eth_call", `[{"to":"0xabc"},"0x10"]`, "", false},
+		{"eth_getBalance", `["0xABC","latest"]`, "eth_getBalance:0xabc", true},
+		{"eth_getBalance", `["0xabc"]`, "eth_getBalance:0xabc", true},
+		{"eth_getBalance", `["0xabc","pending"]`, "", false},
+		{"eth_getTransactionCount", `["0xAbC","latest"]`, "eth_getTransactionCount:0xabc", true},
+		{"eth_getTransactionCount", `["0xabc","0x10"]`, "", false},
+		{"eth_getTransactionCount", `[]`, "", false},
+		{"eth_blockNumber", `[]`, "", false},
+	}
+
+	for _, tt := range tests {
+		req := &rpc.Request{Method: tt.method, Params: json.RawMessage(tt.params)}
+		key, cacheable := cacheKey(req)
+		if key != tt.key || cacheable != tt.cacheable {
+			t.Errorf("cacheKey(%s %s) = %q, %v; want %q, %v", tt.method, tt.params, key, cacheable, tt.key, tt.cacheable)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed console.html
+var consolePage []byte
+
+// ConsoleHandler serves a minimal HTML console that connects to the server,
+// sends requests and displays notifications, for trying the API from a browser
+func ConsoleHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(consolePage)
+	})
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConsoleHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ConsoleHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected HTML content type, got %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "new WebSocket(") {
+		t.Error("Expected console page with a WebSocket client")
+	}
+}
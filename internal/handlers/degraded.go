@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+	"hlnode-websocket/internal/rpc"
+)
+
+// sendQueue holds eth_sendRawTransaction calls that arrived while the
+// upstream was down, for retry until they are sent or expire. Entries stay
+// queued while they are retried, so they count against size and are
+// deduplicated until sent.
+type sendQueue struct {
+	entries []queuedTx
+	size    int
+	ttl     time.Duration
+	mu      sync.Mutex
+	// retryMu serializes retries
+	retryMu sync.Mutex
+}
+
+// queuedTx is a raw transaction awaiting a retry
+type queuedTx struct {
+	hash     string
+	params   json.RawMessage
+	queuedAt time.Time
+}
+
+// SetSendQueue enables queueing up to size eth_sendRawTransaction calls
+// that fail because the upstream is down, retried by RetrySendQueue for up
+// to ttl. A zero size disables the queue.
+func (h *WebSocketHandler) SetSendQueue(size int, ttl time.Duration) {
+	if size <= 0 {
+		h.sendQueue = nil
+		return
+	}
+	h.sendQueue = &sendQueue{size: size, ttl: ttl}
+}
+
+// isOutage reports whether a forwarding error means the upstream could not
+// answer, rather than the client going away or the rate limit refusing the
+// call
+func isOutage(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, rpc.ErrRateLimited)
+}
+
+// unsent reports whether a forwarding error means no attempt reached the
+// upstream: it was marked unavailable, its circuit was open or it could not
+// be dialed. A call that timed out or failed after being sent may still have
+// been processed.
+func unsent(err error) bool {
+	var opErr *net.OpError
+	return errors.Is(err, rpc.ErrUpstreamUnavailable) || (errors.As(err, &opErr) && opErr.Op == "dial")
+}
+
+// degraded answers a request that failed because the upstream is down:
+// cacheable reads from the last result within the max staleness, marked
+// stale, and raw transactions that were never sent by queueing them. It
+// returns false if the request can't be answered.
+func (h *WebSocketHandler) degraded(req *rpc.Request, err error, key string, cacheable bool) (*rpc.Response, bool) {
+	if req.Method == "eth_sendRawTransaction" {
+		if !unsent(err) {
+			return nil, false
+		}
+		return h.queueTransaction(req)
+	}
+	if h.cache == nil || !cacheable {
+		return nil, false
+	}
+	result, age, ok := h.cache.GetStale(key)
+	if !ok {
+		return nil, false
+	}
+	metrics.StaleResponsesTotal.WithLabelValues(req.Method).Inc()
+	logger.Debug("Serving %s from a result %v old while the upstream is down", req.Method, age.Round(time.Millisecond))
+	return &rpc.Response{JSONRPC: "2.0", Result: result, ID: req.ID, Stale: true}, true
+}
+
+// queueTransaction queues a raw transaction for retry and answers with its
+// hash, which is the Keccak-256 of the raw bytes for every transaction type
+func (h *WebSocketHandler) queueTransaction(req *rpc.Request) (*rpc.Response, bool) {
+	q := h.sendQueue
+	if q == nil {
+		return nil, false
+	}
+	var params []string
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+		return nil, false
+	}
+	raw, err := hex.DecodeString(strings.TrimPrefix(params[0], "0x"))
+	if err != nil || len(raw) == 0 {
+		return nil, false
+	}
+	digest := rpc.Keccak256(raw)
+	hash := "0x" + hex.EncodeToString(digest[:])
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, entry := range q.entries {
+		if entry.hash == hash {
+			return queuedResponse(req.ID, hash), true
+		}
+	}
+	if len(q.entries) >= q.size {
+		metrics.SendQueueTotal.WithLabelValues("full").Inc()
+		return nil, false
+	}
+	q.entries = append(q.entries, queuedTx{hash: hash, params: req.Params, queuedAt: h.broadcaster.Clock().Now()})
+	metrics.SendQueueTotal.WithLabelValues("queued").Inc()
+	metrics.SendQueueDepth.Set(float64(len(q.entries)))
+	logger.Info("Queued transaction %s until the upstream is back", hash)
+	return queuedResponse(req.ID, hash), true
+}
+
+func queuedResponse(id json.RawMessage, hash string) *rpc.Response {
+	result, _ := json.Marshal(hash)
+	return &rpc.Response{JSONRPC: "2.0", Result: result, ID: id, Queued: true}
+}
+
+// RetrySendQueue sends the queued transactions in order, dropping the ones
+// queued longer than the queue TTL. It stops at the first call the upstream
+// still can't answer.
+func (h *WebSocketHandler) RetrySendQueue(ctx context.Context) {
+	q := h.sendQueue
+	if q == nil {
+		return
+	}
+	q.retryMu.Lock()
+	defer q.retryMu.Unlock()
+	now := h.broadcaster.Clock().Now()
+
+	for {
+		q.mu.Lock()
+		if len(q.entries) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		entry := q.entries[0]
+		q.mu.Unlock()
+
+		if now.Sub(entry.queuedAt) > q.ttl {
+			q.remove(entry.hash)
+			metrics.SendQueueTotal.WithLabelValues("expired").Inc()
+			logger.Warn("Dropped queued transaction %s: upstream unavailable for %v", entry.hash, q.ttl)
+			continue
+		}
+		resp, err := h.call(ctx, &rpc.Request{JSONRPC: "2.0", Method: "eth_sendRawTransaction", Params: entry.params, ID: json.RawMessage("1")})
+		if err != nil {
+			return
+		}
+		q.remove(entry.hash)
+		if resp.Error != nil {
+			metrics.SendQueueTotal.WithLabelValues("rejected").Inc()
+			logger.Warn("Queued transaction %s rejected by the upstream: %s", entry.hash, resp.Error.Message)
+			continue
+		}
+		metrics.SendQueueTotal.WithLabelValues("sent").Inc()
+		logger.Info("Sent queued transaction %s", entry.hash)
+	}
+}
+
+// remove drops the queued transaction with the given hash
+func (q *sendQueue) remove(hash string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, entry := range q.entries {
+		if entry.hash == hash {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			break
+		}
+	}
+	metrics.SendQueueDepth.Set(float64(len(q.entries)))
+}
+
+// SendQueueLen returns the number of queued transactions
+func (h *WebSocketHandler) SendQueueLen() int {
+	q := h.sendQueue
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hlnode-websocket/internal/cache"
+	"hlnode-websocket/internal/rpc"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestDegradedMode tests serving stale reads and queueing raw transactions while the upstream is down
+func TestDegradedMode(t *testing.T) {
+	var hang atomic.Bool
+	var sent atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpc.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		result := `"0x1"`
+		if req.Method == "eth_sendRawTransaction" {
+			if hang.Load() {
+				<-r.Context().Done()
+				return
+			}
+			sent.Add(1)
+			result = `"0xhash"`
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":` + result + `}`))
+	})
+
+	// The upstream goes down by refusing connections, and comes back on the same address
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	upstream := &http.Server{Handler: handler}
+	go upstream.Serve(listener)
+	defer func() { upstream.Close() }()
+
+	rpcClient := rpc.NewClient("http://" + addr)
+	rpcClient.SetTimeout(200 * time.Millisecond)
+	invalidations := cache.NewBus()
+	headCache := cache.NewHeadCache(invalidations)
+	headCache.SetMaxStaleness(time.Minute)
+	wsHandler := NewWebSocketHandler(rpcClient, newTestBroadcaster(t))
+	wsHandler.SetCache(headCache)
+	wsHandler.SetSendQueue(1, time.Minute)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	call := func(body string) rpc.Response {
+		t.Helper()
+		conn.WriteMessage(websocket.TextMessage, []byte(body))
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var rpcResp rpc.Response
+		if err := conn.ReadJSON(&rpcResp); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return rpcResp
+	}
+
+	// Warm the cache, then move past the head it was fetched at
+	key, _ := cacheKey(&rpc.Request{Method: "eth_gasPrice"})
+	_, gen, _ := headCache.Get(key)
+	headCache.Set(gen, key, json.RawMessage(`"0x1"`))
+	invalidations.Publish("0x2")
+	upstream.Close()
+	rpcClient.CloseIdleConnections()
+
+	resp := call(`{"jsonrpc":"2.0","id":1,"method":"eth_gasPrice","params":[]}`)
+	if resp.Error != nil || string(resp.Result) != `"0x1"` || !resp.Stale {
+		t.Errorf("Expected the stale gas price, got %+v", resp)
+	}
+	resp = call(`{"jsonrpc":"2.0","id":2,"method":"eth_chainId","params":[]}`)
+	if resp.Error == nil {
+		t.Errorf("Expected uncached methods to fail, got %+v", resp)
+	}
+
+	// keccak256 of 0x01
+	resp = call(`{"jsonrpc":"2.0","id":3,"method":"eth_sendRawTransaction","params":["0x01"]}`)
+	if resp.Error != nil || !resp.Queued || string(resp.Result) != `"0x5fe7f977e71dba2ea1a68e21057beebb9be2ac30c6410aa38d4f3fbe41dcffd2"` {
+		t.Fatalf("Expected the transaction queued with its hash, got %+v", resp)
+	}
+	resp = call(`{"jsonrpc":"2.0","id":4,"method":"eth_sendRawTransaction","params":["0x02"]}`)
+	if resp.Error == nil {
+		t.Errorf("Expected a full queue to fail, got %+v", resp)
+	}
+
+	wsHandler.RetrySendQueue(context.Background())
+	if wsHandler.SendQueueLen() != 1 || sent.Load() != 0 {
+		t.Fatalf("Expected the transaction kept while the upstream is down, got %d queued", wsHandler.SendQueueLen())
+	}
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to restart the upstream: %v", err)
+	}
+	upstream = &http.Server{Handler: handler}
+	go upstream.Serve(listener)
+	wsHandler.RetrySendQueue(context.Background())
+	if wsHandler.SendQueueLen() != 0 || sent.Load() != 1 {
+		t.Errorf("Expected the transaction sent once the upstream is back, got %d queued, %d sent", wsHandler.SendQueueLen(), sent.Load())
+	}
+
+	// A timed out send may have reached the node, so it is not queued for a second send
+	hang.Store(true)
+	resp = call(`{"jsonrpc":"2.0","id":5,"method":"eth_sendRawTransaction","params":["0x03"]}`)
+	if resp.Error == nil || resp.Queued || wsHandler.SendQueueLen() != 0 {
+		t.Errorf("Expected a timed out transaction to fail without being queued, got %+v", resp)
+	}
+}
+
+// TestSendQueueRetryInFlight tests that a transaction being retried is still
+// deduplicated and counted against the queue size
+func TestSendQueueRetryInFlight(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+	var sent atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+		sent.Add(1)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0xhash"}`))
+	}))
+	defer upstream.Close()
+
+	wsHandler := NewWebSocketHandler(rpc.NewClient(upstream.URL), newTestBroadcaster(t))
+	wsHandler.SetSendQueue(1, time.Minute)
+
+	send := func(raw string) (*rpc.Response, bool) {
+		return wsHandler.queueTransaction(&rpc.Request{JSONRPC: "2.0", Method: "eth_sendRawTransaction", Params: json.RawMessage(`["` + raw + `"]`), ID: json.RawMessage("1")})
+	}
+	if _, ok := send("0x01"); !ok {
+		t.Fatal("Expected the transaction to be queued")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wsHandler.RetrySendQueue(context.Background())
+		close(done)
+	}()
+	<-received
+
+	// The retried transaction is still queued: a resend is deduplicated and the queue is full
+	if resp, ok := send("0x01"); !ok || !resp.Queued {
+		t.Errorf("Expected the in-flight transaction to be deduplicated, got %+v", resp)
+	}
+	if _, ok := send("0x02"); ok {
+		t.Error("Expected the queue to be full while its transaction is retried")
+	}
+	if wsHandler.SendQueueLen() != 1 {
+		t.Errorf("Expected 1 queued transaction, got %d", wsHandler.SendQueueLen())
+	}
+
+	close(release)
+	<-done
+	if wsHandler.SendQueueLen() != 0 || sent.Load() != 1 {
+		t.Errorf("Expected the transaction sent once, got %d queued, %d sent", wsHandler.SendQueueLen(), sent.Load())
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"hlnode-websocket/internal/broadcaster"
+	"hlnode-websocket/internal/filters"
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/storage"
+	"hlnode-websocket/internal/subscription"
+)
+
+// MaxRPCBodyBytes is the largest JSON-RPC request body accepted over HTTP
+const MaxRPCBodyBytes = 1 << 20
+
+// SetFilters serves the polling filter API locally from the given filters
+// instead of forwarding it upstream
+func (h *WebSocketHandler) SetFilters(m *filters.Manager) {
+	h.filters = m
+}
+
+// SetStorage serves the blocks held in the given storage locally for logs
+// backfills and eth_getFilterLogs instead of through upstream eth_getLogs
+func (h *WebSocketHandler) SetStorage(s storage.Storage) {
+	h.store = s
+}
+
+// isFilterMethod reports whether a method belongs to the polling filter API
+func isFilterMethod(method string) bool {
+	switch method {
+	case "eth_newFilter", "eth_newBlockFilter", "eth_newPendingTransactionFilter",
+		"eth_getFilterChanges", "eth_getFilterLogs", "eth_uninstallFilter":
+		return true
+	}
+	return false
+}
+
+// handleFilter answers a polling filter request from a WebSocket client
+func (h *WebSocketHandler) handleFilter(client *broadcaster.Client, req *rpc.Request) {
+	ctx, cancel := requestContext(client)
+	defer cancel()
+
+	result, rpcErr := h.callFilter(ctx, req)
+	if rpcErr != nil {
+		h.sendError(client, req.ID, rpcErr.Code, rpcErr.Message)
+		return
+	}
+	data, _ := json.Marshal(h.broadcaster.Compat().Empty(result))
+	h.sendResult(client, req.ID, data)
+}
+
+// callFilter answers a polling filter request from the local filters
+func (h *WebSocketHandler) callFilter(ctx context.Context, req *rpc.Request) (interface{}, *rpc.Error) {
+	var params []json.RawMessage
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: "params must be an array"}
+		}
+	}
+
+	if req.Method == "eth_newFilter" {
+		var criteria json.RawMessage
+		if len(params) > 0 {
+			criteria = params[0]
+		}
+		id, err := h.filters.NewLogFilter(criteria)
+		if err != nil {
+			return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+		}
+		return id, nil
+	}
+	if req.Method == "eth_newPendingTransactionFilter" {
+		// Hyperliquid has no public mempool, so there are no pending transactions to report
+		return nil, &rpc.Error{
+			Code:    rpc.ErrCodeMethodNotFound,
+			Message: "eth_newPendingTransactionFilter is not supported: Hyperliquid has no public mempool",
+		}
+	}
+	if req.Method == "eth_newBlockFilter" {
+		id, err := h.filters.NewBlockFilter()
+		if err != nil {
+			return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+		}
+		return id, nil
+	}
+
+	var id string
+	if len(params) == 0 || json.Unmarshal(params[0], &id) != nil {
+		return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: "filter ID is required"}
+	}
+	if req.Method == "eth_uninstallFilter" {
+		return h.filters.Uninstall(id), nil
+	}
+	if req.Method == "eth_getFilterLogs" {
+		return h.filterLogs(ctx, id)
+	}
+	changes, ok := h.filters.Changes(id)
+	if !ok {
+		return nil, &rpc.Error{Code: rpc.ErrCodeFilterNotFound, Message: "filter not found"}
+	}
+	return changes, nil
+}
+
+// filterLogs answers eth_getFilterLogs with all the logs matching a log
+// filter: blocks held in storage or the archive are read locally, the rest of
+// the range is backfilled from upstream eth_getLogs within the backfill limit
+func (h *WebSocketHandler) filterLogs(ctx context.Context, id string) ([]rpc.Log, *rpc.Error) {
+	q, err := h.filters.LogQuery(id)
+	if errors.Is(err, filters.ErrFilterNotFound) {
+		return nil, &rpc.Error{Code: rpc.ErrCodeFilterNotFound, Message: "filter not found"}
+	}
+	if err != nil {
+		return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+	}
+	if q.FromBlock > q.ToBlock {
+		return []rpc.Log{}, nil
+	}
+
+	segments := h.planLogRange(ctx, q.FromBlock, q.ToBlock)
+	if n := upstreamBlocks(segments); h.backfillMaxBlocks > 0 && n > h.backfillMaxBlocks {
+		return nil, &rpc.Error{
+			Code:    rpc.ErrCodeInvalidParams,
+			Message: fmt.Sprintf("filter range is too large: %d blocks are not stored locally, backfill is limited to %d blocks", n, h.backfillMaxBlocks),
+		}
+	}
+	return h.readLogRange(ctx, q.Criteria, segments)
+}
+
+// fetchFilterLogs fetches the logs of a block range matching any of the
+// criteria from upstream eth_getLogs, applying exclusions locally
+func (h *WebSocketHandler) fetchFilterLogs(ctx context.Context, criteria []subscription.LogFilter, from, to uint64) ([]rpc.Log, *rpc.Error) {
+	var logs []rpc.Log
+	seen := make(map[string]bool)
+	for i := range criteria {
+		fetched, err := h.client.GetLogs(ctx, rpc.FormatHexUint64(from), rpc.FormatHexUint64(to), criteria[i].Address, criteria[i].UpstreamTopics())
+		if err != nil {
+			logger.Error("Failed to fetch filter logs: %v", err)
+			return nil, &rpc.Error{Code: rpc.ErrCodeInternalError, Message: "Failed to fetch historical logs"}
+		}
+		for j := range fetched {
+			key := fetched[j].BlockNumber + "/" + fetched[j].LogIndex
+			if seen[key] || !subscription.MatchesLogFilter(&fetched[j], &criteria[i]) {
+				continue
+			}
+			seen[key] = true
+			logs = append(logs, fetched[j])
+		}
+	}
+	return logs, nil
+}
+
+// ServeRPC answers polling filter requests, single or batched, over HTTP
+// POST. Other methods are not proxied over HTTP and require a WebSocket
+// connection.
+func (h *WebSocketHandler) ServeRPC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxRPCBodyBytes))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(rpc.NewProxyErrorResponse(nil, rpc.ErrCodeInvalidRequest, "Request body too large", 0))
+		return
+	}
+
+	requests := 1
+	var result interface{}
+	if len(body) > 0 && body[0] == '[' {
+		var raws []json.RawMessage
+		if err := json.Unmarshal(body, &raws); err != nil || len(raws) == 0 {
+			result = rpc.NewProxyErrorResponse(nil, rpc.ErrCodeParseError, h.broadcaster.Compat().ParseError("Failed to parse JSON-RPC batch"), 0)
+		} else {
+			resps := make([]*rpc.Response, len(raws))
+			for i, raw := range raws {
+				resps[i] = h.serveRPCRequest(r.Context(), raw)
+			}
+			requests, result = len(raws), resps
+		}
+	} else {
+		result = h.serveRPCRequest(r.Context(), body)
+	}
+
+	data, _ := json.Marshal(result)
+	data = append(data, '\n')
+	w.Write(data)
+	if h.usage != nil {
+		h.usage.Record(broadcaster.UsageKey(r), uint64(requests), 0, uint64(len(data)))
+	}
+}
+
+// serveRPCRequest answers a single JSON-RPC request received over HTTP
+func (h *WebSocketHandler) serveRPCRequest(ctx context.Context, raw json.RawMessage) *rpc.Response {
+	var req rpc.Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return rpc.NewProxyErrorResponse(nil, rpc.ErrCodeParseError, h.broadcaster.Compat().ParseError("Failed to parse JSON-RPC request"), 0)
+	}
+	if req.JSONRPC != "2.0" {
+		return rpc.NewProxyErrorResponse(req.ID, rpc.ErrCodeInvalidRequest, h.broadcaster.Compat().InvalidRequest("Invalid JSON-RPC version"), 0)
+	}
+	if req.Method == "" {
+		return rpc.NewProxyErrorResponse(req.ID, rpc.ErrCodeInvalidRequest, h.broadcaster.Compat().InvalidRequest("Method is required"), 0)
+	}
+	if h.draining.Load() {
+		return rpc.NewProxyErrorResponse(req.ID, rpc.ErrCodeDraining, "Server is shutting down; reconnect", 0)
+	}
+
+	// Only the polling filters are served over HTTP; nothing is forwarded upstream
+	if !isFilterMethod(req.Method) || h.filters == nil {
+		return rpc.NewProxyErrorResponse(req.ID, rpc.ErrCodeMethodNotFound, req.Method+" requires a WebSocket connection", 0)
+	}
+	result, rpcErr := h.callFilter(ctx, &req)
+	if rpcErr != nil {
+		return rpc.NewProxyErrorResponse(req.ID, rpcErr.Code, rpcErr.Message, 0)
+	}
+	data, _ := json.Marshal(h.broadcaster.Compat().Empty(result))
+	return &rpc.Response{JSONRPC: "2.0", Result: data, ID: req.ID}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"hlnode-websocket/internal/filters"
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/storage"
+
+	"github.com/gorilla/websocket"
+)
+
+const filterToken = "0x1111111111111111111111111111111111111111"
+
+// TestWebSocketLocalFilters tests the polling filter API served locally over WebSocket
+func TestWebSocketLocalFilters(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+	localFilters := filters.NewManager()
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	wsHandler.SetFilters(localFilters)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	call := func(method string, params ...interface{}) rpc.Response {
+		t.Helper()
+		conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+		var resp rpc.Response
+		if err := conn.ReadJSON(&resp); err != nil {
+			t.Fatalf("Failed to read %s response: %v", method, err)
+		}
+		return resp
+	}
+
+	resp := call("eth_newFilter", map[string]interface{}{"address": filterToken})
+	var filterID string
+	if resp.Error != nil || json.Unmarshal(resp.Result, &filterID) != nil || !strings.HasPrefix(filterID, "0x") {
+		t.Fatalf("Expected a filter ID, got %+v", resp)
+	}
+
+	localFilters.AddLogs(0x10, []rpc.Log{
+		{Address: filterToken, BlockNumber: "0x10", LogIndex: "0x0"},
+		{Address: "0x2222222222222222222222222222222222222222", BlockNumber: "0x10", LogIndex: "0x1"},
+	})
+
+	var logs []rpc.Log
+	resp = call("eth_getFilterChanges", filterID)
+	if json.Unmarshal(resp.Result, &logs); len(logs) != 1 || logs[0].Address != filterToken {
+		t.Errorf("Expected the matching log, got %s", resp.Result)
+	}
+	if resp = call("eth_getFilterChanges", filterID); string(resp.Result) != "[]" {
+		t.Errorf("Expected no changes after polling, got %s", resp.Result)
+	}
+
+	if resp = call("eth_uninstallFilter", filterID); string(resp.Result) != "true" {
+		t.Errorf("Expected uninstall to succeed, got %s", resp.Result)
+	}
+	resp = call("eth_getFilterChanges", filterID)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeFilterNotFound || resp.Error.Message != "filter not found" {
+		t.Errorf("Expected filter not found, got %+v", resp)
+	}
+
+	resp = call("eth_newBlockFilter")
+	var blockFilterID string
+	if resp.Error != nil || json.Unmarshal(resp.Result, &blockFilterID) != nil {
+		t.Fatalf("Expected a block filter ID, got %+v", resp)
+	}
+	localFilters.AddBlock("0xabc")
+	if resp = call("eth_getFilterChanges", blockFilterID); string(resp.Result) != `["0xabc"]` {
+		t.Errorf("Expected the new block hash, got %s", resp.Result)
+	}
+
+	resp = call("eth_newPendingTransactionFilter")
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeMethodNotFound || !strings.Contains(resp.Error.Message, "no public mempool") {
+		t.Errorf("Expected pending transaction filters to be rejected explicitly, got %+v", resp)
+	}
+
+	resp = call("eth_newFilter", map[string]interface{}{"blockHash": "0x01"})
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Errorf("Expected invalid params for a blockHash filter, got %+v", resp)
+	}
+}
+
+// TestServeRPC tests JSON-RPC over HTTP: local filters, and other methods rejected rather than forwarded
+func TestServeRPC(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	wsHandler := NewWebSocketHandler(rpc.NewClient(mockServer.URL), newTestBroadcaster(t))
+	wsHandler.SetFilters(filters.NewManager())
+	server := httptest.NewServer(http.HandlerFunc(wsHandler.ServeRPC))
+	defer server.Close()
+
+	post := func(body string) []byte {
+		t.Helper()
+		resp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return buf.Bytes()
+	}
+
+	var resp rpc.Response
+	json.Unmarshal(post(`{"jsonrpc":"2.0","id":1,"method":"eth_newFilter","params":[{}]}`), &resp)
+	var filterID string
+	if resp.Error != nil || json.Unmarshal(resp.Result, &filterID) != nil {
+		t.Fatalf("Expected a filter ID, got %+v", resp)
+	}
+
+	var batch []rpc.Response
+	json.Unmarshal(post(`[
+		{"jsonrpc":"2.0","id":1,"method":"eth_getFilterChanges","params":["`+filterID+`"]},
+		{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber","params":[]},
+		{"jsonrpc":"2.0","id":3,"method":"eth_subscribe","params":["newHeads"]}
+	]`), &batch)
+	if len(batch) != 3 {
+		t.Fatalf("Expected 3 batch responses, got %d", len(batch))
+	}
+	if string(batch[0].Result) != "[]" {
+		t.Errorf("Expected no filter changes, got %s", batch[0].Result)
+	}
+	if batch[1].Error == nil || batch[1].Error.Code != rpc.ErrCodeMethodNotFound {
+		t.Errorf("Expected eth_blockNumber not to be forwarded over HTTP, got %+v", batch[1])
+	}
+	if batch[2].Error == nil || batch[2].Error.Code != rpc.ErrCodeMethodNotFound {
+		t.Errorf("Expected eth_subscribe to be rejected over HTTP, got %+v", batch[2])
+	}
+
+	json.Unmarshal(post(`not json`), &resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeParseError {
+		t.Errorf("Expected parse error, got %+v", resp)
+	}
+}
+
+// TestFilterLogs tests eth_getFilterLogs combining stored logs with an upstream backfill of older blocks
+func TestFilterLogs(t *testing.T) {
+	var ranges []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpc.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		var params []struct {
+			FromBlock string `json:"fromBlock"`
+			ToBlock   string `json:"toBlock"`
+		}
+		json.Unmarshal(req.Params, &params)
+		ranges = append(ranges, params[0].FromBlock+"-"+params[0].ToBlock)
+		result, _ := json.Marshal([]rpc.Log{
+			{Address: filterToken, BlockNumber: params[0].FromBlock, LogIndex: "0x0"},
+			{Address: "0x2222222222222222222222222222222222222222", BlockNumber: params[0].FromBlock, LogIndex: "0x1"},
+		})
+		json.NewEncoder(w).Encode(rpc.Response{JSONRPC: "2.0", Result: result, ID: req.ID})
+	}))
+	defer upstream.Close()
+
+	store := storage.NewMemory()
+	localFilters := filters.NewManager()
+	for n := uint64(0x10); n <= 0x12; n++ {
+		logs := []rpc.Log{{Address: filterToken, BlockNumber: rpc.FormatHexUint64(n)}}
+		store.PutBlock(context.Background(), n, &rpc.FullBlockHeader{Number: rpc.FormatHexUint64(n)})
+		store.PutLogs(context.Background(), n, logs)
+		localFilters.AddLogs(n, logs)
+	}
+
+	wsHandler := NewWebSocketHandler(rpc.NewClient(upstream.URL), newTestBroadcaster(t))
+	wsHandler.SetFilters(localFilters)
+	wsHandler.SetStorage(store)
+	wsHandler.SetBackfillLimit(10)
+	server := httptest.NewServer(http.HandlerFunc(wsHandler.ServeRPC))
+	defer server.Close()
+
+	call := func(method string, params ...interface{}) rpc.Response {
+		t.Helper()
+		body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+		httpResp, err := http.Post(server.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		defer httpResp.Body.Close()
+		var resp rpc.Response
+		json.NewDecoder(httpResp.Body).Decode(&resp)
+		return resp
+	}
+	newFilter := func(criteria map[string]interface{}) string {
+		t.Helper()
+		var id string
+		if resp := call("eth_newFilter", criteria); json.Unmarshal(resp.Result, &id) != nil {
+			t.Fatalf("Expected a filter ID, got %+v", resp)
+		}
+		return id
+	}
+
+	// Blocks 0x0c-0x0f are backfilled upstream, 0x10-0x12 read from storage
+	id := newFilter(map[string]interface{}{"address": filterToken, "fromBlock": "0xc"})
+	var logs []rpc.Log
+	resp := call("eth_getFilterLogs", id)
+	if err := json.Unmarshal(resp.Result, &logs); err != nil {
+		t.Fatalf("Expected logs, got %+v", resp)
+	}
+	if len(ranges) != 1 || ranges[0] != "0xc-0xf" {
+		t.Errorf("Expected one upstream backfill of 0xc-0xf, got %v", ranges)
+	}
+	if len(logs) != 4 || logs[0].BlockNumber != "0xc" || logs[1].BlockNumber != "0x10" || logs[3].BlockNumber != "0x12" {
+		t.Errorf("Expected the backfilled log then the 3 stored logs, got %+v", logs)
+	}
+
+	// Without bounds, the range is the last polled head, held in storage
+	ranges = nil
+	resp = call("eth_getFilterLogs", newFilter(map[string]interface{}{}))
+	if json.Unmarshal(resp.Result, &logs); len(logs) != 1 || logs[0].BlockNumber != "0x12" || len(ranges) != 0 {
+		t.Errorf("Expected the head's log from storage only, got %s (upstream %v)", resp.Result, ranges)
+	}
+
+	if resp := call("eth_getFilterLogs", newFilter(map[string]interface{}{"fromBlock": "0x1"})); resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Errorf("Expected a backfill beyond the limit to be rejected, got %+v", resp)
+	}
+	if resp := call("eth_getFilterLogs", "0x01"); resp.Error == nil || resp.Error.Code != rpc.ErrCodeFilterNotFound {
+		t.Errorf("Expected filter not found, got %+v", resp)
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"sort"
+
+	"hlnode-websocket/internal/archive"
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/subscription"
+)
+
+// SetArchive serves archived blocks for logs backfills and eth_getFilterLogs,
+// so ranges aged out of storage are replayed without upstream eth_getLogs
+func (h *WebSocketHandler) SetArchive(a *archive.Archiver) {
+	h.archive = a
+}
+
+// Sources of the logs of a block range
+const (
+	sourceUpstream = iota
+	sourceStorage
+	sourceArchive
+)
+
+// logSegment is a part of a block range read from a single source
+type logSegment struct {
+	from, to uint64
+	source   int
+}
+
+// planLogRange splits [from, to] into the parts held in storage, the parts
+// archived, and the rest, to be fetched upstream, in block order. Holes in
+// storage are fetched upstream.
+func (h *WebSocketHandler) planLogRange(ctx context.Context, from, to uint64) []logSegment {
+	segments := []logSegment{{from: from, to: to, source: sourceUpstream}}
+	if h.store != nil {
+		if stored, err := h.store.Spans(ctx); err == nil {
+			spans := make([]archive.Span, len(stored))
+			for i, span := range stored {
+				spans[i] = archive.Span{First: span.First, Last: span.Last}
+			}
+			segments = splitSegments(segments, spans, sourceStorage)
+		}
+	}
+	if h.archive != nil {
+		segments = splitSegments(segments, h.archive.Covered(from, to), sourceArchive)
+	}
+	return segments
+}
+
+// splitSegments assigns the parts of upstream segments within spans to source
+func splitSegments(segments []logSegment, spans []archive.Span, source int) []logSegment {
+	var split []logSegment
+	for _, seg := range segments {
+		if seg.source != sourceUpstream {
+			split = append(split, seg)
+			continue
+		}
+		next := seg.from
+		for _, span := range spans {
+			first, last := max(span.First, seg.from), min(span.Last, seg.to)
+			if first > last {
+				continue
+			}
+			if next < first {
+				split = append(split, logSegment{from: next, to: first - 1, source: sourceUpstream})
+			}
+			split = append(split, logSegment{from: first, to: last, source: source})
+			next = last + 1
+		}
+		if next <= seg.to && next >= seg.from {
+			split = append(split, logSegment{from: next, to: seg.to, source: sourceUpstream})
+		}
+	}
+	sort.Slice(split, func(i, j int) bool { return split[i].from < split[j].from })
+	return split
+}
+
+// upstreamBlocks counts the blocks of a plan fetched upstream
+func upstreamBlocks(segments []logSegment) uint64 {
+	var n uint64
+	for _, seg := range segments {
+		if seg.source == sourceUpstream {
+			n += seg.to - seg.from + 1
+		}
+	}
+	return n
+}
+
+// readLogRange reads the logs matching any of the criteria over a planned range
+func (h *WebSocketHandler) readLogRange(ctx context.Context, criteria []subscription.LogFilter, segments []logSegment) ([]rpc.Log, *rpc.Error) {
+	logs := []rpc.Log{}
+	for _, seg := range segments {
+		var local []rpc.Log
+		var err error
+		switch seg.source {
+		case sourceUpstream:
+			fetched, rpcErr := h.fetchFilterLogs(ctx, criteria, seg.from, seg.to)
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			logs = append(logs, fetched...)
+			continue
+		case sourceStorage:
+			local, err = h.store.GetLogs(ctx, seg.from, seg.to)
+		case sourceArchive:
+			local, err = h.archive.Logs(ctx, seg.from, seg.to)
+		}
+		if err != nil {
+			logger.Error("Failed to read stored logs of blocks %d-%d: %v", seg.from, seg.to, err)
+			return nil, &rpc.Error{Code: rpc.ErrCodeInternalError, Message: "Failed to read stored logs"}
+		}
+		for i := range local {
+			if subscription.MatchesAnyLogFilter(&local[i], criteria) {
+				logs = append(logs, local[i])
+			}
+		}
+	}
+	return logs, nil
+}
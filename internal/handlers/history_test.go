@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hlnode-websocket/internal/archive"
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/storage"
+	"hlnode-websocket/internal/subscription"
+)
+
+func TestLogRangeStorageHoles(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	for n := uint64(0x10); n <= 0x14; n++ {
+		store.PutBlock(ctx, n, &rpc.FullBlockHeader{Number: rpc.FormatHexUint64(n)})
+		// The logs of 0x12 couldn't be fetched, and 0x13 was skipped
+		if n != 0x12 && n != 0x13 {
+			store.PutLogs(ctx, n, nil)
+		}
+	}
+	store.Truncate(ctx, 0x13)
+	store.PutBlock(ctx, 0x14, &rpc.FullBlockHeader{Number: "0x14"})
+	store.PutLogs(ctx, 0x14, nil)
+
+	wsHandler := NewWebSocketHandler(rpc.NewClient(""), newTestBroadcaster(t))
+	wsHandler.SetStorage(store)
+
+	segments := wsHandler.planLogRange(ctx, 0x10, 0x15)
+	want := []logSegment{
+		{from: 0x10, to: 0x11, source: sourceStorage},
+		{from: 0x12, to: 0x13, source: sourceUpstream},
+		{from: 0x14, to: 0x14, source: sourceStorage},
+		{from: 0x15, to: 0x15, source: sourceUpstream},
+	}
+	if len(segments) != len(want) {
+		t.Fatalf("Expected %+v, got %+v", want, segments)
+	}
+	for i := range want {
+		if segments[i] != want[i] {
+			t.Errorf("Expected segment %d to be %+v, got %+v", i, want[i], segments[i])
+		}
+	}
+}
+
+func TestLogRangeFromArchive(t *testing.T) {
+	ctx := context.Background()
+	var ranges []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpc.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		var params []struct {
+			FromBlock string `json:"fromBlock"`
+			ToBlock   string `json:"toBlock"`
+		}
+		json.Unmarshal(req.Params, &params)
+		ranges = append(ranges, params[0].FromBlock+"-"+params[0].ToBlock)
+		result, _ := json.Marshal([]rpc.Log{{Address: filterToken, BlockNumber: params[0].FromBlock}})
+		json.NewEncoder(w).Encode(rpc.Response{JSONRPC: "2.0", Result: result, ID: req.ID})
+	}))
+	defer upstream.Close()
+
+	// Blocks 0x0-0x9 were archived and pruned, 0x10-0x12 are stored
+	store := storage.NewMemory()
+	for n := uint64(0); n <= 0x12; n++ {
+		if n >= 0xa && n < 0x10 {
+			continue
+		}
+		store.PutBlock(ctx, n, &rpc.FullBlockHeader{Number: rpc.FormatHexUint64(n)})
+		store.PutLogs(ctx, n, []rpc.Log{{Address: filterToken, BlockNumber: rpc.FormatHexUint64(n)}})
+	}
+	archiver, err := archive.New(ctx, archive.NewDir(t.TempDir()), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := archiver.Flush(ctx, store, 9); err != nil {
+		t.Fatal(err)
+	}
+	store.Prune(ctx, 0x10)
+
+	wsHandler := NewWebSocketHandler(rpc.NewClient(upstream.URL), newTestBroadcaster(t))
+	wsHandler.SetStorage(store)
+	wsHandler.SetArchive(archiver)
+
+	segments := wsHandler.planLogRange(ctx, 0x5, 0x14)
+	want := []logSegment{
+		{from: 0x5, to: 0x9, source: sourceArchive},
+		{from: 0xa, to: 0xf, source: sourceUpstream},
+		{from: 0x10, to: 0x12, source: sourceStorage},
+		{from: 0x13, to: 0x14, source: sourceUpstream},
+	}
+	if len(segments) != len(want) {
+		t.Fatalf("Expected %+v, got %+v", want, segments)
+	}
+	for i := range want {
+		if segments[i] != want[i] {
+			t.Errorf("Expected segment %d to be %+v, got %+v", i, want[i], segments[i])
+		}
+	}
+	if n := upstreamBlocks(segments); n != 8 {
+		t.Errorf("Expected 8 blocks fetched upstream, got %d", n)
+	}
+
+	logs, rpcErr := wsHandler.readLogRange(ctx, []subscription.LogFilter{{Address: []string{filterToken}}}, segments)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if len(logs) != 10 || logs[0].BlockNumber != "0x5" || logs[5].BlockNumber != "0xa" || logs[6].BlockNumber != "0x10" || logs[9].BlockNumber != "0x13" {
+		t.Errorf("Expected 5 archived, 1 upstream, 3 stored and 1 upstream log in block order, got %+v", logs)
+	}
+	if len(ranges) != 2 || ranges[0] != "0xa-0xf" || ranges[1] != "0x13-0x14" {
+		t.Errorf("Expected upstream fetches of 0xa-0xf and 0x13-0x14, got %v", ranges)
+	}
+}
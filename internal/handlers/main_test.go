@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"testing"
+
+	"hlnode-websocket/internal/broadcaster"
+
+	"go.uber.org/goleak"
+)
+
+// TestMain fails the suite if any test leaves goroutines running, such as
+// a broadcaster Run loop or a client write pump
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// newTestBroadcaster starts a broadcaster that is stopped when the test ends
+func newTestBroadcaster(t *testing.T) *broadcaster.Broadcaster {
+	t.Helper()
+	bc := broadcaster.NewBroadcaster()
+	go bc.Run()
+	t.Cleanup(bc.Stop)
+	return bc
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Client certificate modes of the public listener (TLS_CLIENT_AUTH)
+const (
+	// ClientAuthOptional verifies client certificates that are presented
+	ClientAuthOptional = "optional"
+	// ClientAuthRequire refuses connections without a valid client certificate
+	ClientAuthRequire = "require"
+)
+
+// ListenerTLSOptions configure TLS on the public listener. A client CA
+// enables mutual TLS: certificates it verifies identify their connections.
+type ListenerTLSOptions struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	// ClientAuth is ClientAuthOptional (the default) or ClientAuthRequire
+	ClientAuth string
+}
+
+// Config builds the TLS config of the listener, or returns nil when no
+// certificate is configured
+func (o ListenerTLSOptions) Config() (*tls.Config, error) {
+	if o.CertFile == "" && o.KeyFile == "" {
+		if o.ClientCAFile != "" {
+			return nil, fmt.Errorf("a client CA requires a server certificate and key")
+		}
+		return nil, nil
+	}
+	if o.CertFile == "" || o.KeyFile == "" {
+		return nil, fmt.Errorf("certificate and key must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	switch o.ClientAuth {
+	case "", ClientAuthOptional:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode %q (want %s or %s)", o.ClientAuth, ClientAuthOptional, ClientAuthRequire)
+	}
+	if o.ClientCAFile == "" {
+		if o.ClientAuth == ClientAuthRequire {
+			return nil, fmt.Errorf("requiring client certificates needs a client CA")
+		}
+		config.ClientAuth = tls.NoClientCert
+		return config, nil
+	}
+
+	pem, err := os.ReadFile(o.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in client CA %s", o.ClientCAFile)
+	}
+	config.ClientCAs = pool
+	return config, nil
+}
+
+// SetAdminIdentities grants admin access to connections whose verified
+// client certificate has one of the identities, as the admin token does
+func (h *WebSocketHandler) SetAdminIdentities(identities []string) {
+	h.adminIdentities = make(map[string]bool, len(identities))
+	for _, identity := range identities {
+		h.adminIdentities[identity] = true
+	}
+}
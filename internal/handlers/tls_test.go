@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hlnode-websocket/internal/rpc"
+
+	"github.com/gorilla/websocket"
+)
+
+// testCert issues a certificate for template, signed by parent (self-signed
+// when nil), and returns it with its key
+func testCert(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, any(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writePEM writes a certificate and its key as PEM files and returns their paths
+func writePEM(t *testing.T, cert tls.Certificate) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+// TestClientCertificateIdentity tests identifying and authorizing connections by their TLS client certificate
+func TestClientCertificateIdentity(t *testing.T) {
+	ca := testCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	serverCert := testCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "proxy"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	clientCert := testCert(t, &x509.Certificate{
+		DNSNames:    []string{"indexer.internal"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+
+	caFile, _ := writePEM(t, ca)
+	certFile, keyFile := writePEM(t, serverCert)
+	if _, err := (ListenerTLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire}).Config(); err == nil {
+		t.Error("Expected requiring client certificates without a client CA to be rejected")
+	}
+	if _, err := (ListenerTLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: "always"}).Config(); err == nil {
+		t.Error("Expected an unknown client auth mode to be rejected")
+	}
+	config, err := ListenerTLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: ClientAuthRequire}.Config()
+	if err != nil {
+		t.Fatalf("Config failed: %v", err)
+	}
+
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+	bc := newTestBroadcaster(t)
+	wsHandler := NewWebSocketHandler(rpc.NewClient(mockServer.URL), bc)
+	wsHandler.SetAdminIdentities([]string{"indexer.internal"})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/subscriptions", wsHandler.ServeSubscriptions)
+	mux.Handle("/", wsHandler)
+	server := httptest.NewUnstartedServer(mux)
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	clientTLS := &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}}
+
+	dialer := websocket.Dialer{TLSClientConfig: clientTLS}
+	wsURL := "wss" + strings.TrimPrefix(server.URL, "https")
+	conn, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect with a client certificate: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	// proxyMetrics is admin-only
+	conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "eth_subscribe", "params": []string{"proxyMetrics"}})
+	var resp rpc.Response
+	if err := conn.ReadJSON(&resp); err != nil || resp.Error != nil {
+		t.Errorf("Expected the certificate identity to grant admin access, got %+v, %v", resp.Error, err)
+	}
+	infos := bc.GetAllClientsInfo()
+	if len(infos) != 1 || infos[0].Identity != "indexer.internal" {
+		t.Errorf("Expected the connection identified by its certificate, got %+v", infos)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+	httpResp, err := client.Get(server.URL + "/admin/subscriptions")
+	if err != nil {
+		t.Fatalf("Admin request failed: %v", err)
+	}
+	httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		t.Errorf("Expected admin endpoints to accept the admin identity, got %d", httpResp.StatusCode)
+	}
+
+	anonymous := websocket.Dialer{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	if conn, _, err := anonymous.Dial(wsURL, nil); err == nil {
+		conn.Close()
+		t.Error("Expected connections without a client certificate to be refused")
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hlnode-websocket/internal/usage"
+)
+
+// DefaultUsageWindow is the period reported by /admin/usage when from is omitted
+const DefaultUsageWindow = 24 * time.Hour
+
+// SetUsage records the requests, notifications and bytes sent of each API
+// key in the given table and serves it on /admin/usage
+func (h *WebSocketHandler) SetUsage(t *usage.Table) {
+	h.usage = t
+}
+
+// UsageReport is the response of /admin/usage
+type UsageReport struct {
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+	Buckets []usage.Bucket `json:"buckets"`
+}
+
+// ServeUsage answers GET /admin/usage?from=&to= with the hourly usage buckets
+// of each API key in [from, to). Both bounds are RFC 3339 times or Unix
+// seconds; to defaults to now and from to DefaultUsageWindow before to.
+// Requires the admin token.
+func (h *WebSocketHandler) ServeUsage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !h.isAdmin(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "admin token required"}`))
+		return
+	}
+	if h.usage == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "usage reports are disabled"}`))
+		return
+	}
+
+	to, err := parseUsageTime(r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		writeUsageError(w, "to", err)
+		return
+	}
+	from, err := parseUsageTime(r.URL.Query().Get("from"), to.Add(-DefaultUsageWindow))
+	if err != nil {
+		writeUsageError(w, "from", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&UsageReport{
+		From:    from.UTC(),
+		To:      to.UTC(),
+		Buckets: h.usage.Report(from, to),
+	})
+}
+
+// parseUsageTime parses an RFC 3339 time or Unix seconds, or returns def if value is empty
+func parseUsageTime(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time or Unix seconds", value)
+	}
+	return t, nil
+}
+
+func writeUsageError(w http.ResponseWriter, param string, err error) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": param + ": " + err.Error()})
+}
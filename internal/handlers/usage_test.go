@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"hlnode-websocket/internal/clock"
+	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/usage"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestUsageReports tests usage recording per API key and the /admin/usage endpoint
+func TestUsageReports(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	bc := newTestBroadcaster(t)
+	table := usage.NewTable(clock.Real, time.Hour)
+	wsHandler := NewWebSocketHandler(rpc.NewClient(mockServer.URL), bc)
+	wsHandler.SetAdminToken("secret")
+	wsHandler.SetUsage(table)
+	wsHandler.SetTestSubscription(true)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/usage", wsHandler.ServeUsage)
+	mux.HandleFunc("/rpc", wsHandler.ServeRPC)
+	mux.Handle("/", wsHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"X-API-Key": {"key-ws"}})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "eth_subscribe", "params": []string{"test"}})
+	var resp rpc.Response
+	if err := conn.ReadJSON(&resp); err != nil || resp.Error != nil {
+		t.Fatalf("Failed to subscribe: %v %+v", err, resp)
+	}
+	bc.BroadcastTestTick()
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	httpResp, err := http.Post(server.URL+"/rpc?apiKey=key-http", "application/json",
+		strings.NewReader(`[{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"},{"jsonrpc":"2.0","id":2,"method":"eth_chainId"}]`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	httpResp.Body.Close()
+
+	getUsage := func(query, token string) (*http.Response, *UsageReport) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/admin/usage"+query, nil)
+		if token != "" {
+			req.Header.Set("X-Admin-Token", token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var report UsageReport
+		json.NewDecoder(resp.Body).Decode(&report)
+		return resp, &report
+	}
+
+	if resp, _ := getUsage("", "wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the admin token, got %d", resp.StatusCode)
+	}
+	if resp, _ := getUsage("?from=yesterday", "secret"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid from, got %d", resp.StatusCode)
+	}
+
+	// Bytes are recorded once written, which may follow the client's read
+	var byKey map[string]usage.Bucket
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, report := getUsage("?to="+time.Now().Add(time.Hour).Format(time.RFC3339), "secret")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+		byKey = make(map[string]usage.Bucket)
+		for _, b := range report.Buckets {
+			byKey[b.APIKey] = b
+		}
+		if byKey["key-ws"].Bytes > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if ws := byKey["key-ws"]; ws.Requests != 1 || ws.Notifications != 1 || ws.Bytes == 0 {
+		t.Errorf("Unexpected WebSocket usage: %+v", ws)
+	}
+	if h := byKey["key-http"]; h.Requests != 2 || h.Notifications != 0 || h.Bytes == 0 {
+		t.Errorf("Unexpected HTTP usage: %+v", h)
+	}
+}
@@ -2,19 +2,33 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"hlnode-websocket/internal/archive"
 	"hlnode-websocket/internal/broadcaster"
+	"hlnode-websocket/internal/cache"
+	"hlnode-websocket/internal/filters"
 	"hlnode-websocket/internal/logger"
 	"hlnode-websocket/internal/metrics"
+	"hlnode-websocket/internal/recovery"
 	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/storage"
 	"hlnode-websocket/internal/subscription"
+	"hlnode-websocket/internal/usage"
 
 	"github.com/gorilla/websocket"
 )
 
+// MaxSubscribeBatch is the maximum number of subscriptions in a hl_subscribeBatch request
+const MaxSubscribeBatch = 100
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  4096,
 	WriteBufferSize: 4096,
@@ -27,7 +41,42 @@ var upgrader = websocket.Upgrader{
 // WebSocketHandler handles WebSocket connections (reth-compatible)
 type WebSocketHandler struct {
 	client      *rpc.Client
+	balancer    *rpc.Balancer
 	broadcaster *broadcaster.Broadcaster
+	cache       *cache.HeadCache
+	watchlist   *cache.LogStore
+	gasPrices   *cache.GasPriceCache
+	filters     *filters.Manager
+	store       storage.Storage
+	archive     *archive.Archiver
+	usage       *usage.Table
+	quota       broadcaster.Quota
+	adminToken  string
+	// adminIdentities are client certificate identities granted admin access
+	adminIdentities map[string]bool
+
+	// instanceID is announced on the upgrade response for load balancer stickiness
+	instanceID     string
+	instanceHeader string
+	stickyCookie   string
+
+	// keepalive overrides the default keepalive by client class
+	keepalive map[string]broadcaster.Keepalive
+
+	backfillMaxBlocks    uint64
+	slowRequestThreshold time.Duration
+
+	// testSubscription accepts the synthetic test subscription
+	testSubscription bool
+
+	// syncCheck fetches the sync status for a new syncing subscription's snapshot
+	syncCheck func(context.Context) *rpc.SyncStatus
+
+	// sendQueue holds raw transactions sent while the upstream was down
+	sendQueue *sendQueue
+
+	// draining rejects requests while the server shuts down
+	draining atomic.Bool
 }
 
 // NewWebSocketHandler creates a new WebSocket handler
@@ -38,22 +87,175 @@ func NewWebSocketHandler(client *rpc.Client, bc *broadcaster.Broadcaster) *WebSo
 	}
 }
 
+// SetBalancer spreads forwarded calls across the balancer's upstreams
+// instead of sending them all to the handler's client
+func (h *WebSocketHandler) SetBalancer(b *rpc.Balancer) {
+	h.balancer = b
+}
+
+// call forwards a request upstream, through the balancer when one is set
+func (h *WebSocketHandler) call(ctx context.Context, req *rpc.Request) (*rpc.Response, error) {
+	if h.balancer != nil {
+		return h.balancer.Call(ctx, req)
+	}
+	return h.client.Call(ctx, req)
+}
+
+// callRaw forwards a raw request upstream, through the balancer when one is set
+func (h *WebSocketHandler) callRaw(ctx context.Context, body []byte) ([]byte, error) {
+	if h.balancer != nil {
+		return h.balancer.CallRaw(ctx, body)
+	}
+	return h.client.CallRaw(ctx, body)
+}
+
+// SetDraining makes the handler reject further requests with a draining
+// error, telling clients to reconnect while the server shuts down
+func (h *WebSocketHandler) SetDraining(draining bool) {
+	h.draining.Store(draining)
+}
+
+// SetCache enables serving head-scoped read methods from the given cache
+func (h *WebSocketHandler) SetCache(c *cache.HeadCache) {
+	h.cache = c
+}
+
+// SetWatchlist enables serving logs backfills for watchlist addresses from the local store
+func (h *WebSocketHandler) SetWatchlist(store *cache.LogStore) {
+	h.watchlist = store
+}
+
+// SetTestSubscription accepts subscriptions to the synthetic test counter,
+// which are rejected otherwise
+func (h *WebSocketHandler) SetTestSubscription(enabled bool) {
+	h.testSubscription = enabled
+}
+
+// SetSyncCheck sets how the sync status sent to new syncing subscribers is
+// fetched. Without one they get the last status broadcast, if any.
+func (h *WebSocketHandler) SetSyncCheck(check func(context.Context) *rpc.SyncStatus) {
+	h.syncCheck = check
+}
+
+// SetGasPrices enables sending the latest gas prices to new gasPrice subscribers
+func (h *WebSocketHandler) SetGasPrices(c *cache.GasPriceCache) {
+	h.gasPrices = c
+}
+
+// SetBackfillLimit sets the maximum block range replayed for logs fromBlock backfills
+func (h *WebSocketHandler) SetBackfillLimit(maxBlocks int) {
+	h.backfillMaxBlocks = uint64(maxBlocks)
+}
+
+// SetSlowRequestThreshold sets the latency above which forwarded requests are logged as slow
+func (h *WebSocketHandler) SetSlowRequestThreshold(threshold time.Duration) {
+	h.slowRequestThreshold = threshold
+}
+
+// observeLatency logs and counts forwarded requests exceeding the slow request threshold
+func (h *WebSocketHandler) observeLatency(client *broadcaster.Client, method string, start time.Time) {
+	if h.slowRequestThreshold <= 0 {
+		return
+	}
+	elapsed := time.Since(start)
+	if elapsed < h.slowRequestThreshold {
+		return
+	}
+	metrics.WSSlowRequestsTotal.WithLabelValues(method).Inc()
+	client.IncrementSlowRequests()
+	logger.Warn("Slow request: method=%s client=%s ip=%s latency=%v", method, client.ID, client.IP, elapsed)
+}
+
+// SetInstance sets the replica ID announced on the upgrade response, in the
+// given header and cookie when their names are not empty
+func (h *WebSocketHandler) SetInstance(instanceID, header, cookie string) {
+	h.instanceID = instanceID
+	h.instanceHeader = header
+	h.stickyCookie = cookie
+}
+
+// upgradeHeader returns the extra headers of the upgrade response
+func (h *WebSocketHandler) upgradeHeader() http.Header {
+	if h.instanceID == "" {
+		return nil
+	}
+	header := http.Header{}
+	if h.instanceHeader != "" {
+		header.Set(h.instanceHeader, h.instanceID)
+	}
+	if h.stickyCookie != "" {
+		cookie := &http.Cookie{Name: h.stickyCookie, Value: h.instanceID, Path: "/", HttpOnly: true}
+		header.Add("Set-Cookie", cookie.String())
+	}
+	return header
+}
+
+// SetKeepalive sets the ping interval and pong timeout of a client class.
+// The empty class applies to clients that announce no known class.
+func (h *WebSocketHandler) SetKeepalive(class string, keepalive broadcaster.Keepalive) {
+	if h.keepalive == nil {
+		h.keepalive = make(map[string]broadcaster.Keepalive)
+	}
+	h.keepalive[class] = keepalive
+}
+
+// SetQuota limits the requests and bytes sent per window of each non-admin connection
+func (h *WebSocketHandler) SetQuota(q broadcaster.Quota) {
+	h.quota = q
+}
+
+// SetAdminToken sets the token clients must present to use admin-only features
+func (h *WebSocketHandler) SetAdminToken(token string) {
+	h.adminToken = token
+}
+
+// isAdmin checks the upgrade request for an admin client certificate or the
+// admin token, sent either as "Authorization: Bearer <token>" or
+// "X-Admin-Token: <token>"
+func (h *WebSocketHandler) isAdmin(r *http.Request) bool {
+	if identity := broadcaster.ClientIdentity(r); identity != "" && h.adminIdentities[identity] {
+		return true
+	}
+	if h.adminToken == "" {
+		return false
+	}
+
+	token := r.Header.Get("X-Admin-Token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) == 1
+}
+
 // ServeHTTP upgrades the connection to WebSocket and handles messages
 func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgrader.Upgrade(w, r, h.upgradeHeader())
 	if err != nil {
 		logger.Error("Failed to upgrade connection: %v", err)
 		return
 	}
 
+	client := broadcaster.NewClient(conn, r)
+	client.IsAdmin = h.isAdmin(r)
+	if client.Identity != "" {
+		metrics.WSIdentityConnectionsTotal.WithLabelValues(client.Identity).Inc()
+	}
+	client.Usage = h.usage
+	if !client.IsAdmin {
+		client.SetQuota(h.quota, h.broadcaster.Clock())
+	}
+	if keepalive, ok := h.keepalive[client.Class]; ok {
+		client.Keepalive = keepalive
+	}
+	pongTimeout := client.Keepalive.PongTimeout
+
 	conn.SetReadLimit(1024 * 1024)
-	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	conn.SetReadDeadline(time.Now().Add(pongTimeout))
 	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		conn.SetReadDeadline(time.Now().Add(pongTimeout))
 		return nil
 	})
 
-	client := broadcaster.NewClient(conn, r)
 	h.broadcaster.Register(client)
 
 	go client.WritePump()
@@ -73,13 +275,27 @@ func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
-		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		conn.SetReadDeadline(time.Now().Add(pongTimeout))
 		client.IncrementRecv()
 
-		go h.handleMessage(client, message)
+		go h.handleMessageSafely(client, message)
 	}
 }
 
+// handleMessageSafely runs handleMessage, turning a panic into a crash report
+// and an internal error response instead of a process crash
+func (h *WebSocketHandler) handleMessageSafely(client *broadcaster.Client, message []byte) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			var req rpc.Request
+			json.Unmarshal(message, &req)
+			recovery.Report(recovered, recovery.Context{Component: "handler", Method: req.Method, ClientID: client.ID})
+			h.sendError(client, req.ID, rpc.ErrCodeInternalError, "Internal error")
+		}
+	}()
+	h.handleMessage(client, message)
+}
+
 // handleMessage processes an incoming WebSocket message
 func (h *WebSocketHandler) handleMessage(client *broadcaster.Client, message []byte) {
 	if len(message) > 0 && message[0] == '[' {
@@ -89,22 +305,30 @@ func (h *WebSocketHandler) handleMessage(client *broadcaster.Client, message []b
 
 	var req rpc.Request
 	if err := json.Unmarshal(message, &req); err != nil {
-		h.sendError(client, nil, rpc.ErrCodeParseError, "Failed to parse JSON-RPC request")
+		h.sendError(client, nil, rpc.ErrCodeParseError, h.broadcaster.Compat().ParseError("Failed to parse JSON-RPC request"))
 		return
 	}
 
 	if req.JSONRPC != "2.0" {
-		h.sendError(client, req.ID, rpc.ErrCodeInvalidRequest, "Invalid JSON-RPC version")
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidRequest, h.broadcaster.Compat().InvalidRequest("Invalid JSON-RPC version"))
 		return
 	}
 
 	if req.Method == "" {
-		h.sendError(client, req.ID, rpc.ErrCodeInvalidRequest, "Method is required")
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidRequest, h.broadcaster.Compat().InvalidRequest("Method is required"))
+		return
+	}
+	if h.draining.Load() {
+		h.sendDraining(client, req.ID)
 		return
 	}
 
 	// Track WebSocket RPC request
 	metrics.WSRPCRequestsTotal.WithLabelValues(req.Method).Inc()
+	client.RecordUsage(1, 0, 0)
+	if !h.useRequests(client, 1, req.ID) {
+		return
+	}
 
 	switch req.Method {
 	case "eth_subscribe":
@@ -113,25 +337,102 @@ func (h *WebSocketHandler) handleMessage(client *broadcaster.Client, message []b
 	case "eth_unsubscribe":
 		h.handleUnsubscribe(client, &req)
 		return
+	case "hl_subscribeBatch":
+		h.handleSubscribeBatch(client, &req)
+		return
+	case "hl_exportSubscriptions":
+		h.handleExportSubscriptions(client, &req)
+		return
+	case "hl_importSubscriptions":
+		h.handleImportSubscriptions(client, &req)
+		return
+	case "hl_pauseSubscription":
+		h.handleSetPaused(client, &req, true)
+		return
+	case "hl_resumeSubscription":
+		h.handleSetPaused(client, &req, false)
+		return
+	case "hl_recoverSubscription":
+		h.handleRecoverSubscription(client, &req)
+		return
+	case "hl_decodeTopic":
+		h.handleDecodeTopic(client, &req)
+		return
+	case "eth_newFilter", "eth_newBlockFilter", "eth_newPendingTransactionFilter",
+		"eth_getFilterChanges", "eth_getFilterLogs", "eth_uninstallFilter":
+		if h.filters != nil {
+			h.handleFilter(client, &req)
+			return
+		}
 	}
 
-	resp, err := h.client.Call(context.Background(), &req)
+	key, cacheable := cacheKey(&req)
+	var generation uint64
+	if h.cache != nil && cacheable {
+		result, gen, ok := h.cache.Get(key)
+		if ok {
+			metrics.CacheHitsTotal.WithLabelValues(req.Method).Inc()
+			h.sendResult(client, req.ID, result)
+			return
+		}
+		generation = gen
+		metrics.CacheMissesTotal.WithLabelValues(req.Method).Inc()
+	}
+
+	ctx, cancel := requestContext(client)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := h.call(ctx, &req)
+	h.observeLatency(client, req.Method, start)
+	if isOutage(err) {
+		if resp, ok := h.degraded(&req, err, key, cacheable); ok {
+			h.sendResponse(client, resp)
+			return
+		}
+	}
+	if errors.Is(err, rpc.ErrUpstreamUnavailable) {
+		h.sendUpstreamUnavailable(client, req.ID, err)
+		return
+	}
+	if errors.Is(err, rpc.ErrRateLimited) {
+		h.sendRetryableError(client, req.ID, rpc.ErrCodeQuotaExceeded, err.Error(), rateLimitRetryIn(err))
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		h.sendError(client, req.ID, rpc.ErrCodeTimeout, "timeout: request budget exhausted")
+		return
+	}
 	if err != nil {
 		logger.Error("Failed to forward request: %v", err)
 		h.sendError(client, req.ID, rpc.ErrCodeInternalError, "Failed to forward request")
 		return
 	}
 
-	data, _ := json.Marshal(resp)
-	select {
-	case client.Send() <- data:
-	default:
-		logger.Warn("Client send buffer full")
+	if h.cache != nil && cacheable && resp.Error == nil && len(resp.Result) > 0 {
+		h.cache.Set(generation, key, resp.Result)
+	}
+
+	h.sendResponse(client, resp)
+}
+
+// requestContext returns the context for an upstream call made on behalf of
+// a client: canceled when the client disconnects and bounded by the client's
+// own request budget, if any. The RPC client caps it with the upstream timeout.
+func requestContext(client *broadcaster.Client) (context.Context, context.CancelFunc) {
+	if client.RequestTimeout > 0 {
+		return context.WithTimeout(client.Context(), client.RequestTimeout)
 	}
+	return context.WithCancel(client.Context())
 }
 
 // handleBatchMessage processes a batch of requests
 func (h *WebSocketHandler) handleBatchMessage(client *broadcaster.Client, message []byte) {
+	if h.draining.Load() {
+		h.sendDraining(client, nil)
+		return
+	}
+
 	// Parse to count requests
 	var reqs []rpc.Request
 	if err := json.Unmarshal(message, &reqs); err == nil {
@@ -140,9 +441,30 @@ func (h *WebSocketHandler) handleBatchMessage(client *broadcaster.Client, messag
 				metrics.WSRPCRequestsTotal.WithLabelValues(req.Method).Inc()
 			}
 		}
+		client.RecordUsage(uint64(len(reqs)), 0, 0)
+	}
+	if !h.useRequests(client, uint64(max(len(reqs), 1)), nil) {
+		return
 	}
 
-	resp, err := h.client.CallRaw(context.Background(), message)
+	ctx, cancel := requestContext(client)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := h.callRaw(ctx, message)
+	h.observeLatency(client, "batch", start)
+	if errors.Is(err, rpc.ErrUpstreamUnavailable) {
+		h.sendUpstreamUnavailable(client, nil, err)
+		return
+	}
+	if errors.Is(err, rpc.ErrRateLimited) {
+		h.sendRetryableError(client, nil, rpc.ErrCodeQuotaExceeded, err.Error(), rateLimitRetryIn(err))
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		h.sendError(client, nil, rpc.ErrCodeTimeout, "timeout: request budget exhausted")
+		return
+	}
 	if err != nil {
 		logger.Error("Failed to forward batch request: %v", err)
 		return
@@ -163,10 +485,106 @@ func (h *WebSocketHandler) handleSubscribe(client *broadcaster.Client, req *rpc.
 		return
 	}
 
+	pending, rpcErr := h.subscribe(client, params)
+	if rpcErr != nil {
+		h.sendError(client, req.ID, rpcErr.Code, rpcErr.Message)
+		return
+	}
+
+	result, _ := json.Marshal(pending.id)
+	h.sendResult(client, req.ID, result)
+	pending.start()
+}
+
+// handleSubscribeBatch creates several subscriptions in one request. params is
+// an array of eth_subscribe params; the result is the array of subscription
+// IDs in the same order.
+func (h *WebSocketHandler) handleSubscribeBatch(client *broadcaster.Client, req *rpc.Request) {
+	var specs [][]json.RawMessage
+	if err := json.Unmarshal(req.Params, &specs); err != nil || len(specs) == 0 {
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams, "hl_subscribeBatch requires a non-empty array of subscription parameters")
+		return
+	}
+	if len(specs) > MaxSubscribeBatch {
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams, fmt.Sprintf("hl_subscribeBatch accepts at most %d subscriptions", MaxSubscribeBatch))
+		return
+	}
+	h.subscribeAll(client, req.ID, specs)
+}
+
+// handleExportSubscriptions returns the connection's subscriptions as a
+// snapshot that hl_importSubscriptions accepts, e.g. on another replica
+// after a reconnect
+func (h *WebSocketHandler) handleExportSubscriptions(client *broadcaster.Client, req *rpc.Request) {
+	result, _ := json.Marshal(h.broadcaster.SubscriptionManager().Snapshot(client.ID))
+	h.sendResult(client, req.ID, result)
+}
+
+// handleImportSubscriptions recreates the subscriptions of an exported
+// snapshot and returns their new IDs in the snapshot's order
+func (h *WebSocketHandler) handleImportSubscriptions(client *broadcaster.Client, req *rpc.Request) {
+	var params []subscription.Snapshot
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams, "hl_importSubscriptions requires a single snapshot parameter")
+		return
+	}
+	snapshot := params[0]
+	if snapshot.Version != subscription.SnapshotVersion {
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams, fmt.Sprintf("unsupported snapshot version %d", snapshot.Version))
+		return
+	}
+	if len(snapshot.Subscriptions) > MaxSubscribeBatch {
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams, fmt.Sprintf("hl_importSubscriptions accepts at most %d subscriptions", MaxSubscribeBatch))
+		return
+	}
+	h.subscribeAll(client, req.ID, snapshot.Subscriptions)
+}
+
+// subscribeAll creates the subscriptions of a batch and sends their IDs. It
+// is all-or-nothing: on the first invalid spec the subscriptions already
+// created are removed and the error names the failing spec.
+func (h *WebSocketHandler) subscribeAll(client *broadcaster.Client, id json.RawMessage, specs [][]json.RawMessage) {
+	pending := make([]*pendingSubscription, 0, len(specs))
+	for i, params := range specs {
+		p, rpcErr := h.subscribe(client, params)
+		if rpcErr != nil {
+			for _, created := range pending {
+				h.broadcaster.SubscriptionManager().Unsubscribe(client.ID, created.id)
+			}
+			h.sendError(client, id, rpcErr.Code, fmt.Sprintf("subscription %d: %s", i, rpcErr.Message))
+			return
+		}
+		pending = append(pending, p)
+	}
+
+	ids := make([]string, len(pending))
+	for i, p := range pending {
+		ids[i] = p.id
+	}
+	result, _ := json.Marshal(ids)
+	h.sendResult(client, id, result)
+	for _, p := range pending {
+		p.start()
+	}
+}
+
+// pendingSubscription is a subscription created but not yet announced to the
+// client. start delivers its initial notifications and must be called once
+// the subscription ID has been sent.
+type pendingSubscription struct {
+	id    string
+	start func()
+}
+
+// subscribe validates eth_subscribe params and creates the subscription
+func (h *WebSocketHandler) subscribe(client *broadcaster.Client, params []json.RawMessage) (*pendingSubscription, *rpc.Error) {
+	if len(params) == 0 {
+		return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: "Invalid subscription parameters"}
+	}
+
 	var subType string
 	if err := json.Unmarshal(params[0], &subType); err != nil {
-		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams, "Subscription type must be a string")
-		return
+		return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: "Subscription type must be a string"}
 	}
 
 	var subscriptionType subscription.SubscriptionType
@@ -175,6 +593,14 @@ func (h *WebSocketHandler) handleSubscribe(client *broadcaster.Client, req *rpc.
 	switch subType {
 	case "newHeads":
 		subscriptionType = subscription.SubTypeNewHeads
+		if len(params) > 1 {
+			filterParams = params[1]
+		}
+	case "newHeadsLite":
+		subscriptionType = subscription.SubTypeNewHeadsLite
+		if len(params) > 1 {
+			filterParams = params[1]
+		}
 	case "logs":
 		subscriptionType = subscription.SubTypeLogs
 		if len(params) > 1 {
@@ -182,34 +608,285 @@ func (h *WebSocketHandler) handleSubscribe(client *broadcaster.Client, req *rpc.
 		}
 	case "gasPrice":
 		subscriptionType = subscription.SubTypeGasPrice
+		if len(params) > 1 {
+			if _, err := subscription.ParseGasPriceFilter(params[1]); err != nil {
+				return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+			}
+			filterParams = params[1]
+		}
 	case "blockReceipts":
 		subscriptionType = subscription.SubTypeBlockReceipts
+		if len(params) > 1 {
+			if _, err := subscription.ParseReceiptsFilter(params[1]); err != nil {
+				return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+			}
+			filterParams = params[1]
+		}
+	case "balanceChanges":
+		subscriptionType = subscription.SubTypeBalanceChanges
+		if len(params) < 2 {
+			return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: "balanceChanges requires an address parameter"}
+		}
+		if _, err := subscription.ParseBalanceFilter(params[1]); err != nil {
+			return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+		}
+		filterParams = params[1]
+	case "nonceChanges":
+		subscriptionType = subscription.SubTypeNonceChanges
+		if len(params) < 2 {
+			return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: "nonceChanges requires an address parameter"}
+		}
+		if _, err := subscription.ParseNonceFilter(params[1]); err != nil {
+			return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+		}
+		filterParams = params[1]
+	case "baseFee":
+		subscriptionType = subscription.SubTypeBaseFee
+		if len(params) > 1 {
+			filterParams = params[1]
+		}
+	case "feeHistory":
+		subscriptionType = subscription.SubTypeFeeHistory
+		if len(params) > 1 {
+			if _, err := subscription.ParseFeeHistoryFilter(params[1]); err != nil {
+				return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+			}
+			filterParams = params[1]
+		}
+	case "blockStats":
+		subscriptionType = subscription.SubTypeBlockStats
+		if len(params) > 1 {
+			filterParams = params[1]
+		}
 	case "syncing":
 		subscriptionType = subscription.SubTypeSyncing
+		if len(params) > 1 {
+			filterParams = params[1]
+		}
+	case "txConfirmation":
+		subscriptionType = subscription.SubTypeTxConfirmation
+		if len(params) < 2 {
+			return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: "txConfirmation requires a hash parameter"}
+		}
+		if _, err := subscription.ParseTxConfirmationFilter(params[1]); err != nil {
+			return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+		}
+		filterParams = params[1]
+	case "hl_bigBlocks":
+		subscriptionType = subscription.SubTypeBigBlocks
+		if len(params) > 1 {
+			filterParams = params[1]
+		}
+	case "hl_systemTxs":
+		subscriptionType = subscription.SubTypeSystemTxs
+		if len(params) > 1 {
+			filterParams = params[1]
+		}
+	case "tokenTransfers":
+		subscriptionType = subscription.SubTypeTokenTransfers
+		if len(params) > 1 {
+			if _, err := subscription.ParseTokenTransferFilter(params[1]); err != nil {
+				return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+			}
+			filterParams = params[1]
+		}
+	case "reorg":
+		subscriptionType = subscription.SubTypeReorg
+		if len(params) > 1 {
+			filterParams = params[1]
+		}
+	case "test":
+		if !h.testSubscription {
+			return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: "test subscription is disabled (TEST_INTERVAL)"}
+		}
+		subscriptionType = subscription.SubTypeTest
+		if len(params) > 1 {
+			filterParams = params[1]
+		}
+	case "proxyMetrics":
+		if !client.IsAdmin {
+			return nil, &rpc.Error{Code: rpc.ErrCodeUnauthorized, Message: "proxyMetrics subscription requires admin credentials"}
+		}
+		subscriptionType = subscription.SubTypeProxyMetrics
+		if len(params) > 1 {
+			filterParams = params[1]
+		}
+	case "newPendingTransactions":
+		// Hyperliquid has no public mempool, so there is no pending-tx feed to stream
+		return nil, &rpc.Error{
+			Code:    rpc.ErrCodeInvalidParams,
+			Message: "newPendingTransactions is not supported: Hyperliquid has no public mempool",
+		}
 	default:
-		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams,
-			"Unsupported subscription type. Supported: newHeads, logs, gasPrice, blockReceipts, syncing")
-		return
+		return nil, &rpc.Error{
+			Code: rpc.ErrCodeInvalidParams,
+			Message: h.broadcaster.Compat().UnsupportedSubscription(subType, "Unsupported subscription type. Supported: newHeads, newHeadsLite, logs, gasPrice, blockReceipts, "+
+				"blockStats, baseFee, feeHistory, balanceChanges, nonceChanges, syncing, txConfirmation, hl_bigBlocks, hl_systemTxs, tokenTransfers, reorg, test"),
+		}
+	}
+
+	// A logs filter with fromBlock replays historical logs before live delivery
+	var backfill *subscription.LogFilter
+	if subscriptionType == subscription.SubTypeLogs && len(filterParams) > 0 {
+		filters, err := subscription.ParseLogFilters(filterParams)
+		if err != nil {
+			return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+		}
+		for i := range filters {
+			filter := &filters[i]
+			if filter.FromBlock == "" || filter.FromBlock == "latest" {
+				continue
+			}
+			if len(filters) > 1 {
+				return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: "fromBlock is only supported with a single logs filter"}
+			}
+			if _, err := rpc.ParseHexUint64(filter.FromBlock); err != nil {
+				return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: "fromBlock must be a hex block number"}
+			}
+			backfill = filter
+		}
 	}
 
 	subManager := h.broadcaster.SubscriptionManager()
-	subID, err := subManager.Subscribe(client.ID, subscriptionType, filterParams)
+	var subID string
+	var err error
+	if backfill != nil {
+		// Hold live notifications so the backfill is delivered first and no block is skipped
+		subID, err = subManager.SubscribeHeld(client.ID, subscriptionType, filterParams)
+	} else {
+		subID, err = subManager.Subscribe(client.ID, subscriptionType, filterParams)
+	}
 	if err != nil {
-		h.sendError(client, req.ID, rpc.ErrCodeInternalError, "Failed to create subscription")
+		return nil, &rpc.Error{Code: rpc.ErrCodeInvalidParams, Message: err.Error()}
+	}
+
+	var backfillLogs []rpc.Log
+	var backfilledTo uint64
+	if backfill != nil {
+		var rpcErr *rpc.Error
+		backfillLogs, backfilledTo, rpcErr = h.fetchBackfill(client, backfill)
+		if rpcErr != nil {
+			subManager.Unsubscribe(client.ID, subID)
+			return nil, rpcErr
+		}
+	}
+
+	return &pendingSubscription{
+		id: subID,
+		start: func() {
+			h.startSubscription(client, subID, backfill, backfillLogs, backfilledTo)
+		},
+	}, nil
+}
+
+// startSubscription sends a new subscription's initial notifications: the
+// current sync status for syncing, and the historical logs of a backfill
+// before releasing the held live notifications past the backfilled block
+func (h *WebSocketHandler) startSubscription(client *broadcaster.Client, subID string, backfill *subscription.LogFilter, backfillLogs []rpc.Log, backfilledTo uint64) {
+	sub, exists := h.broadcaster.SubscriptionManager().Get(subID)
+	if !exists {
 		return
 	}
 
-	resp := &rpc.Response{
-		JSONRPC: "2.0",
-		ID:      req.ID,
+	// Send the current sync status right away instead of waiting for the next
+	// poll, which only runs while there are syncing subscribers
+	if sub.Type == subscription.SubTypeSyncing {
+		status := h.broadcaster.LatestSyncStatus()
+		if h.syncCheck != nil {
+			ctx, cancel := requestContext(client)
+			status = h.syncCheck(ctx)
+			cancel()
+		}
+		if status != nil {
+			if data, err := sub.Notification(h.broadcaster.Compat().SyncingResult(status)); err == nil {
+				if h.broadcaster.Deliver(sub, data) {
+					metrics.WSSyncingNotificationsSent.Inc()
+				}
+			}
+		}
 	}
-	resp.Result, _ = json.Marshal(subID)
 
-	data, _ := json.Marshal(resp)
-	select {
-	case client.Send() <- data:
-	default:
+	// Send the current gas prices right away instead of waiting for the next change
+	if sub.Type == subscription.SubTypeGasPrice && h.gasPrices != nil {
+		if info := h.gasPrices.Latest(); info != nil {
+			h.broadcaster.SendGasPriceSnapshot(sub, info)
+		}
+	}
+
+	// Send the chain tip right away instead of waiting for the next block
+	if sub.Type == subscription.SubTypeNewHeads || sub.Type == subscription.SubTypeNewHeadsLite {
+		h.broadcaster.SendLatestHead(sub)
+	}
+	if sub.Type == subscription.SubTypeBaseFee {
+		h.broadcaster.SendLatestBaseFee(sub)
+	}
+
+	// A transaction mined before subscribing is reported right away
+	if sub.Type == subscription.SubTypeTxConfirmation {
+		ctx, cancel := requestContext(client)
+		h.broadcaster.CheckTxConfirmation(ctx, sub, h.client.GetTransactionReceipt)
+		cancel()
+	}
+
+	if backfill != nil {
+		for i := range backfillLogs {
+			if !subscription.MatchesLogFilter(&backfillLogs[i], backfill) {
+				continue
+			}
+			data, err := h.broadcaster.Notification(sub, sub.LogResult(&backfillLogs[i]), backfillLogs[i].Address)
+			if err != nil {
+				if h.broadcaster.NotificationFailed(sub, err) {
+					return
+				}
+				continue
+			}
+			if h.broadcaster.Deliver(sub, data) {
+				metrics.WSLogsBackfilledTotal.Inc()
+			}
+		}
+		h.broadcaster.ReleaseSubscription(client.ID, subID, backfilledTo)
+	}
+}
+
+// fetchBackfill fetches historical logs from filter.FromBlock up to the current
+// head, reading blocks held in storage or the archive locally. It also
+// returns the last block covered, whose logs live delivery must skip.
+func (h *WebSocketHandler) fetchBackfill(client *broadcaster.Client, filter *subscription.LogFilter) ([]rpc.Log, uint64, *rpc.Error) {
+	ctx, cancel := requestContext(client)
+	defer cancel()
+
+	fromBlock, _ := rpc.ParseHexUint64(filter.FromBlock)
+
+	// Watchlist addresses are retained locally, no upstream round trip needed
+	if h.watchlist != nil && h.watchlist.Covers(filter.Address, fromBlock) {
+		logs, newest := h.watchlist.Query(filter.Address, fromBlock)
+		metrics.WSLogsBackfillWatchlistTotal.Inc()
+		return logs, newest, nil
+	}
+
+	latest, err := h.client.GetBlockNumber(ctx)
+	if err != nil {
+		logger.Error("Failed to fetch block number for backfill: %v", err)
+		return nil, 0, &rpc.Error{Code: rpc.ErrCodeInternalError, Message: "Failed to fetch current block for backfill"}
+	}
+	toBlock, err := rpc.ParseHexUint64(latest)
+	if err != nil {
+		return nil, 0, &rpc.Error{Code: rpc.ErrCodeInternalError, Message: "Failed to fetch current block for backfill"}
+	}
+
+	if fromBlock > toBlock {
+		return nil, toBlock, nil
+	}
+	// Blocks held in storage or the archive don't count against the limit
+	segments := h.planLogRange(ctx, fromBlock, toBlock)
+	if h.backfillMaxBlocks > 0 && upstreamBlocks(segments) > h.backfillMaxBlocks {
+		return nil, 0, &rpc.Error{
+			Code:    rpc.ErrCodeInvalidParams,
+			Message: fmt.Sprintf("fromBlock is too far back: backfill is limited to %d blocks", h.backfillMaxBlocks),
+		}
 	}
+	logs, rpcErr := h.readLogRange(ctx, []subscription.LogFilter{*filter}, segments)
+	return logs, toBlock, rpcErr
 }
 
 // handleUnsubscribe handles eth_unsubscribe requests
@@ -229,17 +906,153 @@ func (h *WebSocketHandler) handleUnsubscribe(client *broadcaster.Client, req *rp
 		ID:      req.ID,
 	}
 	resp.Result, _ = json.Marshal(success)
+	h.sendResponse(client, resp)
+}
+
+// handleSetPaused pauses or resumes one of the client's subscriptions. The
+// result is false if the subscription does not exist, as for eth_unsubscribe.
+func (h *WebSocketHandler) handleSetPaused(client *broadcaster.Client, req *rpc.Request, paused bool) {
+	var params []string
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams, fmt.Sprintf("%s requires a single subscription ID parameter", req.Method))
+		return
+	}
+
+	success := h.broadcaster.SubscriptionManager().SetPaused(client.ID, params[0], paused)
+	result, _ := json.Marshal(success)
+	h.sendResult(client, req.ID, result)
+}
+
+// handleRecoverSubscription recovers a resumable subscription after a
+// reconnect given its resume token and the last sequence number received. It
+// returns the subscription ID and then replays the notifications missed since
+// lastSeq.
+func (h *WebSocketHandler) handleRecoverSubscription(client *broadcaster.Client, req *rpc.Request) {
+	var params []json.RawMessage
+	var token string
+	var lastSeq uint64
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 2 ||
+		json.Unmarshal(params[0], &token) != nil || json.Unmarshal(params[1], &lastSeq) != nil {
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams, "hl_recoverSubscription requires a resume token and the last sequence number")
+		return
+	}
+
+	err := h.broadcaster.SubscriptionManager().Resume(token, client.ID, lastSeq,
+		func(subID string) {
+			result, _ := json.Marshal(subID)
+			h.sendResult(client, req.ID, result)
+		},
+		func(data []byte) bool {
+			return h.broadcaster.SendToClient(client.ID, data)
+		})
+	if err != nil {
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams, err.Error())
+	}
+}
 
+// handleDecodeTopic resolves an event topic0 against the bundled signature
+// registry. Unknown topics return null.
+func (h *WebSocketHandler) handleDecodeTopic(client *broadcaster.Client, req *rpc.Request) {
+	var params []string
+	if err := json.Unmarshal(req.Params, &params); err != nil || len(params) != 1 {
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams, "hl_decodeTopic requires a single topic parameter")
+		return
+	}
+	topic := params[0]
+	if len(topic) != 66 || !strings.HasPrefix(topic, "0x") {
+		h.sendError(client, req.ID, rpc.ErrCodeInvalidParams, "topic must be a 32-byte hex string")
+		return
+	}
+
+	result, _ := json.Marshal(rpc.DecodeTopic(topic))
+	h.sendResult(client, req.ID, result)
+}
+
+// sendResult sends a JSON-RPC success response to a WebSocket client
+func (h *WebSocketHandler) sendResult(client *broadcaster.Client, id json.RawMessage, result json.RawMessage) {
+	h.sendResponse(client, &rpc.Response{
+		JSONRPC: "2.0",
+		Result:  result,
+		ID:      id,
+	})
+}
+
+// sendResponse sends a JSON-RPC response to a WebSocket client, with the
+// quota extension field once the client is past a quota warning level
+func (h *WebSocketHandler) sendResponse(client *broadcaster.Client, resp *rpc.Response) {
+	resp.Quota = client.QuotaStatus()
 	data, _ := json.Marshal(resp)
 	select {
 	case client.Send() <- data:
 	default:
+		logger.Warn("Client send buffer full")
 	}
 }
 
+// useRequests counts n requests against the client's quota, pushing a
+// warning when they cross a warning level. It answers id with an error and
+// returns false if the quota is exhausted.
+func (h *WebSocketHandler) useRequests(client *broadcaster.Client, n uint64, id json.RawMessage) bool {
+	if client.Identity != "" {
+		metrics.WSIdentityRequestsTotal.WithLabelValues(client.Identity).Add(float64(n))
+	}
+	ok, warning := client.UseRequests(n)
+	if warning != nil {
+		if data, err := broadcaster.QuotaWarningNotification(warning); err == nil {
+			select {
+			case client.Send() <- data:
+			default:
+			}
+		}
+	}
+	if !ok {
+		h.sendRetryableError(client, id, rpc.ErrCodeQuotaExceeded, fmt.Sprintf("request quota exceeded: %d requests per %v", h.quota.Requests, h.quota.Window), client.RequestQuotaResetsIn())
+	}
+	return ok
+}
+
+// sendUpstreamUnavailable reports that requests cannot be forwarded, including the root cause
+func (h *WebSocketHandler) sendUpstreamUnavailable(client *broadcaster.Client, id json.RawMessage, err error) {
+	message, retryAfter := h.upstreamUnavailable(err)
+	h.sendRetryableError(client, id, rpc.ErrCodeUpstreamUnavailable, message, retryAfter)
+}
+
+// upstreamUnavailable explains why a call wasn't forwarded: an open circuit
+// breaker or the upstream's readiness status, and when to retry
+func (h *WebSocketHandler) upstreamUnavailable(err error) (string, time.Duration) {
+	var open *rpc.CircuitOpenError
+	if errors.As(err, &open) {
+		return "Upstream RPC unavailable: " + open.Error(), open.RetryIn
+	}
+	_, reason := h.client.Status()
+	return "Upstream RPC unavailable: " + reason, 0
+}
+
+// rateLimitRetryIn returns when a call refused by the upstream rate limit
+// may be retried
+func rateLimitRetryIn(err error) time.Duration {
+	var limited *rpc.RateLimitedError
+	if errors.As(err, &limited) {
+		return limited.RetryIn
+	}
+	return 0
+}
+
+// sendDraining tells the client the server is shutting down
+func (h *WebSocketHandler) sendDraining(client *broadcaster.Client, id json.RawMessage) {
+	h.sendError(client, id, rpc.ErrCodeDraining, "Server is shutting down; reconnect")
+}
+
 // sendError sends a JSON-RPC error response to a WebSocket client
 func (h *WebSocketHandler) sendError(client *broadcaster.Client, id json.RawMessage, code int, message string) {
-	resp := rpc.NewErrorResponse(id, code, message)
+	h.sendRetryableError(client, id, code, message, 0)
+}
+
+// sendRetryableError sends a JSON-RPC error response whose data hints the
+// client to retry after retryAfter (0 for the code's default)
+func (h *WebSocketHandler) sendRetryableError(client *broadcaster.Client, id json.RawMessage, code int, message string, retryAfter time.Duration) {
+	resp := rpc.NewProxyErrorResponse(id, code, message, retryAfter)
+	resp.Quota = client.QuotaStatus()
 	data, _ := json.Marshal(resp)
 	select {
 	case client.Send() <- data:
@@ -1,15 +1,21 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"hlnode-websocket/internal/broadcaster"
+	"hlnode-websocket/internal/cache"
+	"hlnode-websocket/internal/clock"
+	"hlnode-websocket/internal/labels"
 	"hlnode-websocket/internal/rpc"
+	"hlnode-websocket/internal/subscription"
 
 	"github.com/gorilla/websocket"
 )
@@ -39,6 +45,20 @@ func mockRPCServer() *httptest.Server {
 				GasUsed:    "0x500000",
 			}
 			resp.Result, _ = json.Marshal(block)
+		case "test_slow":
+			time.Sleep(500 * time.Millisecond)
+			resp.Result, _ = json.Marshal("slow")
+		case "eth_getLogs":
+			logs := []rpc.Log{
+				{
+					Address:         "0x1111111111111111111111111111111111111111",
+					Topics:          []string{"0xtopic1"},
+					BlockNumber:     "0x123450",
+					TransactionHash: "0xhistorical",
+					LogIndex:        "0x0",
+				},
+			}
+			resp.Result, _ = json.Marshal(logs)
 		default:
 			resp.Result, _ = json.Marshal("ok")
 		}
@@ -54,8 +74,7 @@ func TestWebSocketConnection(t *testing.T) {
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -80,8 +99,7 @@ func TestWebSocketRPCCall(t *testing.T) {
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -141,8 +159,7 @@ func TestWebSocketSubscribe(t *testing.T) {
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -194,8 +211,7 @@ func TestWebSocketUnsubscribe(t *testing.T) {
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -259,8 +275,7 @@ func TestWebSocketInvalidRequest(t *testing.T) {
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -303,8 +318,7 @@ func TestWebSocketSubscriptionNotification(t *testing.T) {
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -338,9 +352,6 @@ func TestWebSocketSubscriptionNotification(t *testing.T) {
 		GasUsed:    "0x500",
 	}
 
-	// Give time for client registration
-	time.Sleep(100 * time.Millisecond)
-
 	bc.BroadcastNewHead(testHeader)
 
 	// Read notification
@@ -368,14 +379,189 @@ func TestWebSocketSubscriptionNotification(t *testing.T) {
 	t.Logf("Received notification for block: %v", result["number"])
 }
 
+// TestWebSocketNewHeadsLiteSubscription tests the minimal header variant
+func TestWebSocketNewHeadsLiteSubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"newHeadsLite"},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{
+		Number:     "0x999",
+		Hash:       "0xtest",
+		ParentHash: "0xparent",
+		Timestamp:  "0x12345",
+		LogsBloom:  "0x" + strings.Repeat("0", 512),
+		GasLimit:   "0x1000",
+	})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification map[string]interface{}
+	json.Unmarshal(message, &notification)
+	params := notification["params"].(map[string]interface{})
+	result := params["result"].(map[string]interface{})
+
+	if len(result) != 4 {
+		t.Errorf("Expected 4 header fields, got %v", result)
+	}
+	if result["number"] != "0x999" || result["hash"] != "0xtest" || result["parentHash"] != "0xparent" || result["timestamp"] != "0x12345" {
+		t.Errorf("Unexpected lite header: %v", result)
+	}
+}
+
+// TestWebSocketBigBlocksSubscription tests the hl_bigBlocks header stream
+func TestWebSocketBigBlocksSubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"hl_bigBlocks"},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(message, &response)
+	if response["error"] != nil {
+		t.Fatalf("Subscribe failed: %v", response["error"])
+	}
+
+	// A small block goes to newHeads only
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x999", Hash: "0xsmall", GasLimit: "0x1e8480"})
+
+	header := &rpc.FullBlockHeader{Number: "0x99a", Hash: "0xbig", GasLimit: "0x1c9c380"}
+	if !header.IsBigBlock(10000000) {
+		t.Fatal("Expected a 30M gas limit block to be a big block")
+	}
+	bc.BroadcastBigBlock(&rpc.BigBlockHeader{FullBlockHeader: header, BigBlockGasPrice: "0x5f5e100"})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification map[string]interface{}
+	json.Unmarshal(message, &notification)
+	params := notification["params"].(map[string]interface{})
+	result := params["result"].(map[string]interface{})
+
+	if result["hash"] != "0xbig" {
+		t.Errorf("Expected the big block header, got %v", result)
+	}
+	if result["bigBlockGasPrice"] != "0x5f5e100" {
+		t.Errorf("Expected bigBlockGasPrice 0x5f5e100, got %v", result["bigBlockGasPrice"])
+	}
+}
+
+// TestWebSocketNewHeadsSkipsBigBlocks tests that newHeads stays small-block only
+func TestWebSocketNewHeadsSkipsBigBlocks(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	bc := newTestBroadcaster(t)
+	bc.SetBigBlockMinGasLimit(10000000)
+
+	wsHandler := NewWebSocketHandler(rpc.NewClient(mockServer.URL), bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"newHeads"},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(message, &response)
+	if response["error"] != nil {
+		t.Fatalf("Subscribe failed: %v", response["error"])
+	}
+
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x99a", Hash: "0xbig", GasLimit: "0x1c9c380"})
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x99b", Hash: "0xsmall", GasLimit: "0x1e8480"})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification map[string]interface{}
+	json.Unmarshal(message, &notification)
+	params := notification["params"].(map[string]interface{})
+	result := params["result"].(map[string]interface{})
+	if result["hash"] != "0xsmall" {
+		t.Errorf("Expected the big block to be skipped, got %v", result)
+	}
+}
+
 // TestWebSocketLogsSubscription tests logs subscription with filter
 func TestWebSocketLogsSubscription(t *testing.T) {
 	mockServer := mockRPCServer()
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -395,7 +581,7 @@ func TestWebSocketLogsSubscription(t *testing.T) {
 		"params": []interface{}{
 			"logs",
 			map[string]interface{}{
-				"address": []string{"0x1234567890abcdef"},
+				"address": []string{"0x1234567890abcdef1234567890abcdef12345678"},
 			},
 		},
 		"id": 1,
@@ -422,8 +608,7 @@ func TestWebSocketGasPriceSubscription(t *testing.T) {
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -456,9 +641,6 @@ func TestWebSocketGasPriceSubscription(t *testing.T) {
 		t.Errorf("Expected subscription ID starting with 0x, got %s", subID)
 	}
 
-	// Give time for client registration
-	time.Sleep(100 * time.Millisecond)
-
 	// Simulate gas price broadcast
 	gasPriceInfo := &rpc.GasPriceInfo{
 		GasPrice:         "0x174876e800",
@@ -497,8 +679,7 @@ func TestWebSocketBlockReceiptsSubscription(t *testing.T) {
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -511,6 +692,22 @@ func TestWebSocketBlockReceiptsSubscription(t *testing.T) {
 	}
 	defer conn.Close()
 
+	// A malformed filter is rejected at subscribe
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"blockReceipts", map[string]interface{}{"address": 42}},
+		"id":      0,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var rejected rpc.Response
+	json.Unmarshal(message, &rejected)
+	if rejected.Error == nil || rejected.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Fatalf("Expected invalid params error, got %s", message)
+	}
+
 	// Subscribe to blockReceipts
 	request := map[string]interface{}{
 		"jsonrpc": "2.0",
@@ -520,7 +717,7 @@ func TestWebSocketBlockReceiptsSubscription(t *testing.T) {
 	}
 	conn.WriteJSON(request)
 	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-	_, message, _ := conn.ReadMessage()
+	_, message, _ = conn.ReadMessage()
 
 	var resp rpc.Response
 	json.Unmarshal(message, &resp)
@@ -531,9 +728,6 @@ func TestWebSocketBlockReceiptsSubscription(t *testing.T) {
 		t.Errorf("Expected subscription ID starting with 0x, got %s", subID)
 	}
 
-	// Give time for client registration
-	time.Sleep(100 * time.Millisecond)
-
 	// Simulate block receipts broadcast
 	blockReceipts := &rpc.BlockReceipts{
 		BlockNumber: "0x14c3a5f",
@@ -581,14 +775,13 @@ func TestWebSocketBlockReceiptsSubscription(t *testing.T) {
 	t.Logf("Received blockReceipts notification for block: %v", result["blockNumber"])
 }
 
-// TestWebSocketSyncingSubscription tests syncing subscription and notification
-func TestWebSocketSyncingSubscription(t *testing.T) {
+// TestWebSocketBalanceChangesSubscription tests balance change notifications
+func TestWebSocketBalanceChangesSubscription(t *testing.T) {
 	mockServer := mockRPCServer()
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -601,61 +794,67 @@ func TestWebSocketSyncingSubscription(t *testing.T) {
 	}
 	defer conn.Close()
 
-	// Subscribe to syncing
-	request := map[string]interface{}{
+	// An address is required
+	conn.WriteJSON(map[string]interface{}{
 		"jsonrpc": "2.0",
 		"method":  "eth_subscribe",
-		"params":  []string{"syncing"},
+		"params":  []string{"balanceChanges"},
 		"id":      1,
-	}
-	conn.WriteJSON(request)
+	})
 	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
 	_, message, _ := conn.ReadMessage()
 
 	var resp rpc.Response
 	json.Unmarshal(message, &resp)
-
-	var subID string
-	json.Unmarshal(resp.Result, &subID)
-	if !strings.HasPrefix(subID, "0x") {
-		t.Errorf("Expected subscription ID starting with 0x, got %s", subID)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Errorf("Expected invalid params error without address, got %s", message)
 	}
 
-	// Give time for client registration
-	time.Sleep(100 * time.Millisecond)
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"balanceChanges", map[string]interface{}{"address": "0xWALLET"}},
+		"id":      2,
+	})
+	conn.ReadMessage() // Read subscription response
 
-	// Simulate syncing broadcast (node in sync)
-	syncStatus := &rpc.SyncStatus{
-		Syncing:      false,
-		CurrentBlock: "0x14c3a5f",
+	if watched := bc.WatchedBalanceAddresses(); !watched["0xwallet"] || len(watched) != 1 {
+		t.Errorf("Expected 0xwallet to be watched, got %v", watched)
 	}
-	bc.BroadcastSyncing(syncStatus)
 
-	// Read notification
+	bc.BroadcastBalanceChange(&rpc.BalanceChange{Address: "0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925", BlockNumber: "0x10", PreviousBalance: "0x1", Balance: "0x2"})
+	bc.BroadcastBalanceChange(&rpc.BalanceChange{Address: "0xwallet", BlockNumber: "0x10", PreviousBalance: "0x64", Balance: "0x64"})
+	bc.BroadcastBalanceChange(&rpc.BalanceChange{Address: "0xwallet", BlockNumber: "0x11", PreviousBalance: "0x64", Balance: "0x32"})
+
 	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
 	_, message, err = conn.ReadMessage()
 	if err != nil {
 		t.Fatalf("Failed to read notification: %v", err)
 	}
 
-	var notification map[string]interface{}
+	var notification struct {
+		Params struct {
+			Result rpc.BalanceChange `json:"result"`
+		} `json:"params"`
+	}
 	json.Unmarshal(message, &notification)
 
-	if notification["method"] != "eth_subscription" {
-		t.Errorf("Expected method eth_subscription, got %v", notification["method"])
+	change := notification.Params.Result
+	if change.Address != "0xwallet" || change.BlockNumber != "0x11" || change.PreviousBalance != "0x64" || change.Balance != "0x32" {
+		t.Errorf("Unexpected balance change notification: %s", message)
+	}
+	if balance, ok := bc.LastBalance("0xwallet"); !ok || balance != "0x32" {
+		t.Errorf("Expected last balance 0x32, got %q", balance)
 	}
-
-	t.Logf("Received syncing notification")
 }
 
-// TestWebSocketLogsSubscriptionWithTopics tests logs subscription with topic filters
-func TestWebSocketLogsSubscriptionWithTopics(t *testing.T) {
+// TestWebSocketNonceChangesSubscription tests nonce change notifications
+func TestWebSocketNonceChangesSubscription(t *testing.T) {
 	mockServer := mockRPCServer()
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -668,79 +867,2613 @@ func TestWebSocketLogsSubscriptionWithTopics(t *testing.T) {
 	}
 	defer conn.Close()
 
-	// Subscribe to logs with topic filter (Transfer events)
-	transferTopic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
-	request := map[string]interface{}{
+	// An address is required
+	conn.WriteJSON(map[string]interface{}{
 		"jsonrpc": "2.0",
 		"method":  "eth_subscribe",
-		"params": []interface{}{
-			"logs",
-			map[string]interface{}{
-				"address": "0xdAC17F958D2ee523a2206206994597C13D831ec7",
-				"topics":  []string{transferTopic},
-			},
-		},
-		"id": 1,
-	}
-	conn.WriteJSON(request)
+		"params":  []string{"nonceChanges"},
+		"id":      1,
+	})
 	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-	_, message, _ := conn.ReadMessage()
-
 	var resp rpc.Response
-	json.Unmarshal(message, &resp)
-
-	var subID string
-	json.Unmarshal(resp.Result, &subID)
-	if !strings.HasPrefix(subID, "0x") {
-		t.Errorf("Expected subscription ID starting with 0x, got %s", subID)
+	conn.ReadJSON(&resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Errorf("Expected invalid params error without address, got %+v", resp)
 	}
 
-	// Give time for client registration
-	time.Sleep(100 * time.Millisecond)
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"nonceChanges", map[string]interface{}{"address": []string{"0xWALLET", "0xOther"}}},
+		"id":      2,
+	})
+	conn.ReadMessage() // Read subscription response
 
-	// Simulate log broadcast with matching topic
-	logEntry := &rpc.Log{
-		Address:         "0xdAC17F958D2ee523a2206206994597C13D831ec7",
-		Topics:          []string{transferTopic, "0x0000000000000000000000001234567890abcdef"},
-		Data:            "0x1234",
-		BlockNumber:     "0x14c3a5f",
-		TransactionHash: "0xtx1",
-		LogIndex:        "0x0",
+	if watched := bc.WatchedNonceAddresses(); !watched["0xwallet"] || !watched["0xother"] || len(watched) != 2 {
+		t.Errorf("Expected 0xwallet and 0xother to be watched, got %v", watched)
 	}
-	bc.BroadcastLog(logEntry)
 
-	// Read notification
+	bc.BroadcastNonceChange(&rpc.NonceChange{Address: "0xunwatched", BlockNumber: "0x10", PreviousNonce: "0x1", Nonce: "0x2"})
+	bc.BroadcastNonceChange(&rpc.NonceChange{Address: "0xwallet", BlockNumber: "0x10", PreviousNonce: "0x5", Nonce: "0x5"})
+	bc.BroadcastNonceChange(&rpc.NonceChange{Address: "0xwallet", BlockNumber: "0x11", PreviousNonce: "0x5", Nonce: "0x6"})
+
+	var notification struct {
+		Params struct {
+			Result rpc.NonceChange `json:"result"`
+		} `json:"params"`
+	}
 	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
-	_, message, err = conn.ReadMessage()
-	if err != nil {
+	if err := conn.ReadJSON(&notification); err != nil {
 		t.Fatalf("Failed to read notification: %v", err)
 	}
 
-	var notification map[string]interface{}
-	json.Unmarshal(message, &notification)
-
-	if notification["method"] != "eth_subscription" {
-		t.Errorf("Expected method eth_subscription, got %v", notification["method"])
+	change := notification.Params.Result
+	if change.Address != "0xwallet" || change.BlockNumber != "0x11" || change.PreviousNonce != "0x5" || change.Nonce != "0x6" {
+		t.Errorf("Unexpected nonce change notification: %+v", change)
 	}
-
-	params := notification["params"].(map[string]interface{})
-	result := params["result"].(map[string]interface{})
-
-	if result["address"] != "0xdAC17F958D2ee523a2206206994597C13D831ec7" {
-		t.Errorf("Expected address 0xdAC17F958D2ee523a2206206994597C13D831ec7, got %v", result["address"])
+	if nonce, ok := bc.LastNonce("0xwallet"); !ok || nonce != "0x6" {
+		t.Errorf("Expected last nonce 0x6, got %q", nonce)
 	}
-
-	t.Logf("Received logs notification with topics for block: %v", result["blockNumber"])
 }
 
-// TestWebSocketLogsSubscriptionMultipleAddresses tests logs subscription with multiple addresses
-func TestWebSocketLogsSubscriptionMultipleAddresses(t *testing.T) {
+// TestWebSocketBlockStatsSubscription tests per-block aggregates
+func TestWebSocketBlockStatsSubscription(t *testing.T) {
 	mockServer := mockRPCServer()
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"blockStats"},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	header := &rpc.FullBlockHeader{Number: "0x14c3a5f", GasUsed: "0x32", GasLimit: "0x64", BaseFeePerGas: "0x5f5e100", TxCount: 2}
+	bc.BroadcastBlockStats(rpc.NewBlockSummary(header, []rpc.TransactionReceipt{
+		{EffectiveGasPrice: "0x5f5e100"},
+		{EffectiveGasPrice: "0xbebc200"},
+	}))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification struct {
+		Params struct {
+			Result rpc.BlockSummary `json:"result"`
+		} `json:"params"`
+	}
+	json.Unmarshal(message, &notification)
+
+	summary := notification.Params.Result
+	if summary.Number != "0x14c3a5f" || summary.TxCount != 2 || summary.BaseFeePerGas != "0x5f5e100" || summary.AvgEffectiveGasPrice != "0x8f0d180" {
+		t.Errorf("Unexpected block stats notification: %s", message)
+	}
+}
+
+// TestWebSocketThrottleFakeClock tests maxPerSecond against a fake clock, without real waits
+func TestWebSocketThrottleFakeClock(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	bc := broadcaster.NewBroadcaster()
+	bc.SetClock(fake)
+	go bc.Run()
+	defer bc.Stop()
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"newHeads", map[string]interface{}{"maxPerSecond": 1}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	// Second head within the same fake second is throttled
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x1"})
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x2"})
+	fake.Advance(time.Second)
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x3"})
+
+	var numbers []string
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read notification: %v", err)
+		}
+		var notification subscription.SubscriptionNotification
+		json.Unmarshal(message, &notification)
+		var header rpc.FullBlockHeader
+		json.Unmarshal(notification.Params.Result, &header)
+		numbers = append(numbers, header.Number)
+	}
+
+	if numbers[0] != "0x1" || numbers[1] != "0x3" {
+		t.Errorf("Expected heads [0x1 0x3], got %v", numbers)
+	}
+}
+
+// TestWebSocketRequestQuota tests quota warnings at 80% and 95% and the hard limit
+func TestWebSocketRequestQuota(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	bc := broadcaster.NewBroadcaster()
+	bc.SetClock(fake)
+	go bc.Run()
+	defer bc.Stop()
+
+	wsHandler := NewWebSocketHandler(rpc.NewClient(mockServer.URL), bc)
+	wsHandler.SetQuota(broadcaster.Quota{Requests: 10, Window: time.Minute})
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	type message struct {
+		rpc.Response
+		Method string          `json:"method"`
+		Params rpc.QuotaStatus `json:"params"`
+	}
+	request := func() {
+		t.Helper()
+		if err := conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "eth_blockNumber"}); err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+	}
+	read := func() message {
+		t.Helper()
+		var msg message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		return msg
+	}
+
+	for i := 1; i <= 7; i++ {
+		request()
+		if resp := read(); resp.Error != nil || len(resp.Quota) != 0 {
+			t.Fatalf("Request %d: expected a plain response, got %+v", i, resp)
+		}
+	}
+
+	// The 8th request crosses 80%: a warning, then the response with the quota field
+	request()
+	warning := read()
+	if warning.Method != "hl_quotaWarning" || warning.Params.Quota != "requests" || warning.Params.Percent != 80 ||
+		warning.Params.Used != 8 || warning.Params.Limit != 10 || warning.Params.ResetsAt != fake.Now().Add(time.Minute).UnixMilli() {
+		t.Errorf("Expected an 80%% requests warning, got %+v", warning)
+	}
+	if resp := read(); len(resp.Quota) != 1 || resp.Quota[0].Percent != 80 {
+		t.Errorf("Expected the quota field on the response, got %+v", resp)
+	}
+
+	request()
+	read()
+	request()
+	if warning := read(); warning.Method != "hl_quotaWarning" || warning.Params.Percent != 95 {
+		t.Errorf("Expected a 95%% warning, got %+v", warning)
+	}
+	read()
+
+	request()
+	if resp := read(); resp.Error == nil || resp.Error.Code != rpc.ErrCodeQuotaExceeded {
+		t.Errorf("Expected the quota to be exceeded, got %+v", resp)
+	} else if data, _ := resp.Error.Data.(map[string]interface{}); data["reason"] != rpc.ReasonRateLimited || data["retryAfter"] != float64(time.Minute.Milliseconds()) {
+		t.Errorf("Expected a rate limit retry hint until the window ends, got %+v", resp.Error.Data)
+	}
+
+	// A new window resets the quota
+	fake.Advance(time.Minute)
+	request()
+	if resp := read(); resp.Error != nil || len(resp.Quota) != 0 {
+		t.Errorf("Expected a plain response in the new window, got %+v", resp)
+	}
+}
+
+// TestWebSocketSubscriptionTTL tests that a subscription is removed with a final expiry notification
+func TestWebSocketSubscriptionTTL(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	bc := broadcaster.NewBroadcaster()
+	bc.SetClock(fake)
+	go bc.Run()
+	defer bc.Stop()
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"newHeads", map[string]interface{}{"ttl": "10m", "label": "short"}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var resp rpc.Response
+	conn.ReadJSON(&resp)
+	var subID string
+	json.Unmarshal(resp.Result, &subID)
+
+	fake.Advance(9 * time.Minute)
+	bc.ExpireSubscriptions(fake.Now())
+	if _, ok := bc.SubscriptionManager().Get(subID); !ok {
+		t.Fatal("Subscription expired before its ttl")
+	}
+
+	fake.Advance(time.Minute)
+	bc.ExpireSubscriptions(fake.Now())
+	if _, ok := bc.SubscriptionManager().Get(subID); ok {
+		t.Fatal("Expected subscription to be removed after its ttl")
+	}
+
+	var notification subscription.SubscriptionNotification
+	if err := conn.ReadJSON(&notification); err != nil {
+		t.Fatalf("Failed to read expiry notification: %v", err)
+	}
+	if notification.Params.Subscription != subID || !notification.Params.Expired || notification.Params.Label != "short" {
+		t.Errorf("Unexpected expiry notification %+v", notification.Params)
+	}
+
+	// Later heads are not delivered
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x1"})
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, message, err := conn.ReadMessage(); err == nil {
+		t.Errorf("Expected no notification after expiry, got %s", message)
+	}
+}
+
+// TestWebSocketBaseFeeSubscription tests that baseFee notifies the current base fee, then only changes
+func TestWebSocketBaseFeeSubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x1", BaseFeePerGas: "0x64"})
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"baseFee"},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	// Unchanged base fee is skipped, headers without one are ignored
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x2", BaseFeePerGas: "0x64"})
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x3"})
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x4", BaseFeePerGas: "0x65"})
+
+	var received []rpc.BaseFee
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read notification: %v", err)
+		}
+		var notification subscription.SubscriptionNotification
+		json.Unmarshal(message, &notification)
+		var baseFee rpc.BaseFee
+		json.Unmarshal(notification.Params.Result, &baseFee)
+		received = append(received, baseFee)
+	}
+
+	if received[0] != (rpc.BaseFee{BlockNumber: "0x1", BaseFeePerGas: "0x64"}) || received[1] != (rpc.BaseFee{BlockNumber: "0x4", BaseFeePerGas: "0x65"}) {
+		t.Errorf("Unexpected base fee notifications: %+v", received)
+	}
+}
+
+// TestWebSocketFeeHistorySubscription tests that fee history results only reach subscriptions asking for that window
+func TestWebSocketFeeHistorySubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Invalid window is rejected
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"feeHistory", map[string]interface{}{"rewardPercentiles": []float64{90, 10}}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var resp rpc.Response
+	conn.ReadJSON(&resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Errorf("Expected invalid params error, got %+v", resp.Error)
+	}
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"feeHistory", map[string]interface{}{"blockCount": 4, "rewardPercentiles": []float64{50}}},
+		"id":      2,
+	})
+	conn.ReadJSON(&resp)
+	var subID string
+	json.Unmarshal(resp.Result, &subID)
+
+	other, _ := subscription.ParseFeeHistoryFilter(json.RawMessage(`{"blockCount":8}`))
+	bc.BroadcastFeeHistory(other, &rpc.FeeHistory{OldestBlock: "0x1"})
+	window, _ := subscription.ParseFeeHistoryFilter(json.RawMessage(`{"blockCount":4,"rewardPercentiles":[50]}`))
+	bc.BroadcastFeeHistory(window, &rpc.FeeHistory{OldestBlock: "0x5", BaseFeePerGas: []string{"0x64"}, GasUsedRatio: []float64{0.5}})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification subscription.SubscriptionNotification
+	json.Unmarshal(message, &notification)
+	var history rpc.FeeHistory
+	json.Unmarshal(notification.Params.Result, &history)
+	if notification.Params.Subscription != subID || history.OldestBlock != "0x5" || len(history.BaseFeePerGas) != 1 {
+		t.Errorf("Unexpected fee history notification: %s", message)
+	}
+}
+
+// TestWebSocketBroadcasterStop tests that stopping the broadcaster closes connected clients
+func TestWebSocketBroadcasterStop(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	bc.Stop()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNoStatusReceived) {
+		t.Errorf("Expected connection closed by the server, got %v", err)
+	}
+	if bc.ClientCount() != 0 {
+		t.Errorf("Expected no clients after stop, got %d", bc.ClientCount())
+	}
+}
+
+// TestWebSocketAddressLabels tests address label enrichment of opted-in subscriptions
+func TestWebSocketAddressLabels(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := broadcaster.NewBroadcaster()
+	bc.SetAddressLabels(labels.NewRegistry(map[string]rpc.AddressLabel{
+		"0xFROM": {Name: "Exchange 1", Tags: []string{"exchange"}},
+	}))
 	go bc.Run()
+	defer bc.Stop()
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"blockReceipts", map[string]interface{}{"addressLabels": true}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	bc.BroadcastBlockReceipts(&rpc.BlockReceipts{
+		BlockNumber: "0x14c3a5f",
+		Receipts: []rpc.TransactionReceipt{
+			{TransactionHash: "0xtx1", From: "0xfrom", To: "0xto", Logs: []rpc.Log{}},
+		},
+	})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification struct {
+		Params subscription.NotificationParams `json:"params"`
+	}
+	json.Unmarshal(message, &notification)
+
+	addressLabels := notification.Params.AddressLabels
+	if len(addressLabels) != 1 || addressLabels["0xfrom"].Name != "Exchange 1" {
+		t.Errorf("Expected the label of 0xfrom only, got %v", addressLabels)
+	}
+}
+
+// TestWebSocketSyncingSubscription tests syncing subscription and notification
+func TestWebSocketSyncingSubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Subscribe to syncing
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"syncing"},
+		"id":      1,
+	}
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+
+	var subID string
+	json.Unmarshal(resp.Result, &subID)
+	if !strings.HasPrefix(subID, "0x") {
+		t.Errorf("Expected subscription ID starting with 0x, got %s", subID)
+	}
+
+	// Simulate syncing broadcast (node in sync)
+	syncStatus := &rpc.SyncStatus{
+		Syncing:      false,
+		CurrentBlock: "0x14c3a5f",
+	}
+	bc.BroadcastSyncing(syncStatus)
+
+	// Read notification
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification map[string]interface{}
+	json.Unmarshal(message, &notification)
+
+	if notification["method"] != "eth_subscription" {
+		t.Errorf("Expected method eth_subscription, got %v", notification["method"])
+	}
+
+	t.Logf("Received syncing notification")
+}
+
+// TestWebSocketSyncingSnapshot tests that a new syncing subscriber gets the current status right away
+func TestWebSocketSyncingSnapshot(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	// Status known before anyone subscribes
+	bc.BroadcastSyncing(&rpc.SyncStatus{Syncing: true})
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"syncing"},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	var subID string
+	json.Unmarshal(resp.Result, &subID)
+
+	// Snapshot arrives without any further broadcast
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read snapshot notification: %v", err)
+	}
+
+	var notification subscription.SubscriptionNotification
+	json.Unmarshal(message, &notification)
+	if notification.Params.Subscription != subID {
+		t.Errorf("Expected subscription %s, got %s", subID, notification.Params.Subscription)
+	}
+	if string(notification.Params.Result) != "true" {
+		t.Errorf("Expected syncing true, got %s", notification.Params.Result)
+	}
+}
+
+// TestWebSocketSyncingSnapshotChecked tests that a new syncing subscriber gets
+// a freshly checked status rather than the last one broadcast
+func TestWebSocketSyncingSnapshotChecked(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	bc := newTestBroadcaster(t)
+	bc.BroadcastSyncing(&rpc.SyncStatus{Syncing: true})
+
+	wsHandler := NewWebSocketHandler(rpc.NewClient(mockServer.URL), bc)
+	var checks atomic.Int32
+	wsHandler.SetSyncCheck(func(ctx context.Context) *rpc.SyncStatus {
+		checks.Add(1)
+		return &rpc.SyncStatus{Syncing: false, CurrentBlock: "0x10"}
+	})
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"syncing"},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read snapshot notification: %v", err)
+	}
+
+	var notification subscription.SubscriptionNotification
+	json.Unmarshal(message, &notification)
+	if string(notification.Params.Result) != "false" {
+		t.Errorf("Expected the checked status (false), got %s", notification.Params.Result)
+	}
+	if checks.Load() != 1 {
+		t.Errorf("Expected one sync check at subscribe, got %d", checks.Load())
+	}
+}
+
+// TestWebSocketNewHeadsSnapshot tests that a new newHeads subscription receives the latest head right away
+func TestWebSocketNewHeadsSnapshot(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	// Head known before anyone subscribes
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x10", Hash: "0xabc"})
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"newHeads"},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	var subID string
+	json.Unmarshal(resp.Result, &subID)
+
+	// Latest head arrives without any further broadcast
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read latest head: %v", err)
+	}
+
+	var notification subscription.SubscriptionNotification
+	json.Unmarshal(message, &notification)
+	if notification.Params.Subscription != subID {
+		t.Errorf("Expected subscription %s, got %s", subID, notification.Params.Subscription)
+	}
+	var header rpc.FullBlockHeader
+	json.Unmarshal(notification.Params.Result, &header)
+	if header.Number != "0x10" || header.Hash != "0xabc" {
+		t.Errorf("Expected latest head 0x10/0xabc, got %s/%s", header.Number, header.Hash)
+	}
+
+	// A delayed subscription has no confirmed block yet, so nothing is sent
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"newHeads", map[string]interface{}{"confirmations": 2}},
+		"id":      2,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage()
+
+	conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	if _, message, err = conn.ReadMessage(); err == nil {
+		t.Errorf("Expected no notification for delayed subscription, got %s", message)
+	}
+}
+
+// TestWebSocketSystemTxsSubscription tests the hl_systemTxs stream
+func TestWebSocketSystemTxsSubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"hl_systemTxs"},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	systemTxs := rpc.ClassifyTransactions([]rpc.Transaction{
+		{Hash: "0xuser", From: "0x1234567890123456789012345678901234567890"},
+		{Hash: "0xdeposit", From: rpc.HypeSystemAddress, To: "0xrecipient", Value: "0xde0b6b3a7640000"},
+	})
+	bc.BroadcastSystemTxs(systemTxs)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification map[string]interface{}
+	json.Unmarshal(message, &notification)
+	params := notification["params"].(map[string]interface{})
+	result := params["result"].(map[string]interface{})
+
+	if result["kind"] != rpc.SystemTxHypeDeposit || result["hash"] != "0xdeposit" || result["to"] != "0xrecipient" {
+		t.Errorf("Unexpected system tx notification: %v", result)
+	}
+}
+
+// TestWebSocketTokenTransfersSubscription tests decoded transfers with a token filter
+func TestWebSocketTokenTransfersSubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"tokenTransfers", map[string]interface{}{"token": "0xUSDC"}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	from := "0x000000000000000000000000" + strings.Repeat("a", 40)
+	to := "0x000000000000000000000000" + strings.Repeat("b", 40)
+	amount := "0x" + strings.Repeat("0", 60) + "03e8"
+	bc.BroadcastTokenTransfers([]rpc.Log{
+		{Address: "0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925", Topics: []string{rpc.TransferEventTopic, from, to}, Data: amount, LogIndex: "0x0"},
+		{Address: "0xusdc", Topics: []string{rpc.TransferEventTopic, from, to}, Data: amount, LogIndex: "0x1"},
+	})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification struct {
+		Params struct {
+			Result rpc.TokenTransfer `json:"result"`
+		} `json:"params"`
+	}
+	json.Unmarshal(message, &notification)
+
+	transfer := notification.Params.Result
+	if transfer.Token != "0xusdc" || transfer.Standard != rpc.TokenStandardERC20 || transfer.Amount != "0x3e8" || transfer.LogIndex != "0x1" {
+		t.Errorf("Unexpected token transfer notification: %s", message)
+	}
+}
+
+// TestWebSocketReorgSubscription tests reorg notifications
+func TestWebSocketReorgSubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"reorg"},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	bc.BroadcastReorg(&rpc.Reorg{
+		Depth:          "0x1",
+		ReplacedBlocks: []rpc.BlockRef{{Number: "0x99", Hash: "0xold"}},
+		CommonAncestor: &rpc.BlockRef{Number: "0x98", Hash: "0xancestor"},
+		NewHead:        rpc.BlockRef{Number: "0x9a", Hash: "0xnew"},
+	})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification struct {
+		Params struct {
+			Result rpc.Reorg `json:"result"`
+		} `json:"params"`
+	}
+	json.Unmarshal(message, &notification)
+
+	reorg := notification.Params.Result
+	if reorg.Depth != "0x1" || len(reorg.ReplacedBlocks) != 1 || reorg.ReplacedBlocks[0].Hash != "0xold" || reorg.NewHead.Hash != "0xnew" {
+		t.Errorf("Unexpected reorg notification: %s", message)
+	}
+}
+
+// TestWebSocketEventNames tests hl_decodeTopic and the eventName logs option
+func TestWebSocketEventNames(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	transferTopic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "hl_decodeTopic",
+		"params":  []string{transferTopic},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	var decoded rpc.DecodedTopic
+	json.Unmarshal(resp.Result, &decoded)
+	if decoded.Name != "Transfer" || decoded.Signature != "Transfer(address,address,uint256)" {
+		t.Errorf("Unexpected decoded topic: %s", message)
+	}
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params": []interface{}{
+			"logs",
+			map[string]interface{}{"eventName": true},
+		},
+		"id": 2,
+	})
+	conn.ReadMessage() // Read subscription response
+
+	bc.BroadcastLog(&rpc.Log{
+		Address:  "0x1234567890abcdef",
+		Topics:   []string{transferTopic},
+		LogIndex: "0x0",
+	})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification map[string]interface{}
+	json.Unmarshal(message, &notification)
+	params := notification["params"].(map[string]interface{})
+	result := params["result"].(map[string]interface{})
+	if result["eventName"] != "Transfer" {
+		t.Errorf("Expected eventName Transfer, got %v", result["eventName"])
+	}
+}
+
+// TestWebSocketLogsSubscriptionMultipleFilters tests OR'd filter objects
+func TestWebSocketLogsSubscriptionMultipleFilters(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params": []interface{}{
+			"logs",
+			[]interface{}{
+				map[string]interface{}{"address": "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+				map[string]interface{}{"topics": []string{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}},
+			},
+		},
+		"id": 1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	if resp.Error != nil {
+		t.Fatalf("Subscribe failed: %v", resp.Error)
+	}
+
+	// Matches both filters but is delivered once, then one matching only the second
+	bc.BroadcastLog(&rpc.Log{Address: "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Topics: []string{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}, LogIndex: "0x0"})
+	bc.BroadcastLog(&rpc.Log{Address: "0xcccccccccccccccccccccccccccccccccccccccc", Topics: []string{"0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925"}, LogIndex: "0x1"})
+	bc.BroadcastLog(&rpc.Log{Address: "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Topics: []string{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}, LogIndex: "0x2"})
+
+	for _, expected := range []string{"0x0", "0x2"} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read notification: %v", err)
+		}
+
+		var notification struct {
+			Params struct {
+				Result rpc.Log `json:"result"`
+			} `json:"params"`
+		}
+		json.Unmarshal(message, &notification)
+		if notification.Params.Result.LogIndex != expected {
+			t.Errorf("Expected log %s, got %s", expected, message)
+		}
+	}
+}
+
+// TestWebSocketLogsSubscriptionWithTopics tests logs subscription with topic filters
+func TestWebSocketLogsSubscriptionWithTopics(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Subscribe to logs with topic filter (Transfer events)
+	transferTopic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params": []interface{}{
+			"logs",
+			map[string]interface{}{
+				"address": "0xdAC17F958D2ee523a2206206994597C13D831ec7",
+				"topics":  []string{transferTopic},
+			},
+		},
+		"id": 1,
+	}
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+
+	var subID string
+	json.Unmarshal(resp.Result, &subID)
+	if !strings.HasPrefix(subID, "0x") {
+		t.Errorf("Expected subscription ID starting with 0x, got %s", subID)
+	}
+
+	// Simulate log broadcast with matching topic
+	logEntry := &rpc.Log{
+		Address:         "0xdAC17F958D2ee523a2206206994597C13D831ec7",
+		Topics:          []string{transferTopic, "0x0000000000000000000000001234567890abcdef"},
+		Data:            "0x1234",
+		BlockNumber:     "0x14c3a5f",
+		TransactionHash: "0xtx1",
+		LogIndex:        "0x0",
+	}
+	bc.BroadcastLog(logEntry)
+
+	// Read notification
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification map[string]interface{}
+	json.Unmarshal(message, &notification)
+
+	if notification["method"] != "eth_subscription" {
+		t.Errorf("Expected method eth_subscription, got %v", notification["method"])
+	}
+
+	params := notification["params"].(map[string]interface{})
+	result := params["result"].(map[string]interface{})
+
+	if result["address"] != "0xdAC17F958D2ee523a2206206994597C13D831ec7" {
+		t.Errorf("Expected address 0xdAC17F958D2ee523a2206206994597C13D831ec7, got %v", result["address"])
+	}
+
+	t.Logf("Received logs notification with topics for block: %v", result["blockNumber"])
+}
+
+// TestWebSocketLogsSubscriptionMultipleAddresses tests logs subscription with multiple addresses
+func TestWebSocketLogsSubscriptionMultipleAddresses(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Subscribe to logs with multiple addresses
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params": []interface{}{
+			"logs",
+			map[string]interface{}{
+				"address": []string{
+					"0xf24090f1895cee4033103e670cc58edc28294841",
+					"0xdAC17F958D2ee523a2206206994597C13D831ec7",
+				},
+			},
+		},
+		"id": 1,
+	}
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+
+	var subID string
+	json.Unmarshal(resp.Result, &subID)
+	if !strings.HasPrefix(subID, "0x") {
+		t.Errorf("Expected subscription ID starting with 0x, got %s", subID)
+	}
+
+	// Simulate log broadcast from first address
+	logEntry := &rpc.Log{
+		Address:         "0xf24090f1895cee4033103e670cc58edc28294841",
+		Topics:          []string{"0xtopic1"},
+		Data:            "0x1234",
+		BlockNumber:     "0x14c3a5f",
+		TransactionHash: "0xtx1",
+		LogIndex:        "0x0",
+	}
+	bc.BroadcastLog(logEntry)
+
+	// Read notification
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification map[string]interface{}
+	json.Unmarshal(message, &notification)
+
+	if notification["method"] != "eth_subscription" {
+		t.Errorf("Expected method eth_subscription, got %v", notification["method"])
+	}
+
+	t.Logf("Received logs notification for multiple addresses filter")
+}
+
+// TestWebSocketInvalidSubscriptionType tests error handling for unsupported subscription types
+func TestWebSocketInvalidSubscriptionType(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Subscribe with invalid subscription type
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"invalidSubscriptionType"},
+		"id":      1,
+	}
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+
+	if resp.Error == nil {
+		t.Error("Expected error for invalid subscription type")
+	} else if resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Errorf("Expected error code %d, got %d", rpc.ErrCodeInvalidParams, resp.Error.Code)
+	}
+
+	t.Logf("Got expected error for invalid subscription type: %s", resp.Error.Message)
+}
+
+// TestWebSocketInvalidLogsFilter tests that a malformed logs filter is rejected naming the field
+func TestWebSocketInvalidLogsFilter(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"logs", map[string]interface{}{"address": []string{"0x1234"}}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var resp rpc.Response
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Fatalf("Expected invalid params error, got %+v", resp)
+	}
+	if !strings.Contains(resp.Error.Message, "address[0]") {
+		t.Errorf("Expected error to name the address field, got %q", resp.Error.Message)
+	}
+	if len(bc.SubscriptionManager().CountByType()) != 0 {
+		t.Errorf("Expected no subscription to be created")
+	}
+}
+
+// TestWebSocketLogNotMatchingFilter tests that logs not matching filter are not sent
+func TestWebSocketLogNotMatchingFilter(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Subscribe to logs with specific address filter
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params": []interface{}{
+			"logs",
+			map[string]interface{}{
+				"address": "0x1111111111111111111111111111111111111111",
+			},
+		},
+		"id": 1,
+	}
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	// Simulate log broadcast from DIFFERENT address (should NOT match)
+	logEntry := &rpc.Log{
+		Address:         "0x2222222222222222222222222222222222222222",
+		Topics:          []string{"0xtopic1"},
+		Data:            "0x1234",
+		BlockNumber:     "0x14c3a5f",
+		TransactionHash: "0xtx1",
+		LogIndex:        "0x0",
+	}
+	bc.BroadcastLog(logEntry)
+
+	// Should timeout since the log doesn't match the filter
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	_, _, err = conn.ReadMessage()
+	if err == nil {
+		t.Error("Expected timeout (no notification), but received a message")
+	}
+
+	t.Log("Correctly no notification received for non-matching log")
+}
+
+// TestWebSocketPendingTransactionsUnsupported tests that newPendingTransactions is rejected explicitly,
+// including the full-transaction flag and address filter variants
+func TestWebSocketPendingTransactionsUnsupported(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Both the full-transaction flag and the address filter object are rejected
+	variants := []interface{}{
+		true,
+		map[string]interface{}{
+			"to":   []string{"0x1111111111111111111111111111111111111111"},
+			"from": []string{"0x2222222222222222222222222222222222222222"},
+		},
+	}
+
+	for i, param := range variants {
+		request := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "eth_subscribe",
+			"params":  []interface{}{"newPendingTransactions", param},
+			"id":      i + 1,
+		}
+		conn.WriteJSON(request)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, message, _ := conn.ReadMessage()
+
+		var resp rpc.Response
+		json.Unmarshal(message, &resp)
+
+		if resp.Error == nil {
+			t.Fatalf("Expected error for newPendingTransactions with %v", param)
+		}
+		if !strings.Contains(resp.Error.Message, "mempool") {
+			t.Errorf("Expected mempool explanation in error, got %q", resp.Error.Message)
+		}
+	}
+}
+
+// TestWebSocketProxyMetricsSubscription tests that proxyMetrics is admin-gated
+func TestWebSocketProxyMetricsSubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	wsHandler.SetAdminToken("secret")
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"proxyMetrics"},
+		"id":      1,
+	}
+
+	// Without credentials the subscription is rejected
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeUnauthorized {
+		t.Fatalf("Expected unauthorized error, got %s", message)
+	}
+
+	// With the admin token the subscription succeeds and receives snapshots
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret")
+	adminConn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer adminConn.Close()
+
+	adminConn.WriteJSON(request)
+	adminConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ = adminConn.ReadMessage()
+
+	resp = rpc.Response{}
+	json.Unmarshal(message, &resp)
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error for admin subscription: %s", resp.Error.Message)
+	}
+
+	bc.BroadcastProxyMetrics(bc.GetMetricsSnapshot())
+
+	adminConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = adminConn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification map[string]interface{}
+	json.Unmarshal(message, &notification)
+
+	params := notification["params"].(map[string]interface{})
+	result := params["result"].(map[string]interface{})
+
+	if result["activeConnections"] != float64(2) {
+		t.Errorf("Expected 2 active connections, got %v", result["activeConnections"])
+	}
+	subs := result["subscriptions"].(map[string]interface{})
+	if subs["proxyMetrics"] != float64(1) {
+		t.Errorf("Expected 1 proxyMetrics subscription, got %v", subs["proxyMetrics"])
+	}
+}
+
+// TestWebSocketTestSubscription tests the synthetic counter subscription
+func TestWebSocketTestSubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"test"},
+		"id":      1,
+	}
+
+	// Disabled by default
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Fatalf("Expected the test subscription to be rejected, got %s", message)
+	}
+
+	wsHandler.SetTestSubscription(true)
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	bc.BroadcastTestTick()
+	bc.BroadcastTestTick()
+
+	var counters []float64
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read notification: %v", err)
+		}
+
+		var notification map[string]interface{}
+		json.Unmarshal(message, &notification)
+		params := notification["params"].(map[string]interface{})
+		result := params["result"].(map[string]interface{})
+		counters = append(counters, result["counter"].(float64))
+	}
+
+	if counters[1] != counters[0]+1 {
+		t.Errorf("Expected consecutive counters, got %v", counters)
+	}
+}
+
+// TestWebSocketLogsBackfill tests that fromBlock replays historical logs before live ones
+func TestWebSocketLogsBackfill(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	wsHandler.SetBackfillLimit(100)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Too far back (head is 0x123456) is rejected
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params": []interface{}{
+			"logs",
+			map[string]interface{}{"fromBlock": "0x1"},
+		},
+		"id": 1,
+	}
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Fatalf("Expected invalid params error, got %s", message)
+	}
+
+	request["params"] = []interface{}{
+		"logs",
+		map[string]interface{}{
+			"address":   "0x1111111111111111111111111111111111111111",
+			"fromBlock": "0x123450",
+		},
+	}
+	request["id"] = 2
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ = conn.ReadMessage()
+
+	resp = rpc.Response{}
+	json.Unmarshal(message, &resp)
+	if resp.Error != nil {
+		t.Fatalf("Unexpected error: %s", resp.Error.Message)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read backfill notification: %v", err)
+	}
+
+	var notification map[string]interface{}
+	json.Unmarshal(message, &notification)
+	params := notification["params"].(map[string]interface{})
+	result := params["result"].(map[string]interface{})
+
+	if result["transactionHash"] != "0xhistorical" {
+		t.Errorf("Expected historical log first, got %v", result["transactionHash"])
+	}
+
+	// Live delivery continues after the backfill
+	bc.BroadcastLog(&rpc.Log{
+		Address:         "0x1111111111111111111111111111111111111111",
+		BlockNumber:     "0x123457",
+		TransactionHash: "0xlive",
+		LogIndex:        "0x0",
+	})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read live notification: %v", err)
+	}
+	json.Unmarshal(message, &notification)
+	params = notification["params"].(map[string]interface{})
+	result = params["result"].(map[string]interface{})
+
+	if result["transactionHash"] != "0xlive" {
+		t.Errorf("Expected live log, got %v", result["transactionHash"])
+	}
+}
+
+// TestWebSocketLogsBackfillHeld tests that logs broadcast while a backfill is
+// in flight are delivered once, whether or not the backfill covered them
+func TestWebSocketLogsBackfillHeld(t *testing.T) {
+	bc := newTestBroadcaster(t)
+	historical := rpc.Log{
+		Address:         "0x1111111111111111111111111111111111111111",
+		BlockNumber:     "0x123456",
+		TransactionHash: "0xhistorical",
+		LogIndex:        "0x0",
+	}
+	live := historical
+	live.BlockNumber = "0x123457"
+	live.TransactionHash = "0xlive"
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpc.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := rpc.Response{JSONRPC: "2.0", ID: req.ID}
+		switch req.Method {
+		case "eth_blockNumber":
+			resp.Result, _ = json.Marshal("0x123456")
+		case "eth_getLogs":
+			// The head block and the next one are published mid-backfill
+			bc.BroadcastLog(&historical)
+			bc.BroadcastLog(&live)
+			resp.Result, _ = json.Marshal([]rpc.Log{historical})
+		default:
+			resp.Result, _ = json.Marshal("ok")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer mockServer.Close()
+
+	wsHandler := NewWebSocketHandler(rpc.NewClient(mockServer.URL), bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"logs", map[string]interface{}{"address": historical.Address, "fromBlock": "0x123450"}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	for _, want := range []string{"0xhistorical", "0xlive"} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read notification for %s: %v", want, err)
+		}
+		var notification struct {
+			Params struct {
+				Result rpc.Log `json:"result"`
+			} `json:"params"`
+		}
+		json.Unmarshal(message, &notification)
+		if got := notification.Params.Result.TransactionHash; got != want {
+			t.Fatalf("Expected %s, got %s", want, got)
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, message, err := conn.ReadMessage(); err == nil {
+		t.Errorf("Expected each log delivered once, got an extra %s", message)
+	}
+}
+
+// TestWebSocketLogsBackfillWatchlist tests that watchlist addresses are backfilled from the local store
+func TestWebSocketLogsBackfillWatchlist(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	watched := "0x1111111111111111111111111111111111111111"
+	watchlist := cache.NewLogStore([]string{watched}, 100)
+	watchlist.AddBlock(0x10, []rpc.Log{{Address: watched, BlockNumber: "0x10", TransactionHash: "0xwatched", LogIndex: "0x0"}})
+	watchlist.AddBlock(0x11, nil)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	wsHandler.SetWatchlist(watchlist)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"logs", map[string]interface{}{"address": watched, "fromBlock": "0x10"}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read backfill notification: %v", err)
+	}
+
+	var notification map[string]interface{}
+	json.Unmarshal(message, &notification)
+	params := notification["params"].(map[string]interface{})
+	result := params["result"].(map[string]interface{})
+
+	// The mock upstream would have returned 0xhistorical
+	if result["transactionHash"] != "0xwatched" {
+		t.Errorf("Expected log from the watchlist store, got %v", result["transactionHash"])
+	}
+}
+
+// TestWebSocketUpstreamUnavailable tests that requests fail fast with the root cause in degraded mode
+func TestWebSocketUpstreamUnavailable(t *testing.T) {
+	rpcClient := rpc.NewClient("")
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_chainId",
+		"params":  []interface{}{},
+		"id":      1,
+	}
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeUpstreamUnavailable {
+		t.Fatalf("Expected upstream unavailable error, got %s", message)
+	}
+	if !strings.Contains(resp.Error.Message, "RPC_URL is not set") {
+		t.Errorf("Expected root cause in error message, got %q", resp.Error.Message)
+	}
+	if !strings.Contains(string(message), `"data":{"reason":"upstream_unavailable","retryable":true,"retryAfter":1000}`) {
+		t.Errorf("Expected a retry hint in the error data, got %s", message)
+	}
+
+	// Requests during shutdown are told to reconnect
+	wsHandler.SetDraining(true)
+	conn.WriteJSON(request)
+	_, message, _ = conn.ReadMessage()
+	resp = rpc.Response{}
+	json.Unmarshal(message, &resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeDraining || !strings.Contains(string(message), `"reason":"draining"`) {
+		t.Errorf("Expected a draining error, got %s", message)
+	}
+}
+
+// TestWebSocketUpstreamRateLimit tests that calls refused by the upstream rate limit get a rate_limited error
+func TestWebSocketUpstreamRateLimit(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	rpcClient.SetRateLimit(1, 1, 0)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var message []byte
+	for i := 1; i <= 2; i++ {
+		conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "method": "eth_chainId", "params": []interface{}{}, "id": i})
+		_, message, _ = conn.ReadMessage()
+	}
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeQuotaExceeded || !strings.Contains(string(message), `"reason":"rate_limited","retryable":true,"retryAfter":`) {
+		t.Errorf("Expected a rate limited error with a retry hint, got %s", message)
+	}
+}
+
+// TestWebSocketConfirmationsDelay tests that newHeads and logs honour a confirmation delay
+func TestWebSocketConfirmationsDelay(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Out-of-range confirmations are rejected
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"newHeads", map[string]interface{}{"confirmations": 1000}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Fatalf("Expected invalid params error, got %s", message)
+	}
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"newHeads", map[string]interface{}{"confirmations": 2}},
+		"id":      2,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params": []interface{}{"logs", map[string]interface{}{
+			"address":       "0x1111111111111111111111111111111111111111",
+			"confirmations": 2,
+		}},
+		"id": 3,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x10", Hash: "0xh10"})
+	bc.BroadcastLog(&rpc.Log{
+		Address:         "0x1111111111111111111111111111111111111111",
+		BlockNumber:     "0x10",
+		TransactionHash: "0xtx10",
+	})
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x11", Hash: "0xh11"})
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x12", Hash: "0xh12"})
+
+	var got []string
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read notification: %v", err)
+		}
+		var notification map[string]interface{}
+		json.Unmarshal(message, &notification)
+		params := notification["params"].(map[string]interface{})
+		result := params["result"].(map[string]interface{})
+		if hash, ok := result["hash"]; ok {
+			got = append(got, hash.(string))
+		} else {
+			got = append(got, result["transactionHash"].(string))
+		}
+	}
+
+	if got[0] != "0xh10" || got[1] != "0xtx10" {
+		t.Errorf("Expected confirmed block 0x10 header then log, got %v", got)
+	}
+
+	// Blocks 0x11 and 0x12 are not confirmed yet
+	conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	if _, message, err := conn.ReadMessage(); err == nil {
+		t.Errorf("Expected no further notification, got %s", message)
+	}
+}
+
+// TestWebSocketGasPriceMinChangePercent tests gasPrice threshold filtering
+func TestWebSocketGasPriceMinChangePercent(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"gasPrice", map[string]interface{}{"minChangePercent": 5}},
+		"id":      1,
+	}
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	// 100 -> 103 (3%, suppressed) -> 110 (10% from last sent, delivered)
+	for _, price := range []string{"0x64", "0x67", "0x6e"} {
+		bc.BroadcastGasPrice(&rpc.GasPriceInfo{GasPrice: price, BlockNumber: "0x1"})
+	}
+
+	var prices []string
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read notification: %v", err)
+		}
+		var notification map[string]interface{}
+		json.Unmarshal(message, &notification)
+		params := notification["params"].(map[string]interface{})
+		result := params["result"].(map[string]interface{})
+		prices = append(prices, result["gasPrice"].(string))
+	}
+
+	if prices[0] != "0x64" || prices[1] != "0x6e" {
+		t.Errorf("Expected prices [0x64 0x6e], got %v", prices)
+	}
+}
+
+// TestWebSocketGasPriceSnapshot tests that a new gasPrice subscription receives the latest prices right away
+func TestWebSocketGasPriceSnapshot(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	// Prices polled before anyone subscribes
+	gasPrices := cache.NewGasPriceCache(0)
+	gasPrices.SetSmall("0x64", "0x1")
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	wsHandler.SetGasPrices(gasPrices)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"gasPrice", map[string]interface{}{"minChangePercent": 5}},
+		"id":      1,
+	}
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	// Snapshot arrives without any further broadcast
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read snapshot notification: %v", err)
+	}
+	var notification subscription.SubscriptionNotification
+	json.Unmarshal(message, &notification)
+	var info rpc.GasPriceInfo
+	json.Unmarshal(notification.Params.Result, &info)
+	if info.GasPrice != "0x64" || info.BlockNumber != "0x1" {
+		t.Errorf("Expected snapshot price 0x64 at 0x1, got %s at %s", info.GasPrice, info.BlockNumber)
+	}
+
+	// The snapshot is the threshold baseline: 100 -> 103 (3%) is suppressed
+	bc.BroadcastGasPrice(&rpc.GasPriceInfo{GasPrice: "0x67", BlockNumber: "0x2", BlockType: rpc.BlockTypeSmall})
+	bc.BroadcastGasPrice(&rpc.GasPriceInfo{GasPrice: "0x6e", BlockNumber: "0x3", BlockType: rpc.BlockTypeSmall})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	json.Unmarshal(message, &notification)
+	json.Unmarshal(notification.Params.Result, &info)
+	if info.GasPrice != "0x6e" {
+		t.Errorf("Expected price 0x6e after suppressed change, got %s", info.GasPrice)
+	}
+}
+
+// TestWebSocketRequestTimeout tests that the client's request budget bounds upstream calls
+func TestWebSocketRequestTimeout(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	header := http.Header{}
+	header.Set("X-Request-Timeout", "100ms")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "test_slow",
+		"params":  []interface{}{},
+		"id":      1,
+	}
+	conn.WriteJSON(request)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeTimeout {
+		t.Fatalf("Expected timeout error, got %s", message)
+	}
+}
+
+// TestWebSocketSlowRequests tests that slow forwarded requests are counted per client
+func TestWebSocketSlowRequests(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	wsHandler.SetSlowRequestThreshold(200 * time.Millisecond)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	slow, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer slow.Close()
+	fast, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer fast.Close()
+
+	call := func(conn *websocket.Conn, method string) {
+		t.Helper()
+		conn.WriteJSON(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  method,
+			"params":  []interface{}{},
+			"id":      1,
+		})
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, _, err := conn.ReadMessage(); err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+	}
+	call(slow, "test_slow")
+	call(fast, "eth_blockNumber")
+
+	counts := map[int64]int{}
+	clients := bc.GetAllClientsInfo()
+	for _, info := range clients {
+		counts[info.SlowRequests]++
+	}
+	if len(clients) != 2 || counts[0] != 1 || counts[1] != 1 {
+		t.Errorf("Expected one slow request on one of two clients, got %+v", clients)
+	}
+}
+
+func TestWebSocketTxConfirmation(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// A hash is required
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"txConfirmation", map[string]interface{}{"hash": "0x1234"}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Fatalf("Expected invalid params error, got %s", message)
+	}
+
+	txHash := "0x" + strings.Repeat("ab", 32)
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"txConfirmation", map[string]interface{}{"hash": txHash, "confirmations": 2}},
+		"id":      2,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	bc.BroadcastTxConfirmations(&rpc.BlockReceipts{BlockNumber: "0x10", BlockHash: "0xh10"})
+	bc.BroadcastTxConfirmations(&rpc.BlockReceipts{
+		BlockNumber: "0x11",
+		BlockHash:   "0xh11",
+		Receipts: []rpc.TransactionReceipt{
+			{TransactionHash: txHash, BlockNumber: "0x11", BlockHash: "0xh11", Status: "0x1"},
+		},
+	})
+	bc.BroadcastTxConfirmations(&rpc.BlockReceipts{BlockNumber: "0x12", BlockHash: "0xh12"})
+	bc.BroadcastTxConfirmations(&rpc.BlockReceipts{BlockNumber: "0x13", BlockHash: "0xh13"})
+
+	var got []string
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read notification: %v", err)
+		}
+		var notification map[string]interface{}
+		json.Unmarshal(message, &notification)
+		params := notification["params"].(map[string]interface{})
+		result := params["result"].(map[string]interface{})
+		if result["blockNumber"] != "0x11" {
+			t.Errorf("Expected blockNumber 0x11, got %v", result["blockNumber"])
+		}
+		got = append(got, result["confirmations"].(string))
+	}
+
+	if got[0] != "0x0" || got[1] != "0x2" {
+		t.Errorf("Expected mined then 2 confirmations, got %v", got)
+	}
+
+	// The subscription ends after the final notification
+	if subs := bc.SubscriptionManager().GetSubscriptionsByType(subscription.SubTypeTxConfirmation); len(subs) != 0 {
+		t.Errorf("Expected txConfirmation subscription to be removed, got %d", len(subs))
+	}
+}
+
+// receiptServer serves eth_getTransactionReceipt with the receipt returned
+// by receipt, null while it returns nil
+func receiptServer(receipt func() *rpc.TransactionReceipt) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rpc.Request
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := rpc.Response{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage("null")}
+		if req.Method == "eth_getTransactionReceipt" {
+			if found := receipt(); found != nil {
+				resp.Result, _ = json.Marshal(found)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+// readTxConfirmations reads n txConfirmation notifications and returns their confirmations
+func readTxConfirmations(t *testing.T, conn *websocket.Conn, n int) []string {
+	t.Helper()
+	var got []string
+	for i := 0; i < n; i++ {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read notification: %v", err)
+		}
+		var notification map[string]interface{}
+		json.Unmarshal(message, &notification)
+		params := notification["params"].(map[string]interface{})
+		result := params["result"].(map[string]interface{})
+		if result["blockNumber"] != "0x11" {
+			t.Errorf("Expected blockNumber 0x11, got %v", result["blockNumber"])
+		}
+		got = append(got, result["confirmations"].(string))
+	}
+	return got
+}
+
+// TestWebSocketTxConfirmationAlreadyMined tests that a transaction mined
+// before subscribing is looked up and reported at subscribe
+func TestWebSocketTxConfirmationAlreadyMined(t *testing.T) {
+	txHash := "0x" + strings.Repeat("ab", 32)
+	mockServer := receiptServer(func() *rpc.TransactionReceipt {
+		return &rpc.TransactionReceipt{TransactionHash: txHash, BlockNumber: "0x11", BlockHash: "0xh11", Status: "0x1"}
+	})
+	defer mockServer.Close()
+
+	bc := newTestBroadcaster(t)
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x13", Hash: "0xh13"})
+
+	wsHandler := NewWebSocketHandler(rpc.NewClient(mockServer.URL), bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"txConfirmation", map[string]interface{}{"hash": txHash, "confirmations": 2}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	// Mined at 0x11 with the head at 0x13: both notifications are sent at once
+	if got := readTxConfirmations(t, conn, 2); got[0] != "0x0" || got[1] != "0x2" {
+		t.Errorf("Expected mined then 2 confirmations, got %v", got)
+	}
+	if subs := bc.SubscriptionManager().GetSubscriptionsByType(subscription.SubTypeTxConfirmation); len(subs) != 0 {
+		t.Errorf("Expected txConfirmation subscription to be removed, got %d", len(subs))
+	}
+}
+
+// TestWebSocketTxConfirmationReceiptsFailed tests that a transaction mined in
+// a block whose receipts couldn't be fetched is found by a recheck
+func TestWebSocketTxConfirmationReceiptsFailed(t *testing.T) {
+	txHash := "0x" + strings.Repeat("cd", 32)
+	var mined atomic.Bool
+	mockServer := receiptServer(func() *rpc.TransactionReceipt {
+		if !mined.Load() {
+			return nil
+		}
+		return &rpc.TransactionReceipt{TransactionHash: txHash, BlockNumber: "0x11", BlockHash: "0xh11", Status: "0x1"}
+	})
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"txConfirmation", map[string]interface{}{"hash": txHash, "confirmations": 2}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	// Not mined at subscribe; block 0x11 then mines it but its receipts fetch fails
+	mined.Store(true)
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x11", Hash: "0xh11"})
+	bc.RecheckTxConfirmations(context.Background(), rpcClient.GetTransactionReceipt)
+	if got := readTxConfirmations(t, conn, 1); got[0] != "0x0" {
+		t.Errorf("Expected the mined notification, got %v", got)
+	}
+
+	// A recheck after the transaction is known to be mined doesn't report it again
+	bc.RecheckTxConfirmations(context.Background(), rpcClient.GetTransactionReceipt)
+	bc.BroadcastTxConfirmations(&rpc.BlockReceipts{BlockNumber: "0x12", BlockHash: "0xh12"})
+	bc.BroadcastTxConfirmations(&rpc.BlockReceipts{BlockNumber: "0x13", BlockHash: "0xh13"})
+	if got := readTxConfirmations(t, conn, 1); got[0] != "0x2" {
+		t.Errorf("Expected 2 confirmations, got %v", got)
+	}
+}
+
+func TestWebSocketSubscriptionLabel(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Overlong labels are rejected
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"newHeads", map[string]interface{}{"label": strings.Repeat("x", subscription.MaxLabelLength+1)}},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Fatalf("Expected invalid params error, got %s", message)
+	}
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"newHeads", map[string]interface{}{"label": "blocks"}},
+		"id":      2,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // Read subscription response
+
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x999", Hash: "0xtest"})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification subscription.SubscriptionNotification
+	json.Unmarshal(message, &notification)
+	if notification.Params.Label != "blocks" {
+		t.Errorf("Expected label blocks, got %q", notification.Params.Label)
+	}
+}
+
+// TestWebSocketSubscribeBatch tests creating several subscriptions in one request
+func TestWebSocketSubscribeBatch(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// A batch with an invalid spec creates nothing
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "hl_subscribeBatch",
+		"params": []interface{}{
+			[]interface{}{"newHeads"},
+			[]interface{}{"invalidSubscriptionType"},
+		},
+		"id": 1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	if resp.Error == nil {
+		t.Fatal("Expected error for batch with an invalid subscription type")
+	}
+	if !strings.HasPrefix(resp.Error.Message, "subscription 1: ") {
+		t.Errorf("Expected error for subscription 1, got %q", resp.Error.Message)
+	}
+	if counts := bc.SubscriptionManager().CountByType(); counts[subscription.SubTypeNewHeads] != 0 {
+		t.Errorf("Expected no newHeads subscription after failed batch, got %d", counts[subscription.SubTypeNewHeads])
+	}
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "hl_subscribeBatch",
+		"params": []interface{}{
+			[]interface{}{"newHeads"},
+			[]interface{}{"logs", map[string]interface{}{"address": "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}},
+		},
+		"id": 2,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ = conn.ReadMessage()
+
+	var batchResp struct {
+		Result []string   `json:"result"`
+		Error  *rpc.Error `json:"error"`
+	}
+	json.Unmarshal(message, &batchResp)
+	if batchResp.Error != nil {
+		t.Fatalf("Batch subscribe failed: %v", batchResp.Error)
+	}
+	if len(batchResp.Result) != 2 {
+		t.Fatalf("Expected 2 subscription IDs, got %v", batchResp.Result)
+	}
+
+	bc.BroadcastLog(&rpc.Log{Address: "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", LogIndex: "0x0"})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+
+	var notification struct {
+		Params struct {
+			Subscription string `json:"subscription"`
+		} `json:"params"`
+	}
+	json.Unmarshal(message, &notification)
+	if notification.Params.Subscription != batchResp.Result[1] {
+		t.Errorf("Expected notification for %s, got %s", batchResp.Result[1], message)
+	}
+}
+
+// TestWebSocketExportImportSubscriptions tests moving a subscription set to a new connection
+func TestWebSocketExportImportSubscriptions(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "hl_subscribeBatch",
+		"params": []interface{}{
+			[]interface{}{"newHeads"},
+			[]interface{}{"logs", map[string]interface{}{"address": "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}},
+		},
+		"id": 1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "hl_exportSubscriptions",
+		"params":  []interface{}{},
+		"id":      2,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
+
+	var exportResp struct {
+		Result json.RawMessage `json:"result"`
+	}
+	json.Unmarshal(message, &exportResp)
+	expected := `{"version":1,"subscriptions":[["newHeads"],["logs",{"address":"0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}]]}`
+	if string(exportResp.Result) != expected {
+		t.Fatalf("Expected snapshot %s, got %s", expected, exportResp.Result)
+	}
+
+	// Import the snapshot on a new connection
+	conn2, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn2.Close()
+
+	conn2.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "hl_importSubscriptions",
+		"params":  []json.RawMessage{exportResp.Result},
+		"id":      3,
+	})
+	conn2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ = conn2.ReadMessage()
+
+	var importResp struct {
+		Result []string   `json:"result"`
+		Error  *rpc.Error `json:"error"`
+	}
+	json.Unmarshal(message, &importResp)
+	if importResp.Error != nil {
+		t.Fatalf("Import failed: %v", importResp.Error)
+	}
+	if len(importResp.Result) != 2 {
+		t.Fatalf("Expected 2 subscription IDs, got %v", importResp.Result)
+	}
+	if counts := bc.SubscriptionManager().CountByType(); counts[subscription.SubTypeLogs] != 2 {
+		t.Errorf("Expected 2 logs subscriptions, got %d", counts[subscription.SubTypeLogs])
+	}
+
+	// Unknown snapshot versions are rejected
+	conn2.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "hl_importSubscriptions",
+		"params":  []interface{}{map[string]interface{}{"version": 99, "subscriptions": []interface{}{}}},
+		"id":      4,
+	})
+	conn2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ = conn2.ReadMessage()
+
+	var resp rpc.Response
+	json.Unmarshal(message, &resp)
+	if resp.Error == nil || resp.Error.Code != rpc.ErrCodeInvalidParams {
+		t.Errorf("Expected invalid params error for unknown version, got %s", message)
+	}
+}
+
+// TestWebSocketLogsDedup tests that a log matching several dedup subscriptions is delivered once
+func TestWebSocketLogsDedup(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -753,73 +3486,256 @@ func TestWebSocketLogsSubscriptionMultipleAddresses(t *testing.T) {
 	}
 	defer conn.Close()
 
-	// Subscribe to logs with multiple addresses
-	request := map[string]interface{}{
+	conn.WriteJSON(map[string]interface{}{
 		"jsonrpc": "2.0",
-		"method":  "eth_subscribe",
+		"method":  "hl_subscribeBatch",
 		"params": []interface{}{
-			"logs",
-			map[string]interface{}{
-				"address": []string{
-					"0xf24090f1895cee4033103e670cc58edc28294841",
-					"0xdAC17F958D2ee523a2206206994597C13D831ec7",
-				},
-			},
+			[]interface{}{"logs", map[string]interface{}{"address": "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "dedup": true}},
+			[]interface{}{"logs", map[string]interface{}{"topics": []string{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}, "dedup": true}},
 		},
 		"id": 1,
-	}
-	conn.WriteJSON(request)
+	})
 	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
 	_, message, _ := conn.ReadMessage()
 
-	var resp rpc.Response
-	json.Unmarshal(message, &resp)
+	var batchResp struct {
+		Result []string `json:"result"`
+	}
+	json.Unmarshal(message, &batchResp)
+	if len(batchResp.Result) != 2 {
+		t.Fatalf("Expected 2 subscription IDs, got %s", message)
+	}
+
+	// Matches both subscriptions, then only the second
+	bc.BroadcastLog(&rpc.Log{Address: "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Topics: []string{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}, LogIndex: "0x0"})
+	bc.BroadcastLog(&rpc.Log{Address: "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Topics: []string{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}, LogIndex: "0x1"})
+
+	var notification struct {
+		Params struct {
+			Subscription  string   `json:"subscription"`
+			Subscriptions []string `json:"subscriptions"`
+			Result        rpc.Log  `json:"result"`
+		} `json:"params"`
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	json.Unmarshal(message, &notification)
+	if notification.Params.Result.LogIndex != "0x0" {
+		t.Fatalf("Expected log 0x0, got %s", message)
+	}
+	if notification.Params.Subscription != batchResp.Result[0] || len(notification.Params.Subscriptions) != 2 {
+		t.Errorf("Expected merged notification for both subscriptions, got %s", message)
+	}
+
+	notification.Params.Subscriptions = nil
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	json.Unmarshal(message, &notification)
+	if notification.Params.Result.LogIndex != "0x1" || notification.Params.Subscription != batchResp.Result[1] {
+		t.Errorf("Expected log 0x1 for the second subscription, got %s", message)
+	}
+	if notification.Params.Subscriptions != nil {
+		t.Errorf("Expected no subscriptions list for a single match, got %s", message)
+	}
+}
+
+// TestWebSocketInstanceIdentity tests the instance ID on the upgrade response and in notifications
+func TestWebSocketInstanceIdentity(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := broadcaster.NewBroadcaster()
+	bc.SubscriptionManager().SetInstanceID("replica-1")
+	go bc.Run()
+	defer bc.Stop()
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	wsHandler.SetInstance("replica-1", "X-Instance-ID", "hlnode_instance")
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	if got := resp.Header.Get("X-Instance-ID"); got != "replica-1" {
+		t.Errorf("Expected X-Instance-ID replica-1, got %q", got)
+	}
+	cookies := resp.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "hlnode_instance" || cookies[0].Value != "replica-1" {
+		t.Errorf("Expected hlnode_instance cookie, got %v", cookies)
+	}
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "hl_subscribeBatch",
+		"params": []interface{}{
+			[]interface{}{"newHeads", map[string]interface{}{"instance": true}},
+			[]interface{}{"gasPrice"},
+		},
+		"id": 1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage()
+
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x1", Hash: "0xabc"})
+	bc.BroadcastGasPrice(&rpc.GasPriceInfo{GasPrice: "0x1", BlockNumber: "0x1"})
+
+	var notification struct {
+		Params struct {
+			Instance string `json:"instance"`
+		} `json:"params"`
+	}
+	for _, expected := range []string{"replica-1", ""} {
+		notification.Params.Instance = ""
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read notification: %v", err)
+		}
+		json.Unmarshal(message, &notification)
+		if notification.Params.Instance != expected {
+			t.Errorf("Expected instance %q, got %s", expected, message)
+		}
+	}
+}
+
+// TestWebSocketPauseResumeSubscription tests that a paused subscription drops notifications until resumed
+func TestWebSocketPauseResumeSubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []string{"newHeads"},
+		"id":      1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ := conn.ReadMessage()
 
+	var subResp rpc.Response
+	json.Unmarshal(message, &subResp)
 	var subID string
-	json.Unmarshal(resp.Result, &subID)
-	if !strings.HasPrefix(subID, "0x") {
-		t.Errorf("Expected subscription ID starting with 0x, got %s", subID)
+	json.Unmarshal(subResp.Result, &subID)
+
+	call := func(method string, id int) bool {
+		conn.WriteJSON(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  method,
+			"params":  []string{subID},
+			"id":      id,
+		})
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, message, _ := conn.ReadMessage()
+
+		var resp rpc.Response
+		json.Unmarshal(message, &resp)
+		var success bool
+		json.Unmarshal(resp.Result, &success)
+		return success
 	}
 
-	// Give time for client registration
-	time.Sleep(100 * time.Millisecond)
+	if !call("hl_pauseSubscription", 2) {
+		t.Fatal("Expected pause to succeed")
+	}
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x1", Hash: "0x1"})
 
-	// Simulate log broadcast from first address
-	logEntry := &rpc.Log{
-		Address:         "0xf24090f1895cee4033103e670cc58edc28294841",
-		Topics:          []string{"0xtopic1"},
-		Data:            "0x1234",
-		BlockNumber:     "0x14c3a5f",
-		TransactionHash: "0xtx1",
-		LogIndex:        "0x0",
+	if !call("hl_resumeSubscription", 3) {
+		t.Fatal("Expected resume to succeed")
 	}
-	bc.BroadcastLog(logEntry)
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x2", Hash: "0x2"})
 
-	// Read notification
+	// Only the block broadcast after resuming is delivered
 	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
 	_, message, err = conn.ReadMessage()
 	if err != nil {
 		t.Fatalf("Failed to read notification: %v", err)
 	}
 
-	var notification map[string]interface{}
+	var notification struct {
+		Params struct {
+			Result rpc.FullBlockHeader `json:"result"`
+		} `json:"params"`
+	}
 	json.Unmarshal(message, &notification)
+	if notification.Params.Result.Number != "0x2" {
+		t.Errorf("Expected block 0x2 after resume, got %s", message)
+	}
+}
 
-	if notification["method"] != "eth_subscription" {
-		t.Errorf("Expected method eth_subscription, got %v", notification["method"])
+// TestWebSocketKeepaliveByClientClass tests that the client class selects the ping interval
+func TestWebSocketKeepaliveByClientClass(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	wsHandler.SetKeepalive(broadcaster.ClientClassMobile, broadcaster.Keepalive{PingInterval: 50 * time.Millisecond, PongTimeout: time.Second})
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "?clientClass=mobile"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
 	}
+	defer conn.Close()
 
-	t.Logf("Received logs notification for multiple addresses filter")
+	pings := make(chan struct{}, 10)
+	conn.SetPingHandler(func(string) error {
+		pings <- struct{}{}
+		return nil
+	})
+
+	// Control frames are only processed while reading; no data message is expected
+	conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	conn.ReadMessage()
+
+	if len(pings) < 2 {
+		t.Errorf("Expected pings every 50ms, got %d in 300ms", len(pings))
+	}
+
+	clients := bc.GetAllClientsInfo()
+	if len(clients) != 1 || clients[0].Class != broadcaster.ClientClassMobile {
+		t.Errorf("Expected one mobile client, got %+v", clients)
+	}
 }
 
-// TestWebSocketInvalidSubscriptionType tests error handling for unsupported subscription types
-func TestWebSocketInvalidSubscriptionType(t *testing.T) {
+// TestWebSocketHeartbeat tests heartbeats on a quiet subscription
+func TestWebSocketHeartbeat(t *testing.T) {
 	mockServer := mockRPCServer()
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -832,37 +3748,50 @@ func TestWebSocketInvalidSubscriptionType(t *testing.T) {
 	}
 	defer conn.Close()
 
-	// Subscribe with invalid subscription type
-	request := map[string]interface{}{
+	conn.WriteJSON(map[string]interface{}{
 		"jsonrpc": "2.0",
 		"method":  "eth_subscribe",
-		"params":  []string{"invalidSubscriptionType"},
+		"params":  []interface{}{"newHeads", map[string]interface{}{"heartbeat": "30s"}},
 		"id":      1,
-	}
-	conn.WriteJSON(request)
+	})
 	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
 	_, message, _ := conn.ReadMessage()
 
 	var resp rpc.Response
 	json.Unmarshal(message, &resp)
+	if resp.Error != nil {
+		t.Fatalf("Subscribe failed: %v", resp.Error)
+	}
 
-	if resp.Error == nil {
-		t.Error("Expected error for invalid subscription type")
-	} else if resp.Error.Code != rpc.ErrCodeInvalidParams {
-		t.Errorf("Expected error code %d, got %d", rpc.ErrCodeInvalidParams, resp.Error.Code)
+	// Not quiet for long enough yet
+	bc.BroadcastHeartbeats(time.Now().Add(10 * time.Second))
+	bc.BroadcastHeartbeats(time.Now().Add(31 * time.Second))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read heartbeat: %v", err)
 	}
 
-	t.Logf("Got expected error for invalid subscription type: %s", resp.Error.Message)
+	var notification struct {
+		Params struct {
+			Result    json.RawMessage `json:"result"`
+			Heartbeat bool            `json:"heartbeat"`
+		} `json:"params"`
+	}
+	json.Unmarshal(message, &notification)
+	if !notification.Params.Heartbeat || string(notification.Params.Result) != "null" {
+		t.Errorf("Expected heartbeat with null result, got %s", message)
+	}
 }
 
-// TestWebSocketLogNotMatchingFilter tests that logs not matching filter are not sent
-func TestWebSocketLogNotMatchingFilter(t *testing.T) {
+// TestWebSocketNotificationSequence tests per-subscription sequence numbers
+func TestWebSocketNotificationSequence(t *testing.T) {
 	mockServer := mockRPCServer()
 	defer mockServer.Close()
 
 	rpcClient := rpc.NewClient(mockServer.URL)
-	bc := broadcaster.NewBroadcaster()
-	go bc.Run()
+	bc := newTestBroadcaster(t)
 
 	wsHandler := NewWebSocketHandler(rpcClient, bc)
 	server := httptest.NewServer(wsHandler)
@@ -875,42 +3804,142 @@ func TestWebSocketLogNotMatchingFilter(t *testing.T) {
 	}
 	defer conn.Close()
 
-	// Subscribe to logs with specific address filter
-	request := map[string]interface{}{
+	conn.WriteJSON(map[string]interface{}{
 		"jsonrpc": "2.0",
-		"method":  "eth_subscribe",
+		"method":  "hl_subscribeBatch",
 		"params": []interface{}{
-			"logs",
-			map[string]interface{}{
-				"address": "0x1111111111111111111111111111111111111111",
-			},
+			[]interface{}{"newHeads", map[string]interface{}{"version": 2}},
+			[]interface{}{"newHeadsLite", map[string]interface{}{"version": 2}},
 		},
 		"id": 1,
+	})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage()
+
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x1", Hash: "0x1"})
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x2", Hash: "0x2"})
+
+	// Each subscription counts its own notifications
+	seqs := make(map[string][]uint64)
+	for i := 0; i < 4; i++ {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read notification: %v", err)
+		}
+
+		var notification subscription.SubscriptionNotification
+		json.Unmarshal(message, &notification)
+		seqs[notification.Params.Subscription] = append(seqs[notification.Params.Subscription], notification.Params.Seq)
 	}
-	conn.WriteJSON(request)
+
+	if len(seqs) != 2 {
+		t.Fatalf("Expected notifications for 2 subscriptions, got %v", seqs)
+	}
+	for subID, got := range seqs {
+		if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+			t.Errorf("Expected seq 1, 2 for %s, got %v", subID, got)
+		}
+	}
+}
+
+// TestWebSocketResumeSubscription tests recovering a subscription on a new connection
+func TestWebSocketResumeSubscription(t *testing.T) {
+	mockServer := mockRPCServer()
+	defer mockServer.Close()
+
+	rpcClient := rpc.NewClient(mockServer.URL)
+	bc := newTestBroadcaster(t)
+
+	wsHandler := NewWebSocketHandler(rpcClient, bc)
+	server := httptest.NewServer(wsHandler)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_subscribe",
+		"params":  []interface{}{"newHeads", map[string]interface{}{"resumable": true}},
+		"id":      1,
+	})
 	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-	conn.ReadMessage() // Read subscription response
+	_, message, _ := conn.ReadMessage()
+
+	var subResp rpc.Response
+	json.Unmarshal(message, &subResp)
+	var subID string
+	json.Unmarshal(subResp.Result, &subID)
+
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x1", Hash: "0x1"})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	var notification subscription.SubscriptionNotification
+	json.Unmarshal(message, &notification)
+	token := notification.Params.ResumeToken
+	if token == "" || notification.Params.Seq != 1 {
+		t.Fatalf("Expected seq 1 with a resume token, got %s", message)
+	}
 
-	// Give time for client registration
+	conn.Close()
 	time.Sleep(100 * time.Millisecond)
 
-	// Simulate log broadcast from DIFFERENT address (should NOT match)
-	logEntry := &rpc.Log{
-		Address:         "0x2222222222222222222222222222222222222222",
-		Topics:          []string{"0xtopic1"},
-		Data:            "0x1234",
-		BlockNumber:     "0x14c3a5f",
-		TransactionHash: "0xtx1",
-		LogIndex:        "0x0",
+	// Missed while disconnected
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x2", Hash: "0x2"})
+
+	conn2, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
 	}
-	bc.BroadcastLog(logEntry)
+	defer conn2.Close()
 
-	// Should timeout since the log doesn't match the filter
-	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
-	_, _, err = conn.ReadMessage()
-	if err == nil {
-		t.Error("Expected timeout (no notification), but received a message")
+	conn2.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "hl_recoverSubscription",
+		"params":  []interface{}{token, 1},
+		"id":      2,
+	})
+	conn2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, _ = conn2.ReadMessage()
+
+	var resumeResp rpc.Response
+	json.Unmarshal(message, &resumeResp)
+	var resumedID string
+	json.Unmarshal(resumeResp.Result, &resumedID)
+	if resumeResp.Error != nil || resumedID != subID {
+		t.Fatalf("Expected resume of %s, got %s", subID, message)
 	}
 
-	t.Log("Correctly no notification received for non-matching log")
+	conn2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn2.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read replayed notification: %v", err)
+	}
+	notification = subscription.SubscriptionNotification{}
+	json.Unmarshal(message, &notification)
+	if notification.Params.Seq != 2 || notification.Params.Subscription != subID {
+		t.Errorf("Expected replay of seq 2, got %s", message)
+	}
+
+	// Live delivery continues on the new connection
+	bc.BroadcastNewHead(&rpc.FullBlockHeader{Number: "0x3", Hash: "0x3"})
+
+	conn2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, message, err = conn2.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	notification = subscription.SubscriptionNotification{}
+	json.Unmarshal(message, &notification)
+	if notification.Params.Seq != 3 {
+		t.Errorf("Expected seq 3, got %s", message)
+	}
 }
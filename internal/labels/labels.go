@@ -0,0 +1,82 @@
+package labels
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"hlnode-websocket/internal/rpc"
+)
+
+// Registry maps addresses to operator-provided labels (exchanges, bridges,
+// known contracts) used to annotate notifications
+type Registry struct {
+	labels map[string]rpc.AddressLabel
+}
+
+// NewRegistry creates a registry from address labels
+func NewRegistry(labels map[string]rpc.AddressLabel) *Registry {
+	r := &Registry{labels: make(map[string]rpc.AddressLabel, len(labels))}
+	for addr, label := range labels {
+		r.labels[strings.ToLower(addr)] = label
+	}
+	return r
+}
+
+// Load reads a label file: a JSON object keyed by address whose values are
+// either a name or an object with a name and tags, e.g.
+//
+//	{"0xabc...": "Bridge", "0xdef...": {"name": "Exchange 1", "tags": ["exchange"]}}
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid label file: %w", err)
+	}
+
+	labels := make(map[string]rpc.AddressLabel, len(raw))
+	for addr, value := range raw {
+		var label rpc.AddressLabel
+		if len(value) > 0 && value[0] == '"' {
+			err = json.Unmarshal(value, &label.Name)
+		} else {
+			err = json.Unmarshal(value, &label)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid label for %s: %w", addr, err)
+		}
+		labels[addr] = label
+	}
+	return NewRegistry(labels), nil
+}
+
+// Len returns the number of labeled addresses
+func (r *Registry) Len() int {
+	return len(r.labels)
+}
+
+// Lookup returns the labels of the given addresses that are known, keyed by
+// lowercase address, or nil if none are
+func (r *Registry) Lookup(addresses ...string) map[string]rpc.AddressLabel {
+	var result map[string]rpc.AddressLabel
+	for _, addr := range addresses {
+		if addr == "" {
+			continue
+		}
+		addr = strings.ToLower(addr)
+		label, ok := r.labels[addr]
+		if !ok {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]rpc.AddressLabel)
+		}
+		result[addr] = label
+	}
+	return result
+}
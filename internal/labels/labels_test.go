@@ -0,0 +1,51 @@
+package labels
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labels.json")
+	os.WriteFile(path, []byte(`{
+		"0xAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA": "Bridge",
+		"0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb": {"name": "Exchange 1", "tags": ["exchange", "cex"]}
+	}`), 0o644)
+
+	registry, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load labels: %v", err)
+	}
+	if registry.Len() != 2 {
+		t.Errorf("Expected 2 labels, got %d", registry.Len())
+	}
+
+	found := registry.Lookup("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "", "0xBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB", "0xcccccccccccccccccccccccccccccccccccccccc")
+	if len(found) != 2 {
+		t.Fatalf("Expected 2 labels found, got %v", found)
+	}
+	if found["0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"].Name != "Bridge" {
+		t.Errorf("Unexpected label: %+v", found["0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"])
+	}
+	exchange := found["0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"]
+	if exchange.Name != "Exchange 1" || len(exchange.Tags) != 2 || exchange.Tags[0] != "exchange" {
+		t.Errorf("Unexpected label: %+v", exchange)
+	}
+
+	if found := registry.Lookup("0xcccccccccccccccccccccccccccccccccccccccc"); found != nil {
+		t.Errorf("Expected nil for unknown addresses, got %v", found)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labels.json")
+	os.WriteFile(path, []byte(`{"0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa": 42}`), 0o644)
+
+	if _, err := Load(path); err == nil {
+		t.Error("Expected an error for a non-string, non-object label")
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
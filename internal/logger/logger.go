@@ -3,6 +3,9 @@ package logger
 import (
 	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,10 +17,29 @@ const (
 	DEBUG = "DEBUG"
 )
 
+// fields is the " name=value" suffix appended to every line
+var fields atomic.Value
+
+// SetFields appends the given name=value fields, sorted by name, to every
+// log line so logs of replicas across a fleet can be told apart
+func SetFields(values map[string]string) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var suffix strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&suffix, " %s=%s", name, values[name])
+	}
+	fields.Store(suffix.String())
+}
+
 func log(level, format string, args ...interface{}) {
 	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05.000000Z")
 	msg := fmt.Sprintf(format, args...)
-	fmt.Fprintf(os.Stderr, "%s %s %s\n", timestamp, level, msg)
+	suffix, _ := fields.Load().(string)
+	fmt.Fprintf(os.Stderr, "%s %s %s%s\n", timestamp, level, msg, suffix)
 }
 
 func Info(format string, args ...interface{}) {
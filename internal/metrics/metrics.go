@@ -1,6 +1,10 @@
 package metrics
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -41,6 +45,11 @@ var (
 		Help: "WebSocket JSON-RPC requests by method",
 	}, []string{"method"})
 
+	WSSlowRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_slow_requests_total",
+		Help: "Forwarded JSON-RPC requests slower than the slow request threshold by method",
+	}, []string{"method"})
+
 	// Subscription metrics
 	WSActiveSubscriptions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "hlnode_websocket_ws_active_subscriptions",
@@ -57,6 +66,51 @@ var (
 		Help: "Subscriptions removed by type",
 	}, []string{"type"})
 
+	WSSubscriptionsExpired = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_subscriptions_expired_total",
+		Help: "Subscriptions removed when their TTL elapsed, by type",
+	}, []string{"type"})
+
+	WSNotificationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_notification_errors_total",
+		Help: "Notifications that could not be created, by subscription type",
+	}, []string{"type"})
+
+	WSSubscriptionsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_subscriptions_failed_total",
+		Help: "Subscriptions removed after repeated notification errors, by type",
+	}, []string{"type"})
+
+	WSSubscriptionsRemovedByAdmin = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_subscriptions_removed_by_admin_total",
+		Help: "Subscriptions removed with the admin bulk removal endpoint, by type",
+	}, []string{"type"})
+
+	WSSubscriptionsOrphaned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_subscriptions_orphaned_total",
+		Help: "Subscriptions removed by the consistency sweep because their client was gone, by type",
+	}, []string{"type"})
+
+	WSIdentityConnectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_identity_connections_total",
+		Help: "Connections authenticated with a TLS client certificate, by certificate identity",
+	}, []string{"identity"})
+
+	WSIdentityRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_identity_requests_total",
+		Help: "Requests of connections authenticated with a TLS client certificate, by certificate identity",
+	}, []string{"identity"})
+
+	WSQuotaWarningsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_quota_warnings_total",
+		Help: "Quota warnings sent to connections crossing 80% or 95% of a quota, by quota",
+	}, []string{"quota"})
+
+	WSQuotaExceeded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_quota_exceeded_total",
+		Help: "Requests rejected and notifications dropped by an exhausted connection quota, by quota",
+	}, []string{"quota"})
+
 	// Block notification metrics
 	WSBlockNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "hlnode_websocket_ws_block_notifications_total",
@@ -68,21 +122,101 @@ var (
 		Help: "Log notifications sent to subscribers",
 	})
 
+	WSLogsBackfilledTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_logs_backfilled_total",
+		Help: "Historical logs replayed to subscribers via fromBlock",
+	})
+
+	WSLogsBackfillWatchlistTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_logs_backfill_watchlist_total",
+		Help: "Logs backfills served from the local watchlist store",
+	})
+
 	WSGasPriceNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "hlnode_websocket_ws_gas_price_notifications_total",
 		Help: "Gas price notifications sent to subscribers",
 	})
 
+	WSBigBlockNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_big_block_notifications_total",
+		Help: "Big block header notifications sent to hl_bigBlocks subscribers",
+	})
+
+	WSSystemTxNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_system_tx_notifications_total",
+		Help: "System transaction notifications sent to hl_systemTxs subscribers",
+	})
+
+	WSReorgNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_reorg_notifications_total",
+		Help: "Reorg notifications sent to subscribers",
+	})
+
+	WSTokenTransferNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_token_transfer_notifications_total",
+		Help: "Token transfer notifications sent to subscribers",
+	})
+
+	WSBlockStatsNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_block_stats_notifications_total",
+		Help: "Block stats notifications sent to subscribers",
+	})
+
+	WSBalanceChangeNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_balance_change_notifications_total",
+		Help: "Native balance change notifications sent to subscribers",
+	})
+
+	WSNonceChangeNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_nonce_change_notifications_total",
+		Help: "Nonce change notifications sent to subscribers",
+	})
+
 	WSBlockReceiptsNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "hlnode_websocket_ws_block_receipts_notifications_total",
 		Help: "Block receipts notifications sent to subscribers",
 	})
 
+	WSTxConfirmationNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_tx_confirmation_notifications_total",
+		Help: "Transaction confirmation notifications sent to subscribers",
+	})
+
 	WSSyncingNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "hlnode_websocket_ws_syncing_notifications_total",
 		Help: "Syncing notifications sent to subscribers",
 	})
 
+	WSProxyMetricsNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_proxy_metrics_notifications_total",
+		Help: "Proxy metrics notifications sent to subscribers",
+	})
+
+	WSTestNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_test_notifications_total",
+		Help: "Synthetic test notifications sent to subscribers",
+	})
+
+	WSBaseFeeNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_base_fee_notifications_total",
+		Help: "Base fee change notifications sent",
+	})
+
+	WSFeeHistoryNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_fee_history_notifications_total",
+		Help: "Fee history notifications sent",
+	})
+
+	WSHeartbeatNotificationsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_heartbeat_notifications_total",
+		Help: "Heartbeat notifications sent to quiet subscriptions",
+	})
+
+	WSThrottledNotifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_ws_throttled_notifications_total",
+		Help: "Notifications dropped by a subscription's maxPerSecond limit by type",
+	}, []string{"type"})
+
 	// Upstream metrics (shared)
 	UpstreamRequestsTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "hlnode_websocket_upstream_requests_total",
@@ -94,15 +228,270 @@ var (
 		Help: "Total errors from upstream RPC",
 	})
 
+	// Upstream balancing metrics (UPSTREAM_URLS)
+	UpstreamWeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_upstream_weight",
+		Help: "Health score of a balanced upstream, from its recent latency and error rate; 0 when unavailable",
+	}, []string{"upstream"})
+
+	UpstreamForwardedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_upstream_forwarded_total",
+		Help: "Client calls forwarded to a balanced upstream",
+	}, []string{"upstream"})
+
+	// Upstream circuit breaker metrics (CIRCUIT_BREAKER_FAILURES)
+	UpstreamCircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_upstream_circuit_state",
+		Help: "Circuit breaker state of an upstream: 0 closed, 1 open, 2 half-open",
+	}, []string{"upstream"})
+
+	UpstreamCircuitOpenedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_upstream_circuit_opened_total",
+		Help: "Times an upstream circuit opened after consecutive failures",
+	}, []string{"upstream"})
+
+	UpstreamCircuitRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_upstream_circuit_rejected_total",
+		Help: "Calls failed fast because the upstream circuit was open",
+	}, []string{"upstream"})
+
+	UpstreamRateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_upstream_rate_limited_total",
+		Help: "Upstream calls delayed or rejected by UPSTREAM_RATE_LIMIT, by outcome",
+	}, []string{"upstream", "outcome"})
+
+	UpstreamLaneInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_upstream_lane_in_flight",
+		Help: "Upstream calls in flight, by request lane",
+	}, []string{"upstream", "lane"})
+
+	UpstreamLaneWaitsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_upstream_lane_waits_total",
+		Help: "Upstream calls that waited for a free slot in their request lane",
+	}, []string{"upstream", "lane"})
+
+	UpstreamRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_upstream_retries_total",
+		Help: "Upstream calls retried after a transient error",
+	}, []string{"upstream"})
+
+	UpstreamBlockReceipts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_upstream_block_receipts",
+		Help: "Whether receipts are fetched from an upstream with eth_getBlockReceipts (1) or per transaction (0)",
+	}, []string{"upstream"})
+
+	// Upstream hedging metrics (UPSTREAM_HEDGE)
+	UpstreamHedgedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_upstream_hedged_total",
+		Help: "Latency-critical calls also fired at a second upstream by method",
+	}, []string{"method"})
+
+	UpstreamHedgeWinsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_upstream_hedge_wins_total",
+		Help: "Hedged calls by method and whether the primary or the hedge answered first",
+	}, []string{"method", "winner"})
+
+	// Upstream head stream metrics (UPSTREAM_WS_URL)
+	UpstreamStreamConnected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_upstream_stream_connected",
+		Help: "Upstream newHeads stream subscribed (1/0); blocks are polled while it is down",
+	})
+
+	UpstreamStreamHeadsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_upstream_stream_heads_total",
+		Help: "Heads announced by the upstream newHeads stream",
+	})
+
+	// Upstream probe metrics (background eth_blockNumber, independent of client traffic)
+	UpstreamProbeUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_upstream_probe_up",
+		Help: "Whether the upstream is healthy according to the background probe (1 = healthy)",
+	})
+
+	UpstreamProbeLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "hlnode_websocket_upstream_probe_latency_seconds",
+		Help:    "Latency of successful upstream probes",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	UpstreamProbeFailuresTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_upstream_probe_failures_total",
+		Help: "Failed upstream probes",
+	})
+
+	// Event bus metrics
+	EventsPublishedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_events_published_total",
+		Help: "Events published by the block poller by kind",
+	}, []string{"kind"})
+
+	EventsDroppedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_events_dropped_total",
+		Help: "Events dropped for a lossy consumer whose queue was full",
+	}, []string{"consumer"})
+
+	EventQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_event_queue_depth",
+		Help: "Events queued for a buffered consumer",
+	}, []string{"consumer"})
+
+	// Head cache metrics
+	CacheHitsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_cache_hits_total",
+		Help: "Requests served from the head cache by method",
+	}, []string{"method"})
+
+	CacheMissesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_cache_misses_total",
+		Help: "Cacheable requests forwarded upstream by method",
+	}, []string{"method"})
+
+	// Degraded mode
+	StaleResponsesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_stale_responses_total",
+		Help: "Requests answered from stale cached results while the upstream was down, by method",
+	}, []string{"method"})
+
+	SendQueueTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_send_queue_total",
+		Help: "Raw transactions queued while the upstream was down, by outcome (queued, full, sent, rejected, expired)",
+	}, []string{"outcome"})
+
+	SendQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_send_queue_depth",
+		Help: "Raw transactions queued for sending once the upstream is back",
+	})
+
+	// Local polling filters
+	LocalFiltersActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_filters_active",
+		Help: "Polling filters installed with eth_newFilter or eth_newBlockFilter",
+	})
+
+	LocalFiltersExpired = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_filters_expired_total",
+		Help: "Polling filters uninstalled after not being polled within FILTER_TIMEOUT, by type",
+	}, []string{"type"})
+
+	// Storage retention
+	StorageBlocks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_storage_blocks",
+		Help: "Span of block numbers held in storage",
+	})
+
+	StorageBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_storage_bytes",
+		Help: "Approximate size of the data held in storage",
+	})
+
+	StorageEvictedBlocks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_storage_evicted_blocks_total",
+		Help: "Blocks evicted from storage by retention limit (blocks, age, size)",
+	}, []string{"reason"})
+
+	// Archival of aged-out storage segments
+	ArchiveSegmentsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_archive_segments_total",
+		Help: "Storage segments flushed to the archive",
+	})
+
+	ArchiveErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_archive_errors_total",
+		Help: "Failed archive flushes",
+	})
+
 	// Block processing
 	BlocksProcessedTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "hlnode_websocket_blocks_processed_total",
 		Help: "Total blocks processed",
 	})
+
+	BlockTxCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_block_tx_count",
+		Help: "Transactions in the latest block",
+	})
+
+	BlockGasUtilization = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_block_gas_utilization_percent",
+		Help: "Gas used by the latest block as a percentage of its gas limit",
+	})
+
+	TransactionsPerSecond = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_transactions_per_second",
+		Help: "Rolling transaction rate over recent block time",
+	})
+
+	TransactionsProcessedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_transactions_processed_total",
+		Help: "Transactions in processed blocks",
+	})
+
+	HeadRegressionsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_head_regressions_total",
+		Help: "Polls where the upstream head was behind the last broadcast head",
+	})
+
+	ChainReorgsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hlnode_websocket_chain_reorgs_total",
+		Help: "Reorgs detected where a new head did not build on the last delivered blocks",
+	})
+
+	BlockConsistencyFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_block_consistency_failures_total",
+		Help: "Logs or receipts fetched with a blockHash other than the header's, or headers failing their hash check, by kind",
+	}, []string{"kind"})
+
+	ChainReorgDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "hlnode_websocket_chain_reorg_depth",
+		Help: "Number of blocks replaced by the last detected reorg",
+	})
+
+	// Panics recovered in handler and poller goroutines
+	PanicsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hlnode_websocket_panics_total",
+		Help: "Panics recovered by component",
+	}, []string{"component"})
 )
 
-func init() {
-	Registry.MustRegister(
+// labelNamePattern matches valid Prometheus label names
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseConstLabels parses "name=value" entries into constant labels
+func ParseConstLabels(entries []string) (prometheus.Labels, error) {
+	labels := make(prometheus.Labels, len(entries))
+	for _, entry := range entries {
+		name, value, ok := strings.Cut(entry, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%q is not name=value", entry)
+		}
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("%q is not a valid label name", name)
+		}
+		if _, dup := labels[name]; dup {
+			return nil, fmt.Errorf("label %q is set twice", name)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// Register registers all metrics on Registry with the given constant labels
+// added, so replicas of a fleet can be told apart without relabeling at
+// scrape time. It must be called once, before serving /metrics.
+func Register(constLabels prometheus.Labels) error {
+	registerer := prometheus.WrapRegistererWith(constLabels, Registry)
+	for _, collector := range collectors() {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectors returns all the metrics to register
+func collectors() []prometheus.Collector {
+	return []prometheus.Collector{
 		// WebSocket
 		WSActiveConnections,
 		WSConnectionsTotal,
@@ -110,19 +499,99 @@ func init() {
 		WSMessagesReceived,
 		WSMessagesSent,
 		WSRPCRequestsTotal,
+		WSSlowRequestsTotal,
 		// Subscriptions
 		WSActiveSubscriptions,
 		WSSubscriptionsCreated,
 		WSSubscriptionsRemoved,
+		WSSubscriptionsExpired,
+		WSNotificationErrors,
+		WSSubscriptionsFailed,
+		WSSubscriptionsRemovedByAdmin,
+		WSSubscriptionsOrphaned,
+		WSIdentityConnectionsTotal,
+		WSIdentityRequestsTotal,
+		WSQuotaWarningsSent,
+		WSQuotaExceeded,
 		WSBlockNotificationsSent,
 		WSLogNotificationsSent,
+		WSLogsBackfilledTotal,
+		WSLogsBackfillWatchlistTotal,
 		WSGasPriceNotificationsSent,
+		WSBigBlockNotificationsSent,
+		WSSystemTxNotificationsSent,
+		WSReorgNotificationsSent,
+		WSTokenTransferNotificationsSent,
+		WSBlockStatsNotificationsSent,
+		WSBalanceChangeNotificationsSent,
+		WSNonceChangeNotificationsSent,
 		WSBlockReceiptsNotificationsSent,
+		WSTxConfirmationNotificationsSent,
 		WSSyncingNotificationsSent,
+		WSProxyMetricsNotificationsSent,
+		WSTestNotificationsSent,
+		WSBaseFeeNotificationsSent,
+		WSFeeHistoryNotificationsSent,
+		WSHeartbeatNotificationsSent,
+		WSThrottledNotifications,
 
 		// Upstream
 		UpstreamRequestsTotal,
 		UpstreamErrorsTotal,
+		UpstreamWeight,
+		UpstreamForwardedTotal,
+		UpstreamCircuitState,
+		UpstreamCircuitOpenedTotal,
+		UpstreamCircuitRejectedTotal,
+		UpstreamRateLimitedTotal,
+		UpstreamLaneInFlight,
+		UpstreamLaneWaitsTotal,
+		UpstreamRetriesTotal,
+		UpstreamBlockReceipts,
+		UpstreamHedgedTotal,
+		UpstreamHedgeWinsTotal,
+		UpstreamStreamConnected,
+		UpstreamStreamHeadsTotal,
+		UpstreamProbeUp,
+		UpstreamProbeLatency,
+		UpstreamProbeFailuresTotal,
 		BlocksProcessedTotal,
-	)
+		BlockTxCount,
+		BlockGasUtilization,
+		TransactionsPerSecond,
+		TransactionsProcessedTotal,
+		HeadRegressionsTotal,
+		ChainReorgsTotal,
+		ChainReorgDepth,
+		BlockConsistencyFailuresTotal,
+
+		// Event bus
+		EventsPublishedTotal,
+		EventsDroppedTotal,
+		EventQueueDepth,
+
+		// Cache
+		CacheHitsTotal,
+		CacheMissesTotal,
+
+		// Degraded mode
+		StaleResponsesTotal,
+		SendQueueTotal,
+		SendQueueDepth,
+
+		// Filters
+		LocalFiltersActive,
+		LocalFiltersExpired,
+
+		// Storage
+		StorageBlocks,
+		StorageBytes,
+		StorageEvictedBlocks,
+
+		// Archive
+		ArchiveSegmentsTotal,
+		ArchiveErrorsTotal,
+
+		PanicsTotal,
+	}
 }
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseConstLabels(t *testing.T) {
+	labels, err := ParseConstLabels([]string{"cluster=eu-1", " region = eu-west "})
+	if err != nil {
+		t.Fatalf("ParseConstLabels failed: %v", err)
+	}
+	if labels["cluster"] != "eu-1" || labels["region"] != "eu-west" || len(labels) != 2 {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+
+	tests := []struct {
+		entries []string
+		message string
+	}{
+		{[]string{"cluster"}, "not name=value"},
+		{[]string{"cluster="}, "not name=value"},
+		{[]string{"1cluster=eu"}, "not a valid label name"},
+		{[]string{"__name__=x"}, "not a valid label name"},
+		{[]string{"cluster=a", "cluster=b"}, "set twice"},
+	}
+	for _, tt := range tests {
+		_, err := ParseConstLabels(tt.entries)
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("Expected error mentioning %q for %v, got %v", tt.message, tt.entries, err)
+		}
+	}
+}
+
+func TestRegisterConstLabels(t *testing.T) {
+	saved := Registry
+	defer func() { Registry = saved }()
+	Registry = prometheus.NewRegistry()
+
+	if err := Register(prometheus.Labels{"cluster": "eu-1"}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	WSActiveConnections.Set(1)
+
+	families, err := Registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	if len(families) == 0 {
+		t.Fatal("Expected registered metrics")
+	}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			found := false
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "cluster" && label.GetValue() == "eu-1" {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Expected %s to carry the cluster label", family.GetName())
+			}
+		}
+	}
+}
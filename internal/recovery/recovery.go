@@ -0,0 +1,72 @@
+// Package recovery turns panics in handler and poller goroutines into
+// structured crash reports instead of process crashes
+package recovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+)
+
+// RestartDelay is how long Supervise waits before restarting a panicked function
+var RestartDelay = time.Second
+
+// Context describes where a panic happened
+type Context struct {
+	// Component names the goroutine, e.g. "handler" or "pollBlocks"
+	Component string `json:"component"`
+	Method    string `json:"method,omitempty"`
+	ClientID  string `json:"clientId,omitempty"`
+}
+
+// CrashReport is the structured record logged for a recovered panic
+type CrashReport struct {
+	Context
+	Time  string `json:"time"`
+	Panic string `json:"panic"`
+	Stack string `json:"stack"`
+}
+
+// Report logs a crash report for a recovered panic value and counts it in
+// hlnode_websocket_panics_total. It must be called from the deferred function
+// that recovered, so the stack still shows the panicking frames.
+func Report(recovered interface{}, ctx Context) *CrashReport {
+	report := &CrashReport{
+		Context: ctx,
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Panic:   fmt.Sprint(recovered),
+		Stack:   string(debug.Stack()),
+	}
+	metrics.PanicsTotal.WithLabelValues(ctx.Component).Inc()
+
+	data, _ := json.Marshal(report)
+	logger.Error("Panic recovered: %s", data)
+	return report
+}
+
+// Recover reports a panic of the calling goroutine and lets it exit normally.
+// It must be deferred directly: defer recovery.Recover(ctx).
+func Recover(ctx Context) {
+	if recovered := recover(); recovered != nil {
+		Report(recovered, ctx)
+	}
+}
+
+// Supervise runs fn until it returns, restarting it after RestartDelay each
+// time it panics, so long-running loops survive a crash
+func Supervise(component string, fn func()) {
+	for !run(component, fn) {
+		time.Sleep(RestartDelay)
+	}
+}
+
+// run calls fn and reports whether it returned without panicking
+func run(component string, fn func()) (ok bool) {
+	defer Recover(Context{Component: component})
+	fn()
+	return true
+}
@@ -0,0 +1,57 @@
+package recovery
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecover(t *testing.T) {
+	// An unrecovered panic in the goroutine would crash the test binary
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer Recover(Context{Component: "test", Method: "eth_test", ClientID: "client-1"})
+		panic("boom")
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Goroutine did not exit after the panic")
+	}
+}
+
+func TestReport(t *testing.T) {
+	var report *CrashReport
+	func() {
+		defer func() {
+			report = Report(recover(), Context{Component: "test", Method: "eth_test", ClientID: "client-1"})
+		}()
+		panic("boom")
+	}()
+
+	if report.Panic != "boom" || report.Method != "eth_test" || report.ClientID != "client-1" {
+		t.Errorf("Unexpected crash report: %+v", report)
+	}
+	if !strings.Contains(report.Stack, "TestReport") {
+		t.Errorf("Expected stack to include the panicking function, got %s", report.Stack)
+	}
+}
+
+func TestSupervise(t *testing.T) {
+	RestartDelay = time.Millisecond
+	defer func() { RestartDelay = time.Second }()
+
+	runs := 0
+	Supervise("test", func() {
+		runs++
+		if runs < 3 {
+			panic("boom")
+		}
+	})
+
+	if runs != 3 {
+		t.Errorf("Expected 3 runs, got %d", runs)
+	}
+}
@@ -0,0 +1,217 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+)
+
+// Health scoring of balanced upstreams
+const (
+	// scoreAlpha is the weight of the latest call in the latency and error
+	// rate moving averages
+	scoreAlpha = 0.2
+	// minLatency floors latencies so a few fast calls can't take all traffic
+	minLatency = 5 * time.Millisecond
+	// minShare is the least share of traffic a ready upstream keeps, so a
+	// recovered upstream gets calls that raise its score again
+	minShare = 0.02
+	// repinRatio is how much better another upstream must score to take
+	// over the block poller, so it doesn't flap between similar nodes
+	repinRatio = 1.5
+)
+
+// UpstreamScore is the health score of a balanced upstream
+type UpstreamScore struct {
+	URL       string  `json:"url"`
+	Ready     bool    `json:"ready"`
+	Circuit   string  `json:"circuit"`
+	LatencyMs float64 `json:"latencyMs"`
+	ErrorRate float64 `json:"errorRate"`
+	Weight    float64 `json:"weight"`
+	Pinned    bool    `json:"pinned"`
+}
+
+// balanced is an upstream and its moving averages
+type balanced struct {
+	client  *Client
+	host    string
+	latency float64 // seconds
+	errors  float64 // share of failed calls
+}
+
+// weight is the upstream's share of forwarded calls relative to the others:
+// inversely proportional to latency, scaled down by the error rate. An open
+// circuit gets no calls until it half-opens. The
+// balancer's mu must be held.
+func (u *balanced) weight() float64 {
+	if !u.client.Ready() || u.client.CircuitState() == CircuitOpen {
+		return 0
+	}
+	latency := max(u.latency, minLatency.Seconds())
+	ok := 1 - u.errors
+	return ok * ok / latency
+}
+
+// Balancer spreads forwarded calls across upstreams weighted by their recent
+// latency and error rate, and keeps the block poller pinned to the healthiest
+type Balancer struct {
+	upstreams []*balanced
+	pinned    int
+	// hedge and hedgeDelay are set by SetHedging
+	hedge      bool
+	hedgeDelay time.Duration
+	mu         sync.Mutex
+}
+
+// NewBalancer balances calls across clients; the first is pinned initially
+func NewBalancer(clients ...*Client) *Balancer {
+	b := &Balancer{}
+	for _, c := range clients {
+		b.upstreams = append(b.upstreams, &balanced{client: c, host: c.host, latency: minLatency.Seconds()})
+	}
+	return b
+}
+
+// Pick chooses the upstream of a forwarded call at random, weighted by score
+func (b *Balancer) Pick() *Client {
+	if len(b.upstreams) == 1 {
+		return b.upstreams[0].client
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	weights := make([]float64, len(b.upstreams))
+	var total float64
+	for i, u := range b.upstreams {
+		weights[i] = u.weight()
+		total += weights[i]
+	}
+	if total == 0 {
+		// None is ready: the pinned client reports why
+		return b.upstreams[b.pinned].client
+	}
+	for i, w := range weights {
+		if w > 0 {
+			weights[i] = max(w, total*minShare)
+		}
+	}
+	total = 0
+	for _, w := range weights {
+		total += w
+	}
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return b.upstreams[i].client
+		}
+		r -= w
+	}
+	return b.upstreams[len(b.upstreams)-1].client
+}
+
+// Poller returns the upstream the block poller is pinned to, moving the pin
+// when another upstream scores repinRatio times better
+func (b *Balancer) Poller() *Client {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	best := b.pinned
+	for i, u := range b.upstreams {
+		if u.weight() > b.upstreams[best].weight() {
+			best = i
+		}
+	}
+	current := b.upstreams[b.pinned].weight()
+	if best != b.pinned && (current == 0 || b.upstreams[best].weight() > current*repinRatio) {
+		logger.Info("Block poller moved from upstream %s to %s", b.upstreams[b.pinned].host, b.upstreams[best].host)
+		b.pinned = best
+	}
+	return b.upstreams[b.pinned].client
+}
+
+// Observe records the outcome of a call to one of the upstreams
+func (b *Balancer) Observe(c *Client, latency time.Duration, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, u := range b.upstreams {
+		if u.client != c {
+			continue
+		}
+		failed := 0.0
+		if err != nil {
+			failed = 1
+		} else {
+			u.latency += scoreAlpha * (latency.Seconds() - u.latency)
+		}
+		u.errors += scoreAlpha * (failed - u.errors)
+		metrics.UpstreamWeight.WithLabelValues(u.host).Set(u.weight())
+		return
+	}
+}
+
+// Call forwards a request to an upstream chosen by Pick
+func (b *Balancer) Call(ctx context.Context, req *Request) (*Response, error) {
+	c := b.Pick()
+	start := time.Now()
+	resp, err := c.Call(ctx, req)
+	b.observeCall(ctx, c, start, err)
+	return resp, err
+}
+
+// CallRaw forwards a raw request to an upstream chosen by Pick
+func (b *Balancer) CallRaw(ctx context.Context, body []byte) ([]byte, error) {
+	c := b.Pick()
+	start := time.Now()
+	resp, err := c.CallRaw(ctx, body)
+	b.observeCall(ctx, c, start, err)
+	return resp, err
+}
+
+// observeCall records a forwarded call like observe and counts it
+func (b *Balancer) observeCall(ctx context.Context, c *Client, start time.Time, err error) {
+	if !b.observe(ctx, c, start, err) {
+		return
+	}
+	for _, u := range b.upstreams {
+		if u.client == c {
+			metrics.UpstreamForwardedTotal.WithLabelValues(u.host).Inc()
+		}
+	}
+}
+
+// observe records a call, unless it failed because the caller gave up, the
+// circuit was open or the rate limit refused it, which says nothing new about
+// the upstream; it reports whether the call was recorded
+func (b *Balancer) observe(ctx context.Context, c *Client, start time.Time, err error) bool {
+	var open *CircuitOpenError
+	if err != nil && (ctx.Err() != nil || errors.As(err, &open) || errors.Is(err, ErrRateLimited)) {
+		return false
+	}
+	b.Observe(c, time.Since(start), err)
+	return true
+}
+
+// Scores returns the health score of each upstream
+func (b *Balancer) Scores() []UpstreamScore {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	scores := make([]UpstreamScore, len(b.upstreams))
+	for i, u := range b.upstreams {
+		scores[i] = UpstreamScore{
+			URL:       u.host,
+			Ready:     u.client.Ready(),
+			Circuit:   u.client.CircuitState(),
+			LatencyMs: u.latency * 1000,
+			ErrorRate: u.errors,
+			Weight:    u.weight(),
+			Pinned:    i == b.pinned,
+		}
+	}
+	return scores
+}
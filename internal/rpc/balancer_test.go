@@ -0,0 +1,123 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBalancerWeights(t *testing.T) {
+	fast, slow, failing := NewClient("http://fast:8545"), NewClient("http://slow:8545"), NewClient("http://failing:8545")
+	b := NewBalancer(fast, slow, failing)
+	for range 50 {
+		b.Observe(fast, 10*time.Millisecond, nil)
+		b.Observe(slow, 100*time.Millisecond, nil)
+		b.Observe(failing, 10*time.Millisecond, errors.New("connection refused"))
+	}
+
+	picks := make(map[*Client]int)
+	for range 10000 {
+		picks[b.Pick()]++
+	}
+	// fast weighs about 10 times slow; failing keeps the minimum share
+	if picks[fast] < 7*picks[slow] || picks[slow] < 3*picks[failing] || picks[failing] == 0 {
+		t.Errorf("Expected fast > slow > failing > 0 picks, got %d, %d, %d", picks[fast], picks[slow], picks[failing])
+	}
+
+	scores := b.Scores()
+	if scores[0].URL != "fast:8545" || !scores[0].Pinned || scores[2].ErrorRate < 0.99 {
+		t.Errorf("Unexpected scores %+v", scores)
+	}
+}
+
+func TestBalancerSkipsUnavailable(t *testing.T) {
+	unset, ok := NewClient(""), NewClient("http://ok:8545")
+	b := NewBalancer(unset, ok)
+	for range 100 {
+		if b.Pick() != ok {
+			t.Fatal("Expected an unavailable upstream never to be picked")
+		}
+	}
+	// The poller moves off an unavailable upstream whatever the ratio
+	if b.Poller() != ok {
+		t.Error("Expected the poller to move to the available upstream")
+	}
+}
+
+func TestBalancerPollerHysteresis(t *testing.T) {
+	a, c := NewClient("http://a:8545"), NewClient("http://c:8545")
+	b := NewBalancer(a, c)
+	for range 50 {
+		b.Observe(a, 12*time.Millisecond, nil)
+		b.Observe(c, 10*time.Millisecond, nil)
+	}
+	if b.Poller() != a {
+		t.Error("Expected the poller to stay on a slightly slower upstream")
+	}
+	for range 50 {
+		b.Observe(a, 30*time.Millisecond, nil)
+	}
+	if b.Poller() != c {
+		t.Error("Expected the poller to move to a much healthier upstream")
+	}
+}
+
+func TestBalancerIgnoresCanceledCalls(t *testing.T) {
+	c := NewClient("http://127.0.0.1:1")
+	b := NewBalancer(c)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.Call(ctx, &Request{JSONRPC: "2.0", Method: "eth_chainId"})
+	if rate := b.Scores()[0].ErrorRate; rate != 0 {
+		t.Errorf("Expected a call canceled by the caller not to count as an error, got rate %v", rate)
+	}
+}
+
+func TestHedge(t *testing.T) {
+	release := make(chan struct{})
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}`))
+	}))
+	defer slowServer.Close()
+	defer close(release)
+	fastServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x2","id":1}`))
+	}))
+	defer fastServer.Close()
+
+	slow, fast := NewClient(slowServer.URL), NewClient(fastServer.URL)
+	b := NewBalancer(slow, fast)
+	blockNumber := func(ctx context.Context, c *Client) (string, error) {
+		return c.GetBlockNumber(ctx)
+	}
+
+	// Without hedging only the pinned upstream is asked
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := Hedge(ctx, b, slow, "eth_blockNumber", blockNumber); err == nil {
+		t.Error("Expected an unhedged call to wait for the slow upstream")
+	}
+
+	b.SetHedging(true, 10*time.Millisecond)
+	start := time.Now()
+	got, err := Hedge(context.Background(), b, slow, "eth_blockNumber", blockNumber)
+	if err != nil || got != "0x2" {
+		t.Fatalf("Expected the hedge to answer 0x2, got %q, %v", got, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the hedge to answer quickly, took %v", elapsed)
+	}
+
+	// A failing primary fires the hedge without waiting for the delay
+	dead := NewClient("http://127.0.0.1:1")
+	hedged := NewBalancer(dead, fast)
+	hedged.SetHedging(true, time.Hour)
+	got, err = Hedge(context.Background(), hedged, dead, "eth_blockNumber", blockNumber)
+	if err != nil || got != "0x2" {
+		t.Errorf("Expected the hedge to answer after the primary failed, got %q, %v", got, err)
+	}
+}
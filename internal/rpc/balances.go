@@ -0,0 +1,133 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// BalanceChange is a balanceChanges notification: the native balance of a
+// watched address changed in a block
+type BalanceChange struct {
+	Address         string `json:"address"`
+	BlockNumber     string `json:"blockNumber"`
+	BlockHash       string `json:"blockHash"`
+	PreviousBalance string `json:"previousBalance"`
+	Balance         string `json:"balance"`
+}
+
+// TouchedAddresses returns the lowercase addresses whose native balance a
+// block's transactions may have changed: every sender, which pays for gas,
+// and the recipients of a non-zero value
+func TouchedAddresses(txs []Transaction) []string {
+	seen := make(map[string]bool)
+	var addresses []string
+	add := func(addr string) {
+		addr = strings.ToLower(addr)
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			addresses = append(addresses, addr)
+		}
+	}
+	for _, tx := range txs {
+		add(tx.From)
+		if !isZeroQuantity(tx.Value) {
+			add(tx.To)
+		}
+	}
+	return addresses
+}
+
+// isZeroQuantity reports whether a hex quantity is empty or zero
+func isZeroQuantity(value string) bool {
+	return strings.TrimLeft(strings.TrimPrefix(value, "0x"), "0") == ""
+}
+
+// GetBalance fetches the native balance of an address at a block
+func (c *Client) GetBalance(ctx context.Context, address, blockNum string) (string, error) {
+	params, _ := json.Marshal([]string{address, blockNum})
+	req := &Request{
+		JSONRPC: "2.0",
+		Method:  "eth_getBalance",
+		Params:  params,
+		ID:      json.RawMessage("1"),
+	}
+
+	resp, err := c.Call(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Error != nil {
+		return "", fmt.Errorf("RPC error: %s", resp.Error.Message)
+	}
+
+	var balance string
+	if err := json.Unmarshal(resp.Result, &balance); err != nil {
+		return "", fmt.Errorf("failed to unmarshal balance: %w", err)
+	}
+	return balance, nil
+}
+
+// callFrame is a call in a callTracer trace
+type callFrame struct {
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	Value string      `json:"value"`
+	Calls []callFrame `json:"calls"`
+}
+
+// TraceValueTransfers returns the lowercase senders and recipients of the
+// internal calls carrying value in a block, traced with debug_traceBlockByNumber.
+// ok is false when the upstream does not support tracing.
+func (c *Client) TraceValueTransfers(ctx context.Context, blockNum string) (addresses []string, ok bool, err error) {
+	params, _ := json.Marshal([]interface{}{blockNum, map[string]string{"tracer": "callTracer"}})
+	req := &Request{
+		JSONRPC: "2.0",
+		Method:  "debug_traceBlockByNumber",
+		Params:  params,
+		ID:      json.RawMessage("1"),
+	}
+
+	resp, err := c.Call(ctx, req)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if resp.Error != nil {
+		// Method is not available on this upstream
+		return nil, false, nil
+	}
+
+	var traces []struct {
+		Result callFrame `json:"result"`
+	}
+	if err := json.Unmarshal(resp.Result, &traces); err != nil {
+		return nil, true, fmt.Errorf("failed to unmarshal block trace: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var walk func(frame *callFrame)
+	walk = func(frame *callFrame) {
+		if !isZeroQuantity(frame.Value) {
+			for _, addr := range []string{frame.From, frame.To} {
+				addr = strings.ToLower(addr)
+				if addr != "" && !seen[addr] {
+					seen[addr] = true
+					addresses = append(addresses, addr)
+				}
+			}
+		}
+		for i := range frame.Calls {
+			walk(&frame.Calls[i])
+		}
+	}
+	for i := range traces {
+		// The top-level call is the transaction itself, already covered by TouchedAddresses
+		for j := range traces[i].Result.Calls {
+			walk(&traces[i].Result.Calls[j])
+		}
+	}
+	return addresses, true, nil
+}
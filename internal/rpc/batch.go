@@ -0,0 +1,174 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"hlnode-websocket/internal/logger"
+)
+
+// ErrBatchUnsupported is returned by CallBatch when the upstream answers a
+// batch with something other than an array of responses
+var ErrBatchUnsupported = errors.New("upstream does not support JSON-RPC batches")
+
+// errReceiptsNotRequested is the ReceiptsErr of a bundle fetched without receipts
+var errReceiptsNotRequested = errors.New("receipts not requested")
+
+// CallBatch sends requests as one JSON-RPC batch and returns their responses
+// in request order. The requests are numbered 1 to n in the batch, whatever
+// their own IDs, so answers can be matched in any order. The batch is
+// retried only if all its methods are idempotent.
+func (c *Client) CallBatch(ctx context.Context, reqs []*Request) ([]*Response, error) {
+	if !c.Ready() {
+		return nil, ErrUpstreamUnavailable
+	}
+	if len(reqs) == 0 {
+		return nil, nil
+	}
+
+	batch := make([]Request, len(reqs))
+	methods := make([]string, len(reqs))
+	idempotent := true
+	for i, req := range reqs {
+		batch[i] = *req
+		batch[i].ID = json.RawMessage(strconv.Itoa(i + 1))
+		methods[i] = req.Method
+		idempotent = idempotent && IsIdempotent(req.Method)
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal batch: %w", err)
+	}
+
+	respBody, err := c.post(ctx, body, idempotent, batchLane(methods))
+	if err != nil {
+		return nil, err
+	}
+
+	respBody = bytes.TrimSpace(respBody)
+	if len(respBody) == 0 || respBody[0] != '[' {
+		var single Response
+		if json.Unmarshal(respBody, &single) == nil && single.Error != nil {
+			return nil, fmt.Errorf("%w: %s", ErrBatchUnsupported, single.Error.Message)
+		}
+		return nil, ErrBatchUnsupported
+	}
+	var answers []Response
+	if err := json.Unmarshal(respBody, &answers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal batch response: %w", err)
+	}
+
+	responses := make([]*Response, len(reqs))
+	for i := range answers {
+		id, err := strconv.Atoi(string(answers[i].ID))
+		if err == nil && id >= 1 && id <= len(reqs) {
+			responses[id-1] = &answers[i]
+		}
+	}
+	for i, resp := range responses {
+		if resp == nil {
+			return nil, fmt.Errorf("batch response is missing the answer to %s", reqs[i].Method)
+		}
+	}
+	return responses, nil
+}
+
+// BlockBundle is what the block poller fetches for a block. LogsErr and
+// ReceiptsErr report parts that could not be fetched.
+type BlockBundle struct {
+	Header      *FullBlockHeader
+	Logs        []Log
+	LogsErr     error
+	Receipts    []TransactionReceipt
+	ReceiptsErr error
+}
+
+// SetBatching makes GetBlockBundle send its calls separately instead of as a
+// batch when disabled. Batching is also turned off for good the first time
+// the upstream rejects a batch.
+func (c *Client) SetBatching(enabled bool) {
+	c.noBatch.Store(!enabled)
+}
+
+// GetBlockBundle fetches a block's header, logs and, with receipts, its
+// receipts in a single batch, or in concurrent calls when batching is off.
+// err is set when the header can't be fetched.
+func (c *Client) GetBlockBundle(ctx context.Context, blockNum string, receipts bool) (*BlockBundle, error) {
+	if c.noBatch.Load() {
+		return c.getBlockBundleSeparately(ctx, blockNum, receipts)
+	}
+	blockParams, _ := json.Marshal([]interface{}{blockNum, false})
+	logsParams, _ := json.Marshal([]interface{}{map[string]interface{}{"fromBlock": blockNum, "toBlock": blockNum}})
+	reqs := []*Request{
+		{JSONRPC: "2.0", Method: "eth_getBlockByNumber", Params: blockParams},
+		{JSONRPC: "2.0", Method: "eth_getLogs", Params: logsParams},
+	}
+	if receipts && c.BlockReceiptsSupported() {
+		receiptsParams, _ := json.Marshal([]interface{}{blockNum})
+		reqs = append(reqs, &Request{JSONRPC: "2.0", Method: "eth_getBlockReceipts", Params: receiptsParams})
+	}
+
+	responses, err := c.CallBatch(ctx, reqs)
+	if c.batchRejected(err) {
+		return c.getBlockBundleSeparately(ctx, blockNum, receipts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	bundle := &BlockBundle{ReceiptsErr: errReceiptsNotRequested}
+	if bundle.Header, err = decodeFullBlock(responses[0]); err != nil {
+		return nil, err
+	}
+	bundle.Logs, bundle.LogsErr = decodeLogs(responses[1])
+	switch {
+	case !receipts:
+	case len(responses) < 3 || c.blockReceiptsMissing(responses[2]):
+		// Fetched per transaction by the caller, once the header is known good
+		bundle.ReceiptsErr = errBlockReceiptsUnsupported
+	default:
+		bundle.Receipts, bundle.ReceiptsErr = decodeReceipts(responses[2])
+	}
+	return bundle, nil
+}
+
+// batchRejected reports whether err is the upstream rejecting a batch, and
+// turns batching off for good the first time
+func (c *Client) batchRejected(err error) bool {
+	if !errors.Is(err, ErrBatchUnsupported) {
+		return false
+	}
+	if c.noBatch.CompareAndSwap(false, true) {
+		logger.Warn("Upstream %s rejected a batch, sending separate calls from now on: %v", c.host, err)
+	}
+	return true
+}
+
+// getBlockBundleSeparately fetches a block bundle with one call per part
+func (c *Client) getBlockBundleSeparately(ctx context.Context, blockNum string, receipts bool) (*BlockBundle, error) {
+	bundle := &BlockBundle{ReceiptsErr: errReceiptsNotRequested}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		bundle.Logs, bundle.LogsErr = c.GetBlockLogs(ctx, blockNum)
+	}()
+	if receipts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bundle.Receipts, bundle.ReceiptsErr = c.GetBlockReceipts(ctx, blockNum)
+		}()
+	}
+	header, err := c.GetFullBlock(ctx, blockNum)
+	wg.Wait()
+	if err != nil {
+		return nil, err
+	}
+	bundle.Header = header
+	return bundle, nil
+}
@@ -0,0 +1,129 @@
+package rpc
+
+import (
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// DefaultThroughputWindow is the span of block time, in seconds, over which TPS is averaged
+const DefaultThroughputWindow = 60
+
+// BlockStats are per-block transaction and throughput statistics
+type BlockStats struct {
+	TxCount int `json:"txCount"`
+	// GasUtilization is gasUsed as a percentage of gasLimit
+	GasUtilization float64 `json:"gasUtilization"`
+	// TPS is the transaction rate over the recent block time window
+	TPS float64 `json:"tps"`
+}
+
+// throughputSample is the transaction count of one block at its timestamp
+type throughputSample struct {
+	timestamp uint64
+	txCount   int
+}
+
+// ThroughputTracker computes BlockStats for successive blocks, keeping the
+// blocks within the window needed for the rolling TPS
+type ThroughputTracker struct {
+	window  uint64
+	samples []throughputSample
+	mu      sync.Mutex
+}
+
+// NewThroughputTracker creates a tracker averaging TPS over window seconds of block time
+func NewThroughputTracker(window uint64) *ThroughputTracker {
+	if window == 0 {
+		window = DefaultThroughputWindow
+	}
+	return &ThroughputTracker{window: window}
+}
+
+// Observe records a block and returns its stats. Blocks are expected in
+// increasing order; the TPS covers the blocks since the window start.
+func (t *ThroughputTracker) Observe(header *FullBlockHeader) *BlockStats {
+	stats := &BlockStats{TxCount: header.TxCount}
+
+	gasUsed, errUsed := ParseHexUint64(header.GasUsed)
+	gasLimit, errLimit := ParseHexUint64(header.GasLimit)
+	if errUsed == nil && errLimit == nil && gasLimit > 0 {
+		stats.GasUtilization = float64(gasUsed) * 100 / float64(gasLimit)
+	}
+
+	timestamp, err := ParseHexUint64(header.Timestamp)
+	if err != nil {
+		return stats
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.samples = append(t.samples, throughputSample{timestamp: timestamp, txCount: header.TxCount})
+
+	// Drop blocks that fell out of the window
+	start := 0
+	for start < len(t.samples)-1 && timestamp > t.samples[start].timestamp+t.window {
+		start++
+	}
+	t.samples = t.samples[start:]
+
+	// The oldest block opens the window, so its transactions are not counted
+	if oldest := t.samples[0].timestamp; timestamp > oldest {
+		span := timestamp - oldest
+		txs := 0
+		for _, sample := range t.samples[1:] {
+			txs += sample.txCount
+		}
+		stats.TPS = float64(txs) / float64(span)
+	}
+	return stats
+}
+
+// BlockSummary is a blockStats notification: per-block aggregates
+type BlockSummary struct {
+	Number         string  `json:"number"`
+	Hash           string  `json:"hash"`
+	Timestamp      string  `json:"timestamp"`
+	TxCount        int     `json:"txCount"`
+	GasUsed        string  `json:"gasUsed"`
+	GasLimit       string  `json:"gasLimit"`
+	GasUtilization float64 `json:"gasUtilization"`
+	BaseFeePerGas  string  `json:"baseFeePerGas,omitempty"`
+	// AvgEffectiveGasPrice is the mean effective gas price of the block's
+	// receipts, omitted when there are none
+	AvgEffectiveGasPrice string  `json:"avgEffectiveGasPrice,omitempty"`
+	TPS                  float64 `json:"tps"`
+}
+
+// NewBlockSummary aggregates a polled block and its receipts
+func NewBlockSummary(header *FullBlockHeader, receipts []TransactionReceipt) *BlockSummary {
+	summary := &BlockSummary{
+		Number:        header.Number,
+		Hash:          header.Hash,
+		Timestamp:     header.Timestamp,
+		TxCount:       header.TxCount,
+		GasUsed:       header.GasUsed,
+		GasLimit:      header.GasLimit,
+		BaseFeePerGas: header.BaseFeePerGas,
+	}
+	if header.Stats != nil {
+		summary.GasUtilization = header.Stats.GasUtilization
+		summary.TPS = header.Stats.TPS
+	}
+
+	sum := new(big.Int)
+	count := 0
+	for _, receipt := range receipts {
+		price, ok := new(big.Int).SetString(strings.TrimPrefix(receipt.EffectiveGasPrice, "0x"), 16)
+		if !ok {
+			continue
+		}
+		sum.Add(sum, price)
+		count++
+	}
+	if count > 0 {
+		summary.AvgEffectiveGasPrice = "0x" + sum.Div(sum, big.NewInt(int64(count))).Text(16)
+	}
+	return summary
+}
@@ -0,0 +1,149 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+)
+
+// Circuit breaker states, as exported by hlnode_websocket_upstream_circuit_state
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitOpenError is returned instead of calling an upstream whose circuit
+// is open. It matches ErrUpstreamUnavailable.
+type CircuitOpenError struct {
+	// Failures is the number of consecutive failures that opened the circuit
+	Failures int
+	// RetryIn is the time until a trial call is let through
+	RetryIn time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open after %d consecutive failures, retrying in %v", e.Failures, e.RetryIn.Round(time.Second))
+}
+
+func (e *CircuitOpenError) Unwrap() error { return ErrUpstreamUnavailable }
+
+// SetCircuitBreaker makes the client fail calls fast once threshold
+// consecutive calls failed, for cooldown before a trial call is let through.
+// A zero threshold disables the breaker.
+func (c *Client) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	c.breaker.threshold = threshold
+	c.breaker.cooldown = cooldown
+	metrics.UpstreamCircuitState.WithLabelValues(c.host).Set(0)
+}
+
+// CircuitState returns the state of the client's circuit breaker
+func (c *Client) CircuitState() string {
+	return c.breaker.state()
+}
+
+// allowCall checks the breaker before a call is sent upstream
+func (c *Client) allowCall() error {
+	err := c.breaker.allow()
+	if err != nil {
+		metrics.UpstreamCircuitRejectedTotal.WithLabelValues(c.host).Inc()
+		return err
+	}
+	if c.breaker.state() == CircuitHalfOpen {
+		metrics.UpstreamCircuitState.WithLabelValues(c.host).Set(2)
+	}
+	return nil
+}
+
+// recordCall feeds the outcome of a call to the breaker. A call that failed
+// because the caller gave up says nothing about the upstream.
+func (c *Client) recordCall(ctx context.Context, err error) {
+	opened, closed := c.breaker.record(err != nil, err == nil || ctx.Err() == nil)
+	switch {
+	case opened:
+		metrics.UpstreamCircuitOpenedTotal.WithLabelValues(c.host).Inc()
+		metrics.UpstreamCircuitState.WithLabelValues(c.host).Set(1)
+		logger.Warn("Upstream %s circuit open, failing calls fast: %v", c.host, err)
+	case closed:
+		metrics.UpstreamCircuitState.WithLabelValues(c.host).Set(0)
+		logger.Info("Upstream %s circuit closed", c.host)
+	case err != nil && c.breaker.state() != CircuitClosed:
+		// A failed trial call reopened the circuit
+		metrics.UpstreamCircuitState.WithLabelValues(c.host).Set(1)
+	}
+}
+
+// breaker opens after a run of consecutive failed calls and rejects calls
+// until the cooldown has passed. Then a single trial call is let through
+// (half-open): its success closes the circuit, its failure reopens it.
+type breaker struct {
+	// threshold is the number of consecutive failures that opens the circuit (0 disables)
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	open      bool
+	trial     bool
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+// allow reports whether a call may proceed; when the circuit is open it
+// returns the error to fail the call with
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return nil
+	}
+	if wait := b.cooldown - b.now().Sub(b.openedAt); wait > 0 || b.trial {
+		return &CircuitOpenError{Failures: b.failures, RetryIn: max(wait, 0)}
+	}
+	b.trial = true
+	return nil
+}
+
+// record accounts the outcome of a call let through by allow. Calls that
+// didn't reach a verdict (the caller gave up) release the trial slot only.
+func (b *breaker) record(failed, counted bool) (opened, closed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasTrial := b.trial
+	b.trial = false
+	if !counted {
+		return false, false
+	}
+	if !failed {
+		closed = b.open
+		b.open = false
+		b.failures = 0
+		return false, closed
+	}
+	b.failures++
+	if b.threshold > 0 && (wasTrial || (!b.open && b.failures >= b.threshold)) {
+		b.openedAt = b.now()
+		opened = !b.open
+		b.open = true
+	}
+	return opened, false
+}
+
+// state returns the circuit state name
+func (b *breaker) state() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case !b.open:
+		return CircuitClosed
+	case b.trial || b.now().Sub(b.openedAt) >= b.cooldown:
+		return CircuitHalfOpen
+	default:
+		return CircuitOpen
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,40 +17,87 @@ import (
 type Client struct {
 	httpClient *http.Client
 	rpcURL     string
+	// host labels the upstream in logs and metrics
+	host    string
+	status  upstreamStatus
+	probe   probeState
+	breaker breaker
+	retry   retryPolicy
+	limiter *rateLimiter
+	timeout time.Duration
+	lanes   *lanes
+	// transportOpts tune the connection pools, kept to create the fast lane's
+	transportOpts TransportOptions
+	// noBatch makes GetBlockBundle send separate calls
+	noBatch atomic.Bool
+	// receiptsAuto stops using eth_getBlockReceipts once the upstream reports
+	// it missing; noBlockReceipts fetches receipts per transaction
+	receiptsAuto    bool
+	noBlockReceipts atomic.Bool
+	// lookupHost resolves the upstream hostname, replaced in tests
+	lookupHost func(ctx context.Context, host string) ([]string, error)
 }
 
+// DefaultTimeout caps upstream calls when no other budget applies
+const DefaultTimeout = 30 * time.Second
+
 // NewClient creates a new RPC client
 func NewClient(rpcURL string) *Client {
-	return &Client{
+	c := &Client{
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Transport: newTransport(rpcURL, TransportOptions{}),
 		},
-		rpcURL: rpcURL,
+		rpcURL:  rpcURL,
+		host:    "(unset)",
+		breaker: breaker{now: time.Now},
+		timeout: DefaultTimeout,
+
+		receiptsAuto: true,
+		lookupHost:   net.DefaultResolver.LookupHost,
+	}
+	if u, err := url.Parse(rpcURL); err == nil && u.Host != "" {
+		c.host = u.Host
+	} else if rpcURL != "" {
+		c.host = rpcURL
+	}
+	if rpcURL == "" {
+		c.status.set(false, "RPC_URL is not set")
+	} else {
+		c.status.set(true, "")
 	}
+	return c
 }
 
-// Call makes a JSON-RPC call to the upstream server
-func (c *Client) Call(ctx context.Context, req *Request) (*Response, error) {
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+// SetTimeout sets the cap applied to every upstream call
+func (c *Client) SetTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		c.timeout = timeout
 	}
+}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.rpcURL, bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+// withDeadline derives the upstream deadline from the caller's remaining
+// budget, capped by the client timeout
+func (c *Client) withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= c.timeout {
+		return context.WithCancel(ctx)
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
+	return context.WithTimeout(ctx, c.timeout)
+}
 
-	resp, err := c.httpClient.Do(httpReq)
+// Call makes a JSON-RPC call to the upstream server
+func (c *Client) Call(ctx context.Context, req *Request) (*Response, error) {
+	if !c.Ready() {
+		return nil, ErrUpstreamUnavailable
+	}
+
+	body, err := json.Marshal(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err := c.post(ctx, body, IsIdempotent(req.Method), MethodLane(req.Method))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, err
 	}
 
 	var rpcResp Response
@@ -60,19 +110,55 @@ func (c *Client) Call(ctx context.Context, req *Request) (*Response, error) {
 
 // CallRaw forwards raw JSON bytes and returns raw response bytes
 func (c *Client) CallRaw(ctx context.Context, body []byte) ([]byte, error) {
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.rpcURL, bytes.NewReader(body))
+	if !c.Ready() {
+		return nil, ErrUpstreamUnavailable
+	}
+	return c.post(ctx, body, rawIdempotent(body), rawLane(body))
+}
+
+// attempt sends a JSON-RPC body once in its lane through the circuit
+// breaker and returns the response body and HTTP status. Transport errors
+// and 5xx statuses count as failures.
+func (c *Client) attempt(ctx context.Context, body []byte, lane string) ([]byte, int, error) {
+	callCtx, cancel := c.withDeadline(ctx)
+	defer cancel()
+
+	release, err := c.acquireLane(callCtx, lane)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+	if err := c.waitRateLimit(callCtx); err != nil {
+		return nil, 0, err
+	}
+	if err := c.allowCall(); err != nil {
+		return nil, 0, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(callCtx, "POST", c.rpcURL, bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		c.breaker.record(false, false)
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.httpClientFor(lane).Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		err = fmt.Errorf("failed to send request: %w", err)
+		c.recordCall(ctx, err)
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("failed to read response: %w", err)
+	} else if resp.StatusCode >= http.StatusInternalServerError {
+		c.recordCall(ctx, fmt.Errorf("upstream status %d", resp.StatusCode))
+		return respBody, resp.StatusCode, nil
+	}
+	c.recordCall(ctx, err)
+	return respBody, resp.StatusCode, err
 }
 
 // GetBlockNumber fetches the latest block number
@@ -115,7 +201,11 @@ func (c *Client) GetFullBlock(ctx context.Context, blockNum string) (*FullBlockH
 	if err != nil {
 		return nil, err
 	}
+	return decodeFullBlock(resp)
+}
 
+// decodeFullBlock decodes an eth_getBlockByNumber response; a missing block is nil
+func decodeFullBlock(resp *Response) (*FullBlockHeader, error) {
 	if resp.Error != nil {
 		return nil, fmt.Errorf("RPC error: %s", resp.Error.Message)
 	}
@@ -129,6 +219,13 @@ func (c *Client) GetFullBlock(ctx context.Context, blockNum string) (*FullBlockH
 		return nil, fmt.Errorf("failed to unmarshal block: %w", err)
 	}
 
+	var body struct {
+		Transactions []json.RawMessage `json:"transactions"`
+	}
+	if err := json.Unmarshal(resp.Result, &body); err == nil {
+		header.TxCount = len(body.Transactions)
+	}
+
 	return &header, nil
 }
 
@@ -146,6 +243,51 @@ func (c *Client) GetBlockLogs(ctx context.Context, blockNum string) ([]Log, erro
 		ID:      json.RawMessage("1"),
 	}
 
+	resp, err := c.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return decodeLogs(resp)
+}
+
+// decodeLogs decodes an eth_getLogs response
+func decodeLogs(resp *Response) ([]Log, error) {
+	if resp.Error != nil {
+		return nil, fmt.Errorf("RPC error: %s", resp.Error.Message)
+	}
+
+	if resp.Result == nil || string(resp.Result) == "null" {
+		return nil, nil
+	}
+
+	var logs []Log
+	if err := json.Unmarshal(resp.Result, &logs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal logs: %w", err)
+	}
+
+	return logs, nil
+}
+
+// GetLogs fetches logs matching an address/topics filter over a block range
+func (c *Client) GetLogs(ctx context.Context, fromBlock, toBlock string, addresses []string, topics [][]string) ([]Log, error) {
+	filter := map[string]interface{}{
+		"fromBlock": fromBlock,
+		"toBlock":   toBlock,
+	}
+	if len(addresses) > 0 {
+		filter["address"] = addresses
+	}
+	if len(topics) > 0 {
+		filter["topics"] = topics
+	}
+	params, _ := json.Marshal([]interface{}{filter})
+	req := &Request{
+		JSONRPC: "2.0",
+		Method:  "eth_getLogs",
+		Params:  params,
+		ID:      json.RawMessage("1"),
+	}
+
 	resp, err := c.Call(ctx, req)
 	if err != nil {
 		return nil, err
@@ -193,6 +335,37 @@ func (c *Client) GetGasPrice(ctx context.Context) (string, error) {
 	return gasPrice, nil
 }
 
+// GetFeeHistory fetches the base fees, gas used ratios and, for each of
+// rewardPercentiles, the priority fee of the blockCount blocks up to newestBlock
+func (c *Client) GetFeeHistory(ctx context.Context, blockCount uint64, newestBlock string, rewardPercentiles []float64) (*FeeHistory, error) {
+	if rewardPercentiles == nil {
+		rewardPercentiles = []float64{}
+	}
+	params, _ := json.Marshal([]interface{}{FormatHexUint64(blockCount), newestBlock, rewardPercentiles})
+	req := &Request{
+		JSONRPC: "2.0",
+		Method:  "eth_feeHistory",
+		Params:  params,
+		ID:      json.RawMessage("1"),
+	}
+
+	resp, err := c.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Error != nil {
+		return nil, fmt.Errorf("RPC error: %s", resp.Error.Message)
+	}
+
+	var history FeeHistory
+	if err := json.Unmarshal(resp.Result, &history); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fee history: %w", err)
+	}
+
+	return &history, nil
+}
+
 // GetBigBlockGasPrice fetches the big block gas price (Hyperliquid custom)
 func (c *Client) GetBigBlockGasPrice(ctx context.Context) (string, error) {
 	req := &Request{
@@ -220,8 +393,12 @@ func (c *Client) GetBigBlockGasPrice(ctx context.Context) (string, error) {
 	return gasPrice, nil
 }
 
-// GetBlockReceipts fetches all transaction receipts for a block
+// GetBlockReceipts fetches all transaction receipts for a block, with
+// eth_getBlockReceipts unless the upstream doesn't support it
 func (c *Client) GetBlockReceipts(ctx context.Context, blockNum string) ([]TransactionReceipt, error) {
+	if c.noBlockReceipts.Load() {
+		return c.getReceiptsByTransaction(ctx, blockNum)
+	}
 	params, _ := json.Marshal([]interface{}{blockNum})
 	req := &Request{
 		JSONRPC: "2.0",
@@ -234,7 +411,43 @@ func (c *Client) GetBlockReceipts(ctx context.Context, blockNum string) ([]Trans
 	if err != nil {
 		return nil, err
 	}
+	if c.blockReceiptsMissing(resp) {
+		return c.getReceiptsByTransaction(ctx, blockNum)
+	}
+	return decodeReceipts(resp)
+}
+
+// GetTransactionReceipt fetches the receipt of a transaction, or nil if it
+// isn't mined yet
+func (c *Client) GetTransactionReceipt(ctx context.Context, hash string) (*TransactionReceipt, error) {
+	params, _ := json.Marshal([]string{hash})
+	req := &Request{
+		JSONRPC: "2.0",
+		Method:  "eth_getTransactionReceipt",
+		Params:  params,
+		ID:      json.RawMessage("1"),
+	}
+
+	resp, err := c.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("RPC error: %s", resp.Error.Message)
+	}
+	if resp.Result == nil || string(resp.Result) == "null" {
+		return nil, nil
+	}
+
+	var receipt TransactionReceipt
+	if err := json.Unmarshal(resp.Result, &receipt); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal receipt: %w", err)
+	}
+	return &receipt, nil
+}
 
+// decodeReceipts decodes an eth_getBlockReceipts response
+func decodeReceipts(resp *Response) ([]TransactionReceipt, error) {
 	if resp.Error != nil {
 		return nil, fmt.Errorf("RPC error: %s", resp.Error.Message)
 	}
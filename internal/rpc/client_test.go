@@ -3,9 +3,21 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestClientCall(t *testing.T) {
@@ -104,6 +116,64 @@ func TestClientGetBlockNumber(t *testing.T) {
 	}
 }
 
+func TestClientGetFeeHistory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if req.Method != "eth_feeHistory" || string(req.Params) != `["0x5","latest",[25,75]]` {
+			t.Errorf("Unexpected request: %s %s", req.Method, req.Params)
+		}
+
+		resp := Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+		}
+		resp.Result = json.RawMessage(`{"oldestBlock":"0x10","baseFeePerGas":["0x1","0x2"],"gasUsedRatio":[0.5],"reward":[["0x1","0x2"]]}`)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	history, err := client.GetFeeHistory(context.Background(), 5, "latest", []float64{25, 75})
+	if err != nil {
+		t.Fatalf("GetFeeHistory failed: %v", err)
+	}
+
+	if history.OldestBlock != "0x10" || len(history.BaseFeePerGas) != 2 || len(history.Reward) != 1 {
+		t.Errorf("Unexpected fee history: %+v", history)
+	}
+}
+
+func TestClientGetTransactionCount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if req.Method != "eth_getTransactionCount" || string(req.Params) != `["0xwallet","0x10"]` {
+			t.Errorf("Unexpected request: %s %s", req.Method, req.Params)
+		}
+
+		resp := Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+		}
+		resp.Result = json.RawMessage(`"0x7"`)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	nonce, err := client.GetTransactionCount(context.Background(), "0xwallet", "0x10")
+	if err != nil || nonce != "0x7" {
+		t.Errorf("Expected nonce 0x7, got %q (%v)", nonce, err)
+	}
+}
+
 func TestClientGetFullBlock(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req Request
@@ -211,3 +281,1043 @@ func TestNewErrorResponse(t *testing.T) {
 		t.Errorf("Expected message 'Invalid request', got '%s'", resp.Error.Message)
 	}
 }
+
+func TestClientGetLogs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var params []map[string]interface{}
+		json.Unmarshal(req.Params, &params)
+		if len(params) != 1 || params[0]["fromBlock"] != "0x10" || params[0]["toBlock"] != "0x20" {
+			t.Errorf("Unexpected params: %s", req.Params)
+		}
+		topics := params[0]["topics"].([]interface{})
+		if topics[1] != nil {
+			t.Errorf("Expected null wildcard topic, got %v", topics[1])
+		}
+
+		resp := Response{
+			JSONRPC: "2.0",
+			ID:      req.ID,
+		}
+		resp.Result, _ = json.Marshal([]Log{{Address: "0xcontract", BlockNumber: "0x11"}})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	logs, err := client.GetLogs(context.Background(), "0x10", "0x20", []string{"0xcontract"}, [][]string{{"0xtopic"}, nil})
+	if err != nil {
+		t.Fatalf("GetLogs failed: %v", err)
+	}
+
+	if len(logs) != 1 || logs[0].BlockNumber != "0x11" {
+		t.Errorf("Unexpected logs: %+v", logs)
+	}
+}
+
+func TestClientUpstreamUnset(t *testing.T) {
+	client := NewClient("")
+
+	if client.Ready() {
+		t.Fatal("Client without RPC URL should not be ready")
+	}
+
+	_, err := client.Call(context.Background(), &Request{JSONRPC: "2.0", Method: "eth_chainId"})
+	if err != ErrUpstreamUnavailable {
+		t.Errorf("Expected ErrUpstreamUnavailable, got %v", err)
+	}
+
+	if _, err := client.CheckUpstream(context.Background()); err == nil {
+		t.Error("CheckUpstream should fail without RPC URL")
+	}
+	if _, reason := client.Status(); reason != "RPC_URL is not set" {
+		t.Errorf("Unexpected reason: %s", reason)
+	}
+}
+
+func TestClientCheckUpstream(t *testing.T) {
+	client := NewClient("http://127.0.0.1:8545")
+
+	changed, err := client.CheckUpstream(context.Background())
+	if err != nil {
+		t.Fatalf("CheckUpstream failed for IP literal: %v", err)
+	}
+	if changed {
+		t.Error("Status should not change for an already ready client")
+	}
+
+	client = NewClient("http://upstream.invalid:8545")
+	if _, err := client.CheckUpstream(context.Background()); err == nil {
+		t.Fatal("Expected resolution failure for .invalid host")
+	}
+	if client.Ready() {
+		t.Error("Client should not be ready after failed resolution")
+	}
+}
+
+func TestClientLookupUpstreamReresolves(t *testing.T) {
+	client := NewClient("http://upstream.example:8545")
+
+	var mu sync.Mutex
+	addrs := []string{"10.0.0.2", "10.0.0.1"}
+	client.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if host != "upstream.example" {
+			t.Errorf("Unexpected host lookup: %s", host)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), addrs...), nil
+	}
+
+	got, err := client.LookupUpstream(context.Background())
+	if err != nil {
+		t.Fatalf("LookupUpstream failed: %v", err)
+	}
+	if strings.Join(got, ",") != "10.0.0.1,10.0.0.2" {
+		t.Errorf("Expected sorted addresses, got %v", got)
+	}
+
+	mu.Lock()
+	addrs = []string{"10.0.0.3"}
+	mu.Unlock()
+
+	got, err = client.LookupUpstream(context.Background())
+	if err != nil {
+		t.Fatalf("LookupUpstream failed: %v", err)
+	}
+	if strings.Join(got, ",") != "10.0.0.3" {
+		t.Errorf("Expected the new address after the record changed, got %v", got)
+	}
+
+	client.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		t.Error("IP literal should not be resolved")
+		return nil, nil
+	}
+	client.rpcURL = "http://127.0.0.1:8545"
+	got, err = client.LookupUpstream(context.Background())
+	if err != nil || strings.Join(got, ",") != "127.0.0.1" {
+		t.Errorf("Expected the IP literal itself, got %v (%v)", got, err)
+	}
+}
+
+func TestClientCloseIdleConnections(t *testing.T) {
+	var dials atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	call := func() {
+		t.Helper()
+		if _, err := client.GetBlockNumber(context.Background()); err != nil {
+			t.Fatalf("GetBlockNumber failed: %v", err)
+		}
+	}
+
+	call()
+	call()
+	if n := dials.Load(); n != 1 {
+		t.Fatalf("Expected the pooled connection to be reused, got %d connections", n)
+	}
+
+	client.CloseIdleConnections()
+	call()
+	if n := dials.Load(); n != 2 {
+		t.Errorf("Expected a new connection after recycling, got %d connections", n)
+	}
+}
+
+func TestClientTimeoutCap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.SetTimeout(50 * time.Millisecond)
+
+	_, err := client.Call(context.Background(), &Request{JSONRPC: "2.0", Method: "eth_chainId", ID: json.RawMessage("1")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestClientProbe(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	if !client.ProbeStatus().Healthy {
+		t.Error("Ready client should be healthy before the first probe")
+	}
+
+	if _, err := client.Probe(context.Background()); err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if status := client.ProbeStatus(); !status.Healthy || status.LastProbe.IsZero() {
+		t.Errorf("Expected healthy probe status, got %+v", status)
+	}
+
+	failing.Store(true)
+	for i := 0; i < ProbeFailureThreshold; i++ {
+		if _, err := client.Probe(context.Background()); err == nil {
+			t.Fatal("Expected probe error")
+		}
+		if healthy := client.ProbeStatus().Healthy; healthy != (i < ProbeFailureThreshold-1) {
+			t.Errorf("Unexpected health after %d failures: %v", i+1, healthy)
+		}
+	}
+
+	failing.Store(false)
+	client.Probe(context.Background())
+	if status := client.ProbeStatus(); !status.Healthy || status.ConsecutiveFailures != 0 {
+		t.Errorf("Expected recovery after successful probe, got %+v", status)
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}`))
+	}))
+	defer server.Close()
+
+	now := time.Unix(1700000000, 0)
+	client := NewClient(server.URL)
+	client.SetCircuitBreaker(3, 10*time.Second)
+	client.breaker.now = func() time.Time { return now }
+	req := &Request{JSONRPC: "2.0", Method: "eth_chainId", ID: json.RawMessage("1")}
+
+	failing.Store(true)
+	for i := 0; i < 3; i++ {
+		if _, err := client.Call(context.Background(), req); err == nil {
+			t.Fatal("Expected call error")
+		}
+	}
+	if state := client.CircuitState(); state != CircuitOpen {
+		t.Fatalf("Expected open circuit after 3 failures, got %s", state)
+	}
+
+	_, err := client.Call(context.Background(), req)
+	var open *CircuitOpenError
+	if !errors.As(err, &open) || !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("Expected circuit open error, got %v", err)
+	}
+	if open.Failures != 3 || open.RetryIn != 10*time.Second {
+		t.Errorf("Unexpected circuit open error: %+v", open)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("Open circuit reached the upstream: %d calls", n)
+	}
+
+	// A failed trial call reopens the circuit
+	now = now.Add(10 * time.Second)
+	if state := client.CircuitState(); state != CircuitHalfOpen {
+		t.Fatalf("Expected half-open circuit after cooldown, got %s", state)
+	}
+	if _, err := client.Call(context.Background(), req); errors.As(err, &open) {
+		t.Fatal("Expected the trial call to reach the upstream")
+	}
+	if _, err := client.CallRaw(context.Background(), []byte(`{}`)); !errors.As(err, &open) {
+		t.Errorf("Expected circuit reopened after a failed trial, got %v", err)
+	}
+
+	// A successful trial call closes it
+	now = now.Add(10 * time.Second)
+	failing.Store(false)
+	if _, err := client.Call(context.Background(), req); err != nil {
+		t.Fatalf("Trial call failed: %v", err)
+	}
+	if state := client.CircuitState(); state != CircuitClosed {
+		t.Errorf("Expected closed circuit after a successful trial, got %s", state)
+	}
+}
+
+func TestClientCircuitBreakerIgnoresCanceledCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.SetCircuitBreaker(1, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.Call(ctx, &Request{JSONRPC: "2.0", Method: "eth_chainId", ID: json.RawMessage("1")}); err == nil {
+		t.Fatal("Expected canceled call error")
+	}
+	if state := client.CircuitState(); state != CircuitClosed {
+		t.Errorf("A call the caller gave up on opened the circuit: %s", state)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls, failures atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failures.Add(-1) >= 0 {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.SetRetries(2, time.Millisecond, 5*time.Millisecond)
+
+	failures.Store(2)
+	resp, err := client.Call(context.Background(), &Request{JSONRPC: "2.0", Method: "eth_chainId", ID: json.RawMessage("1")})
+	if err != nil || resp.Error != nil || calls.Load() != 3 {
+		t.Errorf("Expected success on the third attempt, got %v after %d calls", err, calls.Load())
+	}
+
+	// A send that reached the upstream is never repeated
+	calls.Store(0)
+	failures.Store(1)
+	client.CallRaw(context.Background(), []byte(`{"jsonrpc":"2.0","method":"eth_sendRawTransaction","params":["0x00"],"id":1}`))
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected a single send attempt, got %d", n)
+	}
+
+	// Retries give up after the configured count
+	calls.Store(0)
+	failures.Store(10)
+	client.CallRaw(context.Background(), []byte(`[{"jsonrpc":"2.0","method":"eth_blockNumber","id":1}]`))
+	if n := calls.Load(); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.SetCircuitBreaker(1, time.Minute)
+	client.SetRateLimit(1, 2, 0)
+	now := time.Now()
+	client.limiter.now = func() time.Time { return now }
+	client.limiter.last = now
+
+	call := func() error {
+		_, err := client.Call(context.Background(), &Request{JSONRPC: "2.0", Method: "eth_chainId", ID: json.RawMessage("1")})
+		return err
+	}
+
+	// The burst passes, then calls fail until a token is refilled
+	for i := 0; i < 2; i++ {
+		if err := call(); err != nil {
+			t.Fatalf("Expected call %d within the burst to succeed, got %v", i, err)
+		}
+	}
+	var limited *RateLimitedError
+	if err := call(); !errors.As(err, &limited) || !errors.Is(err, ErrRateLimited) || limited.RetryIn != time.Second {
+		t.Fatalf("Expected a rate limit error retrying in 1s, got %v", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected refused calls not to reach the upstream, got %d calls", n)
+	}
+	if state := client.CircuitState(); state != CircuitClosed {
+		t.Errorf("Expected refused calls not to count towards the breaker, got %s", state)
+	}
+	now = now.Add(time.Second)
+	if err := call(); err != nil {
+		t.Errorf("Expected a call after the refill to succeed, got %v", err)
+	}
+
+	// Within the bounded wait, calls wait for their turn
+	client.SetRateLimit(100, 1, time.Second)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := call(); err != nil {
+			t.Fatalf("Expected call %d to wait for a token, got %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("Expected calls beyond the burst to be delayed, took %v", elapsed)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}
+	reset := &net.OpError{Op: "read", Err: syscall.ECONNRESET}
+	tests := []struct {
+		status     int
+		err        error
+		idempotent bool
+		want       bool
+	}{
+		{http.StatusOK, nil, true, false},
+		{http.StatusServiceUnavailable, nil, true, true},
+		{http.StatusServiceUnavailable, nil, false, false},
+		{http.StatusInternalServerError, nil, true, false},
+		{0, fmt.Errorf("failed to send request: %w", dial), false, true},
+		{0, fmt.Errorf("failed to send request: %w", reset), true, true},
+		{0, fmt.Errorf("failed to send request: %w", reset), false, false},
+		{0, fmt.Errorf("failed to send request: %w", context.DeadlineExceeded), true, false},
+		{0, &CircuitOpenError{Failures: 5}, true, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.status, tt.err, tt.idempotent); got != tt.want {
+			t.Errorf("retryable(%d, %v, %v) = %v, want %v", tt.status, tt.err, tt.idempotent, got, tt.want)
+		}
+	}
+
+	if !IsIdempotent("eth_call") || IsIdempotent("eth_sendRawTransaction") || IsIdempotent("eth_newFilter") {
+		t.Error("Unexpected method idempotency")
+	}
+	if !rawIdempotent([]byte(`[{"method":"eth_call"},{"method":"eth_getBalance"}]`)) ||
+		rawIdempotent([]byte(`[{"method":"eth_call"},{"method":"eth_sendRawTransaction"}]`)) ||
+		rawIdempotent([]byte(`not json`)) {
+		t.Error("Unexpected batch idempotency")
+	}
+}
+
+func TestThroughputTracker(t *testing.T) {
+	tracker := NewThroughputTracker(10)
+
+	stats := tracker.Observe(&FullBlockHeader{Timestamp: "0x64", GasUsed: "0x32", GasLimit: "0x64", TxCount: 4})
+	if stats.TxCount != 4 || stats.GasUtilization != 50 || stats.TPS != 0 {
+		t.Errorf("Unexpected stats for first block: %+v", stats)
+	}
+
+	tracker.Observe(&FullBlockHeader{Timestamp: "0x66", TxCount: 6})
+	stats = tracker.Observe(&FullBlockHeader{Timestamp: "0x68", TxCount: 10})
+	if stats.TPS != 4 {
+		t.Errorf("Expected 16 txs over 4s = 4 TPS, got %v", stats.TPS)
+	}
+
+	// Block 0x64 leaves the 10s window, 0x66 opens it
+	stats = tracker.Observe(&FullBlockHeader{Timestamp: "0x70", TxCount: 2})
+	if stats.TPS != 1.2 {
+		t.Errorf("Expected 12 txs over 10s = 1.2 TPS, got %v", stats.TPS)
+	}
+}
+
+func TestNewBlockSummary(t *testing.T) {
+	header := &FullBlockHeader{
+		Number:        "0x10",
+		GasUsed:       "0x32",
+		GasLimit:      "0x64",
+		BaseFeePerGas: "0x7",
+		TxCount:       3,
+		Stats:         &BlockStats{TxCount: 3, GasUtilization: 50, TPS: 1.5},
+	}
+	summary := NewBlockSummary(header, []TransactionReceipt{
+		{EffectiveGasPrice: "0xa"},
+		{EffectiveGasPrice: "0x14"},
+		{EffectiveGasPrice: "0x1e"},
+	})
+	if summary.TxCount != 3 || summary.GasUtilization != 50 || summary.TPS != 1.5 || summary.BaseFeePerGas != "0x7" {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+	if summary.AvgEffectiveGasPrice != "0x14" {
+		t.Errorf("Expected average effective gas price 0x14, got %s", summary.AvgEffectiveGasPrice)
+	}
+
+	if summary := NewBlockSummary(header, nil); summary.AvgEffectiveGasPrice != "" {
+		t.Errorf("Expected no average without receipts, got %s", summary.AvgEffectiveGasPrice)
+	}
+}
+
+func TestDecodeTopic(t *testing.T) {
+	decoded := DecodeTopic("0xDDF252AD1BE2C89B69C2B068FC378DAA952BA7F163C4A11628F55A4DF523B3EF")
+	if decoded == nil || decoded.Name != "Transfer" || decoded.Signature != "Transfer(address,address,uint256)" {
+		t.Errorf("Unexpected decoded Transfer topic: %+v", decoded)
+	}
+
+	if decoded := DecodeTopic("0x" + strings.Repeat("0", 64)); decoded != nil {
+		t.Errorf("Expected nil for unknown topic, got %+v", decoded)
+	}
+
+	logEntry := &Log{Topics: []string{"0x1c411e9a96e071241c2f21f7726b17ae89e3cab4c78be50e062b03a9fffbbad1"}}
+	if name := logEntry.EventName(); name != "Sync" {
+		t.Errorf("Expected event name Sync, got %q", name)
+	}
+	if name := (&Log{}).EventName(); name != "" {
+		t.Errorf("Expected no event name for a log without topics, got %q", name)
+	}
+}
+
+func TestClassifyTransaction(t *testing.T) {
+	tests := []struct {
+		from       string
+		kind       string
+		tokenIndex string
+	}{
+		{from: HypeSystemAddress, kind: SystemTxHypeDeposit},
+		{from: "0x2000000000000000000000000000000000000000", kind: SystemTxTokenDeposit, tokenIndex: "0x0"},
+		{from: "0x20000000000000000000000000000000000000C8", kind: SystemTxTokenDeposit, tokenIndex: "0xc8"},
+		{from: "0x2000000000000000000000010000000000000001"},
+		{from: "0x1234567890123456789012345678901234567890"},
+	}
+
+	for _, tt := range tests {
+		systemTx, ok := ClassifyTransaction(&Transaction{Hash: "0xtx", From: tt.from})
+		if tt.kind == "" {
+			if ok {
+				t.Errorf("%s: expected a regular transaction, got %+v", tt.from, systemTx)
+			}
+			continue
+		}
+		if !ok || systemTx.Kind != tt.kind || systemTx.TokenIndex != tt.tokenIndex {
+			t.Errorf("%s: expected %s (token %q), got %+v", tt.from, tt.kind, tt.tokenIndex, systemTx)
+		}
+	}
+}
+
+func TestChainTracker(t *testing.T) {
+	tracker := NewChainTracker(10)
+	canonical := map[string]*FullBlockHeader{
+		"0x2": {Number: "0x2", Hash: "0xb2", ParentHash: "0xa1"},
+		"0x3": {Number: "0x3", Hash: "0xb3", ParentHash: "0xb2"},
+	}
+	fetch := func(ctx context.Context, blockNum string) (*FullBlockHeader, error) {
+		return canonical[blockNum], nil
+	}
+
+	for _, header := range []*FullBlockHeader{
+		{Number: "0x1", Hash: "0xa1", ParentHash: "0xa0"},
+		{Number: "0x2", Hash: "0xa2", ParentHash: "0xa1"},
+		{Number: "0x3", Hash: "0xa3", ParentHash: "0xa2"},
+	} {
+		if reorg := tracker.Observe(context.Background(), header, fetch); reorg != nil {
+			t.Fatalf("Unexpected reorg at %s: %+v", header.Number, reorg)
+		}
+	}
+
+	// Block 4 builds on a different block 3 and 2, which share block 1
+	reorg := tracker.Observe(context.Background(), &FullBlockHeader{Number: "0x4", Hash: "0xb4", ParentHash: "0xb3"}, fetch)
+	if reorg == nil {
+		t.Fatal("Expected a reorg")
+	}
+	if reorg.Depth != "0x2" || len(reorg.ReplacedBlocks) != 2 {
+		t.Fatalf("Expected 2 replaced blocks, got %+v", reorg)
+	}
+	if reorg.ReplacedBlocks[0] != (BlockRef{Number: "0x3", Hash: "0xa3"}) || reorg.ReplacedBlocks[1] != (BlockRef{Number: "0x2", Hash: "0xa2"}) {
+		t.Errorf("Unexpected replaced blocks: %+v", reorg.ReplacedBlocks)
+	}
+	if reorg.CommonAncestor == nil || *reorg.CommonAncestor != (BlockRef{Number: "0x1", Hash: "0xa1"}) {
+		t.Errorf("Expected common ancestor 0x1, got %+v", reorg.CommonAncestor)
+	}
+
+	// The canonical hashes are recorded, so the next block is not a reorg
+	if reorg := tracker.Observe(context.Background(), &FullBlockHeader{Number: "0x5", Hash: "0xb5", ParentHash: "0xb4"}, fetch); reorg != nil {
+		t.Errorf("Unexpected reorg after recovery: %+v", reorg)
+	}
+}
+
+func TestHeadGuard(t *testing.T) {
+	var heads HeadGuard
+
+	for _, head := range []uint64{10, 11} {
+		if !heads.Check(head) {
+			t.Fatalf("Head %d should be accepted", head)
+		}
+		heads.Accept(head)
+	}
+
+	// After a switch to a lagging upstream, lower and repeated heads are suppressed
+	for _, head := range []uint64{9, 10, 11} {
+		if heads.Check(head) {
+			t.Errorf("Head %d should be suppressed after 11", head)
+		}
+	}
+	if !heads.Behind() {
+		t.Error("Guard should report the upstream as behind")
+	}
+
+	if !heads.Check(12) {
+		t.Fatal("Head 12 should be accepted once the upstream catches up")
+	}
+	if heads.Behind() {
+		t.Error("Guard should no longer report the upstream as behind")
+	}
+	heads.Accept(12)
+
+	// A head that is fetched but not broadcast does not advance the guard
+	if !heads.Check(13) || !heads.Check(13) {
+		t.Error("Head 13 should be accepted until it is broadcast")
+	}
+}
+
+func TestDecodeTokenTransfers(t *testing.T) {
+	word := func(n int) string { return fmt.Sprintf("%064x", n) }
+	from := "0x000000000000000000000000" + strings.Repeat("a", 40)
+	to := "0x000000000000000000000000" + strings.Repeat("b", 40)
+	operator := "0x000000000000000000000000" + strings.Repeat("c", 40)
+
+	tests := []struct {
+		name     string
+		log      Log
+		expected []TokenTransfer
+	}{
+		{
+			name:     "erc20",
+			log:      Log{Address: "0xTOKEN", Topics: []string{TransferEventTopic, from, to}, Data: "0x" + word(1000)},
+			expected: []TokenTransfer{{Standard: TokenStandardERC20, Token: "0xtoken", From: "0x" + strings.Repeat("a", 40), To: "0x" + strings.Repeat("b", 40), Amount: "0x3e8"}},
+		},
+		{
+			name:     "erc721",
+			log:      Log{Address: "0xnft", Topics: []string{TransferEventTopic, from, to, "0x" + word(7)}, Data: "0x"},
+			expected: []TokenTransfer{{Standard: TokenStandardERC721, Token: "0xnft", From: "0x" + strings.Repeat("a", 40), To: "0x" + strings.Repeat("b", 40), TokenID: "0x7"}},
+		},
+		{
+			name:     "erc1155 single",
+			log:      Log{Address: "0xmulti", Topics: []string{TransferSingleEventTopic, operator, from, to}, Data: "0x" + word(5) + word(2)},
+			expected: []TokenTransfer{{Standard: TokenStandardERC1155, Token: "0xmulti", From: "0x" + strings.Repeat("a", 40), To: "0x" + strings.Repeat("b", 40), Operator: "0x" + strings.Repeat("c", 40), TokenID: "0x5", Amount: "0x2"}},
+		},
+		{
+			name: "erc1155 batch",
+			log: Log{Address: "0xmulti", Topics: []string{TransferBatchEventTopic, operator, from, to},
+				Data: "0x" + word(64) + word(160) + word(2) + word(1) + word(2) + word(2) + word(10) + word(20)},
+			expected: []TokenTransfer{
+				{Standard: TokenStandardERC1155, Token: "0xmulti", From: "0x" + strings.Repeat("a", 40), To: "0x" + strings.Repeat("b", 40), Operator: "0x" + strings.Repeat("c", 40), TokenID: "0x1", Amount: "0xa"},
+				{Standard: TokenStandardERC1155, Token: "0xmulti", From: "0x" + strings.Repeat("a", 40), To: "0x" + strings.Repeat("b", 40), Operator: "0x" + strings.Repeat("c", 40), TokenID: "0x2", Amount: "0x14"},
+			},
+		},
+		{
+			name: "batch with out of bounds offset",
+			log:  Log{Topics: []string{TransferBatchEventTopic, operator, from, to}, Data: "0x" + word(4096) + word(64)},
+		},
+		{
+			// offset+32 wraps around to 31
+			name: "batch with an offset near 2^64",
+			log:  Log{Topics: []string{TransferBatchEventTopic, operator, from, to}, Data: "0x" + strings.Repeat("0", 48) + strings.Repeat("f", 16) + word(64) + word(0)},
+		},
+		{
+			name: "batch with a huge array length",
+			log:  Log{Topics: []string{TransferBatchEventTopic, operator, from, to}, Data: "0x" + word(64) + word(64) + strings.Repeat("f", 64)},
+		},
+		{
+			name: "erc20 without data",
+			log:  Log{Topics: []string{TransferEventTopic, from, to}, Data: "0x"},
+		},
+		{
+			name: "other event",
+			log:  Log{Topics: []string{"0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925", from, to}, Data: "0x" + word(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		transfers := DecodeTokenTransfers(&tt.log)
+		if len(transfers) != len(tt.expected) {
+			t.Errorf("%s: expected %d transfers, got %+v", tt.name, len(tt.expected), transfers)
+			continue
+		}
+		for i := range transfers {
+			if transfers[i] != tt.expected[i] {
+				t.Errorf("%s: expected %+v, got %+v", tt.name, tt.expected[i], transfers[i])
+			}
+		}
+	}
+}
+
+func TestTouchedAddresses(t *testing.T) {
+	addresses := TouchedAddresses([]Transaction{
+		{From: "0xAAA", To: "0xbbb", Value: "0x0"},
+		{From: "0xaaa", To: "0xCCC", Value: "0xde0b6b3a7640000"},
+		{From: "0xddd", To: "", Value: "0x1"},
+	})
+	expected := []string{"0xaaa", "0xccc", "0xddd"}
+	if len(addresses) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, addresses)
+	}
+	for i := range expected {
+		if addresses[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, addresses)
+		}
+	}
+}
+
+func TestClientTraceValueTransfers(t *testing.T) {
+	supported := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+
+		resp := Response{JSONRPC: "2.0", ID: req.ID}
+		if !supported {
+			resp.Error = &Error{Code: ErrCodeMethodNotFound, Message: "the method debug_traceBlockByNumber does not exist"}
+		} else {
+			resp.Result = json.RawMessage(`[{"result": {"from": "0xsender", "to": "0xcontract", "value": "0x0", "calls": [
+				{"from": "0xcontract", "to": "0xRECIPIENT", "value": "0x64", "calls": [
+					{"from": "0xrecipient", "to": "0xview", "value": "0x0"}
+				]}
+			]}}]`)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	addresses, ok, err := client.TraceValueTransfers(context.Background(), "0x100")
+	if err != nil || !ok {
+		t.Fatalf("TraceValueTransfers failed: ok=%v err=%v", ok, err)
+	}
+	if len(addresses) != 2 || addresses[0] != "0xcontract" || addresses[1] != "0xrecipient" {
+		t.Errorf("Expected the internal value transfer parties, got %v", addresses)
+	}
+
+	supported = false
+	if _, ok, err := client.TraceValueTransfers(context.Background(), "0x100"); ok || err != nil {
+		t.Errorf("Expected unsupported tracing, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestClientSetTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.SetTransport(TransportOptions{MaxIdleConnsPerHost: 256, TLSHandshakeTimeout: 3 * time.Second, DisableKeepAlives: true})
+	transport := client.httpClient.Transport.(*http.Transport)
+	if transport.MaxIdleConnsPerHost != 256 || transport.MaxIdleConns != 256 {
+		t.Errorf("Expected 256 idle connections per host and overall, got %d and %d", transport.MaxIdleConnsPerHost, transport.MaxIdleConns)
+	}
+	if transport.TLSHandshakeTimeout != 3*time.Second || !transport.DisableKeepAlives {
+		t.Errorf("Expected the TLS handshake timeout and keep-alive setting applied, got %v and %v", transport.TLSHandshakeTimeout, transport.DisableKeepAlives)
+	}
+	// Zero fields keep the defaults
+	if transport.IdleConnTimeout != http.DefaultTransport.(*http.Transport).IdleConnTimeout {
+		t.Errorf("Expected the default idle timeout, got %v", transport.IdleConnTimeout)
+	}
+
+	if blockNum, err := client.GetBlockNumber(context.Background()); err != nil || blockNum != "0x1" {
+		t.Errorf("Expected calls through the new transport to work, got %q, %v", blockNum, err)
+	}
+}
+
+func TestClientCallBatch(t *testing.T) {
+	var batches, singles int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if body[0] != '[' {
+			singles++
+			w.Write([]byte(`{"jsonrpc":"2.0","result":[],"id":1}`))
+			return
+		}
+		batches++
+		var reqs []Request
+		json.Unmarshal(body, &reqs)
+		// Answered out of order, as upstreams may
+		var answers []string
+		for i := len(reqs) - 1; i >= 0; i-- {
+			result := `[]`
+			if reqs[i].Method == "eth_getBlockByNumber" {
+				result = `{"number":"0x10","hash":"0xabc","transactions":["0x1","0x2"]}`
+			}
+			answers = append(answers, fmt.Sprintf(`{"jsonrpc":"2.0","result":%s,"id":%s}`, result, reqs[i].ID))
+		}
+		w.Write([]byte("[" + strings.Join(answers, ",") + "]"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	bundle, err := client.GetBlockBundle(context.Background(), "0x10", true)
+	if err != nil {
+		t.Fatalf("GetBlockBundle failed: %v", err)
+	}
+	if batches != 1 || singles != 0 {
+		t.Errorf("Expected one batch, got %d batches and %d calls", batches, singles)
+	}
+	if bundle.Header == nil || bundle.Header.Hash != "0xabc" || bundle.Header.TxCount != 2 {
+		t.Errorf("Expected the header matched to its request, got %+v", bundle.Header)
+	}
+	if bundle.LogsErr != nil || bundle.ReceiptsErr != nil {
+		t.Errorf("Expected logs and receipts, got %v and %v", bundle.LogsErr, bundle.ReceiptsErr)
+	}
+
+	bundle, _ = client.GetBlockBundle(context.Background(), "0x10", false)
+	if bundle.ReceiptsErr == nil {
+		t.Error("Expected no receipts when not requested")
+	}
+}
+
+func TestClientBatchUnsupported(t *testing.T) {
+	var batches, singles atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if body[0] == '[' {
+			batches.Add(1)
+			w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32600,"message":"batch requests are not supported"},"id":null}`))
+			return
+		}
+		singles.Add(1)
+		w.Write([]byte(`{"jsonrpc":"2.0","result":null,"id":1}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	_, err := client.CallBatch(context.Background(), []*Request{{JSONRPC: "2.0", Method: "eth_chainId"}})
+	if !errors.Is(err, ErrBatchUnsupported) {
+		t.Fatalf("Expected ErrBatchUnsupported, got %v", err)
+	}
+
+	// The bundle falls back to separate calls, for good
+	for range 2 {
+		if _, err := client.GetBlockBundle(context.Background(), "0x10", false); err != nil {
+			t.Fatalf("GetBlockBundle failed: %v", err)
+		}
+	}
+	if batches.Load() != 2 || singles.Load() != 4 {
+		t.Errorf("Expected 2 batches then separate calls only, got %d batches and %d calls", batches.Load(), singles.Load())
+	}
+}
+
+func TestClientBlockReceiptsFallback(t *testing.T) {
+	var methods sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var reqs []Request
+		if body[0] == '[' {
+			json.Unmarshal(body, &reqs)
+		} else {
+			var req Request
+			json.Unmarshal(body, &req)
+			reqs = []Request{req}
+		}
+		var answers []string
+		for _, req := range reqs {
+			count, _ := methods.LoadOrStore(req.Method, new(atomic.Int32))
+			count.(*atomic.Int32).Add(1)
+			switch req.Method {
+			case "eth_getBlockReceipts":
+				answers = append(answers, fmt.Sprintf(`{"jsonrpc":"2.0","error":{"code":-32601,"message":"the method eth_getBlockReceipts does not exist/is not available"},"id":%s}`, req.ID))
+			case "eth_getBlockByNumber":
+				answers = append(answers, fmt.Sprintf(`{"jsonrpc":"2.0","result":{"number":"0x10","hash":"0xabc","transactions":["0x1","0x2"]},"id":%s}`, req.ID))
+			case "eth_getTransactionReceipt":
+				var params []string
+				json.Unmarshal(req.Params, &params)
+				answers = append(answers, fmt.Sprintf(`{"jsonrpc":"2.0","result":{"transactionHash":%q,"blockHash":"0xabc"},"id":%s}`, params[0], req.ID))
+			}
+		}
+		if body[0] == '[' {
+			w.Write([]byte("[" + strings.Join(answers, ",") + "]"))
+		} else {
+			w.Write([]byte(answers[0]))
+		}
+	}))
+	defer server.Close()
+	calls := func(method string) int32 {
+		if count, ok := methods.Load(method); ok {
+			return count.(*atomic.Int32).Load()
+		}
+		return 0
+	}
+
+	client := NewClient(server.URL)
+	supported, err := client.ProbeBlockReceipts(context.Background())
+	if err != nil || supported {
+		t.Fatalf("Expected the probe to find eth_getBlockReceipts missing, got %v, %v", supported, err)
+	}
+	for _, batching := range []bool{true, false} {
+		client.SetBatching(batching)
+		receipts, err := client.GetBlockReceipts(context.Background(), "0x10")
+		if err != nil {
+			t.Fatalf("GetBlockReceipts failed: %v", err)
+		}
+		if len(receipts) != 2 || receipts[0].TransactionHash != "0x1" || receipts[1].TransactionHash != "0x2" {
+			t.Errorf("Expected the receipts of both transactions in order, got %+v", receipts)
+		}
+	}
+	if calls("eth_getBlockReceipts") != 1 || calls("eth_getTransactionReceipt") != 4 {
+		t.Errorf("Expected one probe then per-transaction receipts, got %d and %d calls", calls("eth_getBlockReceipts"), calls("eth_getTransactionReceipt"))
+	}
+
+	// Forced on, the error is returned instead
+	forced := NewClient(server.URL)
+	forced.SetBlockReceipts(BlockReceiptsOn)
+	if _, err := forced.GetBlockReceipts(context.Background(), "0x10"); err == nil {
+		t.Error("Expected an error with eth_getBlockReceipts forced on")
+	}
+	if err := forced.SetBlockReceipts("sometimes"); err == nil {
+		t.Error("Expected an invalid mode to be rejected")
+	}
+}
+
+func TestTLSOptionsConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}`))
+	}))
+	defer server.Close()
+
+	if config, err := (TLSOptions{}).Config(); config != nil || err != nil {
+		t.Fatalf("Expected no TLS config for empty options, got %v, %v", config, err)
+	}
+
+	// The test server's certificate is not trusted by the system roots
+	client := NewClient(server.URL)
+	if _, err := client.GetBlockNumber(context.Background()); err == nil {
+		t.Fatal("Expected an unknown authority to fail verification")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := TLSOptions{CAFile: caFile}.Config()
+	if err != nil {
+		t.Fatalf("Config failed: %v", err)
+	}
+	client.SetTransport(TransportOptions{TLSConfig: config})
+	if blockNum, err := client.GetBlockNumber(context.Background()); err != nil || blockNum != "0x1" {
+		t.Errorf("Expected the CA bundle to verify the upstream, got %q, %v", blockNum, err)
+	}
+
+	if _, err := (TLSOptions{CertFile: caFile}).Config(); err == nil {
+		t.Error("Expected a client certificate without key to be rejected")
+	}
+	if _, err := (TLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}).Config(); err == nil {
+		t.Error("Expected a missing CA bundle to be rejected")
+	}
+}
+
+func TestClientIPC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.ipc")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", path, err)
+	}
+	defer listener.Close()
+
+	// Serve like a node: raw JSON requests answered by raw JSON values
+	var conns atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conn.Close()
+				decoder := json.NewDecoder(conn)
+				for {
+					var req json.RawMessage
+					if err := decoder.Decode(&req); err != nil {
+						return
+					}
+					if req[0] == '[' {
+						conn.Write([]byte(`[{"jsonrpc":"2.0","id":1,"result":"0x2"}]` + "\n"))
+					} else {
+						conn.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x2"}` + "\n"))
+					}
+				}
+			}()
+		}
+	}()
+
+	client := NewClient("ipc://" + path)
+	if _, err := client.CheckUpstream(context.Background()); err != nil {
+		t.Fatalf("Expected the socket to be found, got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if blockNum, err := client.GetBlockNumber(context.Background()); err != nil || blockNum != "0x2" {
+			t.Fatalf("Expected block 0x2 over IPC, got %q, %v", blockNum, err)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("Expected sequential calls to reuse one connection, got %d", n)
+	}
+	body, err := client.CallRaw(context.Background(), []byte(`[{"jsonrpc":"2.0","method":"eth_blockNumber","id":1}]`))
+	if err != nil || !strings.HasPrefix(string(body), "[") {
+		t.Errorf("Expected a batch answered over IPC, got %s, %v", body, err)
+	}
+
+	missing := NewClient("ipc://" + filepath.Join(t.TempDir(), "missing.ipc"))
+	if _, err := missing.CheckUpstream(context.Background()); err == nil || missing.Ready() {
+		t.Error("Expected a missing socket to make the upstream unavailable")
+	}
+}
+
+func TestClientLanes(t *testing.T) {
+	for method, lane := range map[string]string{
+		"eth_blockNumber":          LaneFast,
+		"eth_sendRawTransaction":   LaneFast,
+		"eth_getLogs":              LaneHeavy,
+		"debug_traceTransaction":   LaneHeavy,
+		"trace_block":              LaneHeavy,
+		"eth_getTransactionByHash": LaneDefault,
+	} {
+		if got := MethodLane(method); got != lane {
+			t.Errorf("MethodLane(%s) = %s, want %s", method, got, lane)
+		}
+	}
+	if lane := rawLane([]byte(`[{"method":"eth_chainId"},{"method":"eth_getLogs"}]`)); lane != LaneHeavy {
+		t.Errorf("Expected a batch with a heavy call in the heavy lane, got %s", lane)
+	}
+
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Method == "eth_getLogs" {
+			<-unblock
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","result":"0x1","id":1}`))
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	client := NewClient(server.URL)
+	client.SetTransport(TransportOptions{MaxConnsPerHost: 1})
+	client.SetLanes(0, 1, 0)
+
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		client.Call(context.Background(), &Request{JSONRPC: "2.0", Method: "eth_getLogs", ID: json.RawMessage("1")})
+	}()
+	<-started
+	time.Sleep(20 * time.Millisecond)
+
+	// The heavy lane is full and holds the only pooled connection
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Call(ctx, &Request{JSONRPC: "2.0", Method: "eth_getLogs", ID: json.RawMessage("2")}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a second heavy call to wait out its deadline, got %v", err)
+	}
+
+	// Fast calls have their own connections
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if blockNum, err := client.GetBlockNumber(ctx); err != nil || blockNum != "0x1" {
+		t.Errorf("Expected a fast call to go through beside the heavy one, got %q, %v", blockNum, err)
+	}
+}
@@ -0,0 +1,78 @@
+package rpc
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Reason codes of errors originating in the proxy, carried in the error's
+// data object so client SDKs can implement uniform retry logic
+const (
+	// ReasonInvalidRequest: the request is malformed or names an unknown
+	// method or object; retrying it unchanged fails again
+	ReasonInvalidRequest = "invalid_request"
+	// ReasonUnauthorized: the request needs credentials the connection lacks
+	ReasonUnauthorized = "unauthorized"
+	// ReasonUpstreamUnavailable: the upstream can't be reached or its
+	// circuit is open; retry after retryAfter
+	ReasonUpstreamUnavailable = "upstream_unavailable"
+	// ReasonTimeout: the request budget ran out; retry with a larger budget
+	ReasonTimeout = "timeout"
+	// ReasonRateLimited: a quota is exhausted until retryAfter
+	ReasonRateLimited = "rate_limited"
+	// ReasonDraining: the server is shutting down; reconnect, ideally to
+	// another replica
+	ReasonDraining = "draining"
+	// ReasonInternal: the proxy failed unexpectedly; retrying may succeed
+	ReasonInternal = "internal_error"
+)
+
+// DefaultRetryAfter is the retry hint of failures that don't know when they
+// end, such as an unreachable upstream
+const DefaultRetryAfter = time.Second
+
+// ErrorData is the data object of errors originating in the proxy
+type ErrorData struct {
+	Reason string `json:"reason"`
+	// Retryable tells whether the same request may succeed later
+	Retryable bool `json:"retryable"`
+	// RetryAfter is the number of milliseconds to wait before retrying
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+}
+
+// ErrorReason returns the reason code of a proxy error code and whether the
+// request may be retried
+func ErrorReason(code int) (string, bool) {
+	switch code {
+	case ErrCodeUnauthorized:
+		return ReasonUnauthorized, false
+	case ErrCodeUpstreamUnavailable:
+		return ReasonUpstreamUnavailable, true
+	case ErrCodeTimeout:
+		return ReasonTimeout, true
+	case ErrCodeQuotaExceeded:
+		return ReasonRateLimited, true
+	case ErrCodeDraining:
+		return ReasonDraining, true
+	case ErrCodeInternalError:
+		return ReasonInternal, true
+	}
+	return ReasonInvalidRequest, false
+}
+
+// NewProxyErrorResponse creates the response of an error originating in the
+// proxy, with the data object describing how to retry. A positive
+// retryAfter overrides the default hint of the code.
+func NewProxyErrorResponse(id json.RawMessage, code int, message string, retryAfter time.Duration) *Response {
+	reason, retryable := ErrorReason(code)
+	data := &ErrorData{Reason: reason, Retryable: retryable}
+	if retryAfter <= 0 && reason == ReasonUpstreamUnavailable {
+		retryAfter = DefaultRetryAfter
+	}
+	if retryable && retryAfter > 0 {
+		data.RetryAfter = retryAfter.Milliseconds()
+	}
+	resp := NewErrorResponse(id, code, message)
+	resp.Error.Data = data
+	return resp
+}
@@ -0,0 +1,110 @@
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"hlnode-websocket/internal/metrics"
+)
+
+// Hedge winners, the values of the winner label of the hedge wins metric
+const (
+	HedgePrimary = "primary"
+	HedgeBackup  = "hedge"
+)
+
+// SetHedging makes Hedge fire latency-critical calls at a second upstream
+// when the pinned one hasn't answered within delay (0 fires both at once)
+func (b *Balancer) SetHedging(enabled bool, delay time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hedge = enabled
+	b.hedgeDelay = delay
+}
+
+// hedgeTarget returns the healthiest ready upstream other than primary, or
+// nil when hedging is off or there is none
+func (b *Balancer) hedgeTarget(primary *Client) (*Client, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.hedge {
+		return nil, 0
+	}
+	var best *balanced
+	for _, u := range b.upstreams {
+		if u.client != primary && u.weight() > 0 && (best == nil || u.weight() > best.weight()) {
+			best = u
+		}
+	}
+	if best == nil {
+		return nil, 0
+	}
+	return best.client, b.hedgeDelay
+}
+
+// Hedge makes call against primary and, with hedging on, against the
+// healthiest other upstream too once the hedge delay passes or primary fails.
+// The first successful answer wins and cancels the other call; when both
+// fail the last error is returned. method labels the hedge metrics. Every
+// call is observed for the upstream scores.
+func Hedge[T any](ctx context.Context, b *Balancer, primary *Client, method string, call func(context.Context, *Client) (T, error)) (T, error) {
+	backup, delay := b.hedgeTarget(primary)
+	if backup == nil {
+		start := time.Now()
+		v, err := call(ctx, primary)
+		b.observe(ctx, primary, start, err)
+		return v, err
+	}
+
+	hedgeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		v      T
+		err    error
+		winner string
+	}
+	// Buffered so the losing call never blocks after Hedge returns
+	results := make(chan result, 2)
+	run := func(c *Client, winner string) {
+		start := time.Now()
+		v, err := call(hedgeCtx, c)
+		b.observe(hedgeCtx, c, start, err)
+		results <- result{v, err, winner}
+	}
+	go run(primary, HedgePrimary)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending, hedged := 1, false
+	fire := func() {
+		hedged = true
+		pending++
+		metrics.UpstreamHedgedTotal.WithLabelValues(method).Inc()
+		go run(backup, HedgeBackup)
+	}
+	for {
+		var hedgeC <-chan time.Time
+		if !hedged {
+			hedgeC = timer.C
+		}
+		select {
+		case <-hedgeC:
+			fire()
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				if hedged {
+					metrics.UpstreamHedgeWinsTotal.WithLabelValues(method, r.winner).Inc()
+				}
+				return r.v, nil
+			}
+			if !hedged && ctx.Err() == nil {
+				fire()
+				continue
+			}
+			if pending == 0 {
+				return r.v, r.err
+			}
+		}
+	}
+}
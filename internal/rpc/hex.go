@@ -0,0 +1,20 @@
+package rpc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseHexUint64 parses a 0x-prefixed hex quantity such as a block number
+func ParseHexUint64(s string) (uint64, error) {
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return 0, fmt.Errorf("missing 0x prefix: %q", s)
+	}
+	return strconv.ParseUint(s[2:], 16, 64)
+}
+
+// FormatHexUint64 formats a number as a 0x-prefixed hex quantity
+func FormatHexUint64(n uint64) string {
+	return "0x" + strconv.FormatUint(n, 16)
+}
@@ -0,0 +1,133 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// MismatchError reports block data fetched from a different block than its
+// header, as when the block is replaced between the calls fetching them
+type MismatchError struct {
+	// Kind is "logs" or "receipts"
+	Kind      string
+	Index     int
+	BlockHash string
+	Want      string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s[%d] has blockHash %s, header is %s", e.Kind, e.Index, e.BlockHash, e.Want)
+}
+
+// VerifyLogs checks that all logs belong to the block, by blockHash
+func VerifyLogs(block *FullBlockHeader, logs []Log) error {
+	for i := range logs {
+		if !strings.EqualFold(logs[i].BlockHash, block.Hash) {
+			return &MismatchError{Kind: "logs", Index: i, BlockHash: logs[i].BlockHash, Want: block.Hash}
+		}
+	}
+	return nil
+}
+
+// VerifyReceipts checks that all receipts, and the logs they hold, belong to
+// the block, by blockHash
+func VerifyReceipts(block *FullBlockHeader, receipts []TransactionReceipt) error {
+	for i := range receipts {
+		if !strings.EqualFold(receipts[i].BlockHash, block.Hash) {
+			return &MismatchError{Kind: "receipts", Index: i, BlockHash: receipts[i].BlockHash, Want: block.Hash}
+		}
+		if err := VerifyLogs(block, receipts[i].Logs); err != nil {
+			return &MismatchError{Kind: "receipts", Index: i, BlockHash: err.(*MismatchError).BlockHash, Want: block.Hash}
+		}
+	}
+	return nil
+}
+
+// HeaderHashError reports a header whose hash doesn't match its content, as
+// when the upstream serves corrupted or truncated data
+type HeaderHashError struct {
+	Number   string
+	Hash     string
+	Computed string
+	// Err is set when the header couldn't be encoded to compute its hash
+	Err error
+}
+
+func (e *HeaderHashError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("header of block %s can't be hashed: %v", e.Number, e.Err)
+	}
+	return fmt.Sprintf("header of block %s has hash %s, its content hashes to %s", e.Number, e.Hash, e.Computed)
+}
+
+func (e *HeaderHashError) Unwrap() error { return e.Err }
+
+// VerifyHeaderHash recomputes the hash of a header from its RLP encoding and
+// checks it against the header's hash
+func VerifyHeaderHash(block *FullBlockHeader) error {
+	computed, err := HeaderHash(block)
+	if err != nil {
+		return &HeaderHashError{Number: block.Number, Hash: block.Hash, Err: err}
+	}
+	if !strings.EqualFold(computed, block.Hash) {
+		return &HeaderHashError{Number: block.Number, Hash: block.Hash, Computed: computed}
+	}
+	return nil
+}
+
+// HeaderHash computes the hash of a header: the Keccak-256 of its RLP
+// encoding. Fields added by forks (base fee onwards) are encoded when present.
+func HeaderHash(block *FullBlockHeader) (string, error) {
+	fields := []struct {
+		value    string
+		quantity bool
+		optional bool
+	}{
+		{block.ParentHash, false, false},
+		{block.Sha3Uncles, false, false},
+		{block.Miner, false, false},
+		{block.StateRoot, false, false},
+		{block.TransactionsRoot, false, false},
+		{block.ReceiptsRoot, false, false},
+		{block.LogsBloom, false, false},
+		{block.Difficulty, true, false},
+		{block.Number, true, false},
+		{block.GasLimit, true, false},
+		{block.GasUsed, true, false},
+		{block.Timestamp, true, false},
+		{block.ExtraData, false, false},
+		{block.MixHash, false, false},
+		{block.Nonce, false, false},
+		{block.BaseFeePerGas, true, true},
+		{block.WithdrawalsRoot, false, true},
+		{block.BlobGasUsed, true, true},
+		{block.ExcessBlobGas, true, true},
+		{block.ParentBeaconBlockRoot, false, true},
+		{block.RequestsHash, false, true},
+	}
+
+	items := make([][]byte, 0, len(fields))
+	for _, f := range fields {
+		if f.value == "" {
+			if f.optional {
+				break
+			}
+			f.value = "0x0"
+			if !f.quantity {
+				f.value = "0x"
+			}
+		}
+		encode := rlpHexBytes
+		if f.quantity {
+			encode = rlpHexUint
+		}
+		item, err := encode(f.value)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, item)
+	}
+	hash := Keccak256(rlpList(items...))
+	return "0x" + hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifyBlockData(t *testing.T) {
+	block := &FullBlockHeader{Number: "0x10", Hash: "0xAA"}
+	logs := []Log{{BlockHash: "0xaa"}, {BlockHash: "0xaa"}}
+	if err := VerifyLogs(block, logs); err != nil {
+		t.Errorf("Expected logs of the block to verify (hashes compare case-insensitively), got %v", err)
+	}
+	if err := VerifyLogs(block, nil); err != nil {
+		t.Errorf("Expected no logs to verify, got %v", err)
+	}
+
+	logs[1].BlockHash = "0xbb"
+	var mismatch *MismatchError
+	if err := VerifyLogs(block, logs); !errors.As(err, &mismatch) || mismatch.Kind != "logs" || mismatch.Index != 1 {
+		t.Errorf("Expected a mismatch of logs[1], got %v", err)
+	}
+
+	receipts := []TransactionReceipt{{BlockHash: "0xaa", Logs: []Log{{BlockHash: "0xaa"}}}}
+	if err := VerifyReceipts(block, receipts); err != nil {
+		t.Errorf("Expected receipts of the block to verify, got %v", err)
+	}
+	receipts[0].Logs[0].BlockHash = "0xbb"
+	if err := VerifyReceipts(block, receipts); !errors.As(err, &mismatch) || mismatch.Kind != "receipts" || mismatch.BlockHash != "0xbb" {
+		t.Errorf("Expected a mismatch of a receipt's log, got %v", err)
+	}
+	receipts[0].BlockHash = "0xcc"
+	if err := VerifyReceipts(block, receipts); !errors.As(err, &mismatch) || mismatch.BlockHash != "0xcc" {
+		t.Errorf("Expected a mismatch of the receipt, got %v", err)
+	}
+}
+
+func TestKeccak256(t *testing.T) {
+	tests := map[string]string{
+		"":    "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+		"abc": "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45",
+		// The RLP empty list and empty string: the empty uncles hash and trie root
+		"\xc0": "1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347",
+		"\x80": "56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421",
+	}
+	for input, want := range tests {
+		if got := Keccak256([]byte(input)); hex.EncodeToString(got[:]) != want {
+			t.Errorf("Keccak256(%q) = %x, want %s", input, got, want)
+		}
+	}
+}
+
+func TestVerifyHeaderHash(t *testing.T) {
+	// Ethereum mainnet genesis, whose encoding spans several sponge blocks
+	genesis := &FullBlockHeader{
+		Number:           "0x0",
+		Hash:             "0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3",
+		ParentHash:       "0x0000000000000000000000000000000000000000000000000000000000000000",
+		Nonce:            "0x0000000000000042",
+		Sha3Uncles:       "0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347",
+		LogsBloom:        "0x" + strings.Repeat("00", 256),
+		TransactionsRoot: "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421",
+		StateRoot:        "0xd7f8974fb5ac78d9ac099b9ad5018bedc2ce0a72dad1827a1709da30580f0544",
+		ReceiptsRoot:     "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421",
+		Miner:            "0x0000000000000000000000000000000000000000",
+		Difficulty:       "0x400000000",
+		ExtraData:        "0x11bbe8db4e347b4e8c937c1c8370e4b5ed33adb3db69cbdb7a38e1e50b1b82fa",
+		GasLimit:         "0x1388",
+		GasUsed:          "0x0",
+		Timestamp:        "0x0",
+		MixHash:          "0x0000000000000000000000000000000000000000000000000000000000000000",
+	}
+	if err := VerifyHeaderHash(genesis); err != nil {
+		t.Fatalf("Expected the genesis header to verify, got %v", err)
+	}
+
+	genesis.GasUsed = "0x1"
+	var mismatch *HeaderHashError
+	if err := VerifyHeaderHash(genesis); !errors.As(err, &mismatch) || mismatch.Computed == "" {
+		t.Errorf("Expected a hash mismatch of a modified header, got %v", err)
+	}
+
+	genesis.GasUsed = "0x0"
+	genesis.LogsBloom = "0x00z"
+	if err := VerifyHeaderHash(genesis); !errors.As(err, &mismatch) || mismatch.Err == nil {
+		t.Errorf("Expected a truncated header to fail to hash, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// IPCScheme is the URL scheme of upstreams reached over a unix domain socket,
+// as in ipc:///var/run/node.ipc
+const IPCScheme = "ipc"
+
+// defaultIPCIdleConns is how many idle IPC connections are kept for reuse
+// when the transport options don't say
+const defaultIPCIdleConns = 16
+
+// IPCPath returns the socket path of an ipc:// URL, and false for other URLs
+func IPCPath(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != IPCScheme {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// ipcTransport sends JSON-RPC calls over a unix domain socket the way nodes
+// serve IPC: a raw JSON request, answered by a single JSON value, with no
+// HTTP framing. Each connection carries one call at a time.
+type ipcTransport struct {
+	path        string
+	dialTimeout time.Duration
+	idle        chan net.Conn
+}
+
+func newIPCTransport(path string, opts TransportOptions) *ipcTransport {
+	idle := defaultIPCIdleConns
+	if opts.MaxIdleConnsPerHost > 0 {
+		idle = opts.MaxIdleConnsPerHost
+	}
+	if opts.DisableKeepAlives {
+		idle = 0
+	}
+	dialTimeout := 30 * time.Second
+	if opts.DialTimeout > 0 {
+		dialTimeout = opts.DialTimeout
+	}
+	return &ipcTransport{path: path, dialTimeout: dialTimeout, idle: make(chan net.Conn, idle)}
+}
+
+// RoundTrip sends the request body over a pooled connection and wraps the
+// JSON value read back in a 200 response
+func (t *ipcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := t.conn(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	result, reusable, err := t.exchange(req.Context(), conn, body)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if reusable {
+		t.release(conn)
+	} else {
+		conn.Close()
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(result)),
+		ContentLength: int64(len(result)),
+		Request:       req,
+	}, nil
+}
+
+// exchange writes one call and reads its response, giving up when ctx ends.
+// The connection is reusable unless more than whitespace followed the
+// response.
+func (t *ipcTransport) exchange(ctx context.Context, conn net.Conn, body []byte) (json.RawMessage, bool, error) {
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	// Unblock the read when the caller gives up without a deadline
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+
+	if _, err := conn.Write(body); err != nil {
+		stop()
+		return nil, false, t.ctxErr(ctx, fmt.Errorf("write to %s: %w", t.path, err))
+	}
+	decoder := json.NewDecoder(conn)
+	var result json.RawMessage
+	if err := decoder.Decode(&result); err != nil {
+		stop()
+		return nil, false, t.ctxErr(ctx, fmt.Errorf("read from %s: %w", t.path, err))
+	}
+	rest, _ := io.ReadAll(decoder.Buffered())
+	// A cancellation racing the response may still reset the deadline, so
+	// the connection can't be handed to the next call
+	stopped := stop()
+	return result, stopped && len(bytes.TrimSpace(rest)) == 0, nil
+}
+
+// ctxErr reports the caller giving up rather than the I/O error it caused
+func (t *ipcTransport) ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// conn returns an idle connection or dials a new one
+func (t *ipcTransport) conn(ctx context.Context) (net.Conn, error) {
+	select {
+	case conn := <-t.idle:
+		return conn, nil
+	default:
+	}
+	dialer := net.Dialer{Timeout: t.dialTimeout}
+	return dialer.DialContext(ctx, "unix", t.path)
+}
+
+// release returns a connection to the pool, closing it when the pool is full
+func (t *ipcTransport) release(conn net.Conn) {
+	select {
+	case t.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// CloseIdleConnections closes the pooled connections; http.Client calls it
+func (t *ipcTransport) CloseIdleConnections() {
+	for {
+		select {
+		case conn := <-t.idle:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
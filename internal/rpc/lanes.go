@@ -0,0 +1,162 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"hlnode-websocket/internal/metrics"
+)
+
+// Request lanes: calls are queued for separate concurrency limits by lane,
+// so slow heavy queries can't hold every upstream connection fast calls need
+const (
+	// LaneFast carries cheap, latency-sensitive calls
+	LaneFast = "fast"
+	// LaneHeavy carries calls that scan many blocks or replay transactions
+	LaneHeavy = "heavy"
+	// LaneDefault carries every other call
+	LaneDefault = "default"
+)
+
+// fastMethods are answered from the node's head state at little cost
+var fastMethods = map[string]bool{
+	"eth_blockNumber":          true,
+	"eth_chainId":              true,
+	"net_version":              true,
+	"eth_gasPrice":             true,
+	"eth_maxPriorityFeePerGas": true,
+	"eth_sendRawTransaction":   true,
+}
+
+// heavyMethods read logs or receipts over many blocks or transactions
+var heavyMethods = map[string]bool{
+	"eth_getLogs":          true,
+	"eth_getFilterLogs":    true,
+	"eth_getBlockReceipts": true,
+}
+
+// heavyPrefixes are method prefixes of transaction tracing and replay
+var heavyPrefixes = []string{"debug_", "trace_"}
+
+// MethodLane returns the lane of a method
+func MethodLane(method string) string {
+	if fastMethods[method] {
+		return LaneFast
+	}
+	if heavyMethods[method] {
+		return LaneHeavy
+	}
+	for _, prefix := range heavyPrefixes {
+		if strings.HasPrefix(method, prefix) {
+			return LaneHeavy
+		}
+	}
+	return LaneDefault
+}
+
+// batchLane returns the lane of a batch: heavy if any method is, fast if
+// all are, default otherwise
+func batchLane(methods []string) string {
+	lane := LaneFast
+	for _, method := range methods {
+		switch MethodLane(method) {
+		case LaneHeavy:
+			return LaneHeavy
+		case LaneDefault:
+			lane = LaneDefault
+		}
+	}
+	if len(methods) == 0 {
+		return LaneDefault
+	}
+	return lane
+}
+
+// rawLane returns the lane of a raw request or batch; unparseable bodies
+// take the default lane
+func rawLane(body []byte) string {
+	var calls []struct {
+		Method string `json:"method"`
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] != '[' {
+		trimmed = append(append([]byte{'['}, trimmed...), ']')
+	}
+	if err := json.Unmarshal(trimmed, &calls); err != nil {
+		return LaneDefault
+	}
+	methods := make([]string, len(calls))
+	for i, call := range calls {
+		methods[i] = call.Method
+	}
+	return batchLane(methods)
+}
+
+// lanes are the concurrency limits of a client's lanes. The fast lane has
+// its own connection pool, so it doesn't wait behind connections held by
+// other lanes under UPSTREAM_MAX_CONNS_PER_HOST.
+type lanes struct {
+	// slots holds a token per call in flight, by lane; lanes without a
+	// limit have none
+	slots map[string]chan struct{}
+	fast  *http.Client
+}
+
+// SetLanes caps the calls in flight to the upstream by lane: fast, heavy
+// and default. A call waits for a free slot in its lane for as long as its
+// deadline allows. Zero leaves a lane unlimited; all zero disables lanes.
+func (c *Client) SetLanes(fast, heavy, other int) {
+	if fast <= 0 && heavy <= 0 && other <= 0 {
+		c.lanes = nil
+		return
+	}
+	l := &lanes{
+		slots: make(map[string]chan struct{}),
+		fast:  &http.Client{Transport: newTransport(c.rpcURL, c.transportOpts)},
+	}
+	for lane, limit := range map[string]int{LaneFast: fast, LaneHeavy: heavy, LaneDefault: other} {
+		if limit > 0 {
+			l.slots[lane] = make(chan struct{}, limit)
+		}
+	}
+	c.lanes = l
+}
+
+// httpClientFor returns the HTTP client carrying calls of lane
+func (c *Client) httpClientFor(lane string) *http.Client {
+	if c.lanes != nil && lane == LaneFast {
+		return c.lanes.fast
+	}
+	return c.httpClient
+}
+
+// acquireLane takes a slot in lane, waiting until ctx ends, and returns the
+// function releasing it
+func (c *Client) acquireLane(ctx context.Context, lane string) (func(), error) {
+	if c.lanes == nil {
+		return func() {}, nil
+	}
+	slots := c.lanes.slots[lane]
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+	default:
+		metrics.UpstreamLaneWaitsTotal.WithLabelValues(c.host, lane).Inc()
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	metrics.UpstreamLaneInFlight.WithLabelValues(c.host, lane).Inc()
+	return func() {
+		<-slots
+		metrics.UpstreamLaneInFlight.WithLabelValues(c.host, lane).Dec()
+	}, nil
+}
@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"hlnode-websocket/internal/metrics"
+)
+
+// ErrRateLimited is returned for calls refused by the client's rate limiter
+var ErrRateLimited = errors.New("upstream rate limit exceeded")
+
+// RateLimitedError is returned instead of calling an upstream whose rate
+// limit has no token available within the bounded wait. It matches
+// ErrRateLimited.
+type RateLimitedError struct {
+	// RetryIn is the time until a token is available
+	RetryIn time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("upstream rate limit exceeded, retry in %v", e.RetryIn.Round(time.Millisecond))
+}
+
+func (e *RateLimitedError) Unwrap() error { return ErrRateLimited }
+
+// rateLimiter is a token bucket refilled at rate tokens per second up to
+// burst. A call takes a token, waiting at most maxWait for one.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	maxWait time.Duration
+	tokens  float64
+	last    time.Time
+	now     func() time.Time
+}
+
+// SetRateLimit caps the calls sent to the upstream at rate per second, with
+// bursts of up to burst calls (rate when 0). A call finding no token waits
+// up to maxWait for one, then fails with a RateLimitedError. Each attempt,
+// retries included, takes a token. A zero rate disables the limit.
+func (c *Client) SetRateLimit(rate, burst int, maxWait time.Duration) {
+	if rate <= 0 {
+		c.limiter = nil
+		return
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	c.limiter = &rateLimiter{
+		rate:    float64(rate),
+		burst:   float64(burst),
+		maxWait: maxWait,
+		tokens:  float64(burst),
+		last:    time.Now(),
+		now:     time.Now,
+	}
+}
+
+// reserve takes a token, going into debt for one that becomes available
+// within maxWait and the caller's budget, and returns how long to wait
+// before using it
+func (l *rateLimiter) reserve(budget time.Duration) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	if wait <= 0 {
+		l.tokens--
+		return 0, nil
+	}
+	if wait > l.maxWait || wait > budget {
+		return 0, &RateLimitedError{RetryIn: wait}
+	}
+	l.tokens--
+	return wait, nil
+}
+
+// release returns a reserved token that was not used
+func (l *rateLimiter) release() {
+	l.mu.Lock()
+	l.tokens = min(l.burst, l.tokens+1)
+	l.mu.Unlock()
+}
+
+// waitRateLimit takes a token from the client's rate limiter before a call
+// is sent upstream, waiting for it if needed
+func (c *Client) waitRateLimit(ctx context.Context) error {
+	l := c.limiter
+	if l == nil {
+		return nil
+	}
+
+	budget := time.Duration(1<<63 - 1)
+	if deadline, ok := ctx.Deadline(); ok {
+		budget = time.Until(deadline)
+	}
+	wait, err := l.reserve(budget)
+	if err != nil {
+		metrics.UpstreamRateLimitedTotal.WithLabelValues(c.host, "rejected").Inc()
+		return err
+	}
+	if wait == 0 {
+		return nil
+	}
+
+	metrics.UpstreamRateLimitedTotal.WithLabelValues(c.host, "delayed").Inc()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.release()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
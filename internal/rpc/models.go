@@ -39,6 +39,64 @@ type FullBlockHeader struct {
 	BlobGasUsed           string `json:"blobGasUsed,omitempty"`
 	ExcessBlobGas         string `json:"excessBlobGas,omitempty"`
 	ParentBeaconBlockRoot string `json:"parentBeaconBlockRoot,omitempty"`
+	RequestsHash          string `json:"requestsHash,omitempty"`
+
+	// TxCount and Stats are filled in when the block is fetched and polled,
+	// and are not part of the header JSON
+	TxCount int         `json:"-"`
+	Stats   *BlockStats `json:"-"`
+}
+
+// HeaderWithStats is a newHeads notification carrying the stats extension
+type HeaderWithStats struct {
+	*FullBlockHeader
+	Stats *BlockStats `json:"stats,omitempty"`
+}
+
+// BaseFee is the notification sent to baseFee subscribers
+type BaseFee struct {
+	BlockNumber   string `json:"blockNumber"`
+	BaseFeePerGas string `json:"baseFeePerGas"`
+}
+
+// BaseFee returns the base fee of the block, or nil if the header has none
+func (h *FullBlockHeader) BaseFee() *BaseFee {
+	if h.BaseFeePerGas == "" {
+		return nil
+	}
+	return &BaseFee{BlockNumber: h.Number, BaseFeePerGas: h.BaseFeePerGas}
+}
+
+// LiteBlockHeader is the minimal header sent to newHeadsLite subscribers
+type LiteBlockHeader struct {
+	Number     string `json:"number"`
+	Hash       string `json:"hash"`
+	ParentHash string `json:"parentHash"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// Lite returns the minimal form of the header
+func (h *FullBlockHeader) Lite() *LiteBlockHeader {
+	return &LiteBlockHeader{
+		Number:     h.Number,
+		Hash:       h.Hash,
+		ParentHash: h.ParentHash,
+		Timestamp:  h.Timestamp,
+	}
+}
+
+// IsBigBlock reports whether the block is a Hyperliquid big block, i.e. its
+// gas limit is at least minGasLimit. Small blocks have a much lower gas limit.
+func (h *FullBlockHeader) IsBigBlock(minGasLimit uint64) bool {
+	gasLimit, err := ParseHexUint64(h.GasLimit)
+	return err == nil && gasLimit >= minGasLimit
+}
+
+// BigBlockHeader is the header sent to hl_bigBlocks subscribers, with the
+// latest big block gas price
+type BigBlockHeader struct {
+	*FullBlockHeader
+	BigBlockGasPrice string `json:"bigBlockGasPrice,omitempty"`
 }
 
 // TransactionReceipt represents a transaction receipt
@@ -66,11 +124,69 @@ type BlockReceipts struct {
 	Receipts    []TransactionReceipt `json:"receipts"`
 }
 
+// TxConfirmation represents a txConfirmation notification.
+// Confirmations is the number of blocks mined on top of the transaction's block.
+type TxConfirmation struct {
+	TransactionHash string              `json:"transactionHash"`
+	BlockNumber     string              `json:"blockNumber"`
+	BlockHash       string              `json:"blockHash"`
+	Confirmations   string              `json:"confirmations"`
+	Receipt         *TransactionReceipt `json:"receipt"`
+}
+
+// AddressLabel is an operator-provided label of an address
+type AddressLabel struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Block types of a gasPrice notification, naming the price that changed
+const (
+	BlockTypeSmall = "small"
+	BlockTypeBig   = "big"
+)
+
 // GasPriceInfo represents gas price information for subscription
 type GasPriceInfo struct {
 	GasPrice         string `json:"gasPrice"`
 	BigBlockGasPrice string `json:"bigBlockGasPrice,omitempty"`
 	BlockNumber      string `json:"blockNumber"`
+	// BlockType is the block type whose price changed: "small" (gasPrice) or "big" (bigBlockGasPrice)
+	BlockType string `json:"blockType,omitempty"`
+	// Stats holds rolling statistics over the recent price history, keyed by block type
+	Stats map[string]*GasPriceStats `json:"stats,omitempty"`
+}
+
+// FeeHistory is the result of eth_feeHistory
+type FeeHistory struct {
+	OldestBlock   string     `json:"oldestBlock"`
+	BaseFeePerGas []string   `json:"baseFeePerGas"`
+	GasUsedRatio  []float64  `json:"gasUsedRatio"`
+	Reward        [][]string `json:"reward,omitempty"`
+}
+
+// ChangedPrice returns the price named by BlockType
+func (g *GasPriceInfo) ChangedPrice() string {
+	if g.BlockType == BlockTypeBig {
+		return g.BigBlockGasPrice
+	}
+	return g.GasPrice
+}
+
+// GasPriceStats are rolling statistics over recently observed gas prices
+type GasPriceStats struct {
+	Min     string `json:"min"`
+	Max     string `json:"max"`
+	Avg     string `json:"avg"`
+	Samples int    `json:"samples"`
+}
+
+// GasPriceSample is one observed gas price change
+type GasPriceSample struct {
+	Timestamp   int64  `json:"timestamp"`
+	BlockNumber string `json:"blockNumber"`
+	BlockType   string `json:"blockType"`
+	GasPrice    string `json:"gasPrice"`
 }
 
 // SyncStatus represents the syncing status (matches eth_syncing response)
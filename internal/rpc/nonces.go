@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// NonceChange is a nonceChanges notification: the transaction count of a
+// watched address changed in a block
+type NonceChange struct {
+	Address       string `json:"address"`
+	BlockNumber   string `json:"blockNumber"`
+	BlockHash     string `json:"blockHash"`
+	PreviousNonce string `json:"previousNonce"`
+	Nonce         string `json:"nonce"`
+}
+
+// GetTransactionCount fetches the nonce of an address at a block
+func (c *Client) GetTransactionCount(ctx context.Context, address, blockNum string) (string, error) {
+	params, _ := json.Marshal([]string{address, blockNum})
+	req := &Request{
+		JSONRPC: "2.0",
+		Method:  "eth_getTransactionCount",
+		Params:  params,
+		ID:      json.RawMessage("1"),
+	}
+
+	resp, err := c.Call(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Error != nil {
+		return "", fmt.Errorf("RPC error: %s", resp.Error.Message)
+	}
+
+	var nonce string
+	if err := json.Unmarshal(resp.Result, &nonce); err != nil {
+		return "", fmt.Errorf("failed to unmarshal transaction count: %w", err)
+	}
+	return nonce, nil
+}
@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ProbeFailureThreshold is the number of consecutive failed probes after
+// which the upstream is reported unhealthy
+const ProbeFailureThreshold = 3
+
+// ProbeStatus is the outcome of the background upstream probes
+type ProbeStatus struct {
+	Healthy             bool          `json:"healthy"`
+	Latency             time.Duration `json:"-"`
+	LatencyMs           int64         `json:"latencyMs"`
+	ConsecutiveFailures int           `json:"consecutiveFailures"`
+	LastProbe           time.Time     `json:"lastProbe"`
+	LastError           string        `json:"lastError,omitempty"`
+}
+
+// probeState records probe results independently of client traffic
+type probeState struct {
+	latency  time.Duration
+	failures int
+	last     time.Time
+	lastErr  string
+	mu       sync.RWMutex
+}
+
+// Probe issues a lightweight eth_blockNumber call to measure upstream
+// availability and latency, and records the result. A probe refused by the
+// rate limit is not recorded: a busy upstream is not an unhealthy one.
+func (c *Client) Probe(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	_, err := c.GetBlockNumber(ctx)
+	latency := time.Since(start)
+	if errors.Is(err, ErrRateLimited) {
+		return latency, err
+	}
+
+	c.probe.mu.Lock()
+	defer c.probe.mu.Unlock()
+
+	c.probe.last = start
+	if err != nil {
+		c.probe.failures++
+		c.probe.lastErr = err.Error()
+		return latency, err
+	}
+	c.probe.failures = 0
+	c.probe.lastErr = ""
+	c.probe.latency = latency
+	return latency, nil
+}
+
+// ProbeStatus returns the latest probe outcome. An upstream that has not
+// been probed yet is healthy as long as it is ready.
+func (c *Client) ProbeStatus() ProbeStatus {
+	c.probe.mu.RLock()
+	defer c.probe.mu.RUnlock()
+
+	return ProbeStatus{
+		Healthy:             c.Ready() && c.probe.failures < ProbeFailureThreshold,
+		Latency:             c.probe.latency,
+		LatencyMs:           c.probe.latency.Milliseconds(),
+		ConsecutiveFailures: c.probe.failures,
+		LastProbe:           c.probe.last,
+		LastError:           c.probe.lastErr,
+	}
+}
@@ -0,0 +1,189 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+)
+
+// Block receipts modes: whether GetBlockReceipts uses eth_getBlockReceipts
+const (
+	// BlockReceiptsAuto uses it until the upstream reports the method missing
+	BlockReceiptsAuto = "auto"
+	BlockReceiptsOn   = "on"
+	// BlockReceiptsOff fetches each transaction's receipt instead
+	BlockReceiptsOff = "off"
+)
+
+// maxReceiptFetches bounds the concurrent eth_getTransactionReceipt calls of
+// a block when batching is off
+const maxReceiptFetches = 8
+
+// errBlockReceiptsUnsupported is the ReceiptsErr of a bundle fetched from an
+// upstream without eth_getBlockReceipts
+var errBlockReceiptsUnsupported = errors.New("eth_getBlockReceipts not supported by the upstream")
+
+// SetBlockReceipts sets whether GetBlockReceipts uses eth_getBlockReceipts
+// (BlockReceiptsOn), fetches each transaction's receipt (BlockReceiptsOff),
+// or uses it until the upstream reports it missing (BlockReceiptsAuto, the
+// default)
+func (c *Client) SetBlockReceipts(mode string) error {
+	switch mode {
+	case BlockReceiptsAuto, BlockReceiptsOn, BlockReceiptsOff:
+	default:
+		return fmt.Errorf("block receipts mode %q must be %s, %s or %s", mode, BlockReceiptsAuto, BlockReceiptsOn, BlockReceiptsOff)
+	}
+	c.receiptsAuto = mode == BlockReceiptsAuto
+	c.setBlockReceipts(mode != BlockReceiptsOff)
+	return nil
+}
+
+// BlockReceiptsSupported reports whether GetBlockReceipts uses eth_getBlockReceipts
+func (c *Client) BlockReceiptsSupported() bool {
+	return !c.noBlockReceipts.Load()
+}
+
+func (c *Client) setBlockReceipts(supported bool) {
+	c.noBlockReceipts.Store(!supported)
+	value := 0.0
+	if supported {
+		value = 1
+	}
+	metrics.UpstreamBlockReceipts.WithLabelValues(c.host).Set(value)
+}
+
+// ProbeBlockReceipts checks in auto mode whether the upstream supports
+// eth_getBlockReceipts, so the first blocks don't pay for the detection. err
+// is set when the upstream couldn't be asked.
+func (c *Client) ProbeBlockReceipts(ctx context.Context) (bool, error) {
+	if !c.receiptsAuto {
+		return c.BlockReceiptsSupported(), nil
+	}
+	resp, err := c.Call(ctx, &Request{
+		JSONRPC: "2.0",
+		Method:  "eth_getBlockReceipts",
+		Params:  json.RawMessage(`["latest"]`),
+		ID:      json.RawMessage("1"),
+	})
+	if err != nil {
+		return c.BlockReceiptsSupported(), err
+	}
+	c.blockReceiptsMissing(resp)
+	return c.BlockReceiptsSupported(), nil
+}
+
+// blockReceiptsMissing reports whether an eth_getBlockReceipts response says
+// the method doesn't exist, and in auto mode stops using it
+func (c *Client) blockReceiptsMissing(resp *Response) bool {
+	if !c.receiptsAuto || resp.Error == nil || !methodMissing(resp.Error) {
+		return false
+	}
+	if !c.noBlockReceipts.Load() {
+		logger.Warn("Upstream %s does not support eth_getBlockReceipts, fetching receipts per transaction: %s", c.host, resp.Error.Message)
+		c.setBlockReceipts(false)
+	}
+	return true
+}
+
+// methodMissing reports whether an error says the method is unknown or
+// disabled; nodes word this differently
+func methodMissing(e *Error) bool {
+	if e.Code == ErrCodeMethodNotFound {
+		return true
+	}
+	message := strings.ToLower(e.Message)
+	for _, hint := range []string{"method not found", "does not exist", "not supported", "not available", "unsupported method"} {
+		if strings.Contains(message, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// getReceiptsByTransaction fetches a block's receipts one transaction at a
+// time, in one batch unless batching is off
+func (c *Client) getReceiptsByTransaction(ctx context.Context, blockNum string) ([]TransactionReceipt, error) {
+	hashes, err := c.getTransactionHashes(ctx, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	reqs := make([]*Request, len(hashes))
+	for i, hash := range hashes {
+		params, _ := json.Marshal([]string{hash})
+		reqs[i] = &Request{JSONRPC: "2.0", Method: "eth_getTransactionReceipt", Params: params, ID: json.RawMessage("1")}
+	}
+	responses := make([]*Response, len(reqs))
+
+	batched := false
+	if len(reqs) > 1 && !c.noBatch.Load() {
+		responses, err = c.CallBatch(ctx, reqs)
+		if err != nil && !c.batchRejected(err) {
+			return nil, err
+		}
+		batched = err == nil
+	}
+	if !batched {
+		var wg sync.WaitGroup
+		errs := make([]error, len(reqs))
+		slots := make(chan struct{}, maxReceiptFetches)
+		for i, req := range reqs {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func() {
+				defer func() { <-slots; wg.Done() }()
+				responses[i], errs[i] = c.Call(ctx, req)
+			}()
+		}
+		wg.Wait()
+		if err := errors.Join(errs...); err != nil {
+			return nil, err
+		}
+	}
+
+	receipts := make([]TransactionReceipt, len(responses))
+	for i, resp := range responses {
+		if resp.Error != nil {
+			return nil, fmt.Errorf("RPC error: %s", resp.Error.Message)
+		}
+		if resp.Result == nil || string(resp.Result) == "null" {
+			return nil, fmt.Errorf("receipt of transaction %s not found", hashes[i])
+		}
+		if err := json.Unmarshal(resp.Result, &receipts[i]); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal receipt: %w", err)
+		}
+	}
+	return receipts, nil
+}
+
+// getTransactionHashes fetches the hashes of a block's transactions
+func (c *Client) getTransactionHashes(ctx context.Context, blockNum string) ([]string, error) {
+	params, _ := json.Marshal([]interface{}{blockNum, false})
+	resp, err := c.Call(ctx, &Request{
+		JSONRPC: "2.0",
+		Method:  "eth_getBlockByNumber",
+		Params:  params,
+		ID:      json.RawMessage("1"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("RPC error: %s", resp.Error.Message)
+	}
+	if resp.Result == nil || string(resp.Result) == "null" {
+		return nil, fmt.Errorf("block %s not found", blockNum)
+	}
+	var block struct {
+		Transactions []string `json:"transactions"`
+	}
+	if err := json.Unmarshal(resp.Result, &block); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal block: %w", err)
+	}
+	return block.Transactions, nil
+}
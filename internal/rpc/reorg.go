@@ -0,0 +1,137 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+)
+
+// DefaultReorgTrackDepth is the number of recent block hashes kept to detect reorgs
+const DefaultReorgTrackDepth = 64
+
+// BlockRef identifies a block
+type BlockRef struct {
+	Number string `json:"number"`
+	Hash   string `json:"hash"`
+}
+
+// Reorg represents a reorg notification: the previously delivered blocks
+// that are no longer canonical, newest first
+type Reorg struct {
+	// Depth is the number of replaced blocks
+	Depth          string     `json:"depth"`
+	ReplacedBlocks []BlockRef `json:"replacedBlocks"`
+	// CommonAncestor is the newest block still canonical, omitted when the
+	// reorg is deeper than the tracked history
+	CommonAncestor *BlockRef `json:"commonAncestor,omitempty"`
+	NewHead        BlockRef  `json:"newHead"`
+}
+
+// BlockFetcher fetches the canonical header of a block by number
+type BlockFetcher func(ctx context.Context, blockNum string) (*FullBlockHeader, error)
+
+// ChainTracker records the hashes of recently delivered blocks and detects
+// when a new block does not build on them
+type ChainTracker struct {
+	depth  uint64
+	hashes map[uint64]string
+	mu     sync.Mutex
+}
+
+// NewChainTracker creates a tracker keeping the hashes of the last depth blocks
+func NewChainTracker(depth uint64) *ChainTracker {
+	if depth == 0 {
+		depth = DefaultReorgTrackDepth
+	}
+	return &ChainTracker{depth: depth, hashes: make(map[uint64]string)}
+}
+
+// Observe records a new head and returns the reorg it reveals, if any: its
+// parentHash differs from the hash recorded for the previous block. The
+// replaced blocks are found by walking back through the canonical chain with
+// fetch until a recorded hash matches again.
+func (t *ChainTracker) Observe(ctx context.Context, header *FullBlockHeader, fetch BlockFetcher) *Reorg {
+	blockNum, err := ParseHexUint64(header.Number)
+	if err != nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var reorg *Reorg
+	if recorded, ok := t.hashes[blockNum-1]; ok && blockNum > 0 && recorded != header.ParentHash {
+		reorg = &Reorg{NewHead: BlockRef{Number: header.Number, Hash: header.Hash}}
+		parentHash := header.ParentHash
+		for n := blockNum - 1; ; n-- {
+			recorded, ok := t.hashes[n]
+			if !ok {
+				break
+			}
+			if recorded == parentHash {
+				reorg.CommonAncestor = &BlockRef{Number: FormatHexUint64(n), Hash: recorded}
+				break
+			}
+			reorg.ReplacedBlocks = append(reorg.ReplacedBlocks, BlockRef{Number: FormatHexUint64(n), Hash: recorded})
+			t.hashes[n] = parentHash
+
+			if n == 0 {
+				break
+			}
+			canonical, err := fetch(ctx, FormatHexUint64(n))
+			if err != nil || canonical == nil {
+				break
+			}
+			parentHash = canonical.ParentHash
+		}
+		reorg.Depth = FormatHexUint64(uint64(len(reorg.ReplacedBlocks)))
+	}
+
+	t.hashes[blockNum] = header.Hash
+	for n := range t.hashes {
+		if n+t.depth <= blockNum {
+			delete(t.hashes, n)
+		}
+	}
+	return reorg
+}
+
+// HeadGuard keeps broadcast heads monotonic: after an upstream switch a
+// lagging replica may report lower heights, which are skipped until it
+// catches up
+type HeadGuard struct {
+	last   uint64
+	behind bool
+}
+
+// Check reports whether head is above the last accepted head. A lower head
+// is counted as a regression and logged once until the upstream catches up.
+func (g *HeadGuard) Check(head uint64) bool {
+	if head <= g.last {
+		if head < g.last {
+			metrics.HeadRegressionsTotal.Inc()
+			if !g.behind {
+				logger.Warn("Upstream head %d is behind last broadcast head %d, waiting for it to catch up", head, g.last)
+				g.behind = true
+			}
+		}
+		return false
+	}
+	if g.behind {
+		logger.Info("Upstream caught up at head %d", head)
+		g.behind = false
+	}
+	return true
+}
+
+// Accept records head as broadcast
+func (g *HeadGuard) Accept(head uint64) {
+	g.last = head
+}
+
+// Behind reports whether the last checked head was behind the accepted one
+func (g *HeadGuard) Behind() bool {
+	return g.behind
+}
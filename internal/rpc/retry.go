@@ -0,0 +1,133 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"hlnode-websocket/internal/metrics"
+)
+
+// retryPolicy is how failed calls are retried: up to retries more times,
+// waiting a jittered backoff doubling from backoff up to maxBackoff
+type retryPolicy struct {
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// SetRetries makes the client retry calls failing with a transient error up
+// to retries times, with jittered exponential backoff starting at backoff
+// and capped at maxBackoff. Calls that may have reached the upstream are
+// only retried for idempotent methods. 0 retries disables retrying.
+func (c *Client) SetRetries(retries int, backoff, maxBackoff time.Duration) {
+	c.retry = retryPolicy{retries: max(retries, 0), backoff: backoff, maxBackoff: max(maxBackoff, backoff)}
+}
+
+// nonIdempotentPrefixes are method prefixes whose calls change upstream state,
+// so repeating one that reached the upstream could apply it twice
+var nonIdempotentPrefixes = []string{"eth_send", "personal_", "admin_", "miner_"}
+
+// nonIdempotentMethods create or remove upstream filters
+var nonIdempotentMethods = map[string]bool{
+	"eth_newFilter":                   true,
+	"eth_newBlockFilter":              true,
+	"eth_newPendingTransactionFilter": true,
+	"eth_uninstallFilter":             true,
+}
+
+// IsIdempotent reports whether a method only reads, so a call may be
+// repeated without side effects
+func IsIdempotent(method string) bool {
+	if nonIdempotentMethods[method] {
+		return false
+	}
+	for _, prefix := range nonIdempotentPrefixes {
+		if strings.HasPrefix(method, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// rawIdempotent reports whether every method of a raw request or batch is
+// idempotent; unparseable bodies are not
+func rawIdempotent(body []byte) bool {
+	var methods []struct {
+		Method string `json:"method"`
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] != '[' {
+		trimmed = append(append([]byte{'['}, trimmed...), ']')
+	}
+	if err := json.Unmarshal(trimmed, &methods); err != nil {
+		return false
+	}
+	for _, m := range methods {
+		if !IsIdempotent(m.Method) {
+			return false
+		}
+	}
+	return true
+}
+
+// retryable reports whether a failed attempt may be retried. A connection
+// that was never established is safe to retry for any method; a reset
+// connection or a 502/503/504 from a gateway only for idempotent ones, as
+// the call may have been processed.
+func retryable(status int, err error, idempotent bool) bool {
+	var opErr *net.OpError
+	switch {
+	case err == nil:
+		return idempotent && (status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout)
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return true
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled), errors.Is(err, ErrUpstreamUnavailable), errors.Is(err, ErrRateLimited):
+		return false
+	default:
+		return idempotent && (errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF))
+	}
+}
+
+// delay returns the jittered backoff before a retry, counting from 0
+func (p retryPolicy) delay(retry int) time.Duration {
+	d := p.backoff << min(retry, 30)
+	if d <= 0 || d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	// Equal jitter: half fixed, half random, so clients hitting the same
+	// failure don't retry in lockstep
+	return d/2 + rand.N(d/2+1)
+}
+
+// post sends a JSON-RPC body in lane, retrying transient failures per the
+// retry policy
+func (c *Client) post(ctx context.Context, body []byte, idempotent bool, lane string) ([]byte, error) {
+	for retry := 0; ; retry++ {
+		resp, status, err := c.attempt(ctx, body, lane)
+		if retry == c.retry.retries || !retryable(status, err, idempotent) {
+			return resp, err
+		}
+
+		wait := c.retry.delay(retry)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+		metrics.UpstreamRetriesTotal.WithLabelValues(c.host).Inc()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+	}
+}
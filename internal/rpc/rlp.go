@@ -0,0 +1,62 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// rlpBytes encodes a byte string
+func rlpBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return b
+	}
+	return append(rlpLength(0x80, len(b)), b...)
+}
+
+// rlpList encodes a list of encoded items
+func rlpList(items ...[]byte) []byte {
+	size := 0
+	for _, item := range items {
+		size += len(item)
+	}
+	out := rlpLength(0xc0, size)
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// rlpLength encodes the prefix of a string (offset 0x80) or list (0xc0)
+func rlpLength(offset byte, n int) []byte {
+	if n <= 55 {
+		return []byte{offset + byte(n)}
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	size := buf[:]
+	for len(size) > 1 && size[0] == 0 {
+		size = size[1:]
+	}
+	return append([]byte{offset + 55 + byte(len(size))}, size...)
+}
+
+// rlpHexBytes encodes a 0x-prefixed hex byte string (hashes, addresses, data)
+func rlpHexBytes(s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex %q: %w", s, err)
+	}
+	return rlpBytes(b), nil
+}
+
+// rlpHexUint encodes a 0x-prefixed hex quantity as a minimal big-endian integer
+func rlpHexUint(s string) ([]byte, error) {
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16)
+	if !ok || n.Sign() < 0 {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	return rlpBytes(n.Bytes()), nil
+}
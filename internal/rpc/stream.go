@@ -0,0 +1,165 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+)
+
+// Reconnect backoff of a head stream whose socket dropped
+const (
+	streamMinBackoff = time.Second
+	streamMaxBackoff = 30 * time.Second
+)
+
+// HeadStream consumes an upstream eth_subscribe newHeads stream over
+// WebSocket, so new heads are processed as soon as the node announces them
+// instead of on the next poll. It reconnects with backoff when the socket
+// drops; Connected tells the poller when it must fall back to polling.
+type HeadStream struct {
+	url string
+	// timeout closes a socket that delivered nothing for that long
+	timeout   time.Duration
+	heads     chan uint64
+	connected atomic.Bool
+	// tlsConfig verifies and authenticates wss upstreams
+	tlsConfig *tls.Config
+}
+
+// NewHeadStream creates a stream of the heads announced by a ws:// or wss://
+// upstream. A socket silent for timeout is considered dropped.
+func NewHeadStream(url string, timeout time.Duration) *HeadStream {
+	return &HeadStream{url: url, timeout: timeout, heads: make(chan uint64, 1)}
+}
+
+// SetTLSConfig sets the TLS config used to dial a wss:// upstream. It must
+// be called before Run.
+func (s *HeadStream) SetTLSConfig(config *tls.Config) {
+	s.tlsConfig = config
+}
+
+// Heads returns the channel of announced head numbers. Only the latest
+// unconsumed head is kept: the poller catches up from it.
+func (s *HeadStream) Heads() <-chan uint64 {
+	if s == nil {
+		return nil
+	}
+	return s.heads
+}
+
+// Connected reports whether the stream is subscribed and delivering heads
+func (s *HeadStream) Connected() bool {
+	return s != nil && s.connected.Load()
+}
+
+// Run subscribes and reconnects until ctx is done
+func (s *HeadStream) Run(ctx context.Context) {
+	backoff := streamMinBackoff
+	for {
+		subscribed, err := s.consume(ctx)
+		s.connected.Store(false)
+		metrics.UpstreamStreamConnected.Set(0)
+		if ctx.Err() != nil {
+			return
+		}
+		if subscribed {
+			backoff = streamMinBackoff
+		}
+		logger.Warn("Upstream head stream dropped, polling until it reconnects in %v: %v", backoff, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, streamMaxBackoff)
+	}
+}
+
+// consume dials the upstream, subscribes to newHeads and publishes heads
+// until the socket fails. subscribed reports whether the subscription was
+// established.
+func (s *HeadStream) consume(ctx context.Context) (subscribed bool, err error) {
+	dialer := *websocket.DefaultDialer
+	if s.tlsConfig != nil {
+		dialer.TLSClientConfig = s.tlsConfig.Clone()
+	}
+	conn, _, err := dialer.DialContext(ctx, s.url, nil)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	// Unblock the read below on shutdown
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "eth_subscribe",
+		"params":  []string{"newHeads"},
+	}); err != nil {
+		return false, err
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.timeout))
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Error  *Error          `json:"error"`
+			Method string          `json:"method"`
+			Params struct {
+				Result struct {
+					Number string `json:"number"`
+				} `json:"result"`
+			} `json:"params"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return subscribed, err
+		}
+
+		switch {
+		case msg.Error != nil:
+			return subscribed, fmt.Errorf("eth_subscribe: %s", msg.Error.Message)
+		case msg.ID != nil && !subscribed:
+			subscribed = true
+			s.connected.Store(true)
+			metrics.UpstreamStreamConnected.Set(1)
+			logger.Info("Upstream head stream subscribed at %s", s.url)
+		case msg.Method == "eth_subscription":
+			head, err := ParseHexUint64(msg.Params.Result.Number)
+			if err != nil {
+				logger.Warn("Invalid head %q from upstream stream", msg.Params.Result.Number)
+				continue
+			}
+			metrics.UpstreamStreamHeadsTotal.Inc()
+			s.publish(head)
+		}
+	}
+}
+
+// publish makes head the latest unconsumed head
+func (s *HeadStream) publish(head uint64) {
+	for {
+		select {
+		case s.heads <- head:
+			return
+		default:
+		}
+		// Replace the stale head the poller hasn't consumed yet
+		select {
+		case <-s.heads:
+		default:
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHeadStream(t *testing.T) {
+	drop := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var req Request
+		if conn.ReadJSON(&req) != nil || req.Method != "eth_subscribe" {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"result":"0xsub"}`))
+		for _, number := range []string{"0x10", "0x11"} {
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0xsub","result":{"number":"`+number+`"}}}`))
+		}
+		<-drop
+	}))
+	defer upstream.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := NewHeadStream("ws"+strings.TrimPrefix(upstream.URL, "http"), 5*time.Second)
+	done := make(chan struct{})
+	go func() {
+		stream.Run(ctx)
+		close(done)
+	}()
+
+	// Only the latest unconsumed head is kept
+	deadline := time.After(2 * time.Second)
+	for head := uint64(0); head != 0x11; {
+		select {
+		case head = <-stream.Heads():
+		case <-deadline:
+			t.Fatalf("Expected head 0x11, last got %#x", head)
+		}
+	}
+	if !stream.Connected() {
+		t.Error("Expected the stream to be connected")
+	}
+
+	close(drop)
+	for start := time.Now(); stream.Connected(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 2*time.Second {
+			t.Fatal("Expected the stream to report the dropped socket")
+		}
+	}
+
+	cancel()
+	<-done
+}
+
+func TestHeadStreamNil(t *testing.T) {
+	var stream *HeadStream
+	if stream.Connected() || stream.Heads() != nil {
+		t.Error("Expected a nil stream to be disconnected with no heads")
+	}
+}
@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// HypeSystemAddress sends the transactions crediting native HYPE transferred
+// from HyperCore to the EVM
+const HypeSystemAddress = "0x2222222222222222222222222222222222222222"
+
+// Kinds of system transaction
+const (
+	// SystemTxHypeDeposit credits native HYPE transferred from HyperCore
+	SystemTxHypeDeposit = "hypeDeposit"
+	// SystemTxTokenDeposit credits a HyperCore spot token linked to an EVM contract
+	SystemTxTokenDeposit = "tokenDeposit"
+)
+
+// tokenSystemPrefix starts the system address of a linked token: 0x20
+// followed by zeros and the big-endian token index
+const tokenSystemPrefix = "0x20"
+
+// Transaction is a transaction as returned in a full eth_getBlockByNumber block
+type Transaction struct {
+	Hash             string `json:"hash"`
+	From             string `json:"from"`
+	To               string `json:"to"`
+	Value            string `json:"value"`
+	Input            string `json:"input"`
+	Nonce            string `json:"nonce"`
+	Gas              string `json:"gas"`
+	GasPrice         string `json:"gasPrice"`
+	BlockNumber      string `json:"blockNumber"`
+	BlockHash        string `json:"blockHash"`
+	TransactionIndex string `json:"transactionIndex"`
+	Type             string `json:"type"`
+}
+
+// SystemTx is an hl_systemTxs notification: a system transaction and its kind
+type SystemTx struct {
+	Kind string `json:"kind"`
+	// TokenIndex is the HyperCore token index of a token deposit
+	TokenIndex string `json:"tokenIndex,omitempty"`
+	*Transaction
+}
+
+// ClassifyTransaction reports whether a transaction is a HyperCore system
+// transaction, identified by its sender being a system address
+func ClassifyTransaction(tx *Transaction) (*SystemTx, bool) {
+	from := strings.ToLower(tx.From)
+	if from == HypeSystemAddress {
+		return &SystemTx{Kind: SystemTxHypeDeposit, Transaction: tx}, true
+	}
+
+	// 0x20 + 11 zero bytes + 8-byte token index
+	if len(from) == 42 && strings.HasPrefix(from, tokenSystemPrefix) && strings.Trim(from[4:26], "0") == "" {
+		index, err := ParseHexUint64("0x" + from[26:])
+		if err != nil {
+			return nil, false
+		}
+		return &SystemTx{
+			Kind:        SystemTxTokenDeposit,
+			TokenIndex:  fmt.Sprintf("0x%x", index),
+			Transaction: tx,
+		}, true
+	}
+	return nil, false
+}
+
+// ClassifyTransactions returns the system transactions of a block
+func ClassifyTransactions(txs []Transaction) []SystemTx {
+	var systemTxs []SystemTx
+	for i := range txs {
+		if systemTx, ok := ClassifyTransaction(&txs[i]); ok {
+			systemTxs = append(systemTxs, *systemTx)
+		}
+	}
+	return systemTxs
+}
+
+// GetBlockTransactions fetches the full transactions of a block
+func (c *Client) GetBlockTransactions(ctx context.Context, blockNum string) ([]Transaction, error) {
+	params, _ := json.Marshal([]interface{}{blockNum, true})
+	req := &Request{
+		JSONRPC: "2.0",
+		Method:  "eth_getBlockByNumber",
+		Params:  params,
+		ID:      json.RawMessage("1"),
+	}
+
+	resp, err := c.Call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Error != nil {
+		return nil, fmt.Errorf("RPC error: %s", resp.Error.Message)
+	}
+
+	if resp.Result == nil || string(resp.Result) == "null" {
+		return nil, nil
+	}
+
+	var block struct {
+		Transactions []Transaction `json:"transactions"`
+	}
+	if err := json.Unmarshal(resp.Result, &block); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal block transactions: %w", err)
+	}
+	return block.Transactions, nil
+}
@@ -0,0 +1,166 @@
+package rpc
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+)
+
+// Topics of the token transfer events
+const (
+	// TransferEventTopic is Transfer(address,address,uint256), shared by ERC-20 and ERC-721
+	TransferEventTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	// TransferSingleEventTopic is TransferSingle(address,address,address,uint256,uint256)
+	TransferSingleEventTopic = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+	// TransferBatchEventTopic is TransferBatch(address,address,address,uint256[],uint256[])
+	TransferBatchEventTopic = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"
+)
+
+// Token standards of a token transfer
+const (
+	TokenStandardERC20   = "erc20"
+	TokenStandardERC721  = "erc721"
+	TokenStandardERC1155 = "erc1155"
+)
+
+// TokenTransfer is a tokenTransfers notification: a transfer event decoded
+// into a normalized form. Amount is set for ERC-20 and ERC-1155, TokenID for
+// ERC-721 and ERC-1155.
+type TokenTransfer struct {
+	Standard        string `json:"standard"`
+	Token           string `json:"token"`
+	From            string `json:"from"`
+	To              string `json:"to"`
+	Amount          string `json:"amount,omitempty"`
+	TokenID         string `json:"tokenId,omitempty"`
+	Operator        string `json:"operator,omitempty"`
+	BlockNumber     string `json:"blockNumber"`
+	BlockHash       string `json:"blockHash"`
+	TransactionHash string `json:"transactionHash"`
+	LogIndex        string `json:"logIndex"`
+	Removed         bool   `json:"removed,omitempty"`
+}
+
+// DecodeTokenTransfers decodes an ERC-20, ERC-721 or ERC-1155 transfer log.
+// An ERC-1155 batch yields one transfer per token ID. It returns nil for
+// other logs and for malformed transfer logs.
+func DecodeTokenTransfers(logEntry *Log) []TokenTransfer {
+	if len(logEntry.Topics) == 0 {
+		return nil
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(logEntry.Data, "0x"))
+	if err != nil {
+		return nil
+	}
+
+	base := TokenTransfer{
+		Token:           strings.ToLower(logEntry.Address),
+		BlockNumber:     logEntry.BlockNumber,
+		BlockHash:       logEntry.BlockHash,
+		TransactionHash: logEntry.TransactionHash,
+		LogIndex:        logEntry.LogIndex,
+		Removed:         logEntry.Removed,
+	}
+
+	topics := logEntry.Topics
+	switch strings.ToLower(topics[0]) {
+	case TransferEventTopic:
+		switch {
+		case len(topics) == 3 && len(data) >= 32:
+			base.Standard = TokenStandardERC20
+			base.Amount = wordToHex(data[:32])
+		case len(topics) == 4:
+			base.Standard = TokenStandardERC721
+			base.TokenID = topicToHex(topics[3])
+		default:
+			return nil
+		}
+		base.From = topicToAddress(topics[1])
+		base.To = topicToAddress(topics[2])
+		return []TokenTransfer{base}
+
+	case TransferSingleEventTopic:
+		if len(topics) != 4 || len(data) < 64 {
+			return nil
+		}
+		base.Standard = TokenStandardERC1155
+		base.Operator = topicToAddress(topics[1])
+		base.From = topicToAddress(topics[2])
+		base.To = topicToAddress(topics[3])
+		base.TokenID = wordToHex(data[:32])
+		base.Amount = wordToHex(data[32:64])
+		return []TokenTransfer{base}
+
+	case TransferBatchEventTopic:
+		if len(topics) != 4 || len(data) < 64 {
+			return nil
+		}
+		ids := decodeUintArray(data, data[:32])
+		values := decodeUintArray(data, data[32:64])
+		if ids == nil || len(ids) != len(values) {
+			return nil
+		}
+		base.Standard = TokenStandardERC1155
+		base.Operator = topicToAddress(topics[1])
+		base.From = topicToAddress(topics[2])
+		base.To = topicToAddress(topics[3])
+		transfers := make([]TokenTransfer, len(ids))
+		for i := range ids {
+			transfers[i] = base
+			transfers[i].TokenID = ids[i]
+			transfers[i].Amount = values[i]
+		}
+		return transfers
+	}
+	return nil
+}
+
+// decodeUintArray decodes an ABI-encoded uint256[] whose offset into data is
+// the given word, returning nil if it is out of bounds
+func decodeUintArray(data, offsetWord []byte) []string {
+	// Bounds are checked without adding to the offset, which the log's
+	// emitter controls and could wrap around
+	size := uint64(len(data))
+	offset := new(big.Int).SetBytes(offsetWord)
+	if size < 32 || !offset.IsUint64() || offset.Uint64() > size-32 {
+		return nil
+	}
+	start := offset.Uint64()
+	length := new(big.Int).SetBytes(data[start : start+32])
+	if !length.IsUint64() || length.Uint64() > (size-start-32)/32 {
+		return nil
+	}
+
+	values := make([]string, length.Uint64())
+	for i := range values {
+		word := start + 32 + uint64(i)*32
+		if word > size-32 {
+			return nil
+		}
+		values[i] = wordToHex(data[word : word+32])
+	}
+	return values
+}
+
+// wordToHex formats a 32-byte big-endian word as a hex quantity
+func wordToHex(word []byte) string {
+	return "0x" + new(big.Int).SetBytes(word).Text(16)
+}
+
+// topicToHex formats a topic as a hex quantity
+func topicToHex(topic string) string {
+	word, err := hex.DecodeString(strings.TrimPrefix(topic, "0x"))
+	if err != nil {
+		return topic
+	}
+	return wordToHex(word)
+}
+
+// topicToAddress returns the address held in the low 20 bytes of a topic
+func topicToAddress(topic string) string {
+	topic = strings.ToLower(strings.TrimPrefix(topic, "0x"))
+	if len(topic) < 40 {
+		return "0x" + topic
+	}
+	return "0x" + topic[len(topic)-40:]
+}
@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// defaultMaxIdleConns is the Go default cap on idle connections across hosts
+const defaultMaxIdleConns = 100
+
+// TransportOptions tune the connection pool of the upstream HTTP client.
+// Zero fields keep the Go defaults.
+type TransportOptions struct {
+	// MaxIdleConnsPerHost is how many idle connections are kept for reuse;
+	// the Go default of 2 makes busy proxies dial for most calls
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps connections to the upstream, idle or not
+	MaxConnsPerHost int
+	// IdleConnTimeout closes connections idle for that long
+	IdleConnTimeout time.Duration
+	// DisableKeepAlives dials a new connection for every call
+	DisableKeepAlives bool
+	// TCPKeepAlive is the period of TCP keep-alive probes; negative disables them
+	TCPKeepAlive time.Duration
+	// DialTimeout caps establishing a connection
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout caps the TLS handshake with an https upstream
+	TLSHandshakeTimeout time.Duration
+	// TLSConfig verifies and authenticates https upstreams; nil uses the
+	// system roots
+	TLSConfig *tls.Config
+}
+
+// TLSOptions locate the PKI of upstreams behind an internal CA
+type TLSOptions struct {
+	// CAFile is a PEM bundle of CAs trusted instead of the system roots
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and key presented
+	// to upstreams requiring mutual TLS
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify accepts any upstream certificate
+	InsecureSkipVerify bool
+}
+
+// Config loads the files of opts into a TLS config, or returns nil when
+// opts are empty
+func (opts TLSOptions) Config() (*tls.Config, error) {
+	if opts == (TLSOptions{}) {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA bundle %s", opts.CAFile)
+		}
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("client certificate and key must be set together")
+	}
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// SetTransport replaces the client's connection pools with ones tuned by
+// opts. Pooled connections of the previous transport are closed.
+func (c *Client) SetTransport(opts TransportOptions) {
+	c.transportOpts = opts
+	previous := c.httpClient
+	c.httpClient = &http.Client{Transport: newTransport(c.rpcURL, opts)}
+	previous.CloseIdleConnections()
+	if c.lanes != nil {
+		previous := c.lanes.fast
+		c.lanes.fast = &http.Client{Transport: newTransport(c.rpcURL, opts)}
+		previous.CloseIdleConnections()
+	}
+}
+
+// newTransport creates a connection pool to rpcURL tuned by opts. IPC
+// upstreams only use the idle connection count, keep-alives and dial
+// timeout.
+func newTransport(rpcURL string, opts TransportOptions) http.RoundTripper {
+	if path, ok := IPCPath(rpcURL); ok {
+		return newIPCTransport(path, opts)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		transport.MaxIdleConns = max(defaultMaxIdleConns, opts.MaxIdleConnsPerHost)
+	}
+	if opts.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+	if opts.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	if opts.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	}
+	if opts.TLSConfig != nil {
+		transport.TLSClientConfig = opts.TLSConfig.Clone()
+	}
+	transport.DisableKeepAlives = opts.DisableKeepAlives
+	if opts.TCPKeepAlive != 0 || opts.DialTimeout > 0 {
+		// The Go defaults, as in http.DefaultTransport
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		if opts.DialTimeout > 0 {
+			dialer.Timeout = opts.DialTimeout
+		}
+		if opts.TCPKeepAlive != 0 {
+			dialer.KeepAlive = opts.TCPKeepAlive
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	return transport
+}
@@ -16,6 +16,24 @@ type Response struct {
 	Result  json.RawMessage `json:"result,omitempty"`
 	Error   *Error          `json:"error,omitempty"`
 	ID      json.RawMessage `json:"id"`
+	// Quota lists the connection's quotas past a warning level (extension field)
+	Quota []QuotaStatus `json:"quota,omitempty"`
+	// Stale marks a result served from cache while the upstream is down (extension field)
+	Stale bool `json:"stale,omitempty"`
+	// Queued marks a transaction queued for sending once the upstream is back (extension field)
+	Queued bool `json:"queued,omitempty"`
+}
+
+// QuotaStatus is a connection's use of its request or bandwidth quota
+type QuotaStatus struct {
+	// Quota is "requests" or "bytes"
+	Quota string `json:"quota"`
+	Used  uint64 `json:"used"`
+	Limit uint64 `json:"limit"`
+	// Percent is the highest warning level reached, e.g. 80 or 95
+	Percent int `json:"percent"`
+	// ResetsAt is when the quota window ends, in Unix milliseconds
+	ResetsAt int64 `json:"resetsAt"`
 }
 
 // Error represents a JSON-RPC error
@@ -45,3 +63,13 @@ const (
 	ErrCodeInvalidParams  = -32602
 	ErrCodeInternalError  = -32603
 )
+
+// Server error codes
+const (
+	ErrCodeUnauthorized        = -32001
+	ErrCodeTimeout             = -32002
+	ErrCodeUpstreamUnavailable = -32003
+	ErrCodeFilterNotFound      = -32000
+	ErrCodeQuotaExceeded       = -32005
+	ErrCodeDraining            = -32006
+)
@@ -0,0 +1,120 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ErrUpstreamUnavailable is returned instead of calling an upstream that is
+// known to be unusable (RPC_URL unset or its hostname not resolving)
+var ErrUpstreamUnavailable = errors.New("upstream RPC unavailable")
+
+// upstreamStatus tracks whether the upstream can currently be reached
+type upstreamStatus struct {
+	ready  bool
+	reason string
+	mu     sync.RWMutex
+}
+
+func (s *upstreamStatus) set(ready bool, reason string) (changed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed = s.ready != ready || s.reason != reason
+	s.ready = ready
+	s.reason = reason
+	return changed
+}
+
+func (s *upstreamStatus) get() (bool, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ready, s.reason
+}
+
+// Ready reports whether the upstream is considered usable
+func (c *Client) Ready() bool {
+	ready, _ := c.status.get()
+	return ready
+}
+
+// Status returns the upstream readiness and, when not ready, the reason
+func (c *Client) Status() (bool, string) {
+	return c.status.get()
+}
+
+// CheckUpstream validates the upstream URL and resolves its hostname,
+// updating the readiness status. It returns whether the status changed.
+func (c *Client) CheckUpstream(ctx context.Context) (bool, error) {
+	err := c.resolveUpstream(ctx)
+	if err != nil {
+		return c.status.set(false, err.Error()), err
+	}
+	return c.status.set(true, ""), nil
+}
+
+func (c *Client) resolveUpstream(ctx context.Context) error {
+	_, err := c.LookupUpstream(ctx)
+	return err
+}
+
+// LookupUpstream resolves the upstream hostname and returns its addresses.
+// For an IPC upstream it checks the socket exists and returns its path.
+func (c *Client) LookupUpstream(ctx context.Context) ([]string, error) {
+	if c.rpcURL == "" {
+		return nil, errors.New("RPC_URL is not set")
+	}
+	if path, ok := IPCPath(c.rpcURL); ok {
+		return lookupSocket(path)
+	}
+
+	u, err := url.Parse(c.rpcURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RPC_URL: %w", err)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return nil, fmt.Errorf("invalid RPC_URL: missing host")
+	}
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	addrs, err := c.lookupHost(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve upstream host %s: %w", host, err)
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// lookupSocket checks that path is a unix domain socket
+func lookupSocket(path string) ([]string, error) {
+	if path == "" {
+		return nil, fmt.Errorf("invalid RPC_URL: missing socket path")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find upstream socket: %w", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return nil, fmt.Errorf("upstream path %s is not a socket", path)
+	}
+	return []string{path}, nil
+}
+
+// CloseIdleConnections drops pooled upstream connections so the next
+// requests dial again and pick up the current DNS resolution
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+	if c.lanes != nil {
+		c.lanes.fast.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"sort"
+	"sync"
+
+	"hlnode-websocket/internal/rpc"
+)
+
+// Memory is a Storage kept in process memory; nothing survives a restart
+type Memory struct {
+	blocks        map[uint64]*rpc.FullBlockHeader
+	logs          map[uint64][]rpc.Log
+	receipts      map[uint64][]rpc.TransactionReceipt
+	checkpoints   map[string][]byte
+	subscriptions map[string][]byte
+	// sizes is the encoded size of the chain data of each block, by kind
+	sizes map[string]map[uint64]int64
+	bytes int64
+	mu    sync.RWMutex
+}
+
+// Kinds of chain data accounted in Memory.sizes
+const (
+	kindBlock    = "block"
+	kindLogs     = "logs"
+	kindReceipts = "receipts"
+)
+
+// NewMemory creates an empty in-memory storage
+func NewMemory() *Memory {
+	return &Memory{
+		blocks:        make(map[uint64]*rpc.FullBlockHeader),
+		logs:          make(map[uint64][]rpc.Log),
+		receipts:      make(map[uint64][]rpc.TransactionReceipt),
+		checkpoints:   make(map[string][]byte),
+		subscriptions: make(map[string][]byte),
+		sizes: map[string]map[uint64]int64{
+			kindBlock:    make(map[uint64]int64),
+			kindLogs:     make(map[uint64]int64),
+			kindReceipts: make(map[uint64]int64),
+		},
+	}
+}
+
+// account records the encoded size of a kind of chain data of a block, or
+// forgets it when v is nil. m.mu must be held.
+func (m *Memory) account(kind string, number uint64, v interface{}) {
+	m.bytes -= m.sizes[kind][number]
+	delete(m.sizes[kind], number)
+	if v == nil {
+		return
+	}
+	data, _ := json.Marshal(v)
+	m.sizes[kind][number] = int64(len(data))
+	m.bytes += int64(len(data))
+}
+
+func (m *Memory) PutBlock(ctx context.Context, number uint64, block *rpc.FullBlockHeader) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blocks[number] = block
+	m.account(kindBlock, number, block)
+	return nil
+}
+
+func (m *Memory) GetBlock(ctx context.Context, number uint64) (*rpc.FullBlockHeader, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	block, ok := m.blocks[number]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return block, nil
+}
+
+func (m *Memory) PutLogs(ctx context.Context, number uint64, logs []rpc.Log) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logs[number] = append([]rpc.Log(nil), logs...)
+	m.account(kindLogs, number, logs)
+	return nil
+}
+
+func (m *Memory) GetLogs(ctx context.Context, from, to uint64) ([]rpc.Log, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var numbers []uint64
+	for n := range m.logs {
+		if n >= from && n <= to {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	var logs []rpc.Log
+	for _, n := range numbers {
+		logs = append(logs, m.logs[n]...)
+	}
+	return logs, nil
+}
+
+func (m *Memory) PutReceipts(ctx context.Context, number uint64, receipts []rpc.TransactionReceipt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.receipts[number] = append([]rpc.TransactionReceipt(nil), receipts...)
+	m.account(kindReceipts, number, receipts)
+	return nil
+}
+
+func (m *Memory) GetReceipts(ctx context.Context, number uint64) ([]rpc.TransactionReceipt, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	receipts, ok := m.receipts[number]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return receipts, nil
+}
+
+func (m *Memory) BlockRange(ctx context.Context) (oldest, newest uint64, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.blocks) == 0 {
+		return 0, 0, ErrNotFound
+	}
+	first := true
+	for n := range m.blocks {
+		if first || n < oldest {
+			oldest = n
+		}
+		if first || n > newest {
+			newest = n
+		}
+		first = false
+	}
+	return oldest, newest, nil
+}
+
+func (m *Memory) Spans(ctx context.Context) ([]Span, error) {
+	m.mu.RLock()
+	numbers := make([]uint64, 0, len(m.blocks))
+	for n := range m.blocks {
+		if _, ok := m.logs[n]; ok {
+			numbers = append(numbers, n)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	var spans []Span
+	for _, n := range numbers {
+		if len(spans) > 0 && spans[len(spans)-1].Last+1 == n {
+			spans[len(spans)-1].Last = n
+			continue
+		}
+		spans = append(spans, Span{First: n, Last: n})
+	}
+	return spans, nil
+}
+
+func (m *Memory) Prune(ctx context.Context, before uint64) error {
+	m.deleteBlocks(func(n uint64) bool { return n < before })
+	return nil
+}
+
+func (m *Memory) Truncate(ctx context.Context, from uint64) error {
+	m.deleteBlocks(func(n uint64) bool { return n >= from })
+	return nil
+}
+
+// deleteBlocks deletes the chain data of the block numbers matching drop
+func (m *Memory) deleteBlocks(drop func(uint64) bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for n := range m.blocks {
+		if drop(n) {
+			delete(m.blocks, n)
+			m.account(kindBlock, n, nil)
+		}
+	}
+	for n := range m.logs {
+		if drop(n) {
+			delete(m.logs, n)
+			m.account(kindLogs, n, nil)
+		}
+	}
+	for n := range m.receipts {
+		if drop(n) {
+			delete(m.receipts, n)
+			m.account(kindReceipts, n, nil)
+		}
+	}
+}
+
+// Size returns the encoded size of the stored chain data, checkpoints and
+// subscription state
+func (m *Memory) Size(ctx context.Context) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	size := m.bytes
+	for _, value := range m.checkpoints {
+		size += int64(len(value))
+	}
+	for _, data := range m.subscriptions {
+		size += int64(len(data))
+	}
+	return size, nil
+}
+
+// Compact copies the chain data into new maps, as Go maps don't shrink
+// when entries are deleted
+func (m *Memory) Compact(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blocks = maps.Clone(m.blocks)
+	m.logs = maps.Clone(m.logs)
+	m.receipts = maps.Clone(m.receipts)
+	for kind, sizes := range m.sizes {
+		m.sizes[kind] = maps.Clone(sizes)
+	}
+	return nil
+}
+
+func (m *Memory) PutCheckpoint(ctx context.Context, name string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkpoints[name] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *Memory) GetCheckpoint(ctx context.Context, name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.checkpoints[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (m *Memory) PutSubscriptions(ctx context.Context, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptions[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *Memory) GetSubscriptions(ctx context.Context, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.subscriptions[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (m *Memory) DeleteSubscriptions(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.subscriptions, key)
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
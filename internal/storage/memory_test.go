@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"hlnode-websocket/internal/rpc"
+)
+
+func TestOpen(t *testing.T) {
+	if _, err := Open(BackendMemory); err != nil {
+		t.Errorf("Expected the memory backend to open, got %v", err)
+	}
+	for _, backend := range []string{"sqlite", "redis", "postgres"} {
+		if _, err := Open(backend); err == nil {
+			t.Errorf("Expected %s to be unavailable", backend)
+		}
+	}
+}
+
+func TestMemoryChainData(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	if _, _, err := m.BlockRange(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an empty store, got %v", err)
+	}
+	for n := uint64(10); n <= 12; n++ {
+		hex := rpc.FormatHexUint64(n)
+		m.PutBlock(ctx, n, &rpc.FullBlockHeader{Number: hex})
+		m.PutLogs(ctx, n, []rpc.Log{{BlockNumber: hex, LogIndex: "0x0"}, {BlockNumber: hex, LogIndex: "0x1"}})
+		m.PutReceipts(ctx, n, []rpc.TransactionReceipt{{BlockNumber: hex}})
+	}
+
+	if oldest, newest, err := m.BlockRange(ctx); err != nil || oldest != 10 || newest != 12 {
+		t.Errorf("Expected range 10-12, got %d-%d (%v)", oldest, newest, err)
+	}
+	if block, err := m.GetBlock(ctx, 11); err != nil || block.Number != "0xb" {
+		t.Errorf("Expected block 11, got %+v (%v)", block, err)
+	}
+	logs, _ := m.GetLogs(ctx, 11, 20)
+	if len(logs) != 4 || logs[0].BlockNumber != "0xb" || logs[3].BlockNumber != "0xc" {
+		t.Errorf("Expected the logs of blocks 11 and 12 in order, got %+v", logs)
+	}
+
+	m.Prune(ctx, 12)
+	if _, err := m.GetBlock(ctx, 11); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected block 11 to be pruned, got %v", err)
+	}
+	if _, err := m.GetReceipts(ctx, 11); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected receipts of block 11 to be pruned, got %v", err)
+	}
+	if logs, _ := m.GetLogs(ctx, 0, 20); len(logs) != 2 {
+		t.Errorf("Expected only the logs of block 12, got %+v", logs)
+	}
+	if oldest, _, _ := m.BlockRange(ctx); oldest != 12 {
+		t.Errorf("Expected oldest block 12 after pruning, got %d", oldest)
+	}
+
+	for n := uint64(13); n <= 15; n++ {
+		m.PutBlock(ctx, n, &rpc.FullBlockHeader{Number: rpc.FormatHexUint64(n)})
+		m.PutLogs(ctx, n, []rpc.Log{{BlockNumber: rpc.FormatHexUint64(n)}})
+	}
+	m.PutBlock(ctx, 17, &rpc.FullBlockHeader{Number: "0x11"})
+	m.PutLogs(ctx, 17, nil)
+	m.PutBlock(ctx, 16, &rpc.FullBlockHeader{Number: "0x10"}) // logs missing
+	spans, _ := m.Spans(ctx)
+	if len(spans) != 2 || spans[0] != (Span{First: 12, Last: 15}) || spans[1] != (Span{First: 17, Last: 17}) {
+		t.Errorf("Expected spans 12-15 and 17, got %+v", spans)
+	}
+
+	m.Truncate(ctx, 14)
+	if oldest, newest, _ := m.BlockRange(ctx); oldest != 12 || newest != 13 {
+		t.Errorf("Expected range 12-13 after truncating, got %d-%d", oldest, newest)
+	}
+	if logs, _ := m.GetLogs(ctx, 14, 15); len(logs) != 0 {
+		t.Errorf("Expected the logs of truncated blocks deleted, got %+v", logs)
+	}
+}
+
+func TestMemoryState(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	value := []byte("0x10")
+	m.PutCheckpoint(ctx, "head", value)
+	value[0] = 'x'
+	if got, err := m.GetCheckpoint(ctx, "head"); err != nil || string(got) != "0x10" {
+		t.Errorf("Expected the stored checkpoint copy, got %q (%v)", got, err)
+	}
+	if _, err := m.GetCheckpoint(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	m.PutSubscriptions(ctx, "client", []byte(`[]`))
+	if data, err := m.GetSubscriptions(ctx, "client"); err != nil || string(data) != "[]" {
+		t.Errorf("Expected stored subscriptions, got %q (%v)", data, err)
+	}
+	m.DeleteSubscriptions(ctx, "client")
+	if _, err := m.GetSubscriptions(ctx, "client"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected deleted subscriptions, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"hlnode-websocket/internal/metrics"
+	"hlnode-websocket/internal/rpc"
+)
+
+// Reasons blocks are evicted for, in the order the limits are applied
+const (
+	EvictBlocks = "blocks"
+	EvictAge    = "age"
+	EvictSize   = "size"
+)
+
+// Retention bounds the chain data kept in storage by block count, block age
+// and size; a zero limit is unlimited
+type Retention struct {
+	Blocks uint64
+	MaxAge time.Duration
+	Bytes  int64
+}
+
+// Eviction reports what an Enforce pass evicted and what remains
+type Eviction struct {
+	// Evicted is the number of block numbers evicted by reason
+	Evicted map[string]uint64
+	// Blocks is the span of block numbers still stored
+	Blocks uint64
+	// Bytes is the approximate size of the store after the pass
+	Bytes int64
+}
+
+// Enforce evicts the oldest blocks beyond the retention limits, never those
+// at or after keepFrom (e.g. blocks not archived yet), then compacts the
+// store if anything was evicted. Ages are measured by block timestamp.
+func (r Retention) Enforce(ctx context.Context, store Storage, now time.Time, keepFrom uint64) (*Eviction, error) {
+	ev := &Eviction{Evicted: make(map[string]uint64)}
+	oldest, newest, err := store.BlockRange(ctx)
+	if errors.Is(err, ErrNotFound) {
+		ev.Bytes, err = store.Size(ctx)
+		return ev, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The newest block is always kept
+	limit := min(newest, keepFrom)
+	cutoff := oldest
+	evict := func(to uint64, reason string) {
+		to = min(to, limit)
+		if to > cutoff {
+			ev.Evicted[reason] += to - cutoff
+			cutoff = to
+		}
+	}
+
+	if r.Blocks > 0 && newest-oldest+1 > r.Blocks {
+		evict(newest-r.Blocks+1, EvictBlocks)
+	}
+
+	if r.MaxAge > 0 {
+		horizon := now.Add(-r.MaxAge).Unix()
+		n := cutoff
+		for ; n < limit; n++ {
+			block, err := store.GetBlock(ctx, n)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if ts, err := rpc.ParseHexUint64(block.Timestamp); err != nil || int64(ts) >= horizon {
+				break
+			}
+		}
+		evict(n, EvictAge)
+	}
+
+	if cutoff > oldest {
+		if err := store.Prune(ctx, cutoff); err != nil {
+			return nil, err
+		}
+	}
+
+	if ev.Bytes, err = store.Size(ctx); err != nil {
+		return nil, err
+	}
+	// Evict the share of the remaining blocks by which the store is too large
+	if r.Bytes > 0 && ev.Bytes > r.Bytes && cutoff < limit {
+		span := newest - cutoff + 1
+		excess := uint64((ev.Bytes - r.Bytes) * int64(span) / ev.Bytes)
+		before := cutoff
+		evict(cutoff+max(excess, 1), EvictSize)
+		if cutoff > before {
+			if err := store.Prune(ctx, cutoff); err != nil {
+				return nil, err
+			}
+			if ev.Bytes, err = store.Size(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cutoff > oldest {
+		if err := store.Compact(ctx); err != nil {
+			return nil, err
+		}
+		if ev.Bytes, err = store.Size(ctx); err != nil {
+			return nil, err
+		}
+	}
+	ev.Blocks = newest - cutoff + 1
+
+	for reason, n := range ev.Evicted {
+		metrics.StorageEvictedBlocks.WithLabelValues(reason).Add(float64(n))
+	}
+	metrics.StorageBlocks.Set(float64(ev.Blocks))
+	metrics.StorageBytes.Set(float64(ev.Bytes))
+	return ev, nil
+}
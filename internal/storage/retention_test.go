@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hlnode-websocket/internal/rpc"
+)
+
+// storeBlocks stores blocks from..to, one second apart from start, with one log each
+func storeBlocks(ctx context.Context, m *Memory, from, to uint64, start time.Time) {
+	for n := from; n <= to; n++ {
+		hex := rpc.FormatHexUint64(n)
+		ts := rpc.FormatHexUint64(uint64(start.Unix()) + n - from)
+		m.PutBlock(ctx, n, &rpc.FullBlockHeader{Number: hex, Timestamp: ts})
+		m.PutLogs(ctx, n, []rpc.Log{{BlockNumber: hex, LogIndex: "0x0"}})
+	}
+}
+
+func TestRetentionBlocksAndAge(t *testing.T) {
+	ctx := context.Background()
+	start := time.Unix(1700000000, 0)
+	m := NewMemory()
+	storeBlocks(ctx, m, 1, 100, start)
+
+	// Block 100 is 99s old: 80 blocks are kept by count, 30 by age
+	r := Retention{Blocks: 80, MaxAge: 30 * time.Second}
+	ev, err := r.Enforce(ctx, m, start.Add(99*time.Second), ^uint64(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Evicted[EvictBlocks] != 20 || ev.Evicted[EvictAge] != 49 || ev.Blocks != 31 {
+		t.Errorf("Expected 20 blocks evicted by count and 49 by age, 31 kept, got %+v", ev)
+	}
+	if oldest, _, _ := m.BlockRange(ctx); oldest != 70 {
+		t.Errorf("Expected block 70 to be the oldest kept, got %d", oldest)
+	}
+
+	// Blocks not archived yet are kept whatever the limits
+	ev, _ = Retention{Blocks: 1}.Enforce(ctx, m, start, 80)
+	if ev.Evicted[EvictBlocks] != 10 {
+		t.Errorf("Expected eviction to stop at block 80, got %+v", ev)
+	}
+}
+
+func TestRetentionSize(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	storeBlocks(ctx, m, 1, 100, time.Unix(1700000000, 0))
+	size, _ := m.Size(ctx)
+
+	ev, err := Retention{Bytes: size / 4}.Enforce(ctx, m, time.Now(), ^uint64(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Evicted[EvictSize] == 0 || ev.Bytes > size/4+size/50 {
+		t.Errorf("Expected the store to shrink to about %d bytes, got %+v", size/4, ev)
+	}
+	if after, _ := m.Size(ctx); after != ev.Bytes {
+		t.Errorf("Expected the reported size %d to match the store, got %d", ev.Bytes, after)
+	}
+
+	// Everything stored counts, and pruning releases it
+	m.Prune(ctx, 1000)
+	if after, _ := m.Size(ctx); after != 0 {
+		t.Errorf("Expected an empty store to have size 0, got %d", after)
+	}
+}
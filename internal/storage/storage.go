@@ -0,0 +1,84 @@
+// Package storage defines the backend persisting polled chain data (blocks,
+// logs, receipts) and proxy state (checkpoints, subscriptions), so
+// persistence features work the same whatever backend a deployment uses
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"hlnode-websocket/internal/rpc"
+)
+
+// BackendMemory is the in-process backend selectable with STORAGE_BACKEND
+const BackendMemory = "memory"
+
+// Span is a run of consecutive block numbers, First to Last inclusive
+type Span struct {
+	First, Last uint64
+}
+
+// ErrNotFound is returned when a key or block is not stored
+var ErrNotFound = errors.New("not found")
+
+// Storage persists chain data by block number and proxy state by key.
+// Implementations are safe for concurrent use.
+type Storage interface {
+	// PutBlock stores a block header, replacing any stored at its number
+	PutBlock(ctx context.Context, number uint64, block *rpc.FullBlockHeader) error
+	// GetBlock returns the header stored at a block number
+	GetBlock(ctx context.Context, number uint64) (*rpc.FullBlockHeader, error)
+
+	// PutLogs stores the logs of a block, replacing any stored for it
+	PutLogs(ctx context.Context, number uint64, logs []rpc.Log) error
+	// GetLogs returns the stored logs of the blocks in [from, to], in block order
+	GetLogs(ctx context.Context, from, to uint64) ([]rpc.Log, error)
+
+	// PutReceipts stores the receipts of a block, replacing any stored for it
+	PutReceipts(ctx context.Context, number uint64, receipts []rpc.TransactionReceipt) error
+	// GetReceipts returns the receipts stored for a block
+	GetReceipts(ctx context.Context, number uint64) ([]rpc.TransactionReceipt, error)
+
+	// BlockRange returns the oldest and newest stored block numbers, or
+	// ErrNotFound if no block is stored
+	BlockRange(ctx context.Context) (oldest, newest uint64, err error)
+	// Spans returns the runs of consecutive blocks stored with their logs,
+	// oldest first. Blocks whose logs couldn't be fetched, or that the
+	// poller skipped, are holes between spans.
+	Spans(ctx context.Context) ([]Span, error)
+	// Prune deletes the blocks, logs and receipts of blocks before a number
+	Prune(ctx context.Context, before uint64) error
+	// Truncate deletes the blocks, logs and receipts of blocks from a number
+	// on, e.g. those replaced by a reorg
+	Truncate(ctx context.Context, from uint64) error
+	// Size returns the approximate bytes held by the backend
+	Size(ctx context.Context) (int64, error)
+	// Compact reclaims the space freed by Prune
+	Compact(ctx context.Context) error
+
+	// PutCheckpoint stores a named progress marker, e.g. the last polled head
+	PutCheckpoint(ctx context.Context, name string, value []byte) error
+	// GetCheckpoint returns a named progress marker
+	GetCheckpoint(ctx context.Context, name string) ([]byte, error)
+
+	// PutSubscriptions stores exported subscription state under a key
+	PutSubscriptions(ctx context.Context, key string, data []byte) error
+	// GetSubscriptions returns the subscription state stored under a key
+	GetSubscriptions(ctx context.Context, key string) ([]byte, error)
+	// DeleteSubscriptions deletes the subscription state stored under a key
+	DeleteSubscriptions(ctx context.Context, key string) error
+
+	// Close releases the backend's resources
+	Close() error
+}
+
+// Open opens the storage backend of the given name
+func Open(backend string) (Storage, error) {
+	switch backend {
+	case BackendMemory:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (supported: %s)", backend, BackendMemory)
+	}
+}
@@ -0,0 +1,73 @@
+package subscription
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// DefaultDeltaSnapshotInterval is how many notifications of a delta
+// subscription are sent between full snapshots, unless configured otherwise
+const DefaultDeltaSnapshotInterval = 32
+
+// deltaKeys are always kept in a delta so clients can place it on their chain
+var deltaKeys = []string{"number", "hash"}
+
+// deltaState is the last full view a delta subscription's client holds
+type deltaState struct {
+	base map[string]json.RawMessage
+	// sinceSnapshot counts the deltas sent since the last full snapshot
+	sinceSnapshot int
+}
+
+// Delta returns the notification result for a subscription with the delta
+// option: every snapshotInterval notifications (and the first) the full
+// result, otherwise an object holding only the fields that changed from the
+// previous result, number, hash and "delta":true. Removed fields are null.
+// Results that don't encode as a JSON object are returned unchanged.
+func (s *Subscription) Delta(result interface{}, snapshotInterval int) interface{} {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return result
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return result
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	base := s.delta.base
+	s.delta.base = fields
+	if base == nil || s.delta.sinceSnapshot+1 >= snapshotInterval {
+		s.delta.sinceSnapshot = 0
+		return result
+	}
+	s.delta.sinceSnapshot++
+
+	changed := map[string]json.RawMessage{"delta": json.RawMessage("true")}
+	for key, value := range fields {
+		if old, ok := base[key]; !ok || !bytes.Equal(old, value) {
+			changed[key] = value
+		}
+	}
+	for key := range base {
+		if _, ok := fields[key]; !ok {
+			changed[key] = json.RawMessage("null")
+		}
+	}
+	for _, key := range deltaKeys {
+		if value, ok := fields[key]; ok {
+			changed[key] = value
+		}
+	}
+	return changed
+}
+
+// ResetDelta makes the next notification a full snapshot, after one was
+// dropped and the client's view can no longer be patched
+func (s *Subscription) ResetDelta() {
+	s.mu.Lock()
+	s.delta = deltaState{}
+	s.mu.Unlock()
+}
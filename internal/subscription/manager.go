@@ -1,12 +1,19 @@
 package subscription
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"hlnode-websocket/internal/clock"
 	"hlnode-websocket/internal/logger"
 	"hlnode-websocket/internal/metrics"
 	"hlnode-websocket/internal/rpc"
@@ -18,32 +25,252 @@ type SubscriptionType string
 const (
 	SubTypeNewHeads SubscriptionType = "newHeads"
 	SubTypeLogs     SubscriptionType = "logs"
+	// newHeads with only number, hash, parentHash and timestamp
+	SubTypeNewHeadsLite SubscriptionType = "newHeadsLite"
 	// Custom Hyperliquid subscriptions
 	SubTypeGasPrice      SubscriptionType = "gasPrice"
 	SubTypeBlockReceipts SubscriptionType = "blockReceipts"
 	SubTypeSyncing       SubscriptionType = "syncing"
+	// Watches a single transaction until it reaches the requested depth
+	SubTypeTxConfirmation SubscriptionType = "txConfirmation"
+	// Headers of big blocks only, alongside the big block gas price
+	SubTypeBigBlocks SubscriptionType = "hl_bigBlocks"
+	// HyperCore system transactions (deposits to the EVM)
+	SubTypeSystemTxs SubscriptionType = "hl_systemTxs"
+	// Previously delivered blocks replaced by a chain reorganization
+	SubTypeReorg SubscriptionType = "reorg"
+	// ERC-20/721/1155 transfers decoded from logs
+	SubTypeTokenTransfers SubscriptionType = "tokenTransfers"
+	// Per-block aggregates derived from the polled block and its receipts
+	SubTypeBlockStats SubscriptionType = "blockStats"
+	// Native balance changes of registered addresses
+	SubTypeBalanceChanges SubscriptionType = "balanceChanges"
+	// Nonce changes of registered addresses, checked every block
+	SubTypeNonceChanges SubscriptionType = "nonceChanges"
+	// Base fee of new heads, only when it changes
+	SubTypeBaseFee SubscriptionType = "baseFee"
+	// Periodic eth_feeHistory results for fee estimators
+	SubTypeFeeHistory SubscriptionType = "feeHistory"
+	// Synthetic subscriptions (no chain dependency)
+	SubTypeTest SubscriptionType = "test"
+	// Admin-only subscriptions
+	SubTypeProxyMetrics SubscriptionType = "proxyMetrics"
 )
 
+// Types lists every subscription type
+var Types = []SubscriptionType{
+	SubTypeNewHeads, SubTypeNewHeadsLite, SubTypeLogs, SubTypeGasPrice, SubTypeBlockReceipts, SubTypeBlockStats,
+	SubTypeBaseFee, SubTypeFeeHistory, SubTypeBalanceChanges, SubTypeNonceChanges, SubTypeSyncing,
+	SubTypeTxConfirmation, SubTypeBigBlocks, SubTypeSystemTxs, SubTypeReorg, SubTypeTokenTransfers, SubTypeTest,
+	SubTypeProxyMetrics,
+}
+
+// maxHeldNotifications bounds the queue of a held subscription
+const maxHeldNotifications = 1024
+
 // Subscription represents an active subscription
 type Subscription struct {
 	ID       string
 	Type     SubscriptionType
 	Params   json.RawMessage
+	Options  Options
 	ClientID string
+	// CreatedAt is when the subscription was created
+	CreatedAt time.Time
+
+	// held subscriptions queue live notifications until released,
+	// e.g. while a historical backfill is being delivered
+	held    bool
+	pending [][]byte
+
+	// paused subscriptions drop notifications until resumed
+	paused bool
+
+	// lastSent is when the last notification was delivered, for heartbeats
+	lastSent time.Time
+
+	// expiresAt is when a subscription with a TTL is removed, zero otherwise
+	expiresAt time.Time
+
+	// seq is the sequence number of the last delivered notification. seqMu
+	// keeps stamping and sending atomic so numbers reach the client in order.
+	seq   uint64
+	seqMu sync.Mutex
+
+	// resumable subscriptions retain their last notifications in history and
+	// survive a disconnect, detached, until resumed with resumeToken
+	resumeToken string
+	history     [][]byte
+	historySize int
+	detachedAt  time.Time
+
+	// instance is the replica ID echoed in notifications when Options.Instance is set
+	instance string
+
+	// token bucket enforcing Options.MaxPerSecond
+	tokens     float64
+	lastRefill time.Time
+
+	// delta is the client's view of a subscription with Options.Delta
+	delta deltaState
+
+	// failures counts consecutive notifications that could not be created
+	failures int
+
+	mu sync.Mutex
+}
+
+// Throttle reports whether a notification at now exceeds the subscription's
+// maxPerSecond and must be dropped. The rate allows bursts of up to
+// maxPerSecond notifications.
+func (s *Subscription) Throttle(now time.Time) bool {
+	limit := float64(s.Options.MaxPerSecond)
+	if limit == 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastRefill.IsZero() {
+		s.tokens = limit
+	} else {
+		s.tokens = min(limit, s.tokens+now.Sub(s.lastRefill).Seconds()*limit)
+	}
+	s.lastRefill = now
+	if s.tokens < 1 {
+		return true
+	}
+	s.tokens--
+	return false
+}
+
+// Enqueue queues a notification if the subscription is held.
+// Returns false if the notification should be sent immediately.
+func (s *Subscription) Enqueue(data []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.held {
+		return false
+	}
+	if len(s.pending) < maxHeldNotifications {
+		s.pending = append(s.pending, data)
+	} else {
+		logger.Warn("Held subscription %s queue full, dropping notification", s.ID)
+	}
+	return true
+}
+
+// notificationPrefix is how every marshaled notification starts; the sequence
+// number is inserted right after it
+var notificationPrefix = []byte(`{"jsonrpc":"2.0","method":"eth_subscription","params":{`)
+
+// receivedAtField is the field WireV2 notifications carry after seq
+var receivedAtField = []byte(`"receivedAt":`)
+
+// Receive stamps a notification of a WireV2 subscription with receivedAt, the
+// time in Unix milliseconds at which the proxy received its data. Stamping
+// happens once, before the notification is held or delivered.
+func (s *Subscription) Receive(data []byte, now time.Time) []byte {
+	if s.Options.Version < WireV2 || !bytes.HasPrefix(data, notificationPrefix) ||
+		bytes.HasPrefix(data[len(notificationPrefix):], receivedAtField) {
+		return data
+	}
+	stamped := make([]byte, 0, len(data)+32)
+	stamped = append(stamped, notificationPrefix...)
+	stamped = append(stamped, receivedAtField...)
+	stamped = strconv.AppendInt(stamped, now.UnixMilli(), 10)
+	stamped = append(stamped, ',')
+	return append(stamped, data[len(notificationPrefix):]...)
+}
+
+// Sequence stamps a notification with the subscription's next sequence number
+// and passes it to send. The number is consumed even if send drops the
+// notification, so clients can detect the gap. WireV1 notifications are sent
+// unchanged unless the subscription is resumable, which needs seq.
+func (s *Subscription) Sequence(data []byte, send func([]byte) bool) bool {
+	s.seqMu.Lock()
+	defer s.seqMu.Unlock()
+
+	s.seq++
+	if (s.Options.Version < WireV2 && s.resumeToken == "") || !bytes.HasPrefix(data, notificationPrefix) {
+		return send(data)
+	}
+	stamped := make([]byte, 0, len(data)+24)
+	stamped = append(stamped, notificationPrefix...)
+	stamped = append(stamped, `"seq":`...)
+	stamped = strconv.AppendUint(stamped, s.seq, 10)
+	stamped = append(stamped, ',')
+	stamped = append(stamped, data[len(notificationPrefix):]...)
+	s.retain(stamped)
+	return send(stamped)
+}
+
+// MarkSent records that a notification was delivered at now
+func (s *Subscription) MarkSent(now time.Time) {
+	s.mu.Lock()
+	s.lastSent = now
+	s.mu.Unlock()
+}
+
+// HeartbeatDue reports whether the subscription asked for heartbeats and has
+// been quiet for the heartbeat interval at now. Detached subscriptions get no
+// heartbeats, which would only crowd out their retained notifications.
+func (s *Subscription) HeartbeatDue(now time.Time) bool {
+	if s.Options.Heartbeat == 0 || s.Detached() {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Sub(s.lastSent) >= s.Options.Heartbeat
+}
+
+// Expired reports whether the subscription's TTL has elapsed at now
+func (s *Subscription) Expired(now time.Time) bool {
+	return !s.expiresAt.IsZero() && !now.Before(s.expiresAt)
+}
+
+// Paused reports whether the client paused the subscription
+func (s *Subscription) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// release clears the held flag and returns the queued notifications
+func (s *Subscription) release() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.pending
+	s.held = false
+	s.pending = nil
+	return pending
 }
 
 // LogFilter represents filter params for logs subscription
 // Supports flexible parsing where address can be string or []string
 // and topics can be (string | []string | null)[] for position-based OR matching
+// FromBlock, when set, requests a historical backfill before live delivery
 type LogFilter struct {
-	Address []string
-	Topics  [][]string
+	Address   []string
+	Topics    [][]string
+	FromBlock string
+
+	// ExcludeAddress and ExcludeTopics reject logs that would otherwise match
+	ExcludeAddress []string
+	ExcludeTopics  [][]string
 }
 
 // logFilterRaw is used for flexible JSON unmarshalling
 type logFilterRaw struct {
-	Address json.RawMessage   `json:"address,omitempty"`
-	Topics  []json.RawMessage `json:"topics,omitempty"`
+	Address        json.RawMessage   `json:"address,omitempty"`
+	Topics         []json.RawMessage `json:"topics,omitempty"`
+	FromBlock      string            `json:"fromBlock,omitempty"`
+	ExcludeAddress json.RawMessage   `json:"excludeAddress,omitempty"`
+	ExcludeTopics  []json.RawMessage `json:"excludeTopics,omitempty"`
 }
 
 // UnmarshalJSON implements custom unmarshalling for LogFilter
@@ -54,54 +281,385 @@ func (f *LogFilter) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	f.FromBlock = raw.FromBlock
+
 	// Parse address: can be string or []string
-	if len(raw.Address) > 0 {
+	f.Address = parseAddresses(raw.Address)
+	f.ExcludeAddress = parseAddresses(raw.ExcludeAddress)
+
+	f.Topics = parseTopics(raw.Topics)
+	f.ExcludeTopics = parseTopics(raw.ExcludeTopics)
+
+	return nil
+}
+
+// parseTopics parses a topics param where each element can be null, string, or []string
+func parseTopics(raw []json.RawMessage) [][]string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	topics := make([][]string, len(raw))
+	for i, topicRaw := range raw {
+		if topicRaw == nil || string(topicRaw) == "null" {
+			// null means match any topic at this position
+			topics[i] = nil
+			continue
+		}
+
 		// Try as single string first
-		var singleAddr string
-		if err := json.Unmarshal(raw.Address, &singleAddr); err == nil {
-			f.Address = []string{normalizeAddress(singleAddr)}
+		var singleTopic string
+		if err := json.Unmarshal(topicRaw, &singleTopic); err == nil {
+			topics[i] = []string{normalizeTopic(singleTopic)}
 		} else {
-			// Try as array of strings
-			var addrArray []string
-			if err := json.Unmarshal(raw.Address, &addrArray); err == nil {
-				f.Address = make([]string, len(addrArray))
-				for i, addr := range addrArray {
-					f.Address[i] = normalizeAddress(addr)
+			// Try as array of strings (OR matching)
+			var topicArray []string
+			if err := json.Unmarshal(topicRaw, &topicArray); err == nil {
+				topics[i] = make([]string, len(topicArray))
+				for j, topic := range topicArray {
+					topics[i][j] = normalizeTopic(topic)
 				}
 			}
 		}
 	}
+	return topics
+}
 
-	// Parse topics: each element can be null, string, or []string
-	if len(raw.Topics) > 0 {
-		f.Topics = make([][]string, len(raw.Topics))
-		for i, topicRaw := range raw.Topics {
-			if topicRaw == nil || string(topicRaw) == "null" {
-				// null means match any topic at this position
-				f.Topics[i] = nil
-				continue
-			}
+// parseAddresses parses an address param that can be a string or []string
+func parseAddresses(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
 
-			// Try as single string first
-			var singleTopic string
-			if err := json.Unmarshal(topicRaw, &singleTopic); err == nil {
-				f.Topics[i] = []string{normalizeTopic(singleTopic)}
-			} else {
-				// Try as array of strings (OR matching)
-				var topicArray []string
-				if err := json.Unmarshal(topicRaw, &topicArray); err == nil {
-					f.Topics[i] = make([]string, len(topicArray))
-					for j, topic := range topicArray {
-						f.Topics[i][j] = normalizeTopic(topic)
-					}
-				}
-			}
+	// Try as single string first
+	var singleAddr string
+	if err := json.Unmarshal(raw, &singleAddr); err == nil {
+		return []string{normalizeAddress(singleAddr)}
+	}
+
+	// Try as array of strings
+	var addrArray []string
+	if err := json.Unmarshal(raw, &addrArray); err == nil {
+		addresses := make([]string, len(addrArray))
+		for i, addr := range addrArray {
+			addresses[i] = normalizeAddress(addr)
 		}
+		return addresses
 	}
+	return nil
+}
 
+// TokenTransferFilter represents filter params for tokenTransfers subscription.
+// Address matches the sender or recipient, Token the token contract.
+type TokenTransferFilter struct {
+	Address []string
+	Token   []string
+}
+
+// UnmarshalJSON accepts address and token as a string or []string
+func (f *TokenTransferFilter) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Address json.RawMessage `json:"address,omitempty"`
+		Token   json.RawMessage `json:"token,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	f.Address = parseAddresses(raw.Address)
+	f.Token = parseAddresses(raw.Token)
 	return nil
 }
 
+// ParseTokenTransferFilter parses and validates tokenTransfers params
+func ParseTokenTransferFilter(params json.RawMessage) (*TokenTransferFilter, error) {
+	var filter TokenTransferFilter
+	if len(params) == 0 {
+		return &filter, nil
+	}
+	if err := json.Unmarshal(params, &filter); err != nil {
+		return nil, fmt.Errorf("invalid tokenTransfers params: %w", err)
+	}
+	return &filter, nil
+}
+
+// MatchesTokenTransferFilter checks a transfer against the token and
+// sender/recipient filters; empty filters match everything
+func MatchesTokenTransferFilter(transfer *rpc.TokenTransfer, filter *TokenTransferFilter) bool {
+	if filter == nil {
+		return true
+	}
+	if len(filter.Token) > 0 && !containsAddress(filter.Token, transfer.Token) {
+		return false
+	}
+	if len(filter.Address) > 0 && !containsAddress(filter.Address, transfer.From) && !containsAddress(filter.Address, transfer.To) {
+		return false
+	}
+	return true
+}
+
+// containsAddress reports whether addr is one of the normalized addresses
+func containsAddress(addresses []string, addr string) bool {
+	addr = normalizeAddress(addr)
+	for _, a := range addresses {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxBalanceAddresses is the most addresses a balanceChanges subscription may watch
+const MaxBalanceAddresses = 100
+
+// BalanceFilter represents params for balanceChanges subscription
+type BalanceFilter struct {
+	Address []string
+}
+
+// UnmarshalJSON accepts address as a string or []string
+func (f *BalanceFilter) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Address json.RawMessage `json:"address,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	f.Address = parseAddresses(raw.Address)
+	return nil
+}
+
+// ParseBalanceFilter parses and validates balanceChanges params, which
+// require at least one address
+func ParseBalanceFilter(params json.RawMessage) (*BalanceFilter, error) {
+	var filter BalanceFilter
+	if len(params) == 0 {
+		return nil, fmt.Errorf("balanceChanges requires an address parameter")
+	}
+	if err := json.Unmarshal(params, &filter); err != nil {
+		return nil, fmt.Errorf("invalid balanceChanges params: %w", err)
+	}
+	if len(filter.Address) == 0 {
+		return nil, fmt.Errorf("balanceChanges requires an address parameter")
+	}
+	if len(filter.Address) > MaxBalanceAddresses {
+		return nil, fmt.Errorf("at most %d addresses can be watched per subscription", MaxBalanceAddresses)
+	}
+	return &filter, nil
+}
+
+// MaxNonceAddresses is the most addresses a nonceChanges subscription may
+// watch; every watched address costs an upstream call per block
+const MaxNonceAddresses = 100
+
+// NonceFilter represents params for nonceChanges subscription
+type NonceFilter struct {
+	Address []string
+}
+
+// UnmarshalJSON accepts address as a string or []string
+func (f *NonceFilter) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Address json.RawMessage `json:"address,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	f.Address = parseAddresses(raw.Address)
+	return nil
+}
+
+// ParseNonceFilter parses and validates nonceChanges params, which
+// require at least one address
+func ParseNonceFilter(params json.RawMessage) (*NonceFilter, error) {
+	var filter NonceFilter
+	if len(params) == 0 {
+		return nil, fmt.Errorf("nonceChanges requires an address parameter")
+	}
+	if err := json.Unmarshal(params, &filter); err != nil {
+		return nil, fmt.Errorf("invalid nonceChanges params: %w", err)
+	}
+	if len(filter.Address) == 0 {
+		return nil, fmt.Errorf("nonceChanges requires an address parameter")
+	}
+	if len(filter.Address) > MaxNonceAddresses {
+		return nil, fmt.Errorf("at most %d addresses can be watched per subscription", MaxNonceAddresses)
+	}
+	return &filter, nil
+}
+
+// ReceiptsFilter represents filter params for blockReceipts subscription
+type ReceiptsFilter struct {
+	Address []string
+}
+
+// UnmarshalJSON accepts address as a string or []string
+func (f *ReceiptsFilter) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Address json.RawMessage `json:"address,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	f.Address = parseAddresses(raw.Address)
+	return nil
+}
+
+// ParseReceiptsFilter parses and validates blockReceipts subscription params
+func ParseReceiptsFilter(params json.RawMessage) (*ReceiptsFilter, error) {
+	var filter ReceiptsFilter
+	if len(params) == 0 {
+		return &filter, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(params, &fields); err != nil {
+		return nil, fmt.Errorf("invalid blockReceipts params: must be an object")
+	}
+	for key, value := range fields {
+		if key == "address" {
+			if err := validateAddressField(key, value); err != nil {
+				return nil, fmt.Errorf("invalid blockReceipts params: %w", err)
+			}
+		} else if !IsOptionField(key) {
+			return nil, fmt.Errorf("invalid blockReceipts params: unknown field %q", key)
+		}
+	}
+	if err := json.Unmarshal(params, &filter); err != nil {
+		return nil, fmt.Errorf("invalid blockReceipts params: %w", err)
+	}
+	return &filter, nil
+}
+
+// MatchesReceiptsFilter checks if a receipt's from, to or contractAddress
+// is one of the filter addresses
+func MatchesReceiptsFilter(receipt *rpc.TransactionReceipt, filter *ReceiptsFilter) bool {
+	if filter == nil || len(filter.Address) == 0 {
+		return true
+	}
+
+	for _, addr := range filter.Address {
+		if strings.ToLower(receipt.From) == addr ||
+			strings.ToLower(receipt.To) == addr ||
+			strings.ToLower(receipt.ContractAddress) == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// TxConfirmationFilter represents filter params for txConfirmation subscription
+type TxConfirmationFilter struct {
+	Hash string `json:"hash"`
+}
+
+// ParseTxConfirmationFilter parses and validates txConfirmation subscription params
+func ParseTxConfirmationFilter(params json.RawMessage) (*TxConfirmationFilter, error) {
+	var filter TxConfirmationFilter
+	if len(params) == 0 {
+		return nil, fmt.Errorf("txConfirmation requires a hash parameter")
+	}
+	if err := json.Unmarshal(params, &filter); err != nil {
+		return nil, fmt.Errorf("invalid txConfirmation params: %w", err)
+	}
+	if !isHash(filter.Hash) {
+		return nil, fmt.Errorf("hash must be a 32-byte hex transaction hash")
+	}
+	filter.Hash = strings.ToLower(filter.Hash)
+	return &filter, nil
+}
+
+// isHash reports whether s is a 0x-prefixed 32-byte hex string
+func isHash(s string) bool {
+	return len(s) == 66 && strings.HasPrefix(s, "0x") && isHexDigits(s[2:])
+}
+
+// GasPriceFilter represents filter params for gasPrice subscription
+type GasPriceFilter struct {
+	// MinChangePercent suppresses notifications until the price moved more
+	// than this percentage from the last value sent to the subscriber
+	MinChangePercent float64 `json:"minChangePercent,omitempty"`
+}
+
+// ParseGasPriceFilter parses and validates gasPrice subscription params
+func ParseGasPriceFilter(params json.RawMessage) (*GasPriceFilter, error) {
+	var filter GasPriceFilter
+	if len(params) == 0 {
+		return &filter, nil
+	}
+	if err := json.Unmarshal(params, &filter); err != nil {
+		return nil, fmt.Errorf("invalid gasPrice params: %w", err)
+	}
+	if filter.MinChangePercent < 0 {
+		return nil, fmt.Errorf("minChangePercent must not be negative")
+	}
+	return &filter, nil
+}
+
+// Fee history window bounds
+const (
+	DefaultFeeHistoryBlocks = 20
+	MaxFeeHistoryBlocks     = 1024
+	MaxRewardPercentiles    = 100
+)
+
+// FeeHistoryFilter represents params for feeHistory subscription
+type FeeHistoryFilter struct {
+	// BlockCount is the number of blocks up to the latest one
+	BlockCount uint64 `json:"blockCount,omitempty"`
+	// RewardPercentiles are the priority fee percentiles reported per block
+	RewardPercentiles []float64 `json:"rewardPercentiles,omitempty"`
+}
+
+// ParseFeeHistoryFilter parses and validates feeHistory subscription params
+func ParseFeeHistoryFilter(params json.RawMessage) (*FeeHistoryFilter, error) {
+	filter := FeeHistoryFilter{BlockCount: DefaultFeeHistoryBlocks}
+	if len(params) == 0 {
+		return &filter, nil
+	}
+	if err := json.Unmarshal(params, &filter); err != nil {
+		return nil, fmt.Errorf("invalid feeHistory params: %w", err)
+	}
+	if filter.BlockCount == 0 {
+		filter.BlockCount = DefaultFeeHistoryBlocks
+	}
+	if filter.BlockCount > MaxFeeHistoryBlocks {
+		return nil, fmt.Errorf("blockCount must not exceed %d", MaxFeeHistoryBlocks)
+	}
+	if len(filter.RewardPercentiles) > MaxRewardPercentiles {
+		return nil, fmt.Errorf("at most %d rewardPercentiles are allowed", MaxRewardPercentiles)
+	}
+	for i, p := range filter.RewardPercentiles {
+		if p < 0 || p > 100 {
+			return nil, fmt.Errorf("rewardPercentiles must be between 0 and 100")
+		}
+		if i > 0 && p <= filter.RewardPercentiles[i-1] {
+			return nil, fmt.Errorf("rewardPercentiles must be increasing")
+		}
+	}
+	return &filter, nil
+}
+
+// Key identifies the eth_feeHistory query of the filter, so subscriptions
+// asking the same window share one upstream call
+func (f *FeeHistoryFilter) Key() string {
+	return fmt.Sprintf("%d:%v", f.BlockCount, f.RewardPercentiles)
+}
+
+// ExceedsChangeThreshold reports whether moving from last to current
+// changes the price by more than minChangePercent
+func ExceedsChangeThreshold(last, current *big.Int, minChangePercent float64) bool {
+	if last == nil || minChangePercent <= 0 {
+		return true
+	}
+	if last.Sign() == 0 {
+		return current.Sign() != 0
+	}
+
+	diff := new(big.Int).Sub(current, last)
+	diff.Abs(diff)
+	change, _ := new(big.Float).Quo(new(big.Float).SetInt(diff), new(big.Float).SetInt(last)).Float64()
+	return change*100 > minChangePercent
+}
+
 // normalizeAddress normalizes an Ethereum address to lowercase for comparison
 func normalizeAddress(addr string) string {
 	return strings.ToLower(addr)
@@ -117,28 +675,127 @@ type Manager struct {
 	subscriptions map[string]*Subscription
 	clientSubs    map[string][]string
 	mu            sync.RWMutex
+
+	// defaultConfirmations applies to newHeads and logs subscriptions
+	// that don't set confirmations themselves
+	defaultConfirmations int
+
+	// instanceID is the replica ID added to notifications of subscriptions asking for it
+	instanceID string
+
+	// resumeTokens maps the resume tokens of resumable subscriptions to their IDs
+	resumeTokens map[string]string
+	// resumeBufferSize is the number of notifications retained per resumable subscription
+	resumeBufferSize int
+
+	// clock timestamps new and detached subscriptions
+	clock clock.Clock
+
+	// idBytes is the random length of subscription IDs; trimIDs strips
+	// their leading zeros
+	idBytes int
+	trimIDs bool
 }
 
 // NewManager creates a new subscription manager
 func NewManager() *Manager {
 	return &Manager{
-		subscriptions: make(map[string]*Subscription),
-		clientSubs:    make(map[string][]string),
+		subscriptions:    make(map[string]*Subscription),
+		clientSubs:       make(map[string][]string),
+		resumeTokens:     make(map[string]string),
+		resumeBufferSize: DefaultResumeBufferSize,
+		clock:            clock.Real,
+		idBytes:          16,
+	}
+}
+
+// SetClock replaces the clock used to timestamp subscriptions
+func (m *Manager) SetClock(c clock.Clock) {
+	m.clock = c
+}
+
+// SetDefaultConfirmations sets the emission delay for newHeads and logs
+// subscriptions that don't request one
+func (m *Manager) SetDefaultConfirmations(confirmations int) error {
+	if confirmations < 0 || confirmations > MaxConfirmations {
+		return fmt.Errorf("confirmations must be between 0 and %d", MaxConfirmations)
 	}
+	m.defaultConfirmations = confirmations
+	return nil
+}
+
+// SetIDFormat sets the number of random bytes in new subscription IDs and
+// whether their leading zeros are stripped, as geth does
+func (m *Manager) SetIDFormat(bytes int, trim bool) {
+	if bytes > 0 {
+		m.idBytes = bytes
+	}
+	m.trimIDs = trim
+}
+
+// SetInstanceID sets the replica ID added to notifications of subscriptions
+// with the instance option
+func (m *Manager) SetInstanceID(instanceID string) {
+	m.instanceID = instanceID
 }
 
 // Subscribe creates a new subscription
 func (m *Manager) Subscribe(clientID string, subType SubscriptionType, params json.RawMessage) (string, error) {
-	subID := generateSubscriptionID()
+	return m.subscribe(clientID, subType, params, false)
+}
+
+// SubscribeHeld creates a subscription whose notifications are queued until
+// Release is called, so the caller can deliver initial data first
+func (m *Manager) SubscribeHeld(clientID string, subType SubscriptionType, params json.RawMessage) (string, error) {
+	return m.subscribe(clientID, subType, params, true)
+}
+
+// Release ends the held state of a subscription and returns its queued notifications
+func (m *Manager) Release(subID string) [][]byte {
+	m.mu.RLock()
+	sub, exists := m.subscriptions[subID]
+	m.mu.RUnlock()
+
+	if !exists {
+		return nil
+	}
+	return sub.release()
+}
+
+func (m *Manager) subscribe(clientID string, subType SubscriptionType, params json.RawMessage, held bool) (string, error) {
+	opts, err := ParseOptions(params)
+	if err != nil {
+		return "", err
+	}
+	if !opts.confirmationsSet && delaysEmission(subType) {
+		opts.Confirmations = m.defaultConfirmations
+	}
+
+	subID := m.generateSubscriptionID()
 
 	sub := &Subscription{
 		ID:       subID,
 		Type:     subType,
 		Params:   params,
+		Options:  opts,
 		ClientID: clientID,
+		held:     held,
+		lastSent: m.clock.Now(),
+	}
+	sub.CreatedAt = sub.lastSent
+	if opts.TTL > 0 {
+		sub.expiresAt = sub.lastSent.Add(opts.TTL)
+	}
+	if opts.Instance {
+		sub.instance = m.instanceID
 	}
 
 	m.mu.Lock()
+	if opts.Resumable {
+		sub.resumeToken = generateResumeToken()
+		sub.historySize = m.resumeBufferSize
+		m.resumeTokens[sub.resumeToken] = subID
+	}
 	m.subscriptions[subID] = sub
 	m.clientSubs[clientID] = append(m.clientSubs[clientID], subID)
 	m.mu.Unlock()
@@ -160,20 +817,45 @@ func (m *Manager) Unsubscribe(clientID, subID string) bool {
 		return false
 	}
 
-	delete(m.subscriptions, subID)
+	m.remove(sub)
 
-	subs := m.clientSubs[clientID]
+	logger.Info("Client %s unsubscribed from %s (sub_id: %s)", clientID, sub.Type, subID)
+	return true
+}
+
+// remove deletes sub from the manager. Callers hold m.mu.
+func (m *Manager) remove(sub *Subscription) {
+	delete(m.subscriptions, sub.ID)
+	delete(m.resumeTokens, sub.resumeToken)
+
+	subs := m.clientSubs[sub.ClientID]
 	for i, id := range subs {
-		if id == subID {
-			m.clientSubs[clientID] = append(subs[:i], subs[i+1:]...)
+		if id == sub.ID {
+			subs = append(subs[:i], subs[i+1:]...)
 			break
 		}
 	}
+	if len(subs) == 0 {
+		delete(m.clientSubs, sub.ClientID)
+	} else {
+		m.clientSubs[sub.ClientID] = subs
+	}
 
 	metrics.WSActiveSubscriptions.WithLabelValues(string(sub.Type)).Dec()
 	metrics.WSSubscriptionsRemoved.WithLabelValues(string(sub.Type)).Inc()
+}
 
-	logger.Info("Client %s unsubscribed from %s (sub_id: %s)", clientID, sub.Type, subID)
+// RemoveOrphan removes the subscription if it still belongs to clientID and
+// isn't detached awaiting resumption, for subscriptions whose client is gone
+func (m *Manager) RemoveOrphan(clientID, subID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub, exists := m.subscriptions[subID]
+	if !exists || sub.ClientID != clientID || sub.Detached() {
+		return false
+	}
+	m.remove(sub)
 	return true
 }
 
@@ -185,6 +867,11 @@ func (m *Manager) UnsubscribeAll(clientID string) {
 	subs := m.clientSubs[clientID]
 	for _, subID := range subs {
 		if sub, exists := m.subscriptions[subID]; exists {
+			// Resumable subscriptions stay, detached, until resumed or expired
+			if sub.resumeToken != "" {
+				sub.detach(m.clock.Now())
+				continue
+			}
 			metrics.WSActiveSubscriptions.WithLabelValues(string(sub.Type)).Dec()
 			metrics.WSSubscriptionsRemoved.WithLabelValues(string(sub.Type)).Inc()
 			delete(m.subscriptions, subID)
@@ -197,6 +884,41 @@ func (m *Manager) UnsubscribeAll(clientID string) {
 	}
 }
 
+// SetPaused pauses or resumes a subscription of a client. Returns false if
+// the client has no such subscription.
+func (m *Manager) SetPaused(clientID, subID string, paused bool) bool {
+	m.mu.RLock()
+	sub, exists := m.subscriptions[subID]
+	m.mu.RUnlock()
+
+	if !exists || sub.ClientID != clientID {
+		return false
+	}
+
+	sub.mu.Lock()
+	sub.paused = paused
+	sub.mu.Unlock()
+
+	if paused {
+		logger.Info("Client %s paused %s (sub_id: %s)", clientID, sub.Type, subID)
+	} else {
+		logger.Info("Client %s resumed %s (sub_id: %s)", clientID, sub.Type, subID)
+	}
+	return true
+}
+
+// All returns every subscription
+func (m *Manager) All() []*Subscription {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]*Subscription, 0, len(m.subscriptions))
+	for _, sub := range m.subscriptions {
+		result = append(result, sub)
+	}
+	return result
+}
+
 // GetSubscriptionsByType returns all subscriptions of a given type
 func (m *Manager) GetSubscriptionsByType(subType SubscriptionType) []*Subscription {
 	m.mu.RLock()
@@ -211,6 +933,27 @@ func (m *Manager) GetSubscriptionsByType(subType SubscriptionType) []*Subscripti
 	return result
 }
 
+// Get returns a subscription by ID
+func (m *Manager) Get(subID string) (*Subscription, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sub, exists := m.subscriptions[subID]
+	return sub, exists
+}
+
+// CountByType returns the number of active subscriptions per type
+func (m *Manager) CountByType() map[SubscriptionType]int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[SubscriptionType]int)
+	for _, sub := range m.subscriptions {
+		counts[sub.Type]++
+	}
+	return counts
+}
+
 // GetClientSubscriptions returns subscription IDs for a client
 func (m *Manager) GetClientSubscriptions(clientID string) []string {
 	m.mu.RLock()
@@ -225,6 +968,38 @@ func (m *Manager) GetClientSubscriptions(clientID string) []string {
 	return result
 }
 
+// SnapshotVersion is the version of the subscription snapshot format
+const SnapshotVersion = 1
+
+// Snapshot is a client's subscription set in a portable form: each entry is
+// the eth_subscribe params that created the subscription. Importing it on
+// another replica recreates the same subscriptions under new IDs.
+type Snapshot struct {
+	Version       int                 `json:"version"`
+	Subscriptions [][]json.RawMessage `json:"subscriptions"`
+}
+
+// Snapshot exports the subscriptions of a client in creation order
+func (m *Manager) Snapshot(clientID string) Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	snapshot := Snapshot{Version: SnapshotVersion, Subscriptions: [][]json.RawMessage{}}
+	for _, subID := range m.clientSubs[clientID] {
+		sub, ok := m.subscriptions[subID]
+		if !ok {
+			continue
+		}
+		subType, _ := json.Marshal(string(sub.Type))
+		entry := []json.RawMessage{subType}
+		if len(sub.Params) > 0 {
+			entry = append(entry, sub.Params)
+		}
+		snapshot.Subscriptions = append(snapshot.Subscriptions, entry)
+	}
+	return snapshot
+}
+
 // SubscriptionNotification represents a notification sent to subscribers
 type SubscriptionNotification struct {
 	JSONRPC string             `json:"jsonrpc"`
@@ -234,12 +1009,200 @@ type SubscriptionNotification struct {
 
 // NotificationParams contains subscription notification params
 type NotificationParams struct {
+	// Seq is the per-subscription sequence number, starting at 1. It is
+	// stamped at delivery and never set when marshaling.
+	Seq          uint64          `json:"seq,omitempty"`
 	Subscription string          `json:"subscription"`
+	Label        string          `json:"label,omitempty"`
 	Result       json.RawMessage `json:"result"`
+	// AddressLabels are the operator labels of the addresses in the result
+	AddressLabels map[string]rpc.AddressLabel `json:"addressLabels,omitempty"`
+	// Subscriptions lists all the client's subscriptions a deduplicated log matched
+	Subscriptions []string `json:"subscriptions,omitempty"`
+	// Instance is the ID of the replica serving the subscription
+	Instance string `json:"instance,omitempty"`
+	// Heartbeat marks an empty notification sent after a quiet period
+	Heartbeat bool `json:"heartbeat,omitempty"`
+	// Expired marks the final notification of a subscription whose TTL elapsed
+	Expired bool `json:"expired,omitempty"`
+	// Error is set on the final notification of a subscription removed by the server
+	Error *rpc.Error `json:"error,omitempty"`
+	// ResumeToken recovers a resumable subscription after a reconnect
+	ResumeToken string `json:"resumeToken,omitempty"`
 }
 
 // CreateNotification creates a notification message for a subscription
 func CreateNotification(subID string, result interface{}) ([]byte, error) {
+	return createNotification(subID, "", result)
+}
+
+// Notification creates a notification message for the subscription,
+// echoing its label if the client set one
+func (s *Subscription) Notification(result interface{}) ([]byte, error) {
+	return s.LabeledNotification(result, nil)
+}
+
+// LabeledNotification creates a notification message carrying address labels
+func (s *Subscription) LabeledNotification(result interface{}, addressLabels map[string]rpc.AddressLabel) ([]byte, error) {
+	data, err := s.labeledNotification(result, addressLabels)
+	s.countFailure(err)
+	return data, err
+}
+
+func (s *Subscription) labeledNotification(result interface{}, addressLabels map[string]rpc.AddressLabel) ([]byte, error) {
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	resultBytes = s.Options.project(resultBytes)
+
+	return json.Marshal(SubscriptionNotification{
+		JSONRPC: "2.0",
+		Method:  "eth_subscription",
+		Params: NotificationParams{
+			Subscription:  s.ID,
+			Label:         s.Options.Label,
+			Result:        resultBytes,
+			AddressLabels: addressLabels,
+			Instance:      s.instance,
+			ResumeToken:   s.resumeToken,
+		},
+	})
+}
+
+// MergedNotification creates a single notification for several subscriptions
+// of a client matching the same result. It is addressed to the first
+// subscription, formatted with its options, and lists all their IDs.
+func MergedNotification(subs []*Subscription, result interface{}, addressLabels map[string]rpc.AddressLabel) ([]byte, error) {
+	resultBytes, err := json.Marshal(result)
+	subs[0].countFailure(err)
+	if err != nil {
+		return nil, err
+	}
+	resultBytes = subs[0].Options.project(resultBytes)
+
+	ids := make([]string, len(subs))
+	for i, sub := range subs {
+		ids[i] = sub.ID
+	}
+	return json.Marshal(SubscriptionNotification{
+		JSONRPC: "2.0",
+		Method:  "eth_subscription",
+		Params: NotificationParams{
+			Subscription:  subs[0].ID,
+			Label:         subs[0].Options.Label,
+			Result:        resultBytes,
+			AddressLabels: addressLabels,
+			Subscriptions: ids,
+			Instance:      subs[0].instance,
+			ResumeToken:   subs[0].resumeToken,
+		},
+	})
+}
+
+// HeartbeatNotification creates an empty notification with a null result
+func (s *Subscription) HeartbeatNotification() ([]byte, error) {
+	return json.Marshal(SubscriptionNotification{
+		JSONRPC: "2.0",
+		Method:  "eth_subscription",
+		Params: NotificationParams{
+			Subscription: s.ID,
+			Label:        s.Options.Label,
+			Result:       json.RawMessage("null"),
+			Instance:     s.instance,
+			Heartbeat:    true,
+			ResumeToken:  s.resumeToken,
+		},
+	})
+}
+
+// ExpiryNotification creates the final notification, with a null result,
+// of a subscription whose TTL elapsed
+func (s *Subscription) ExpiryNotification() ([]byte, error) {
+	return json.Marshal(SubscriptionNotification{
+		JSONRPC: "2.0",
+		Method:  "eth_subscription",
+		Params: NotificationParams{
+			Subscription: s.ID,
+			Label:        s.Options.Label,
+			Result:       json.RawMessage("null"),
+			Instance:     s.instance,
+			Expired:      true,
+		},
+	})
+}
+
+// ErrorNotification creates the final notification, with a null result and
+// an error, of a subscription the server removes
+func (s *Subscription) ErrorNotification(code int, message string) ([]byte, error) {
+	return json.Marshal(SubscriptionNotification{
+		JSONRPC: "2.0",
+		Method:  "eth_subscription",
+		Params: NotificationParams{
+			Subscription: s.ID,
+			Label:        s.Options.Label,
+			Result:       json.RawMessage("null"),
+			Instance:     s.instance,
+			Error:        &rpc.Error{Code: code, Message: message},
+		},
+	})
+}
+
+// countFailure counts a notification that could not be created, or resets
+// the count after one that could
+func (s *Subscription) countFailure(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failures++
+	} else {
+		s.failures = 0
+	}
+}
+
+// Failures returns the number of consecutive notifications that could not be created
+func (s *Subscription) Failures() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failures
+}
+
+// LogResult returns the notification result for a log, with its event name
+// if the subscription asked for it
+func (s *Subscription) LogResult(logEntry *rpc.Log) interface{} {
+	if s.Options.EventName {
+		return &rpc.LogWithEventName{Log: logEntry, EventName: logEntry.EventName()}
+	}
+	return logEntry
+}
+
+// NotificationLogBlock returns the block number of the log a notification
+// carries, and false for removed logs and notifications that aren't logs
+func NotificationLogBlock(data []byte) (uint64, bool) {
+	var notification struct {
+		Params struct {
+			Result struct {
+				BlockNumber string  `json:"blockNumber"`
+				LogIndex    *string `json:"logIndex"`
+				Removed     bool    `json:"removed"`
+			} `json:"result"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return 0, false
+	}
+	result := notification.Params.Result
+	if result.LogIndex == nil || result.Removed {
+		return 0, false
+	}
+	block, err := rpc.ParseHexUint64(result.BlockNumber)
+	if err != nil {
+		return 0, false
+	}
+	return block, true
+}
+
+func createNotification(subID, label string, result interface{}) ([]byte, error) {
 	resultBytes, err := json.Marshal(result)
 	if err != nil {
 		return nil, err
@@ -250,6 +1213,7 @@ func CreateNotification(subID string, result interface{}) ([]byte, error) {
 		Method:  "eth_subscription",
 		Params: NotificationParams{
 			Subscription: subID,
+			Label:        label,
 			Result:       resultBytes,
 		},
 	}
@@ -257,6 +1221,194 @@ func CreateNotification(subID string, result interface{}) ([]byte, error) {
 	return json.Marshal(notification)
 }
 
+// MaxLogFilters is the most filter objects a logs subscription may OR together
+const MaxLogFilters = 16
+
+// MaxTopicPositions is the number of indexed topics a log can have
+const MaxTopicPositions = 4
+
+// validateLogFilter checks a logs filter object field by field, so malformed
+// filters are rejected with the offending field named instead of never matching
+func validateLogFilter(data json.RawMessage) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("filter must be an object")
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := fields[key]
+		var err error
+		switch key {
+		case "address", "excludeAddress":
+			err = validateAddressField(key, value)
+		case "topics", "excludeTopics":
+			err = validateTopicsField(key, value)
+		case "fromBlock":
+			var fromBlock string
+			if json.Unmarshal(value, &fromBlock) != nil {
+				err = fmt.Errorf("fromBlock: must be a string")
+			}
+		default:
+			if !IsOptionField(key) {
+				err = fmt.Errorf("unknown field %q", key)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAddressField checks an address param: null, an address or an array of addresses
+func validateAddressField(name string, value json.RawMessage) error {
+	if string(value) == "null" {
+		return nil
+	}
+	var single string
+	if json.Unmarshal(value, &single) == nil {
+		if !isAddress(single) {
+			return fmt.Errorf("%s: %q is not a 20-byte hex address", name, single)
+		}
+		return nil
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(value, &list) != nil {
+		return fmt.Errorf("%s: must be an address or an array of addresses", name)
+	}
+	for i, item := range list {
+		var addr string
+		if json.Unmarshal(item, &addr) != nil || !isAddress(addr) {
+			return fmt.Errorf("%s[%d]: %s is not a 20-byte hex address", name, i, item)
+		}
+	}
+	return nil
+}
+
+// validateTopicsField checks a topics param: up to MaxTopicPositions
+// positions, each null, a topic or an array of topics
+func validateTopicsField(name string, value json.RawMessage) error {
+	if string(value) == "null" {
+		return nil
+	}
+	var positions []json.RawMessage
+	if json.Unmarshal(value, &positions) != nil {
+		return fmt.Errorf("%s: must be an array", name)
+	}
+	if len(positions) > MaxTopicPositions {
+		return fmt.Errorf("%s: at most %d positions are allowed", name, MaxTopicPositions)
+	}
+	for i, position := range positions {
+		if string(position) == "null" {
+			continue
+		}
+		var single string
+		if json.Unmarshal(position, &single) == nil {
+			if !isTopicPattern(single) {
+				return fmt.Errorf("%s[%d]: %q is not a 32-byte hex topic or 0x-prefix wildcard", name, i, single)
+			}
+			continue
+		}
+		var alternatives []json.RawMessage
+		if json.Unmarshal(position, &alternatives) != nil {
+			return fmt.Errorf("%s[%d]: must be null, a topic or an array of topics", name, i)
+		}
+		for j, item := range alternatives {
+			var topic string
+			if json.Unmarshal(item, &topic) != nil {
+				return fmt.Errorf("%s[%d][%d]: must be a topic string, nested too deep", name, i, j)
+			}
+			if !isTopicPattern(topic) {
+				return fmt.Errorf("%s[%d][%d]: %q is not a 32-byte hex topic or 0x-prefix wildcard", name, i, j, topic)
+			}
+		}
+	}
+	return nil
+}
+
+// isAddress reports whether s is a 0x-prefixed 20-byte hex string
+func isAddress(s string) bool {
+	return len(s) == 42 && strings.HasPrefix(s, "0x") && isHexDigits(s[2:])
+}
+
+// isTopicPattern reports whether s is a topic filter entry: a 32-byte hex
+// hash, "*", or a 0x-prefixed hex prefix followed by "*"
+func isTopicPattern(s string) bool {
+	if s == TopicWildcard {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(s, TopicWildcard); ok {
+		return strings.HasPrefix(prefix, "0x") && len(prefix) <= 66 && isHexDigits(prefix[2:])
+	}
+	return isHash(s)
+}
+
+// isHexDigits reports whether s only contains hex digits
+func isHexDigits(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLogFilters parses logs params: a filter object, or an array of filter
+// objects of which a log must match at least one
+func ParseLogFilters(params json.RawMessage) ([]LogFilter, error) {
+	if len(params) == 0 {
+		return []LogFilter{{}}, nil
+	}
+	if params[0] != '[' {
+		if err := validateLogFilter(params); err != nil {
+			return nil, fmt.Errorf("invalid logs filter: %w", err)
+		}
+		var filter LogFilter
+		if err := json.Unmarshal(params, &filter); err != nil {
+			return nil, fmt.Errorf("invalid logs filter: %w", err)
+		}
+		return []LogFilter{filter}, nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(params, &raw); err != nil {
+		return nil, fmt.Errorf("invalid logs filters: %w", err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("logs filters must not be empty")
+	}
+	if len(raw) > MaxLogFilters {
+		return nil, fmt.Errorf("at most %d logs filters are allowed", MaxLogFilters)
+	}
+	for i, filter := range raw {
+		if err := validateLogFilter(filter); err != nil {
+			return nil, fmt.Errorf("invalid logs filter %d: %w", i, err)
+		}
+	}
+
+	var filters []LogFilter
+	if err := json.Unmarshal(params, &filters); err != nil {
+		return nil, fmt.Errorf("invalid logs filters: %w", err)
+	}
+	return filters, nil
+}
+
+// MatchesAnyLogFilter checks if a log matches at least one of the filters
+func MatchesAnyLogFilter(logEntry *rpc.Log, filters []LogFilter) bool {
+	for i := range filters {
+		if MatchesLogFilter(logEntry, &filters[i]) {
+			return true
+		}
+	}
+	return false
+}
+
 // MatchesLogFilter checks if a log matches the given filter
 // Comparison is case-insensitive since filter values are normalized to lowercase
 func MatchesLogFilter(logEntry *rpc.Log, filter *LogFilter) bool {
@@ -294,7 +1446,7 @@ func MatchesLogFilter(logEntry *rpc.Log, filter *LogFilter) bool {
 		found := false
 		logTopic := strings.ToLower(logEntry.Topics[i])
 		for _, topic := range topicFilter {
-			if logTopic == topic {
+			if matchesTopic(logTopic, topic) {
 				found = true
 				break
 			}
@@ -304,11 +1456,81 @@ func MatchesLogFilter(logEntry *rpc.Log, filter *LogFilter) bool {
 		}
 	}
 
-	return true
+	return !excluded(logEntry, filter)
 }
 
-func generateSubscriptionID() string {
-	bytes := make([]byte, 16)
+// excluded reports whether a log hits the filter's exclusions: its address is
+// in ExcludeAddress, or its topic at some position is listed at that position
+// of ExcludeTopics
+func excluded(logEntry *rpc.Log, filter *LogFilter) bool {
+	if len(filter.ExcludeAddress) > 0 {
+		logAddr := strings.ToLower(logEntry.Address)
+		for _, addr := range filter.ExcludeAddress {
+			if logAddr == addr {
+				return true
+			}
+		}
+	}
+
+	for i, topicFilter := range filter.ExcludeTopics {
+		if i >= len(logEntry.Topics) {
+			break
+		}
+		logTopic := strings.ToLower(logEntry.Topics[i])
+		for _, topic := range topicFilter {
+			if matchesTopic(logTopic, topic) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TopicWildcard matches any topic, and as a suffix any topic with the given prefix
+const TopicWildcard = "*"
+
+// matchesTopic compares a log topic against a filter entry, which is either
+// an exact hash, "*" (any topic present at this position) or a "0xprefix*" pattern
+func matchesTopic(logTopic, pattern string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, TopicWildcard); ok {
+		return strings.HasPrefix(logTopic, prefix)
+	}
+	return logTopic == pattern
+}
+
+// UpstreamTopics returns the filter topics in a form upstream eth_getLogs
+// accepts: positions containing a wildcard become null (match any), so
+// wildcards must still be applied locally with MatchesLogFilter
+func (f *LogFilter) UpstreamTopics() [][]string {
+	if len(f.Topics) == 0 {
+		return nil
+	}
+	topics := make([][]string, len(f.Topics))
+	for i, position := range f.Topics {
+		wildcard := false
+		for _, topic := range position {
+			if strings.HasSuffix(topic, TopicWildcard) {
+				wildcard = true
+				break
+			}
+		}
+		if !wildcard {
+			topics[i] = position
+		}
+	}
+	return topics
+}
+
+// generateSubscriptionID returns a random ID of the manager's format
+func (m *Manager) generateSubscriptionID() string {
+	bytes := make([]byte, m.idBytes)
 	rand.Read(bytes)
-	return "0x" + hex.EncodeToString(bytes)
+	id := hex.EncodeToString(bytes)
+	if m.trimIDs {
+		id = strings.TrimLeft(id, "0")
+		if id == "" {
+			id = "0"
+		}
+	}
+	return "0x" + id
 }
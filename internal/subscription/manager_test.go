@@ -1,9 +1,15 @@
 package subscription
 
 import (
+	"bytes"
 	"encoding/json"
+	"math"
+	"math/big"
+	"strings"
 	"testing"
+	"time"
 
+	"hlnode-websocket/internal/clock"
 	"hlnode-websocket/internal/rpc"
 )
 
@@ -30,6 +36,22 @@ func TestManagerSubscribe(t *testing.T) {
 	}
 }
 
+func TestManagerIDFormat(t *testing.T) {
+	m := NewManager()
+	subID, _ := m.Subscribe("client1", SubTypeNewHeads, nil)
+	if len(subID) != 2+32 || !strings.HasPrefix(subID, "0x") {
+		t.Errorf("Expected a 16-byte hex ID by default, got %s", subID)
+	}
+
+	m.SetIDFormat(8, true)
+	for i := 0; i < 50; i++ {
+		subID, _ := m.Subscribe("client1", SubTypeNewHeads, nil)
+		if len(subID) > 2+16 || strings.HasPrefix(subID, "0x0") && subID != "0x0" {
+			t.Fatalf("Expected a trimmed 8-byte hex ID, got %s", subID)
+		}
+	}
+}
+
 func TestManagerUnsubscribe(t *testing.T) {
 	m := NewManager()
 
@@ -78,6 +100,31 @@ func TestManagerUnsubscribeAll(t *testing.T) {
 	}
 }
 
+func TestManagerRemoveOrphan(t *testing.T) {
+	m := NewManager()
+
+	subID, _ := m.Subscribe("client1", SubTypeNewHeads, nil)
+	resumableID, err := m.Subscribe("client1", SubTypeNewHeads, json.RawMessage(`{"resumable":true}`))
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	if m.RemoveOrphan("client2", subID) {
+		t.Error("RemoveOrphan should not remove another client's subscription")
+	}
+	if !m.RemoveOrphan("client1", subID) {
+		t.Error("RemoveOrphan should remove the subscription")
+	}
+
+	m.UnsubscribeAll("client1")
+	if m.RemoveOrphan("client1", resumableID) {
+		t.Error("RemoveOrphan should keep detached resumable subscriptions")
+	}
+	if len(m.All()) != 1 {
+		t.Errorf("Expected the detached subscription only, got %d subscriptions", len(m.All()))
+	}
+}
+
 func TestCreateNotification(t *testing.T) {
 	header := &rpc.FullBlockHeader{
 		Number: "0x123",
@@ -166,6 +213,72 @@ func TestMatchesLogFilter(t *testing.T) {
 			},
 			expected: true,
 		},
+		{
+			name: "topic prefix wildcard match",
+			log:  &rpc.Log{Topics: []string{"0xDDF252AD1be2"}},
+			filter: &LogFilter{
+				Topics: [][]string{{"0xddf252ad*"}},
+			},
+			expected: true,
+		},
+		{
+			name: "topic prefix wildcard no match",
+			log:  &rpc.Log{Topics: []string{"0x8c5be1e5"}},
+			filter: &LogFilter{
+				Topics: [][]string{{"0xddf252ad*"}},
+			},
+			expected: false,
+		},
+		{
+			name: "topic star requires a topic at the position",
+			log:  &rpc.Log{Topics: []string{"0xabc"}},
+			filter: &LogFilter{
+				Topics: [][]string{{"0xabc"}, {"*"}},
+			},
+			expected: false,
+		},
+		{
+			name: "excluded address",
+			log:  &rpc.Log{Address: "0xNoisy", Topics: []string{"0xddf252ad"}},
+			filter: &LogFilter{
+				Topics:         [][]string{{"0xddf252ad"}},
+				ExcludeAddress: []string{"0xnoisy"},
+			},
+			expected: false,
+		},
+		{
+			name: "address not excluded",
+			log:  &rpc.Log{Address: "0x1234", Topics: []string{"0xddf252ad"}},
+			filter: &LogFilter{
+				Topics:         [][]string{{"0xddf252ad"}},
+				ExcludeAddress: []string{"0xnoisy"},
+			},
+			expected: true,
+		},
+		{
+			name: "excluded topic at position",
+			log:  &rpc.Log{Topics: []string{"0xddf252ad", "0xmint"}},
+			filter: &LogFilter{
+				ExcludeTopics: [][]string{nil, {"0xmint"}},
+			},
+			expected: false,
+		},
+		{
+			name: "excluded topic at other position",
+			log:  &rpc.Log{Topics: []string{"0xmint", "0xabc"}},
+			filter: &LogFilter{
+				ExcludeTopics: [][]string{nil, {"0xmint"}},
+			},
+			expected: true,
+		},
+		{
+			name: "topic star matches any topic",
+			log:  &rpc.Log{Topics: []string{"0xabc", "0xdef"}},
+			filter: &LogFilter{
+				Topics: [][]string{nil, {"*"}},
+			},
+			expected: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -177,3 +290,684 @@ func TestMatchesLogFilter(t *testing.T) {
 		})
 	}
 }
+
+func TestLogFilterExclusions(t *testing.T) {
+	var filter LogFilter
+	err := json.Unmarshal([]byte(`{"excludeAddress":"0xABC","excludeTopics":[null,["0xDEF","0x123"]]}`), &filter)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(filter.ExcludeAddress) != 1 || filter.ExcludeAddress[0] != "0xabc" {
+		t.Errorf("Unexpected excludeAddress: %v", filter.ExcludeAddress)
+	}
+	if len(filter.ExcludeTopics) != 2 || filter.ExcludeTopics[0] != nil || filter.ExcludeTopics[1][0] != "0xdef" {
+		t.Errorf("Unexpected excludeTopics: %v", filter.ExcludeTopics)
+	}
+}
+
+func TestLogFilterUpstreamTopics(t *testing.T) {
+	filter := &LogFilter{Topics: [][]string{{"0xddf252ad*"}, nil, {"0xabc", "0xdef"}}}
+	topics := filter.UpstreamTopics()
+	if len(topics) != 3 || topics[0] != nil || topics[1] != nil || len(topics[2]) != 2 {
+		t.Errorf("Expected wildcard position dropped, got %v", topics)
+	}
+}
+
+func TestManagerSubscribeHeld(t *testing.T) {
+	m := NewManager()
+
+	subID, _ := m.SubscribeHeld("client1", SubTypeLogs, nil)
+	sub := m.GetSubscriptionsByType(SubTypeLogs)[0]
+
+	if !sub.Enqueue([]byte("first")) || !sub.Enqueue([]byte("second")) {
+		t.Fatal("Held subscription should queue notifications")
+	}
+
+	pending := m.Release(subID)
+	if len(pending) != 2 || string(pending[0]) != "first" {
+		t.Errorf("Unexpected queued notifications: %q", pending)
+	}
+
+	if sub.Enqueue([]byte("third")) {
+		t.Error("Released subscription should not queue notifications")
+	}
+}
+
+func TestLogFilterFromBlock(t *testing.T) {
+	var filter LogFilter
+	if err := json.Unmarshal([]byte(`{"address":"0xABC","fromBlock":"0x10"}`), &filter); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if filter.FromBlock != "0x10" {
+		t.Errorf("Expected fromBlock 0x10, got %s", filter.FromBlock)
+	}
+	if len(filter.Address) != 1 || filter.Address[0] != "0xabc" {
+		t.Errorf("Expected normalized address, got %v", filter.Address)
+	}
+}
+
+func TestParseLogFilters(t *testing.T) {
+	filters, err := ParseLogFilters(json.RawMessage(`[
+		{"address": "0xAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", "label": "multi"},
+		{"topics": ["0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"]}
+	]`))
+	if err != nil {
+		t.Fatalf("ParseLogFilters failed: %v", err)
+	}
+	if len(filters) != 2 {
+		t.Fatalf("Expected 2 filters, got %d", len(filters))
+	}
+
+	tests := []struct {
+		log      rpc.Log
+		expected bool
+	}{
+		{rpc.Log{Address: "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Topics: []string{"0x01"}}, true},
+		{rpc.Log{Address: "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Topics: []string{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}}, true},
+		{rpc.Log{Address: "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Topics: []string{"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}}, true},
+		{rpc.Log{Address: "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Topics: []string{"0x01"}}, false},
+	}
+	for i, tt := range tests {
+		if got := MatchesAnyLogFilter(&tt.log, filters); got != tt.expected {
+			t.Errorf("case %d: expected %v, got %v", i, tt.expected, got)
+		}
+	}
+
+	// Options come from the first filter
+	opts, err := ParseOptions(json.RawMessage(`[{"label": "multi"}, {"address": "0xbbb"}]`))
+	if err != nil || opts.Label != "multi" {
+		t.Errorf("Expected label from the first filter, got %q (%v)", opts.Label, err)
+	}
+
+	if filters, err := ParseLogFilters(nil); err != nil || len(filters) != 1 {
+		t.Errorf("Expected a single match-all filter for empty params, got %v (%v)", filters, err)
+	}
+	if _, err := ParseLogFilters(json.RawMessage(`[]`)); err == nil {
+		t.Error("Expected error for an empty filter array")
+	}
+	if _, err := ParseLogFilters(json.RawMessage(`[{"address": 1}, 2]`)); err == nil {
+		t.Error("Expected error for a non-object filter")
+	}
+}
+
+func TestParseLogFiltersValidation(t *testing.T) {
+	addr := "0x1234567890abcdef1234567890abcdef12345678"
+	topic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+	valid := []string{
+		`{"address": "` + addr + `", "topics": [null, ["` + topic + `", "0xddf2*"], "*"], "label": "ok", "fromBlock": "0x1"}`,
+		`{"address": ["` + addr + `"], "excludeAddress": null, "excludeTopics": [["` + topic + `"]]}`,
+		`{"topics": []}`,
+	}
+	for _, params := range valid {
+		if _, err := ParseLogFilters(json.RawMessage(params)); err != nil {
+			t.Errorf("Expected %s to be valid, got %v", params, err)
+		}
+	}
+
+	tests := []struct {
+		params string
+		field  string
+	}{
+		{`{"address": "0x12"}`, `address: "0x12"`},
+		{`{"address": ["` + addr + `", "0xzz34567890abcdef1234567890abcdef12345678"]}`, "address[1]"},
+		{`{"address": 5}`, "address:"},
+		{`{"excludeAddress": [1]}`, "excludeAddress[0]"},
+		{`{"topics": "` + topic + `"}`, "topics: must be an array"},
+		{`{"topics": [[["` + topic + `"]]]}`, "topics[0][0]: must be a topic string, nested too deep"},
+		{`{"topics": [null, "0x01"]}`, `topics[1]: "0x01"`},
+		{`{"topics": [null, null, null, null, null]}`, "at most 4 positions"},
+		{`{"excludeTopics": [["0xnothex*"]]}`, "excludeTopics[0][0]"},
+		{`{"fromBlock": 1}`, "fromBlock"},
+		{`{"adress": "` + addr + `"}`, `unknown field "adress"`},
+		{`[{"address": "` + addr + `"}, {"topic": []}]`, `invalid logs filter 1: unknown field "topic"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseLogFilters(json.RawMessage(tt.params))
+		if err == nil {
+			t.Errorf("Expected error for %s", tt.params)
+		} else if !strings.Contains(err.Error(), tt.field) {
+			t.Errorf("Expected error for %s to mention %q, got %v", tt.params, tt.field, err)
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions(json.RawMessage(`{"address":"0x1","confirmations":3}`))
+	if err != nil {
+		t.Fatalf("ParseOptions failed: %v", err)
+	}
+	if opts.Confirmations != 3 {
+		t.Errorf("Expected 3 confirmations, got %d", opts.Confirmations)
+	}
+
+	if _, err := ParseOptions(json.RawMessage(`{"confirmations":-1}`)); err == nil {
+		t.Error("Expected error for negative confirmations")
+	}
+	if _, err := ParseOptions(json.RawMessage(`{"maxPerSecond":-1}`)); err == nil {
+		t.Error("Expected error for negative maxPerSecond")
+	}
+	if opts, err := ParseOptions(json.RawMessage(`{"heartbeat":"30s"}`)); err != nil || opts.Heartbeat != 30*time.Second {
+		t.Errorf("Expected 30s heartbeat, got %v (%v)", opts.Heartbeat, err)
+	}
+	for _, heartbeat := range []string{`"100ms"`, `"2h"`, `"soon"`, `30`} {
+		if _, err := ParseOptions(json.RawMessage(`{"heartbeat":` + heartbeat + `}`)); err == nil {
+			t.Errorf("Expected error for heartbeat %s", heartbeat)
+		}
+	}
+	if opts, err := ParseOptions(json.RawMessage(`{"ttl":"10m"}`)); err != nil || opts.TTL != 10*time.Minute {
+		t.Errorf("Expected 10m ttl, got %v (%v)", opts.TTL, err)
+	}
+	for _, ttl := range []string{`"500ms"`, `"25h"`, `"later"`, `600`} {
+		if _, err := ParseOptions(json.RawMessage(`{"ttl":` + ttl + `}`)); err == nil {
+			t.Errorf("Expected error for ttl %s", ttl)
+		}
+	}
+	if opts, err := ParseOptions(json.RawMessage(`{}`)); err != nil || opts.Version != WireV1 {
+		t.Errorf("Expected wire version 1 by default, got %d (%v)", opts.Version, err)
+	}
+	if opts, err := ParseOptions(json.RawMessage(`{"version":2}`)); err != nil || opts.Version != WireV2 {
+		t.Errorf("Expected wire version 2, got %d (%v)", opts.Version, err)
+	}
+	for _, version := range []string{`0`, `3`, `"2"`} {
+		if _, err := ParseOptions(json.RawMessage(`{"version":` + version + `}`)); err == nil {
+			t.Errorf("Expected error for version %s", version)
+		}
+	}
+
+	m := NewManager()
+	if _, err := m.Subscribe("client1", SubTypeNewHeads, json.RawMessage(`{"confirmations":"two"}`)); err == nil {
+		t.Error("Subscribe should reject malformed options")
+	}
+}
+
+func TestExceedsChangeThreshold(t *testing.T) {
+	tests := []struct {
+		name     string
+		last     int64
+		current  int64
+		percent  float64
+		first    bool
+		expected bool
+	}{
+		{name: "first value always sent", current: 100, percent: 5, first: true, expected: true},
+		{name: "no threshold", last: 100, current: 100, percent: 0, expected: true},
+		{name: "below threshold", last: 100, current: 104, percent: 5, expected: false},
+		{name: "exactly threshold", last: 100, current: 105, percent: 5, expected: false},
+		{name: "above threshold", last: 100, current: 106, percent: 5, expected: true},
+		{name: "drop above threshold", last: 100, current: 90, percent: 5, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var last *big.Int
+			if !tt.first {
+				last = big.NewInt(tt.last)
+			}
+			result := ExceedsChangeThreshold(last, big.NewInt(tt.current), tt.percent)
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestMatchesReceiptsFilter(t *testing.T) {
+	var filter ReceiptsFilter
+	if err := json.Unmarshal([]byte(`{"address":["0xAAAA","0xcccc"]}`), &filter); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		receipt  *rpc.TransactionReceipt
+		expected bool
+	}{
+		{name: "from match", receipt: &rpc.TransactionReceipt{From: "0xaaaa", To: "0xbbbb"}, expected: true},
+		{name: "to match", receipt: &rpc.TransactionReceipt{From: "0xbbbb", To: "0xAAAA"}, expected: true},
+		{name: "contract match", receipt: &rpc.TransactionReceipt{From: "0xbbbb", ContractAddress: "0xCCCC"}, expected: true},
+		{name: "no match", receipt: &rpc.TransactionReceipt{From: "0xbbbb", To: "0xdddd"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := MatchesReceiptsFilter(tt.receipt, &filter); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseReceiptsFilter(t *testing.T) {
+	addr := "0x" + strings.Repeat("AA", 20)
+	filter, err := ParseReceiptsFilter(json.RawMessage(`{"address":"` + addr + `","addressLabels":true}`))
+	if err != nil {
+		t.Fatalf("Expected a valid filter, got %v", err)
+	}
+	if len(filter.Address) != 1 || filter.Address[0] != strings.ToLower(addr) {
+		t.Errorf("Expected the lowercase address, got %v", filter.Address)
+	}
+
+	if filter, err := ParseReceiptsFilter(nil); err != nil || len(filter.Address) != 0 {
+		t.Errorf("Expected no params to match every receipt, got %v, %v", filter, err)
+	}
+
+	for _, params := range []string{`"0x1234"`, `{"address":42}`, `{"address":"0x1234"}`, `{"adress":"` + addr + `"}`} {
+		if _, err := ParseReceiptsFilter(json.RawMessage(params)); err == nil {
+			t.Errorf("Expected %s to be rejected", params)
+		}
+	}
+}
+
+func TestParseTxConfirmationFilter(t *testing.T) {
+	hash := "0x" + strings.Repeat("AB", 32)
+	filter, err := ParseTxConfirmationFilter(json.RawMessage(`{"hash":"` + hash + `","confirmations":3}`))
+	if err != nil {
+		t.Fatalf("ParseTxConfirmationFilter failed: %v", err)
+	}
+	if filter.Hash != strings.ToLower(hash) {
+		t.Errorf("Expected normalized hash, got %s", filter.Hash)
+	}
+
+	invalid := []string{``, `{}`, `{"hash":"0x1234"}`, `{"hash":"0x` + strings.Repeat("zz", 32) + `"}`}
+	for _, params := range invalid {
+		if _, err := ParseTxConfirmationFilter(json.RawMessage(params)); err == nil {
+			t.Errorf("Expected error for params %q", params)
+		}
+	}
+}
+
+func TestParseFeeHistoryFilter(t *testing.T) {
+	filter, err := ParseFeeHistoryFilter(nil)
+	if err != nil || filter.BlockCount != DefaultFeeHistoryBlocks || filter.RewardPercentiles != nil {
+		t.Errorf("Expected default filter, got %+v (%v)", filter, err)
+	}
+
+	filter, err = ParseFeeHistoryFilter(json.RawMessage(`{"blockCount":5,"rewardPercentiles":[10,50,90]}`))
+	if err != nil {
+		t.Fatalf("ParseFeeHistoryFilter failed: %v", err)
+	}
+	if filter.BlockCount != 5 || len(filter.RewardPercentiles) != 3 {
+		t.Errorf("Unexpected filter: %+v", filter)
+	}
+
+	same, _ := ParseFeeHistoryFilter(json.RawMessage(`{"rewardPercentiles":[10,50,90],"blockCount":5}`))
+	other, _ := ParseFeeHistoryFilter(json.RawMessage(`{"blockCount":5,"rewardPercentiles":[10,50]}`))
+	if filter.Key() != same.Key() || filter.Key() == other.Key() {
+		t.Errorf("Unexpected keys: %s, %s, %s", filter.Key(), same.Key(), other.Key())
+	}
+
+	invalid := []string{`{"blockCount":2000}`, `{"rewardPercentiles":[50,10]}`, `{"rewardPercentiles":[101]}`, `{"blockCount":-1}`}
+	for _, params := range invalid {
+		if _, err := ParseFeeHistoryFilter(json.RawMessage(params)); err == nil {
+			t.Errorf("Expected error for params %q", params)
+		}
+	}
+}
+
+func TestManagerDefaultConfirmations(t *testing.T) {
+	m := NewManager()
+	if err := m.SetDefaultConfirmations(MaxConfirmations + 1); err == nil {
+		t.Error("Expected error for out-of-range default")
+	}
+	if err := m.SetDefaultConfirmations(3); err != nil {
+		t.Fatalf("SetDefaultConfirmations failed: %v", err)
+	}
+
+	tests := []struct {
+		subType  SubscriptionType
+		params   string
+		expected int
+	}{
+		{SubTypeNewHeads, ``, 3},
+		{SubTypeLogs, `{"address":"0x1"}`, 3},
+		{SubTypeNewHeads, `{"confirmations":0}`, 0},
+		{SubTypeLogs, `{"confirmations":5}`, 5},
+		{SubTypeGasPrice, ``, 0},
+	}
+
+	for _, tt := range tests {
+		subID, err := m.Subscribe("client1", tt.subType, json.RawMessage(tt.params))
+		if err != nil {
+			t.Fatalf("Subscribe failed: %v", err)
+		}
+		for _, sub := range m.GetSubscriptionsByType(tt.subType) {
+			if sub.ID == subID && sub.Options.Confirmations != tt.expected {
+				t.Errorf("%s %q: expected %d confirmations, got %d", tt.subType, tt.params, tt.expected, sub.Options.Confirmations)
+			}
+		}
+	}
+}
+
+func TestManagerSnapshot(t *testing.T) {
+	m := NewManager()
+
+	m.Subscribe("client1", SubTypeNewHeads, nil)
+	m.Subscribe("client2", SubTypeGasPrice, nil)
+	logsID, _ := m.Subscribe("client1", SubTypeLogs, json.RawMessage(`{"address":"0x1"}`))
+	m.Subscribe("client1", SubTypeTest, json.RawMessage(`{"label":"probe"}`))
+	m.Unsubscribe("client1", logsID)
+
+	data, _ := json.Marshal(m.Snapshot("client1"))
+	expected := `{"version":1,"subscriptions":[["newHeads"],["test",{"label":"probe"}]]}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	data, _ = json.Marshal(m.Snapshot("unknown"))
+	if string(data) != `{"version":1,"subscriptions":[]}` {
+		t.Errorf("Expected empty snapshot, got %s", data)
+	}
+}
+
+func TestSubscriptionThrottle(t *testing.T) {
+	sub := &Subscription{Options: Options{MaxPerSecond: 2}}
+	now := time.Now()
+
+	// A burst of maxPerSecond passes, the next is dropped
+	for i, expected := range []bool{false, false, true} {
+		if throttled := sub.Throttle(now); throttled != expected {
+			t.Errorf("Notification %d: expected throttled=%v", i, expected)
+		}
+	}
+
+	// Half a second refills one token
+	now = now.Add(500 * time.Millisecond)
+	if sub.Throttle(now) {
+		t.Error("Expected notification after refill to pass")
+	}
+	if !sub.Throttle(now) {
+		t.Error("Expected second notification after refill to be throttled")
+	}
+
+	unlimited := &Subscription{}
+	for i := 0; i < 100; i++ {
+		if unlimited.Throttle(now) {
+			t.Fatal("Subscription without maxPerSecond should not be throttled")
+		}
+	}
+}
+
+func TestManagerSetPaused(t *testing.T) {
+	m := NewManager()
+
+	subID, _ := m.Subscribe("client1", SubTypeNewHeads, nil)
+	sub, _ := m.Get(subID)
+
+	if m.SetPaused("client2", subID, true) {
+		t.Error("SetPaused should fail for wrong client")
+	}
+	if !m.SetPaused("client1", subID, true) || !sub.Paused() {
+		t.Error("Expected subscription to be paused")
+	}
+	if !m.SetPaused("client1", subID, false) || sub.Paused() {
+		t.Error("Expected subscription to be resumed")
+	}
+	if m.SetPaused("client1", "0xunknown", true) {
+		t.Error("SetPaused should fail for unknown subscription")
+	}
+}
+
+func TestSubscriptionHeartbeatDue(t *testing.T) {
+	now := time.Now()
+	sub := &Subscription{Options: Options{Heartbeat: 30 * time.Second}, lastSent: now}
+
+	if sub.HeartbeatDue(now.Add(10 * time.Second)) {
+		t.Error("Heartbeat should not be due before the interval")
+	}
+	if !sub.HeartbeatDue(now.Add(30 * time.Second)) {
+		t.Error("Heartbeat should be due after the interval")
+	}
+
+	sub.MarkSent(now.Add(30 * time.Second))
+	if sub.HeartbeatDue(now.Add(40 * time.Second)) {
+		t.Error("Heartbeat should not be due after a notification")
+	}
+
+	if (&Subscription{lastSent: now}).HeartbeatDue(now.Add(time.Hour)) {
+		t.Error("Heartbeat should never be due without the option")
+	}
+}
+
+func TestSubscriptionExpired(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	m := NewManager()
+	m.SetClock(fake)
+
+	subID, err := m.Subscribe("client", SubTypeNewHeads, json.RawMessage(`{"ttl":"1m"}`))
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	sub, _ := m.Get(subID)
+	if sub.Expired(fake.Now().Add(59 * time.Second)) {
+		t.Error("Subscription should not expire before its ttl")
+	}
+	if !sub.Expired(fake.Now().Add(time.Minute)) {
+		t.Error("Subscription should expire after its ttl")
+	}
+
+	permanentID, _ := m.Subscribe("client", SubTypeNewHeads, nil)
+	permanent, _ := m.Get(permanentID)
+	if permanent.Expired(fake.Now().Add(MaxTTL * 2)) {
+		t.Error("Subscription without ttl should never expire")
+	}
+
+	data, err := sub.ExpiryNotification()
+	if err != nil {
+		t.Fatalf("ExpiryNotification failed: %v", err)
+	}
+	var notification SubscriptionNotification
+	json.Unmarshal(data, &notification)
+	if !notification.Params.Expired || notification.Params.Subscription != subID || string(notification.Params.Result) != "null" {
+		t.Errorf("Unexpected expiry notification %s", data)
+	}
+}
+
+func TestSubscriptionSequence(t *testing.T) {
+	sub := &Subscription{ID: "0xsubid", Options: Options{Version: WireV2}}
+	data, _ := sub.Notification(map[string]string{"number": "0x1"})
+
+	var sent []string
+	send := func(stamped []byte) bool {
+		sent = append(sent, string(stamped))
+		return len(sent) != 2
+	}
+	sub.Sequence(data, send)
+	sub.Sequence(data, send) // dropped, but the number is consumed
+	sub.Sequence(data, send)
+
+	for i, expected := range []uint64{1, 2, 3} {
+		var notification SubscriptionNotification
+		if err := json.Unmarshal([]byte(sent[i]), &notification); err != nil {
+			t.Fatalf("Stamped notification is not valid JSON: %s", sent[i])
+		}
+		if notification.Params.Seq != expected || notification.Params.Subscription != "0xsubid" {
+			t.Errorf("Expected seq %d, got %s", expected, sent[i])
+		}
+	}
+}
+
+func TestSubscriptionWireVersion(t *testing.T) {
+	now := time.UnixMilli(1700000000123)
+	v1 := &Subscription{ID: "0xsubid", Options: Options{Version: WireV1}}
+	data, _ := v1.Notification(map[string]string{"number": "0x1"})
+	if received := v1.Receive(data, now); !bytes.Equal(received, data) {
+		t.Errorf("Version 1 notification changed: %s", received)
+	}
+	var sent []byte
+	v1.Sequence(data, func(b []byte) bool { sent = b; return true })
+	original := `{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0xsubid","result":{"number":"0x1"}}}`
+	if string(sent) != original {
+		t.Errorf("Expected the version 1 notification sent as %s, got %s", original, sent)
+	}
+
+	v2 := &Subscription{ID: "0xsubid", Options: Options{Version: WireV2}}
+	received := v2.Receive(data, now)
+	if again := v2.Receive(received, now.Add(time.Second)); !bytes.Equal(again, received) {
+		t.Errorf("Expected a notification to be stamped once, got %s", again)
+	}
+	var stamped []byte
+	v2.Sequence(received, func(b []byte) bool { stamped = b; return true })
+	expected := `{"jsonrpc":"2.0","method":"eth_subscription","params":{"seq":1,"receivedAt":1700000000123,"subscription":"0xsubid","result":{"number":"0x1"}}}`
+	if string(stamped) != expected {
+		t.Errorf("Expected %s, got %s", expected, stamped)
+	}
+}
+
+func TestSubscriptionDelta(t *testing.T) {
+	opts, err := ParseOptions(json.RawMessage(`{"delta":true}`))
+	if err != nil || !opts.Delta {
+		t.Fatalf("Expected the delta option to be parsed, got %+v, %v", opts, err)
+	}
+	sub := &Subscription{ID: "0xsubid", Options: opts}
+	encode := func(result interface{}) string {
+		data, _ := json.Marshal(result)
+		return string(data)
+	}
+	head := func(number, hash, gasUsed string) map[string]string {
+		return map[string]string{"number": number, "hash": hash, "gasLimit": "0x1c9c380", "gasUsed": gasUsed, "miner": "0xabc"}
+	}
+
+	if got := encode(sub.Delta(head("0x1", "0xa", "0x5"), 3)); got != encode(head("0x1", "0xa", "0x5")) {
+		t.Errorf("Expected the first notification to be a full snapshot, got %s", got)
+	}
+	second := head("0x2", "0xb", "0x5")
+	delete(second, "miner")
+	if got := encode(sub.Delta(second, 3)); got != `{"delta":true,"hash":"0xb","miner":null,"number":"0x2"}` {
+		t.Errorf("Expected only changed and removed fields, got %s", got)
+	}
+	if got := encode(sub.Delta(head("0x3", "0xc", "0x6"), 3)); got != `{"delta":true,"gasUsed":"0x6","hash":"0xc","miner":"0xabc","number":"0x3"}` {
+		t.Errorf("Expected a delta from the previous header, got %s", got)
+	}
+	if got := encode(sub.Delta(head("0x4", "0xd", "0x6"), 3)); strings.Contains(got, "delta") {
+		t.Errorf("Expected a full snapshot every 3 notifications, got %s", got)
+	}
+
+	// After a dropped notification the client's view is stale
+	sub.ResetDelta()
+	if got := encode(sub.Delta(head("0x6", "0xf", "0x6"), 3)); strings.Contains(got, "delta") {
+		t.Errorf("Expected a full snapshot after a reset, got %s", got)
+	}
+}
+
+func TestSubscriptionFields(t *testing.T) {
+	if _, err := ParseOptions(json.RawMessage(`{"fields":["number",""]}`)); err == nil {
+		t.Error("Expected an empty field name to be rejected")
+	}
+	opts, err := ParseOptions(json.RawMessage(`{"fields":["timestamp","number","hash","number","missing"]}`))
+	if err != nil {
+		t.Fatalf("ParseOptions failed: %v", err)
+	}
+	sub := &Subscription{ID: "0xsubid", Options: opts}
+	header := map[string]string{"number": "0x1", "hash": "0xa", "parentHash": "0x0", "timestamp": "0x5", "miner": "0xabc"}
+
+	data, _ := sub.Notification(header)
+	var notification SubscriptionNotification
+	json.Unmarshal(data, &notification)
+	if got := string(notification.Params.Result); got != `{"timestamp":"0x5","number":"0x1","hash":"0xa"}` {
+		t.Errorf("Expected only the requested fields in order, got %s", got)
+	}
+
+	// The delta marker survives the projection
+	data, _ = sub.Notification(map[string]interface{}{"delta": true, "number": "0x2", "miner": "0xdef"})
+	json.Unmarshal(data, &notification)
+	if got := string(notification.Params.Result); got != `{"delta":true,"number":"0x2"}` {
+		t.Errorf("Expected the delta marker kept, got %s", got)
+	}
+
+	// Results that aren't objects are untouched
+	data, _ = sub.Notification(true)
+	json.Unmarshal(data, &notification)
+	if got := string(notification.Params.Result); got != "true" {
+		t.Errorf("Expected a boolean result unchanged, got %s", got)
+	}
+}
+
+func TestSubscriptionNotificationFailures(t *testing.T) {
+	sub := &Subscription{ID: "0xsubid", Options: Options{Label: "blocks"}}
+	for range 2 {
+		if _, err := sub.Notification(map[string]interface{}{"ratio": math.Inf(1)}); err == nil {
+			t.Fatal("Expected a non-finite number to fail to encode")
+		}
+	}
+	if sub.Failures() != 2 {
+		t.Errorf("Expected 2 consecutive failures, got %d", sub.Failures())
+	}
+	sub.Notification(map[string]string{"number": "0x1"})
+	if sub.Failures() != 0 {
+		t.Errorf("Expected a successful notification to reset the count, got %d", sub.Failures())
+	}
+
+	data, err := sub.ErrorNotification(rpc.ErrCodeInternalError, "subscription removed")
+	if err != nil {
+		t.Fatalf("ErrorNotification failed: %v", err)
+	}
+	expected := `{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0xsubid","label":"blocks","result":null,"error":{"code":-32603,"message":"subscription removed"}}}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+}
+
+func TestManagerResume(t *testing.T) {
+	m := NewManager()
+	m.SetResumeBufferSize(2)
+
+	subID, _ := m.Subscribe("client1", SubTypeNewHeads, json.RawMessage(`{"resumable":true}`))
+	sub, _ := m.Get(subID)
+	if sub.resumeToken == "" {
+		t.Fatal("Expected a resume token for a resumable subscription")
+	}
+
+	for i := 0; i < 3; i++ {
+		data, _ := sub.Notification(i)
+		sub.Sequence(data, func([]byte) bool { return true })
+	}
+
+	m.UnsubscribeAll("client1")
+	if _, exists := m.Get(subID); !exists || !sub.Detached() {
+		t.Fatal("Resumable subscription should be detached, not removed")
+	}
+
+	// Only seq 2 and 3 are retained
+	if err := m.Resume(sub.resumeToken, "client2", 0, func(string) {}, func([]byte) bool { return true }); err == nil {
+		t.Error("Expected error when missed notifications are no longer retained")
+	}
+	if err := m.Resume("unknown", "client2", 2, func(string) {}, func([]byte) bool { return true }); err == nil {
+		t.Error("Expected error for unknown token")
+	}
+
+	var acked string
+	var replayed []uint64
+	err := m.Resume(sub.resumeToken, "client2", 1,
+		func(id string) { acked = id },
+		func(data []byte) bool {
+			var notification SubscriptionNotification
+			json.Unmarshal(data, &notification)
+			replayed = append(replayed, notification.Params.Seq)
+			return true
+		})
+	if err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if acked != subID || len(replayed) != 2 || replayed[0] != 2 || replayed[1] != 3 {
+		t.Errorf("Expected ack %s and replay of seq 2, 3, got %s %v", subID, acked, replayed)
+	}
+	if sub.ClientID != "client2" || sub.Detached() {
+		t.Error("Resumed subscription should belong to the new client")
+	}
+	if subs := m.GetClientSubscriptions("client2"); len(subs) != 1 || subs[0] != subID {
+		t.Errorf("Expected subscription listed for client2, got %v", subs)
+	}
+
+	// Detached again, then expired
+	m.UnsubscribeAll("client2")
+	m.ExpireDetached(time.Now(), time.Hour)
+	if _, exists := m.Get(subID); !exists {
+		t.Error("Subscription should be kept within the TTL")
+	}
+	m.ExpireDetached(time.Now().Add(2*time.Hour), time.Hour)
+	if _, exists := m.Get(subID); exists {
+		t.Error("Subscription should be removed after the TTL")
+	}
+}
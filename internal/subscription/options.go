@@ -0,0 +1,245 @@
+package subscription
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// MaxConfirmations is the deepest confirmation delay a subscription may request
+const MaxConfirmations = 64
+
+// MaxLabelLength is the longest label a subscription may carry
+const MaxLabelLength = 128
+
+// MaxFields is the most fields a subscription may project notifications to
+const MaxFields = 64
+
+// Bounds of the heartbeat interval a subscription may request
+const (
+	MinHeartbeat = time.Second
+	MaxHeartbeat = time.Hour
+)
+
+// Bounds of the lifetime a subscription may request
+const (
+	MinTTL = time.Second
+	MaxTTL = 24 * time.Hour
+)
+
+// Notification wire format versions a subscription may request. Version 1 is
+// the original format, kept byte for byte; later versions add fields.
+const (
+	WireV1 = 1
+	// WireV2 adds seq and receivedAt to every notification
+	WireV2 = 2
+
+	LatestWireVersion = WireV2
+)
+
+// Options are generic per-subscription settings read from the params object.
+// For logs subscriptions they sit alongside the filter fields.
+type Options struct {
+	// Confirmations delays notifications until the block has this many descendants
+	Confirmations int `json:"confirmations,omitempty"`
+
+	// Label is a client-chosen alias echoed back in every notification
+	Label string `json:"label,omitempty"`
+
+	// Stats adds per-block transaction and throughput stats to newHeads notifications
+	Stats bool `json:"stats,omitempty"`
+
+	// EventName adds the event name resolved from topic0 to logs notifications
+	EventName bool `json:"eventName,omitempty"`
+
+	// AddressLabels adds the operator labels of the addresses involved to notifications
+	AddressLabels bool `json:"addressLabels,omitempty"`
+
+	// Dedup delivers a log matching several of the client's dedup logs
+	// subscriptions once, listing all their IDs
+	Dedup bool `json:"dedup,omitempty"`
+
+	// Instance adds the ID of the serving replica to notifications
+	Instance bool `json:"instance,omitempty"`
+
+	// Heartbeat is the quiet period after which an empty heartbeat notification
+	// is sent, so clients can tell a quiet chain from a dead connection.
+	// 0 disables heartbeats.
+	Heartbeat time.Duration `json:"heartbeat,omitempty"`
+
+	// Resumable keeps the subscription's recent notifications and keeps it
+	// alive after a disconnect so hl_recoverSubscription can recover it
+	Resumable bool `json:"resumable,omitempty"`
+
+	// TTL is the lifetime after which the subscription is removed with a
+	// final expiry notification. 0 means no expiry.
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// MaxPerSecond caps the notification rate; excess notifications are dropped.
+	// 0 means unlimited.
+	MaxPerSecond int `json:"maxPerSecond,omitempty"`
+
+	// Delta makes newHeads and newHeadsLite notifications carry only the fields
+	// changed from the previous header, with periodic full snapshots
+	Delta bool `json:"delta,omitempty"`
+
+	// Fields trims object notification results to these top-level fields,
+	// in this order. Empty keeps every field.
+	Fields []string `json:"fields,omitempty"`
+
+	// Version is the notification wire format version, WireV1 unless requested
+	Version int `json:"version,omitempty"`
+
+	// confirmationsSet records whether the client gave confirmations explicitly,
+	// so an explicit 0 overrides the server-wide default
+	confirmationsSet bool
+}
+
+// optionFields are the JSON keys of Options, which may appear in any params object
+var optionFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(Options{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// IsOptionField reports whether key is a generic subscription option
+func IsOptionField(key string) bool {
+	return optionFields[key]
+}
+
+// ParseOptions extracts the generic options from subscription params.
+// For an array of logs filters, the options are read from the first one.
+func ParseOptions(params json.RawMessage) (Options, error) {
+	opts := Options{Version: WireV1}
+	if len(params) > 0 && params[0] == '[' {
+		var elements []json.RawMessage
+		if err := json.Unmarshal(params, &elements); err == nil && len(elements) > 0 {
+			params = elements[0]
+		}
+	}
+	if len(params) == 0 || params[0] != '{' {
+		return opts, nil
+	}
+	var raw struct {
+		Confirmations *int     `json:"confirmations"`
+		Label         string   `json:"label"`
+		Stats         bool     `json:"stats"`
+		EventName     bool     `json:"eventName"`
+		AddressLabels bool     `json:"addressLabels"`
+		MaxPerSecond  int      `json:"maxPerSecond"`
+		Dedup         bool     `json:"dedup"`
+		Instance      bool     `json:"instance"`
+		Heartbeat     string   `json:"heartbeat"`
+		Resumable     bool     `json:"resumable"`
+		TTL           string   `json:"ttl"`
+		Version       *int     `json:"version"`
+		Delta         bool     `json:"delta"`
+		Fields        []string `json:"fields"`
+	}
+	if err := json.Unmarshal(params, &raw); err != nil {
+		return opts, fmt.Errorf("invalid subscription options: %w", err)
+	}
+	if raw.Confirmations != nil {
+		opts.Confirmations = *raw.Confirmations
+		opts.confirmationsSet = true
+	}
+	if opts.Confirmations < 0 || opts.Confirmations > MaxConfirmations {
+		return opts, fmt.Errorf("confirmations must be between 0 and %d", MaxConfirmations)
+	}
+	if len(raw.Label) > MaxLabelLength {
+		return opts, fmt.Errorf("label must be at most %d characters", MaxLabelLength)
+	}
+	if raw.Version != nil {
+		if *raw.Version < WireV1 || *raw.Version > LatestWireVersion {
+			return opts, fmt.Errorf("version must be between %d and %d", WireV1, LatestWireVersion)
+		}
+		opts.Version = *raw.Version
+	}
+	if len(raw.Fields) > MaxFields {
+		return opts, fmt.Errorf("fields must list at most %d fields", MaxFields)
+	}
+	for _, field := range raw.Fields {
+		if field == "" {
+			return opts, fmt.Errorf("fields must not contain empty names")
+		}
+	}
+	if raw.MaxPerSecond < 0 {
+		return opts, fmt.Errorf("maxPerSecond must not be negative")
+	}
+	if raw.Heartbeat != "" {
+		heartbeat, err := time.ParseDuration(raw.Heartbeat)
+		if err != nil || heartbeat < MinHeartbeat || heartbeat > MaxHeartbeat {
+			return opts, fmt.Errorf("heartbeat must be a duration between %v and %v", MinHeartbeat, MaxHeartbeat)
+		}
+		opts.Heartbeat = heartbeat
+	}
+	if raw.TTL != "" {
+		ttl, err := time.ParseDuration(raw.TTL)
+		if err != nil || ttl < MinTTL || ttl > MaxTTL {
+			return opts, fmt.Errorf("ttl must be a duration between %v and %v", MinTTL, MaxTTL)
+		}
+		opts.TTL = ttl
+	}
+	opts.Label = raw.Label
+	opts.Stats = raw.Stats
+	opts.EventName = raw.EventName
+	opts.AddressLabels = raw.AddressLabels
+	opts.MaxPerSecond = raw.MaxPerSecond
+	opts.Dedup = raw.Dedup
+	opts.Instance = raw.Instance
+	opts.Resumable = raw.Resumable
+	opts.Delta = raw.Delta
+	opts.Fields = raw.Fields
+	return opts, nil
+}
+
+// delaysEmission reports whether the confirmations option delays block
+// emission for a subscription type, and thus whether the default applies
+func delaysEmission(subType SubscriptionType) bool {
+	return subType == SubTypeNewHeads || subType == SubTypeNewHeadsLite || subType == SubTypeLogs
+}
+
+// project trims an encoded result to the requested fields. The delta marker
+// of a delta notification is always kept; results that aren't JSON objects
+// are returned unchanged.
+func (o Options) project(result []byte) []byte {
+	if len(o.Fields) == 0 || len(result) == 0 || result[0] != '{' {
+		return result
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(result, &all); err != nil {
+		return result
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	write := func(key string, value json.RawMessage) {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	if marker, ok := all["delta"]; ok {
+		write("delta", marker)
+	}
+	for _, field := range o.Fields {
+		if value, ok := all[field]; ok && field != "delta" {
+			write(field, value)
+			// A field listed twice is written once
+			delete(all, field)
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
@@ -0,0 +1,129 @@
+package subscription
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"hlnode-websocket/internal/logger"
+	"hlnode-websocket/internal/metrics"
+)
+
+// DefaultResumeBufferSize is the number of notifications retained per resumable subscription
+const DefaultResumeBufferSize = 256
+
+// SetResumeBufferSize sets the number of notifications retained per
+// resumable subscription created from now on
+func (m *Manager) SetResumeBufferSize(size int) error {
+	if size <= 0 {
+		return fmt.Errorf("resume buffer size must be positive")
+	}
+	m.mu.Lock()
+	m.resumeBufferSize = size
+	m.mu.Unlock()
+	return nil
+}
+
+// retain records a stamped notification of a resumable subscription, dropping
+// the oldest beyond the buffer size. Must be called with seqMu held.
+func (s *Subscription) retain(stamped []byte) {
+	if s.resumeToken == "" {
+		return
+	}
+	if len(s.history) >= s.historySize {
+		s.history = append(s.history[:0], s.history[1:]...)
+	}
+	s.history = append(s.history, stamped)
+}
+
+// detach marks a resumable subscription as left behind by its client
+func (s *Subscription) detach(now time.Time) {
+	s.seqMu.Lock()
+	s.detachedAt = now
+	s.seqMu.Unlock()
+}
+
+// Detached reports whether the subscription's client disconnected and it
+// awaits being resumed
+func (s *Subscription) Detached() bool {
+	s.seqMu.Lock()
+	defer s.seqMu.Unlock()
+	return !s.detachedAt.IsZero()
+}
+
+// Resume moves the resumable subscription identified by token to a client
+// and replays the retained notifications after lastSeq through send. ack is
+// called with the subscription ID before the replay starts. It also takes
+// over subscriptions still attached to another connection, e.g. one that
+// has not been detected as dead yet.
+func (m *Manager) Resume(token, clientID string, lastSeq uint64, ack func(subID string), send func([]byte) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subID, ok := m.resumeTokens[token]
+	if !ok {
+		return fmt.Errorf("unknown or expired resume token")
+	}
+	sub := m.subscriptions[subID]
+
+	sub.seqMu.Lock()
+	defer sub.seqMu.Unlock()
+
+	if lastSeq > sub.seq {
+		return fmt.Errorf("lastSeq %d is ahead of the subscription (seq %d)", lastSeq, sub.seq)
+	}
+	oldest := sub.seq - uint64(len(sub.history)) + 1
+	if lastSeq+1 < oldest {
+		return fmt.Errorf("notifications after seq %d are no longer retained (oldest: %d)", lastSeq, oldest)
+	}
+
+	if sub.ClientID != clientID {
+		previous := m.clientSubs[sub.ClientID]
+		for i, id := range previous {
+			if id == subID {
+				m.clientSubs[sub.ClientID] = append(previous[:i], previous[i+1:]...)
+				break
+			}
+		}
+		m.clientSubs[clientID] = append(m.clientSubs[clientID], subID)
+		sub.ClientID = clientID
+	}
+	sub.detachedAt = time.Time{}
+
+	ack(subID)
+	for _, stamped := range sub.history[lastSeq+1-oldest:] {
+		send(stamped)
+	}
+
+	logger.Info("Client %s resumed %s (sub_id: %s) after seq %d", clientID, sub.Type, subID, lastSeq)
+	return nil
+}
+
+// ExpireDetached removes resumable subscriptions detached for longer than ttl
+func (m *Manager) ExpireDetached(now time.Time, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for token, subID := range m.resumeTokens {
+		sub := m.subscriptions[subID]
+		sub.seqMu.Lock()
+		detachedAt := sub.detachedAt
+		sub.seqMu.Unlock()
+
+		if detachedAt.IsZero() || now.Sub(detachedAt) < ttl {
+			continue
+		}
+		delete(m.resumeTokens, token)
+		delete(m.subscriptions, subID)
+		metrics.WSActiveSubscriptions.WithLabelValues(string(sub.Type)).Dec()
+		metrics.WSSubscriptionsRemoved.WithLabelValues(string(sub.Type)).Inc()
+		logger.Info("Expired detached %s subscription %s", sub.Type, subID)
+	}
+}
+
+func generateResumeToken() string {
+	bytes := make([]byte, 32)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,81 @@
+package subscription
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Criteria select subscriptions for admin bulk operations. Zero fields
+// match every subscription.
+type Criteria struct {
+	Type SubscriptionType
+	// Address matches subscriptions whose filter names the address
+	Address string
+	// ClientIDs, if not nil, matches subscriptions of these clients only
+	ClientIDs map[string]bool
+	// CreatedBefore matches subscriptions created before it
+	CreatedBefore time.Time
+}
+
+// Select returns the subscriptions matching c, oldest first
+func (m *Manager) Select(c Criteria) []*Subscription {
+	address := normalizeAddress(c.Address)
+	var result []*Subscription
+	for _, sub := range m.All() {
+		if c.Type != "" && sub.Type != c.Type {
+			continue
+		}
+		if c.ClientIDs != nil && !c.ClientIDs[sub.ClientID] {
+			continue
+		}
+		if !c.CreatedBefore.IsZero() && !sub.CreatedAt.Before(c.CreatedBefore) {
+			continue
+		}
+		if address != "" && !containsAddress(sub.Addresses(), address) {
+			continue
+		}
+		result = append(result, sub)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Addresses returns the lowercase addresses named by the subscription's
+// filter, for the subscription types that filter by address
+func (s *Subscription) Addresses() []string {
+	var addresses []string
+	switch s.Type {
+	case SubTypeLogs:
+		filters, _ := ParseLogFilters(s.Params)
+		for _, filter := range filters {
+			addresses = append(addresses, filter.Address...)
+		}
+	case SubTypeTokenTransfers:
+		if filter, err := ParseTokenTransferFilter(s.Params); err == nil {
+			addresses = append(append(addresses, filter.Address...), filter.Token...)
+		}
+	case SubTypeBalanceChanges:
+		if filter, err := ParseBalanceFilter(s.Params); err == nil {
+			addresses = filter.Address
+		}
+	case SubTypeNonceChanges:
+		if filter, err := ParseNonceFilter(s.Params); err == nil {
+			addresses = filter.Address
+		}
+	case SubTypeBlockReceipts:
+		var filter ReceiptsFilter
+		if len(s.Params) > 0 && filter.UnmarshalJSON(s.Params) == nil {
+			addresses = filter.Address
+		}
+	}
+	for i, address := range addresses {
+		addresses[i] = strings.ToLower(address)
+	}
+	return addresses
+}
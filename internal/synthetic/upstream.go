@@ -0,0 +1,256 @@
+// Package synthetic serves a generated chain over JSON-RPC, standing in for a
+// node when soak testing the full pipeline
+package synthetic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"hlnode-websocket/internal/clock"
+	"hlnode-websocket/internal/rpc"
+)
+
+// TransferTopic is the topic of every generated log (ERC-20 Transfer)
+const TransferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// LogAddress is the contract address of every generated log
+const LogAddress = "0x5050505050505050505050505050505050505050"
+
+// MaxLogsRange is the widest eth_getLogs block range served
+const MaxLogsRange = 10000
+
+// Config sets the rates of the generated chain
+type Config struct {
+	// BlockInterval is the time between blocks
+	BlockInterval time.Duration
+	// LogsPerBlock is the number of logs in every block
+	LogsPerBlock int
+	// StartBlock is the head when the upstream is created
+	StartBlock uint64
+}
+
+// Upstream is a JSON-RPC handler serving a chain that grows by one block
+// every BlockInterval. Blocks and logs are derived from their number, so
+// nothing is stored and any block can be fetched again identically.
+type Upstream struct {
+	cfg   Config
+	clock clock.Clock
+	start time.Time
+}
+
+// NewUpstream creates an upstream whose chain starts at cfg.StartBlock now
+func NewUpstream(cfg Config, clk clock.Clock) (*Upstream, error) {
+	if cfg.BlockInterval <= 0 {
+		return nil, fmt.Errorf("block interval must be positive")
+	}
+	if cfg.LogsPerBlock < 0 {
+		return nil, fmt.Errorf("logs per block must not be negative")
+	}
+	return &Upstream{cfg: cfg, clock: clk, start: clk.Now()}, nil
+}
+
+// Head returns the number of the latest block
+func (u *Upstream) Head() uint64 {
+	return u.cfg.StartBlock + uint64(u.clock.Now().Sub(u.start)/u.cfg.BlockInterval)
+}
+
+// Block returns the header of block n
+func (u *Upstream) Block(n uint64) *rpc.FullBlockHeader {
+	timestamp := u.start.Add(time.Duration(n-u.cfg.StartBlock) * u.cfg.BlockInterval).Unix()
+	return &rpc.FullBlockHeader{
+		Number:           fmt.Sprintf("0x%x", n),
+		Hash:             BlockHash(n),
+		ParentHash:       BlockHash(n - 1),
+		Sha3Uncles:       hash("uncles", 0),
+		LogsBloom:        "0x" + strings.Repeat("00", 256),
+		TransactionsRoot: hash("transactions", n),
+		StateRoot:        hash("state", n),
+		ReceiptsRoot:     hash("receipts", n),
+		Miner:            "0x0000000000000000000000000000000000000000",
+		ExtraData:        "0x",
+		GasLimit:         "0x1e8480",
+		GasUsed:          fmt.Sprintf("0x%x", 21000*u.cfg.LogsPerBlock),
+		Timestamp:        fmt.Sprintf("0x%x", timestamp),
+		BaseFeePerGas:    "0x5f5e100",
+	}
+}
+
+// Logs returns the logs of block n, one per transaction
+func (u *Upstream) Logs(n uint64) []rpc.Log {
+	logs := make([]rpc.Log, u.cfg.LogsPerBlock)
+	for i := range logs {
+		logs[i] = rpc.Log{
+			Address:          LogAddress,
+			Topics:           []string{TransferTopic, hash("from", n), hash("to", uint64(i))},
+			Data:             fmt.Sprintf("0x%064x", n),
+			BlockNumber:      fmt.Sprintf("0x%x", n),
+			BlockHash:        BlockHash(n),
+			TransactionHash:  hash(fmt.Sprintf("tx%d", i), n),
+			TransactionIndex: fmt.Sprintf("0x%x", i),
+			LogIndex:         fmt.Sprintf("0x%x", i),
+		}
+	}
+	return logs
+}
+
+// BlockHash returns the hash of block n
+func BlockHash(n uint64) string {
+	return hash("block", n)
+}
+
+// hash derives a 32-byte hex value from a namespace and a number
+func hash(namespace string, n uint64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", namespace, n)))
+	return "0x" + hex.EncodeToString(sum[:])
+}
+
+// ServeHTTP answers a JSON-RPC request, or a batch of them
+func (u *Upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if len(raw) > 0 && raw[0] == '[' {
+		var reqs []rpc.Request
+		if err := json.Unmarshal(raw, &reqs); err != nil {
+			http.Error(w, "invalid batch", http.StatusBadRequest)
+			return
+		}
+		resps := make([]*rpc.Response, len(reqs))
+		for i := range reqs {
+			resps[i] = u.handle(&reqs[i])
+		}
+		json.NewEncoder(w).Encode(resps)
+		return
+	}
+
+	var req rpc.Request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(u.handle(&req))
+}
+
+// handle answers a single request
+func (u *Upstream) handle(req *rpc.Request) *rpc.Response {
+	var params []json.RawMessage
+	json.Unmarshal(req.Params, &params)
+
+	var result interface{}
+	switch req.Method {
+	case "eth_blockNumber":
+		result = fmt.Sprintf("0x%x", u.Head())
+	case "eth_chainId":
+		result = "0x3e7"
+	case "eth_gasPrice", "eth_bigBlockGasPrice":
+		result = "0x5f5e100"
+	case "eth_syncing":
+		result = false
+	case "eth_getBlockByNumber":
+		if len(params) == 0 {
+			return rpc.NewErrorResponse(req.ID, rpc.ErrCodeInvalidParams, "missing block number")
+		}
+		n, ok := u.blockParam(params[0])
+		if !ok {
+			return rpc.NewErrorResponse(req.ID, rpc.ErrCodeInvalidParams, "invalid block number")
+		}
+		if n > u.Head() {
+			result = nil
+			break
+		}
+		result = struct {
+			*rpc.FullBlockHeader
+			Transactions []string `json:"transactions"`
+		}{u.Block(n), []string{}}
+	case "eth_getLogs":
+		logs, err := u.getLogs(params)
+		if err != nil {
+			return rpc.NewErrorResponse(req.ID, rpc.ErrCodeInvalidParams, err.Error())
+		}
+		result = logs
+	default:
+		return rpc.NewErrorResponse(req.ID, rpc.ErrCodeMethodNotFound, fmt.Sprintf("method %s not supported by the synthetic upstream", req.Method))
+	}
+
+	data, _ := json.Marshal(result)
+	return &rpc.Response{JSONRPC: "2.0", Result: data, ID: req.ID}
+}
+
+// getLogs serves eth_getLogs over a block range, matching the generated
+// contract address and topics
+func (u *Upstream) getLogs(params []json.RawMessage) ([]rpc.Log, error) {
+	var filter struct {
+		FromBlock json.RawMessage `json:"fromBlock"`
+		ToBlock   json.RawMessage `json:"toBlock"`
+		Address   json.RawMessage `json:"address"`
+		Topics    json.RawMessage `json:"topics"`
+	}
+	if len(params) > 0 {
+		json.Unmarshal(params[0], &filter)
+	}
+	head := u.Head()
+	from, to := head, head
+	if filter.FromBlock != nil {
+		var ok bool
+		if from, ok = u.blockParam(filter.FromBlock); !ok {
+			return nil, fmt.Errorf("invalid fromBlock")
+		}
+	}
+	if filter.ToBlock != nil {
+		var ok bool
+		if to, ok = u.blockParam(filter.ToBlock); !ok {
+			return nil, fmt.Errorf("invalid toBlock")
+		}
+	}
+	if to > head {
+		to = head
+	}
+	if from > to {
+		return []rpc.Log{}, nil
+	}
+	if to-from >= MaxLogsRange {
+		return nil, fmt.Errorf("block range exceeds %d blocks", MaxLogsRange)
+	}
+
+	// Generated logs all share an address and first topic, so filters either
+	// match every log or none
+	if filter.Address != nil && !strings.Contains(strings.ToLower(string(filter.Address)), LogAddress) {
+		return []rpc.Log{}, nil
+	}
+	var topics []json.RawMessage
+	json.Unmarshal(filter.Topics, &topics)
+	if len(topics) > 0 && string(topics[0]) != "null" && !strings.Contains(strings.ToLower(string(topics[0])), TransferTopic) {
+		return []rpc.Log{}, nil
+	}
+
+	logs := []rpc.Log{}
+	for n := from; n <= to; n++ {
+		logs = append(logs, u.Logs(n)...)
+	}
+	return logs, nil
+}
+
+// blockParam parses a block number param: a hex quantity or a tag
+func (u *Upstream) blockParam(param json.RawMessage) (uint64, bool) {
+	var value string
+	if err := json.Unmarshal(param, &value); err != nil {
+		return 0, false
+	}
+	switch value {
+	case "latest", "safe", "finalized", "pending":
+		return u.Head(), true
+	case "earliest":
+		return 0, true
+	}
+	n, err := rpc.ParseHexUint64(value)
+	return n, err == nil
+}
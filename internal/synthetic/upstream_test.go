@@ -0,0 +1,76 @@
+package synthetic
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"hlnode-websocket/internal/clock"
+	"hlnode-websocket/internal/rpc"
+)
+
+func TestUpstreamChain(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	upstream, err := NewUpstream(Config{BlockInterval: time.Second, LogsPerBlock: 3, StartBlock: 100}, clk)
+	if err != nil {
+		t.Fatalf("NewUpstream failed: %v", err)
+	}
+	server := httptest.NewServer(upstream)
+	defer server.Close()
+	client := rpc.NewClient(server.URL)
+	ctx := context.Background()
+
+	if head, _ := client.GetBlockNumber(ctx); head != "0x64" {
+		t.Errorf("Expected head 0x64, got %s", head)
+	}
+	clk.Advance(2500 * time.Millisecond)
+	head, err := client.GetBlockNumber(ctx)
+	if err != nil || head != "0x66" {
+		t.Fatalf("Expected head 0x66 after 2.5 blocks, got %s (%v)", head, err)
+	}
+
+	block, err := client.GetFullBlock(ctx, head)
+	if err != nil || block == nil {
+		t.Fatalf("GetFullBlock failed: %v", err)
+	}
+	parent, _ := client.GetFullBlock(ctx, "0x65")
+	if block.ParentHash != parent.Hash || block.Hash != BlockHash(0x66) {
+		t.Errorf("Expected block 0x66 to link to its parent, got %+v", block)
+	}
+	if future, err := client.GetFullBlock(ctx, "0x67"); err != nil || future != nil {
+		t.Errorf("Expected no block past the head, got %+v (%v)", future, err)
+	}
+
+	logs, err := client.GetBlockLogs(ctx, head)
+	if err != nil || len(logs) != 3 {
+		t.Fatalf("Expected 3 logs, got %d (%v)", len(logs), err)
+	}
+	if logs[2].LogIndex != "0x2" || logs[2].BlockHash != block.Hash || logs[2].Topics[0] != TransferTopic {
+		t.Errorf("Unexpected log %+v", logs[2])
+	}
+
+	ranged, err := client.GetLogs(ctx, "0x64", "latest", []string{LogAddress}, nil)
+	if err != nil || len(ranged) != 9 {
+		t.Errorf("Expected 9 logs over 3 blocks, got %d (%v)", len(ranged), err)
+	}
+	other, err := client.GetLogs(ctx, "0x64", "latest", []string{"0x1111111111111111111111111111111111111111"}, nil)
+	if err != nil || len(other) != 0 {
+		t.Errorf("Expected no logs of another address, got %d (%v)", len(other), err)
+	}
+
+	resp, err := client.Call(ctx, &rpc.Request{JSONRPC: "2.0", Method: "eth_call", Params: json.RawMessage("[]"), ID: json.RawMessage("1")})
+	if err != nil || resp.Error == nil || resp.Error.Code != rpc.ErrCodeMethodNotFound {
+		t.Errorf("Expected method not found, got %+v (%v)", resp, err)
+	}
+}
+
+func TestNewUpstreamInvalid(t *testing.T) {
+	if _, err := NewUpstream(Config{}, clock.Real); err == nil {
+		t.Error("Expected error for a zero block interval")
+	}
+	if _, err := NewUpstream(Config{BlockInterval: time.Second, LogsPerBlock: -1}, clock.Real); err == nil {
+		t.Error("Expected error for negative logs per block")
+	}
+}
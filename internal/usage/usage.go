@@ -0,0 +1,174 @@
+// Package usage aggregates requests, notifications and bytes sent by API key
+// and hour into an in-memory table, optionally persisted to a file, for
+// lightweight billing and reporting
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"hlnode-websocket/internal/clock"
+)
+
+// MaxKeysPerHour is the most API keys tracked per hour; usage of further keys
+// is folded into OverflowKey so clients can't grow the table without bound
+const MaxKeysPerHour = 10000
+
+// OverflowKey collects the usage of API keys beyond MaxKeysPerHour
+const OverflowKey = "_other"
+
+// Bucket is the usage of one API key during one hour
+type Bucket struct {
+	APIKey        string    `json:"apiKey"`
+	Hour          time.Time `json:"hour"`
+	Requests      uint64    `json:"requests"`
+	Notifications uint64    `json:"notifications"`
+	Bytes         uint64    `json:"bytes"`
+}
+
+type bucketKey struct {
+	apiKey string
+	hour   int64 // Unix seconds of the start of the hour
+}
+
+// Table holds the usage buckets of the retention period
+type Table struct {
+	clock     clock.Clock
+	retention time.Duration
+
+	buckets     map[bucketKey]*Bucket
+	keysPerHour map[int64]int
+	mu          sync.Mutex
+}
+
+// NewTable creates an empty table keeping buckets for the retention period
+func NewTable(clk clock.Clock, retention time.Duration) *Table {
+	return &Table{
+		clock:       clk,
+		retention:   retention,
+		buckets:     make(map[bucketKey]*Bucket),
+		keysPerHour: make(map[int64]int),
+	}
+}
+
+// Record adds usage of an API key to the current hour's bucket; requests
+// without a key are recorded under the empty key
+func (t *Table) Record(apiKey string, requests, notifications, bytes uint64) {
+	hour := t.clock.Now().UTC().Truncate(time.Hour)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bucket(apiKey, hour).add(requests, notifications, bytes)
+}
+
+// bucket returns the bucket of an API key and hour, creating it if needed.
+// t.mu must be held.
+func (t *Table) bucket(apiKey string, hour time.Time) *Bucket {
+	key := bucketKey{apiKey: apiKey, hour: hour.Unix()}
+	if b, ok := t.buckets[key]; ok {
+		return b
+	}
+	if t.keysPerHour[key.hour] >= MaxKeysPerHour {
+		key.apiKey = OverflowKey
+		if b, ok := t.buckets[key]; ok {
+			return b
+		}
+	}
+	b := &Bucket{APIKey: key.apiKey, Hour: hour}
+	t.buckets[key] = b
+	t.keysPerHour[key.hour]++
+	return b
+}
+
+func (b *Bucket) add(requests, notifications, bytes uint64) {
+	b.Requests += requests
+	b.Notifications += notifications
+	b.Bytes += bytes
+}
+
+// Report returns the buckets of the hours starting in [from, to), ordered by
+// hour then API key
+func (t *Table) Report(from, to time.Time) []Bucket {
+	t.mu.Lock()
+	report := make([]Bucket, 0)
+	for _, b := range t.buckets {
+		if !b.Hour.Before(from) && b.Hour.Before(to) {
+			report = append(report, *b)
+		}
+	}
+	t.mu.Unlock()
+
+	sort.Slice(report, func(i, j int) bool {
+		if !report[i].Hour.Equal(report[j].Hour) {
+			return report[i].Hour.Before(report[j].Hour)
+		}
+		return report[i].APIKey < report[j].APIKey
+	})
+	return report
+}
+
+// Prune drops the buckets of hours older than the retention period
+func (t *Table) Prune() {
+	cutoff := t.clock.Now().Add(-t.retention).Unix()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.buckets {
+		if key.hour < cutoff {
+			delete(t.buckets, key)
+		}
+	}
+	for hour := range t.keysPerHour {
+		if hour < cutoff {
+			delete(t.keysPerHour, hour)
+		}
+	}
+}
+
+// Save writes all buckets to a JSON file, replacing it atomically
+func (t *Table) Save(path string) error {
+	t.mu.Lock()
+	buckets := make([]Bucket, 0, len(t.buckets))
+	for _, b := range t.buckets {
+		buckets = append(buckets, *b)
+	}
+	t.mu.Unlock()
+
+	data, err := json.Marshal(buckets)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load adds the buckets of a file written by Save to the table. A missing
+// file is not an error, so the first start with persistence begins empty.
+func (t *Table) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var buckets []Bucket
+	if err := json.Unmarshal(data, &buckets); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, b := range buckets {
+		t.bucket(b.APIKey, b.Hour.UTC()).add(b.Requests, b.Notifications, b.Bytes)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package usage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hlnode-websocket/internal/clock"
+)
+
+var start = time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC)
+
+func TestRecordAndReport(t *testing.T) {
+	clk := clock.NewFake(start)
+	table := NewTable(clk, 24*time.Hour)
+
+	table.Record("key-b", 1, 0, 100)
+	table.Record("key-a", 2, 5, 300)
+	table.Record("key-b", 1, 1, 50)
+	clk.Advance(time.Hour)
+	table.Record("key-a", 1, 0, 10)
+
+	report := table.Report(start.Add(-time.Hour), start.Add(2*time.Hour))
+	if len(report) != 3 {
+		t.Fatalf("Expected 3 buckets, got %+v", report)
+	}
+	hour := start.Truncate(time.Hour)
+	if report[0].APIKey != "key-a" || !report[0].Hour.Equal(hour) || report[0].Requests != 2 || report[0].Notifications != 5 || report[0].Bytes != 300 {
+		t.Errorf("Unexpected first bucket: %+v", report[0])
+	}
+	if report[1].APIKey != "key-b" || report[1].Requests != 2 || report[1].Notifications != 1 || report[1].Bytes != 150 {
+		t.Errorf("Unexpected second bucket: %+v", report[1])
+	}
+	if report[2].APIKey != "key-a" || !report[2].Hour.Equal(hour.Add(time.Hour)) {
+		t.Errorf("Unexpected third bucket: %+v", report[2])
+	}
+
+	// from is inclusive and to exclusive
+	if report := table.Report(hour.Add(time.Hour), hour.Add(2*time.Hour)); len(report) != 1 {
+		t.Errorf("Expected only the second hour, got %+v", report)
+	}
+}
+
+func TestKeysPerHourCap(t *testing.T) {
+	table := NewTable(clock.NewFake(start), time.Hour)
+	for i := 0; i < MaxKeysPerHour+5; i++ {
+		table.Record(fmt.Sprintf("key-%d", i), 1, 0, 0)
+	}
+
+	report := table.Report(start.Add(-time.Hour), start.Add(time.Hour))
+	if len(report) != MaxKeysPerHour+1 {
+		t.Fatalf("Expected %d buckets, got %d", MaxKeysPerHour+1, len(report))
+	}
+	for _, b := range report {
+		if b.APIKey == OverflowKey && b.Requests != 5 {
+			t.Errorf("Expected 5 requests folded into the overflow key, got %d", b.Requests)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	clk := clock.NewFake(start)
+	table := NewTable(clk, 2*time.Hour)
+	table.Record("key", 1, 0, 0)
+	clk.Advance(3 * time.Hour)
+	table.Record("key", 1, 0, 0)
+	table.Prune()
+
+	if report := table.Report(time.Time{}, start.Add(24*time.Hour)); len(report) != 1 || !report[0].Hour.Equal(start.Add(3*time.Hour).Truncate(time.Hour)) {
+		t.Errorf("Expected only the recent bucket, got %+v", report)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+
+	table := NewTable(clock.NewFake(start), 24*time.Hour)
+	if err := table.Load(path); err != nil {
+		t.Fatalf("Load of a missing file failed: %v", err)
+	}
+	table.Record("key", 3, 2, 1)
+	if err := table.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	restored := NewTable(clock.NewFake(start), 24*time.Hour)
+	if err := restored.Load(path); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	restored.Record("key", 1, 0, 0)
+
+	report := restored.Report(time.Time{}, start.Add(time.Hour))
+	if len(report) != 1 || report[0].Requests != 4 || report[0].Notifications != 2 || report[0].Bytes != 1 {
+		t.Errorf("Expected restored usage to be added to, got %+v", report)
+	}
+}